@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"go_ingestion/ingest"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// backfill --query q --from 2018-01 --to 2020-12 [--sources ...] [--limit n] [--max-papers n] [--max-pages n] [--max-duration d] [--sink kind] [--out path]
+// walks each month from oldest to newest, paging every window from offset 0
+func (a *app) backfillCommand() *cobra.Command {
+	var o ingest.BackfillOptions
+	cmd := &cobra.Command{
+		Use:   "backfill --query q --from YYYY-MM",
+		Short: "Pages a topic month by month",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if strings.TrimSpace(o.Query) == "" || o.From == "" {
+				return fmt.Errorf("%w: backfill --query <query> --from YYYY-MM [--to YYYY-MM] [--sources ...]", ErrUsage)
+			}
+			return a.runner().Backfill(cmd.Context(), o)
+		},
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&o.Query, "query", "", "search query, also stored as the papers topic")
+	fs.StringVar(&o.From, "from", "", "first month to backfill, YYYY-MM")
+	fs.StringVar(&o.To, "to", time.Now().Format("2006-01"), "last month to backfill, YYYY-MM")
+	fs.StringVar(&o.Sources, "sources", "", "comma separated sources to backfill from, every source that has its key when empty")
+	fs.Uint64Var(&o.Limit, "limit", a.cfg.PageSizing.Initial, "papers per page")
+	fs.Uint64Var(&o.MaxPapers, "max-papers", 0, "stop all sources once this many papers were inserted, 0 is unlimited")
+	fs.Uint64Var(&o.MaxPages, "max-pages", 0, "stop all sources after fetching this many pages in total, 0 is unlimited")
+	fs.DurationVar(&o.MaxDuration, "max-duration", 0, "stop the run after this long, 0 is unlimited")
+	fs.StringVar(&o.Sink, "sink", a.cfg.Sink.Kind, "where papers are written: postgres, jsonl or stdout")
+	fs.StringVar(&o.Out, "out", a.cfg.Sink.Path, "file the jsonl sink appends to")
+	fs.StringVar(&o.Manifest, "manifest", "", "file listing the papers this run inserted, .csv or .jsonl, defaults to sink.manifest_dir")
+	fs.BoolVar(&o.SkipTotals, "skip-totals", false, "don't ask sources for window totals, page each window until an empty page")
+	return cmd
+}
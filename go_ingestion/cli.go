@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"go_ingestion/internal/secrets"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// app holds what every subcommand needs
+type app struct {
+	dbPool  *pgxpool.Pool
+	cfg     config.Config
+	project db.Project
+}
+
+// offline annotates commands that run without a database connection or project
+const offline = "offline"
+
+// newRootCommand builds the commands of the binary. Flags default to a.cfg so it has to be
+// loaded first, the database and project are set up before a command that needs them runs.
+func (a *app) newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:   filepath.Base(os.Args[0]),
+		Short: "Ingests research papers from their sources into postgres and serves them",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				return fmt.Errorf("%w: unknown command %q, see help", ErrUsage, args[0])
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Fprint(os.Stderr, cmd.UsageString())
+			return fmt.Errorf("%w: no command given", ErrUsage)
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if cmd.Annotations[offline] != "" {
+				return nil
+			}
+			return a.connect(cmd.Context())
+		},
+		Annotations:       map[string]string{offline: "true"},
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		CompletionOptions: cobra.CompletionOptions{DisableDefaultCmd: true},
+	}
+	// NOTE: subcommands inherit it, a bad flag exits with exitUsage like a bad argument
+	root.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return fmt.Errorf("%w: %s: %w", ErrUsage, cmd.CommandPath(), err)
+	})
+
+	root.AddCommand(
+		a.ingestCommand(),
+		a.backfillCommand(),
+		a.refreshCommand(),
+		a.statsCommand(),
+		a.exportCommand(),
+		a.runsCommand(),
+		a.eventsCommand(),
+		a.statusCommand(),
+		a.planCommand(),
+		a.qualityReportCommand(),
+		a.suggestTopicsCommand(),
+		a.subjectsCommand(),
+		a.pruneCommand(),
+		a.gcCommand(),
+		a.deleteTopicCommand(),
+		a.rebuildCommand(),
+		a.snapshotCommand(),
+		a.dedupeCommand(),
+		a.reviewCommand(),
+		a.resolvePDFsCommand(),
+		a.crossrefCommand(),
+		a.archiveCommand(),
+		a.reenrichCommand(),
+		a.quarantineCommand(),
+		a.identifiersCommand(),
+		a.credentialsCommand(),
+		a.keyphrasesCommand(),
+		a.similarCommand(),
+		a.compareCommand(),
+		a.trendCommand(),
+		a.embeddingsCommand(),
+		a.serveCommand(),
+		a.daemonCommand(),
+		a.orchestrateCommand(),
+		a.schemaCommand(),
+	)
+	root.InitDefaultHelpCmd()
+	for _, cmd := range root.Commands() {
+		if cmd.Name() == "help" {
+			offlineCommand(cmd)
+		}
+	}
+	return root
+}
+
+// connect loads the secrets, connects to the database and gets or creates the project
+// named PROJECT_NAME. The caller closes a.dbPool once it is set, connect failing or not.
+func (a *app) connect(ctx context.Context) error {
+	secretsProvider, err := secrets.Load(ctx, a.cfg.Secrets)
+	if err != nil {
+		return err
+	}
+	if secretsProvider != nil && a.cfg.Secrets.Refresh > 0 {
+		go secrets.Refresh(ctx, secretsProvider, a.cfg.Secrets.Refresh)
+	}
+
+	if a.dbPool, err = db.ConnectToDb(a.cfg.Database); err != nil {
+		return err
+	}
+	if a.project, err = db.GetOrCreateProject(ctx, a.dbPool, os.Getenv("PROJECT_NAME")); err != nil {
+		return err
+	}
+	log.Printf("[PROJECT] using project=%q id=%d", a.project.Name, a.project.ID)
+	return nil
+}
+
+// offlineCommand marks cmd to run without the database
+func offlineCommand(cmd *cobra.Command) *cobra.Command {
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+	cmd.Annotations[offline] = "true"
+	return cmd
+}
+
+// group makes cmd a command that only runs its subcommands, without one or with an
+// unknown one it fails with ErrUsage. It doesn't need the database itself.
+func group(cmd *cobra.Command, subs ...*cobra.Command) *cobra.Command {
+	cmd.AddCommand(subs...)
+	names := make([]string, 0, len(subs))
+	for _, sub := range subs {
+		names = append(names, sub.Name())
+	}
+	cmd.Args = func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			return fmt.Errorf("%w: unknown %s command %q, use %s", ErrUsage, cmd.Name(), args[0], strings.Join(names, "|"))
+		}
+		return nil
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return fmt.Errorf("%w: %s %s", ErrUsage, cmd.CommandPath(), strings.Join(names, "|"))
+	}
+	return offlineCommand(cmd)
+}
+
+// usageArgs wraps the error of check, e.g. cobra.ExactArgs, in ErrUsage
+func usageArgs(check cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := check(cmd, args); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrUsage, cmd.UseLine(), err)
+		}
+		return nil
+	}
+}
+
+// countFlag adds the -n flag of the commands that list the first n rows
+func countFlag(fs *pflag.FlagSet, n int, usage string) *int {
+	return fs.IntP("n", "n", n, usage)
+}
+
+// writeJSON prints v as one json object on stdout, for --output json.
+func writeJSON(v any) error {
+	return json.NewEncoder(os.Stdout).Encode(v)
+}
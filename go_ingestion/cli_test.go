@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"go_ingestion/config"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// NOTE: every case fails before the command connects, they run without a database
+func TestCommandUsage(t *testing.T) {
+	cfg, err := config.Load(filepath.Join(t.TempDir(), "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"unknown command", []string{"bogus"}},
+		{"no subcommand", []string{"snapshot"}},
+		{"unknown subcommand", []string{"dedupe", "bogus"}},
+		{"unknown flag", []string{"ingest", "--bogus"}},
+		{"bad flag value", []string{"runs", "list", "-n", "ten"}},
+		{"missing argument", []string{"runs", "diff", "1"}},
+		{"extra argument", []string{"status", "bogus"}},
+		{"offline command argument", []string{"export", "verify"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &app{cfg: cfg}
+			root := a.newRootCommand()
+			root.SetArgs(tt.args)
+			root.SetOut(io.Discard)
+			root.SetErr(io.Discard)
+
+			err := root.ExecuteContext(context.Background())
+			if got := exitCode(err); got != exitUsage {
+				t.Errorf("%v: exit %d (%v), want %d", tt.args, got, err, exitUsage)
+			}
+			if a.dbPool != nil {
+				a.dbPool.Close()
+				t.Errorf("%v connected to the database", tt.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,754 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"go_ingestion/internal/license"
+	"io/fs"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const DefaultPath = "config/config.yaml"
+
+type Config struct {
+	// PDFDir is where downloaded PDFs are stored as <paper id>.pdf
+	PDFDir     string     `yaml:"pdf_dir"`
+	PDFMirrors PDFMirrors `yaml:"pdf_mirrors"`
+	Database   Database   `yaml:"database"`
+	Timeouts   Timeouts   `yaml:"timeouts"`
+	Retention  Retention  `yaml:"retention"`
+	GC         GC         `yaml:"gc"`
+	Dedupe     Dedupe     `yaml:"dedupe"`
+	Review     Review     `yaml:"review"`
+	License    License    `yaml:"license"`
+	Filters    Filters    `yaml:"filters"`
+	Validation Validation `yaml:"validation"`
+	RateLimits RateLimits `yaml:"rate_limits"`
+	Daemon     Daemon     `yaml:"daemon"`
+	Health     Health     `yaml:"health"`
+	Retries    Retries    `yaml:"retries"`
+	PageSizing PageSizing `yaml:"page_sizing"`
+	Cache      Cache      `yaml:"cache"`
+	Archive    Archive    `yaml:"archive"`
+	Totals     Totals     `yaml:"totals"`
+	Sink       Sink       `yaml:"sink"`
+	Resolver   Resolver   `yaml:"resolver"`
+	Crossref   Crossref   `yaml:"crossref"`
+	Reenrich   Reenrich   `yaml:"reenrich"`
+	Keyphrases Keyphrases `yaml:"keyphrases"`
+	Resume     Resume     `yaml:"resume"`
+	Runs       Runs       `yaml:"runs"`
+	Quarantine Quarantine `yaml:"quarantine"`
+	API        API        `yaml:"api"`
+	Secrets    Secrets    `yaml:"secrets"`
+	Springer   Springer   `yaml:"springer"`
+	// Orchestrator runs the processing stages next to the daemon, see the orchestrate command
+	Orchestrator Orchestrator `yaml:"orchestrator"`
+	// Topics are ingested on their own schedule by the daemon
+	Topics []Topic `yaml:"topics"`
+	// Mappings override mapped paper fields with Go templates, keyed by source then
+	// field (title, pdf_url, doi, abstract, venue, license, published, topics, language)
+	Mappings map[string]map[string]string `yaml:"mappings"`
+}
+
+// PDFMirrors chooses between the PDF URLs a paper has, all of them land in pdf_candidates.
+type PDFMirrors struct {
+	// PreferHosts are hosts (arxiv.org) or kinds (arxiv, publisher, repository), earlier wins,
+	// unmatched candidates keep the source's order
+	PreferHosts []string `yaml:"prefer_hosts"`
+	// Prevalidate requests the PDF links of new papers before they are stored, dead links
+	// and landing pages are dropped and papers without a working link go to the pdf backlog
+	Prevalidate bool `yaml:"prevalidate"`
+	// PrevalidateWorkers links of a page are requested at a time
+	PrevalidateWorkers int           `yaml:"prevalidate_workers"`
+	PrevalidateTimeout time.Duration `yaml:"prevalidate_timeout"`
+}
+
+// Database sizes the connection pool, DATABASE_URL says where to connect.
+type Database struct {
+	// MaxConns of 0 keeps the pgx default, the larger of 4 and the number of CPUs
+	MaxConns        int32         `yaml:"max_conns"`
+	MinConns        int32         `yaml:"min_conns"`
+	MaxConnLifetime time.Duration `yaml:"max_conn_lifetime"`
+	MaxConnIdleTime time.Duration `yaml:"max_conn_idle_time"`
+	// ConnectTimeout bounds establishing a connection, 0 waits as long as the context allows
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+}
+
+// Timeouts bound the requests to the paper sources.
+type Timeouts struct {
+	// Page bounds fetching one page, 0 is unbounded
+	Page time.Duration `yaml:"page"`
+	// Totals bounds asking a source for its total before paging it
+	Totals time.Duration `yaml:"totals"`
+}
+
+type Retention struct {
+	// RawPayloadDays drops the raw upstream metadata of embedded papers older than N days, 0 keeps it forever
+	RawPayloadDays uint `yaml:"raw_payload_days"`
+	// DropDeletedTopics removes papers belonging to topics marked as deleted
+	DropDeletedTopics bool `yaml:"drop_deleted_topics"`
+	// VacuumOrphans removes chunks/embeddings/PDFs whose paper no longer exists
+	VacuumOrphans bool `yaml:"vacuum_orphans"`
+}
+
+type GC struct {
+	// MinAge spares PDFs modified more recently, a download may land before its paper row commits
+	MinAge time.Duration `yaml:"min_age"`
+}
+
+type Dedupe struct {
+	Enabled bool `yaml:"enabled"`
+	// TrigramThreshold is the pg_trgm similarity a title needs to be scored at all
+	TrigramThreshold float64 `yaml:"trigram_threshold"`
+	// MatchThreshold and above (Jaro-Winkler) is skipped as a duplicate
+	MatchThreshold float64 `yaml:"match_threshold"`
+	// ReviewThreshold and above is inserted but queued for a human to review
+	ReviewThreshold float64 `yaml:"review_threshold"`
+	// Precedence ranks sources per field (title, pdf_url, doi, license, authors, tldr) when a
+	// duplicate is merged, a better ranked source overwrites the stored value. Fields that
+	// aren't listed keep the first value stored.
+	Precedence map[string][]string `yaml:"precedence"`
+}
+
+// Review holds papers without a DOI and with weak metadata back from research_papers until a
+// curator approves them, see the review command.
+type Review struct {
+	WeakPapers bool `yaml:"weak_papers"`
+	// MinAuthors is the fewest authors a paper without a DOI needs, papers without an
+	// abstract are weak too
+	MinAuthors int `yaml:"min_authors"`
+}
+
+type License struct {
+	// OnlyRedistributable skips papers whose normalized license isn't in Allowed (unknown counts as not allowed)
+	OnlyRedistributable bool     `yaml:"only_redistributable"`
+	Allowed             []string `yaml:"allowed"`
+}
+
+// Filters are applied to every source before insert, a rule is skipped when the
+// source doesn't report the field.
+type Filters struct {
+	MinYear int `yaml:"min_year"`
+	// RequiredFieldsOfStudy keeps papers matching at least one of them
+	RequiredFieldsOfStudy   []string `yaml:"required_fields_of_study"`
+	ExcludePublicationTypes []string `yaml:"exclude_publication_types"`
+	// IncludeContentTypes keeps only springer records of these content types (Chapter,
+	// Article, Book, ReferenceWorkEntry), ExcludeContentTypes drops them
+	IncludeContentTypes []string `yaml:"include_content_types"`
+	ExcludeContentTypes []string `yaml:"exclude_content_types"`
+	MinCitations        int      `yaml:"min_citations"`
+	Languages           []string `yaml:"languages"`
+	// Categories keeps papers in at least one of them, an archive like cs matches all its categories
+	Categories []string `yaml:"categories"`
+}
+
+// Validation rejects records an upstream API returned broken, per source with a default
+// like Retries. Zero values turn a rule off.
+type Validation struct {
+	Default ValidationRules `yaml:"default"`
+	// Sources replace Default entirely for a source
+	Sources map[string]ValidationRules `yaml:"sources"`
+}
+
+// For returns the rules of source, falling back to Default.
+func (v Validation) For(source string) ValidationRules {
+	if r, ok := v.Sources[source]; ok {
+		return r
+	}
+	return v.Default
+}
+
+type ValidationRules struct {
+	MinTitleLength int `yaml:"min_title_length"`
+	MaxTitleLength int `yaml:"max_title_length"`
+	// MinYear is the earliest plausible publication year, later than next year never is
+	MinYear int `yaml:"min_year"`
+	// URLSchemes are the schemes a pdf_url may have
+	URLSchemes []string `yaml:"url_schemes"`
+	MaxAuthors int      `yaml:"max_authors"`
+}
+
+type RateLimits struct {
+	// Shared keeps limiter state in Postgres so all instances respect the limits together
+	Shared bool `yaml:"shared"`
+	// Sources is keyed by paper source (arxiv, semanticscholar, springernature) or
+	// lookup service (unpaywall, doi.org, crossref)
+	Sources map[string]SourceLimit `yaml:"sources"`
+}
+
+// SourceLimit is a token bucket refilled one request per Interval, holding Burst requests
+// that may go out back to back after a quiet spell.
+type SourceLimit struct {
+	Interval time.Duration `yaml:"interval"`
+	// Burst of 0 or 1 spaces every request Interval apart
+	Burst int `yaml:"burst"`
+	// DailyQuota of 0 is unlimited, only enforced when Shared
+	DailyQuota int `yaml:"daily_quota"`
+}
+
+type Daemon struct {
+	// PollInterval is how often workers look for jobs and the scheduler checks what is due
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// LeaderRetry is how often a standby replica tries to become the scheduler leader
+	LeaderRetry time.Duration `yaml:"leader_retry"`
+	// JobLease is how long a worker that stopped renewing it keeps its job, after that the
+	// job is claimed again
+	JobLease time.Duration `yaml:"job_lease"`
+	// JobMaxAttempts is how often a job is claimed before one that keeps losing its worker fails
+	JobMaxAttempts int `yaml:"job_max_attempts"`
+	// RetentionEvery schedules the retention job, 0 disables it
+	RetentionEvery time.Duration `yaml:"retention_every"`
+	// HealthEvery schedules the source health probe, 0 disables it
+	HealthEvery time.Duration `yaml:"health_every"`
+	// ResolveEvery schedules a batch of the pdf backlog, 0 disables it
+	ResolveEvery time.Duration `yaml:"resolve_every"`
+	// GCEvery schedules the removal of orphaned PDFs, chunks and vectors, 0 disables it
+	GCEvery time.Duration `yaml:"gc_every"`
+	// CrossrefEvery schedules a batch of crossref enrichment, 0 disables it
+	CrossrefEvery time.Duration `yaml:"crossref_every"`
+	// ReenrichEvery schedules a batch of citation count and open access refreshes, 0 disables it
+	ReenrichEvery time.Duration `yaml:"reenrich_every"`
+	// KeyphrasesEvery schedules keyphrase extraction of a batch of chunks, 0 disables it
+	KeyphrasesEvery time.Duration `yaml:"keyphrases_every"`
+	// StuckRunsEvery schedules logging the runs that are stuck, see Runs, 0 disables it
+	StuckRunsEvery time.Duration `yaml:"stuck_runs_every"`
+}
+
+type Health struct {
+	// Timeout bounds a single probe request
+	Timeout time.Duration `yaml:"timeout"`
+	// RecheckInterval is how often a waiting worker re-probes its unhealthy source
+	RecheckInterval time.Duration `yaml:"recheck_interval"`
+}
+
+type Retries struct {
+	Default RetryPolicy `yaml:"default"`
+	// Sources replaces Default entirely for a paper source (arxiv, semanticscholar, springernature)
+	Sources map[string]RetryPolicy `yaml:"sources"`
+}
+
+// For returns the policy of source, falling back to Default.
+func (r Retries) For(source string) RetryPolicy {
+	if p, ok := r.Sources[source]; ok {
+		return p
+	}
+	return r.Default
+}
+
+type RetryPolicy struct {
+	// MaxRetries is the number of attempts per page before it is skipped
+	MaxRetries     int           `yaml:"max_retries"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	// Multiplier grows the backoff after every failed attempt, 1 keeps it constant
+	Multiplier float64 `yaml:"multiplier"`
+	// Jitter is the share of each backoff taken off at random, 0.2 waits 80-100% of it
+	Jitter float64 `yaml:"jitter"`
+	// RetryableStatuses are the HTTP statuses worth retrying, network failures and timeouts always are
+	RetryableStatuses []int `yaml:"retryable_statuses"`
+}
+
+// PageSizing adapts the papers per page of each source to its error rate and latency,
+// the limit flag is only the starting size when Adaptive.
+type PageSizing struct {
+	Adaptive bool `yaml:"adaptive"`
+	// Initial is the papers per page a run starts with when it isn't given --limit
+	Initial uint64 `yaml:"initial"`
+	Min     uint64 `yaml:"min"`
+	// Max is the largest page each source accepts, keyed by paper source, 0 is unbounded
+	Max map[string]uint64 `yaml:"max"`
+	// SlowAfter is the page latency above which the size stops growing
+	SlowAfter time.Duration `yaml:"slow_after"`
+}
+
+type Quarantine struct {
+	// After is how many times a record may fail to map before pages skip it, 0 turns it off
+	After int `yaml:"after"`
+}
+
+// Springer says what to do with records of a whole book or proceedings volume.
+type Springer struct {
+	// Volumes is keep (one paper for the volume), skip or expand (fetch its chapters)
+	Volumes string `yaml:"volumes"`
+	// MaxChapters caps the chapters fetched per expanded volume
+	MaxChapters int `yaml:"max_chapters"`
+}
+
+// API is served by the serve command.
+type API struct {
+	Addr string `yaml:"addr"`
+	// Public serves only the read endpoints, never the admin ones, with responses cached
+	// for CacheTTL, so the corpus can be shared outside the team
+	Public   bool          `yaml:"public"`
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+	// MaxLimit caps limit of the list and search endpoints
+	MaxLimit int `yaml:"max_limit"`
+	// QueryCacheTTL is how long search and similar results are reused for the same
+	// normalized query and filters, kept in the cache backend (memory unless redis)
+	QueryCacheTTL time.Duration `yaml:"query_cache_ttl"`
+}
+
+// Secrets are read from a secrets manager into the environment at startup, so DATABASE_URL
+// and the source API keys don't have to be in .env.
+type Secrets struct {
+	// Provider is vault, aws, file or empty to only use the environment
+	Provider string `yaml:"provider"`
+	// Refresh is how often the secret is read again, 0 reads it once
+	Refresh time.Duration `yaml:"refresh"`
+	Vault   Vault         `yaml:"vault"`
+	AWS     AWSSecrets    `yaml:"aws"`
+	File    FileSecrets   `yaml:"file"`
+}
+
+// Vault reads a KV v2 secret with VAULT_TOKEN, or logs in with the AppRole VAULT_ROLE_ID
+// and VAULT_SECRET_ID.
+type Vault struct {
+	// Addr defaults to VAULT_ADDR
+	Addr      string `yaml:"addr"`
+	Namespace string `yaml:"namespace"`
+	Mount     string `yaml:"mount"`
+	Path      string `yaml:"path"`
+	// AppRoleMount is where the approle auth method is enabled
+	AppRoleMount string `yaml:"approle_mount"`
+}
+
+// AWSSecrets reads a Secrets Manager secret holding a JSON object, signed with
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type AWSSecrets struct {
+	// Region defaults to AWS_REGION
+	Region   string `yaml:"region"`
+	SecretID string `yaml:"secret_id"`
+}
+
+// FileSecrets reads a mounted directory with one file per variable, named after it, such
+// as a kubernetes secret volume. Kubernetes updates the files when the secret changes.
+type FileSecrets struct {
+	Dir string `yaml:"dir"`
+}
+
+type Orchestrator struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// BatchSize is how many papers of a stage's backlog are fetched at once
+	BatchSize int `yaml:"batch_size"`
+	// ShutdownGrace is how long papers in flight may finish after a shutdown signal
+	ShutdownGrace time.Duration `yaml:"shutdown_grace"`
+	Download      Stage         `yaml:"download"`
+	Extract       Stage         `yaml:"extract"`
+	Chunk         Stage         `yaml:"chunk"`
+	Embed         Stage         `yaml:"embed"`
+	// Routes pick the splitter and embedding model the chunk and embed commands use per
+	// paper language
+	Routes Routes `yaml:"routes"`
+	// PDF classifies downloaded PDFs, see pdfcheck.Classify
+	PDF PDFCheck `yaml:"pdf"`
+}
+
+// PDFCheck sets where a PDF stops looking like a full paper.
+type PDFCheck struct {
+	// AbstractPages or fewer pages, or less than MinTextLength extracted characters, is
+	// an abstract-only PDF
+	AbstractPages int `yaml:"abstract_pages"`
+	MinTextLength int `yaml:"min_text_length"`
+	// VolumePages or more pages is a proceedings volume or book rather than one paper,
+	// 0 never calls a PDF a volume
+	VolumePages int `yaml:"volume_pages"`
+	// Skip lists the kinds extract, chunk and embed pass over
+	Skip []string `yaml:"skip"`
+}
+
+// Routes are keyed by ISO 639-1 language, Default covers the other languages and papers
+// whose language isn't known.
+type Routes struct {
+	Default   Route            `yaml:"default"`
+	Languages map[string]Route `yaml:"languages"`
+}
+
+type Route struct {
+	Splitter string `yaml:"splitter"`
+	Model    string `yaml:"model"`
+}
+
+// For returns the route of lang, fields it leaves empty fall back to Default.
+func (r Routes) For(lang string) Route {
+	route, ok := r.Languages[lang]
+	if !ok {
+		return r.Default
+	}
+	if route.Splitter == "" {
+		route.Splitter = r.Default.Splitter
+	}
+	if route.Model == "" {
+		route.Model = r.Default.Model
+	}
+	return route
+}
+
+type Stage struct {
+	// Workers of 0 turns the stage off
+	Workers int `yaml:"workers"`
+	// Command runs once per paper with its id appended, empty leaves the stage to another
+	// process. Download is built in and ignores it.
+	Command []string `yaml:"command"`
+	// StoreChunks (chunk only) stores the chunks the command prints as json lines, reusing
+	// unchanged ones, instead of leaving storage to the command
+	StoreChunks bool `yaml:"store_chunks"`
+}
+
+type Cache struct {
+	// Backend is memory (per process), redis (shared by all instances) or empty to disable
+	Backend  string `yaml:"backend"`
+	RedisURL string `yaml:"redis_url"`
+	// TotalsTTL and PagesTTL are how long source totals and fetched pages are reused
+	TotalsTTL time.Duration `yaml:"totals_ttl"`
+	PagesTTL  time.Duration `yaml:"pages_ttl"`
+}
+
+// Archive keeps every page fetched upstream, compressed and filed under
+// pages/<source>/<day>/<query>/<offset>, so the archive replay command can map old pages again.
+type Archive struct {
+	// Backend is dir, s3 or empty to archive nothing
+	Backend string `yaml:"backend"`
+	// Dir is where the dir backend files pages, a mounted bucket works too
+	Dir string    `yaml:"dir"`
+	S3  ArchiveS3 `yaml:"s3"`
+}
+
+// ArchiveS3 writes to a bucket of any S3 compatible store, signed with AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type ArchiveS3 struct {
+	// Endpoint defaults to AWS, set it for minio, r2 and other stores
+	Endpoint string `yaml:"endpoint"`
+	// Region defaults to AWS_REGION
+	Region string `yaml:"region"`
+	Bucket string `yaml:"bucket"`
+	// Prefix is put before every key, e.g. researchq/
+	Prefix string `yaml:"prefix"`
+}
+
+type Totals struct {
+	// Skip lists sources never asked for their total, they're paged until an empty page.
+	// Totals of the others are fetched once per query and day.
+	Skip []string `yaml:"skip"`
+}
+
+type Sink struct {
+	// Kind is postgres, jsonl or stdout (NDJSON), only postgres dedupes against stored papers
+	Kind string `yaml:"kind"`
+	// Path is the file jsonl appends to
+	Path string `yaml:"path"`
+	// OpenSearch also indexes every written paper when URL is set
+	OpenSearch OpenSearch `yaml:"opensearch"`
+	// ManifestDir gets a run-<id>.<ManifestFormat> per run listing the papers it inserted,
+	// empty writes none unless a run is given --manifest
+	ManifestDir    string `yaml:"manifest_dir"`
+	ManifestFormat string `yaml:"manifest_format"`
+}
+
+type OpenSearch struct {
+	URL      string `yaml:"url"`
+	Index    string `yaml:"index"`
+	Username string `yaml:"username"`
+	// BatchSize papers are sent per bulk request
+	BatchSize int `yaml:"batch_size"`
+}
+
+// Resolver looks up open access PDFs for papers skipped with a DOI but no PDF.
+type Resolver struct {
+	// UnpaywallEmail identifies us to Unpaywall as they require, empty skips Unpaywall
+	UnpaywallEmail string `yaml:"unpaywall_email"`
+	// Inline asks Unpaywall for papers with a DOI but no PDF while they are saved, only
+	// those it has no copy of go to the backlog
+	Inline bool `yaml:"inline"`
+	// BatchSize backlog entries are looked up per job
+	BatchSize    int           `yaml:"batch_size"`
+	MaxAttempts  int           `yaml:"max_attempts"`
+	RecheckAfter time.Duration `yaml:"recheck_after"`
+	// EmbargoWindow is how long papers that aren't open access yet wait before their first lookup
+	EmbargoWindow time.Duration `yaml:"embargo_window"`
+}
+
+// Crossref is searched for papers, and enriches papers with a DOI with their funders and
+// author affiliations.
+type Crossref struct {
+	// Mailto identifies us so requests go to the polite pools of Crossref and OpenAlex, and
+	// to NCBI for PubMed
+	Mailto string `yaml:"mailto"`
+	// BatchSize papers are looked up per job
+	BatchSize int `yaml:"batch_size"`
+}
+
+// Reenrich keeps the citation counts and open access status of all papers fresh by
+// looking them up at Semantic Scholar again, a batch per job.
+type Reenrich struct {
+	// BatchSize papers are looked up per job
+	BatchSize int `yaml:"batch_size"`
+	// DailyBudget caps the papers looked up per day across instances, 0 is unlimited
+	DailyBudget int `yaml:"daily_budget"`
+	// MaxAge is how long a paper stays fresh before it is looked up again
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+type Keyphrases struct {
+	// BatchSize chunks are extracted per job
+	BatchSize int `yaml:"batch_size"`
+	// PerChunk is how many of the best scored phrases of a chunk are kept
+	PerChunk int `yaml:"per_chunk"`
+}
+
+type Resume struct {
+	// AbandonAfter is how long a page may stay in flight before another run re-drives it,
+	// pages of runs that finished are re-driven right away
+	AbandonAfter time.Duration `yaml:"abandon_after"`
+}
+
+type Runs struct {
+	// StuckAfter is how long a worker of an unfinished run may go without getting past a
+	// page before status and the daemon report it as stuck
+	StuckAfter time.Duration `yaml:"stuck_after"`
+}
+
+// Topic is a query the daemon keeps fresh, hot topics get a shorter schedule and a
+// higher priority than archival ones.
+type Topic struct {
+	Query string `yaml:"query"`
+	// Schedule is hourly, daily, weekly or a duration such as 6h
+	Schedule string `yaml:"schedule"`
+	// Sources is a subset of arxiv, semanticscholar, springernature, crossref, openalex,
+	// pubmed, ieee, core, dblp, acl, empty is all of them
+	Sources []string `yaml:"sources"`
+	// Priority orders queued jobs, higher runs first when workers are busy
+	Priority  int    `yaml:"priority"`
+	Limit     uint64 `yaml:"limit"`
+	MaxPapers uint64 `yaml:"max_papers"`
+}
+
+// Every returns how often the topic is ingested.
+func (t Topic) Every() (time.Duration, error) {
+	switch t.Schedule {
+	case "hourly":
+		return time.Hour, nil
+	case "daily", "":
+		return 24 * time.Hour, nil
+	case "weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+
+	every, err := time.ParseDuration(t.Schedule)
+	if err != nil || every <= 0 {
+		return 0, fmt.Errorf("invalid schedule %q of topic %q, expected hourly, daily, weekly or a duration", t.Schedule, t.Query)
+	}
+	return every, nil
+}
+
+func defaults() Config {
+	return Config{
+		PDFDir: "data/pdfs",
+		PDFMirrors: PDFMirrors{
+			PrevalidateWorkers: 4,
+			PrevalidateTimeout: 10 * time.Second,
+		},
+		Database: Database{
+			MaxConnLifetime: time.Hour,
+			MaxConnIdleTime: 30 * time.Minute,
+			ConnectTimeout:  10 * time.Second,
+		},
+		Timeouts: Timeouts{
+			Page:   2 * time.Minute,
+			Totals: 30 * time.Second,
+		},
+		Retention: Retention{
+			RawPayloadDays:    0,
+			DropDeletedTopics: true,
+			VacuumOrphans:     true,
+		},
+		GC: GC{
+			MinAge: time.Hour,
+		},
+		Dedupe: Dedupe{
+			Enabled:          true,
+			TrigramThreshold: 0.5,
+			MatchThreshold:   0.97,
+			ReviewThreshold:  0.9,
+		},
+		Review: Review{MinAuthors: 2},
+		License: License{
+			OnlyRedistributable: false,
+			Allowed:             license.DefaultRedistributable,
+		},
+		Validation: Validation{
+			Default: ValidationRules{
+				MinTitleLength: 3,
+				MaxTitleLength: 1000,
+				MinYear:        1600,
+				URLSchemes:     []string{"http", "https"},
+				MaxAuthors:     5000,
+			},
+		},
+		RateLimits: RateLimits{
+			Shared: false,
+			Sources: map[string]SourceLimit{
+				"arxiv":           {Interval: 3 * time.Second},
+				"semanticscholar": {Interval: time.Second},
+				"springernature":  {Interval: time.Second},
+				"unpaywall":       {Interval: 100 * time.Millisecond},
+				"doi.org":         {Interval: 200 * time.Millisecond},
+				"crossref":        {Interval: 100 * time.Millisecond},
+				"openalex":        {Interval: 100 * time.Millisecond},
+				"pubmed":          {Interval: 350 * time.Millisecond},
+				"ieee":            {Interval: 200 * time.Millisecond, DailyQuota: 200},
+				"core":            {Interval: 6 * time.Second},
+				"dblp":            {Interval: 2 * time.Second},
+				"acl":             {},
+			},
+		},
+		Daemon: Daemon{
+			PollInterval:    10 * time.Second,
+			LeaderRetry:     30 * time.Second,
+			JobLease:        5 * time.Minute,
+			JobMaxAttempts:  3,
+			RetentionEvery:  24 * time.Hour,
+			HealthEvery:     5 * time.Minute,
+			ResolveEvery:    time.Hour,
+			GCEvery:         6 * time.Hour,
+			CrossrefEvery:   time.Hour,
+			ReenrichEvery:   30 * time.Minute,
+			KeyphrasesEvery: time.Hour,
+			StuckRunsEvery:  10 * time.Minute,
+		},
+		Health: Health{
+			Timeout:         10 * time.Second,
+			RecheckInterval: time.Minute,
+		},
+		Quarantine: Quarantine{After: 3},
+		API: API{
+			Addr:          ":8080",
+			CacheTTL:      10 * time.Minute,
+			MaxLimit:      500,
+			QueryCacheTTL: 30 * time.Second,
+		},
+		Springer: Springer{Volumes: "skip", MaxChapters: 500},
+		Orchestrator: Orchestrator{
+			PollInterval:  30 * time.Second,
+			BatchSize:     50,
+			ShutdownGrace: 30 * time.Second,
+			Download:      Stage{Workers: 4},
+			Extract:       Stage{Workers: 2},
+			Chunk:         Stage{Workers: 2},
+			Embed:         Stage{Workers: 1},
+			PDF:           PDFCheck{AbstractPages: 2, MinTextLength: 6000, VolumePages: 150},
+		},
+		PageSizing: PageSizing{
+			Adaptive:  true,
+			Initial:   25,
+			Min:       5,
+			Max:       map[string]uint64{"arxiv": 500, "semanticscholar": 100, "springernature": 100, "crossref": 1000, "openalex": 200, "pubmed": 200, "ieee": 200, "core": 100, "dblp": 1000, "acl": 1000},
+			SlowAfter: 10 * time.Second,
+		},
+		Retries: Retries{
+			Default: RetryPolicy{
+				MaxRetries:        3,
+				InitialBackoff:    45 * time.Second,
+				MaxBackoff:        10 * time.Minute,
+				Multiplier:        2,
+				Jitter:            0.2,
+				RetryableStatuses: []int{429, 500, 502, 503, 504},
+			},
+			Sources: map[string]RetryPolicy{
+				"springernature": {
+					MaxRetries:        3,
+					InitialBackoff:    45 * time.Second,
+					MaxBackoff:        45 * time.Second,
+					Multiplier:        1,
+					Jitter:            0.2,
+					RetryableStatuses: []int{429, 500, 502, 503, 504},
+				},
+			},
+		},
+		Cache: Cache{
+			Backend:   "memory",
+			TotalsTTL: 10 * time.Minute,
+			PagesTTL:  10 * time.Minute,
+		},
+		Archive: Archive{
+			Dir: "data/archive",
+		},
+		Resolver: Resolver{
+			Inline:        true,
+			BatchSize:     200,
+			MaxAttempts:   5,
+			RecheckAfter:  7 * 24 * time.Hour,
+			EmbargoWindow: 180 * 24 * time.Hour,
+		},
+		Crossref: Crossref{
+			BatchSize: 200,
+		},
+		Reenrich: Reenrich{
+			BatchSize:   500,
+			DailyBudget: 10000,
+			MaxAge:      30 * 24 * time.Hour,
+		},
+		Keyphrases: Keyphrases{
+			BatchSize: 1000,
+			PerChunk:  10,
+		},
+		Resume: Resume{
+			AbandonAfter: 15 * time.Minute,
+		},
+		Runs: Runs{
+			StuckAfter: 30 * time.Minute,
+		},
+		Secrets: Secrets{
+			Refresh: 15 * time.Minute,
+			Vault: Vault{
+				Mount:        "secret",
+				AppRoleMount: "approle",
+			},
+		},
+		Sink: Sink{
+			Kind:           "postgres",
+			Path:           "data/papers.jsonl",
+			ManifestFormat: "csv",
+			OpenSearch: OpenSearch{
+				Index:     "research_papers",
+				BatchSize: 100,
+			},
+		},
+	}
+}
+
+// Path returns CONFIG_PATH if set, otherwise the default config location.
+func Path() string {
+	if p := os.Getenv("CONFIG_PATH"); p != "" {
+		return p
+	}
+	return DefaultPath
+}
+
+// ErrConfig marks errors a run can't get past without changing its configuration, its
+// environment or its flags, running it again as it is fails the same way.
+var ErrConfig = errors.New("invalid configuration")
+
+// Load reads the yaml config at path on top of the defaults; a missing file is not an error.
+// The environment overrides both, see applyEnv.
+func Load(path string) (Config, error) {
+	cfg := defaults()
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return cfg, fmt.Errorf("%w: failed to read config %s: %w", ErrConfig, path, err)
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("%w: failed to parse config %s: %w", ErrConfig, path, err)
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/embedding"
+	"go_ingestion/internal/subject"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// subjects list [-n 20] | subjects papers <subject>
+func (a *app) subjectsCommand() *cobra.Command {
+	var n *int
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the subjects of the most papers",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			facets, err := db.SubjectFacets(cmd.Context(), a.dbPool, a.project.ID, *n)
+			if err != nil {
+				return err
+			}
+			for _, f := range facets {
+				fmt.Printf("%6d  %s\n", f.Papers, f.Label)
+			}
+			return nil
+		},
+	}
+	n = countFlag(list.Flags(), 20, "number of subjects to show")
+
+	papers := &cobra.Command{
+		Use:   "papers <subject>",
+		Short: "Lists the ids of the papers of a subject",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ids, err := db.PaperIDsBySubject(cmd.Context(), a.dbPool, a.project.ID, subject.Key(args[0]))
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				fmt.Println(id)
+			}
+			return nil
+		},
+	}
+
+	return group(&cobra.Command{Use: "subjects", Short: "Browses the papers by subject"}, list, papers)
+}
+
+// similar <paper id> [-k 10] [--source s] [--topic t] [--namespace ns] lists the papers
+// nearest to a paper by their embeddings, most similar first
+func (a *app) similarCommand() *cobra.Command {
+	var k int
+	var source string
+	var filter db.SimilarFilter
+	cmd := &cobra.Command{
+		Use:   "similar <paper id>",
+		Short: "Lists the papers nearest to a paper",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: invalid paper id %q: %w", ErrUsage, args[0], err)
+			}
+
+			filter.Source = db.PaperSource(source)
+			papers, err := db.SimilarPapers(cmd.Context(), a.dbPool, a.project.ID, id, k, filter)
+			if err != nil {
+				return err
+			}
+			for _, p := range papers {
+				fmt.Printf("%.3f  #%d [%s] %s\n", p.Similarity, p.ID, p.Source, p.Title)
+			}
+			return nil
+		},
+	}
+	fs := cmd.Flags()
+	fs.IntVarP(&k, "k", "k", 10, "number of papers to list")
+	fs.StringVar(&source, "source", "", "only papers of this source")
+	fs.StringVar(&filter.Topic, "topic", "", "only papers ingested under this topic")
+	fs.StringVar(&filter.Namespace, "namespace", db.DefaultNamespace, "compare the vectors of this embedding namespace")
+	return cmd
+}
+
+// compare <topic A> <topic B> [-n 10] prints how the corpora of two topics intersect: the
+// papers both have, their shared authors and venues, and how often each cites the other.
+// Citations come from the references crossref enrichment stored.
+func (a *app) compareCommand() *cobra.Command {
+	var n *int
+	cmd := &cobra.Command{
+		Use:   "compare <topic A> <topic B>",
+		Short: "Shows how two topics' corpora intersect",
+		Args:  usageArgs(cobra.ExactArgs(2)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := db.CompareTopics(cmd.Context(), a.dbPool, a.project.ID, args[0], args[1], *n)
+			if err != nil {
+				return err
+			}
+
+			for _, side := range []db.TopicCorpus{c.A, c.B} {
+				fmt.Printf("%q papers=%d authors=%d venues=%d with_references=%d\n", side.Topic, side.Papers, side.Authors, side.Venues, side.WithReferences)
+			}
+
+			fmt.Printf("\noverlap: %d papers\n", len(c.Overlap))
+			for _, pair := range c.Overlap[:min(*n, len(c.Overlap))] {
+				match := "title"
+				if pair.MatchedDOI {
+					match = "doi"
+				}
+				fmt.Printf("  #%d = #%d (%s) %s\n", pair.A, pair.B, match, pair.TitleA)
+			}
+
+			fmt.Printf("\nshared authors: %d\n", c.SharedAuthorsCount)
+			for _, s := range c.SharedAuthors {
+				fmt.Printf("  %-40s %d / %d\n", s.Name, s.PapersA, s.PapersB)
+			}
+			fmt.Printf("\nshared venues: %d\n", c.SharedVenuesCount)
+			for _, s := range c.SharedVenues {
+				fmt.Printf("  %-40s %d / %d\n", s.Name, s.PapersA, s.PapersB)
+			}
+
+			fmt.Printf("\ncitations: %q -> %q %d, %q -> %q %d\n", c.A.Topic, c.B.Topic, c.CitesAB, c.B.Topic, c.A.Topic, c.CitesBA)
+			if c.A.WithReferences == 0 && c.B.WithReferences == 0 {
+				log.Printf("[COMPARE] no references stored for either topic, run crossref enrich first")
+			}
+			return nil
+		},
+	}
+	n = countFlag(cmd.Flags(), 10, "number of overlapping papers, shared authors and venues to list")
+	return cmd
+}
+
+// trend <topic> [--by day|week|month|year] [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--refresh]
+// prints how many papers of a topic were published per period and how fast that grows.
+// The daily counts are refreshed after every run of the topic, --refresh recounts them
+// first for papers stored otherwise
+func (a *app) trendCommand() *cobra.Command {
+	var by, from, to string
+	var refresh bool
+	cmd := &cobra.Command{
+		Use:   "trend <topic>",
+		Short: "Counts a topic's papers per period of publication",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			start, end, err := db.ParseTrendRange(from, to, time.Now())
+			if err != nil {
+				return err
+			}
+			if refresh {
+				if err := db.RefreshTopicCounts(ctx, a.dbPool, a.project.ID, args[0]); err != nil {
+					return err
+				}
+			}
+
+			trend, err := db.TopicTrend(ctx, a.dbPool, a.project.ID, args[0], by, start, end)
+			if err != nil {
+				return err
+			}
+
+			for _, p := range trend.Points {
+				partial := ""
+				if p.Partial {
+					partial = " (partial)"
+				}
+				fmt.Printf("%s %6d%s\n", p.Bucket.Format(time.DateOnly), p.Papers, partial)
+			}
+			fmt.Printf("\ngrowth: %+.1f%% of an average %s per %s\n", trend.Growth*100, trend.By, trend.By)
+			return nil
+		},
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&by, "by", "month", "period to count by: day, week, month or year")
+	fs.StringVar(&from, "from", "", "first publication day, two years before --to by default")
+	fs.StringVar(&to, "to", "", "last publication day, today by default")
+	fs.BoolVar(&refresh, "refresh", false, "recount the topic's papers per day first")
+	return cmd
+}
+
+// embeddings export [--out dir] [--level chunk|paper] [--format npy|faiss] [--metric ip|l2] [--namespace ns]
+// writes the project's vectors with JSONL metadata for use outside pgvector
+// embeddings namespaces lists the embedding namespaces next to default
+// embeddings register <namespace> --model m --dims n has the embed stage also embed every
+// paper with model into namespace, so two models can be compared on the same corpus
+func (a *app) embeddingsCommand() *cobra.Command {
+	var out, level, format, metric, namespace string
+	export := &cobra.Command{
+		Use:   "export",
+		Short: "Writes the project's vectors",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if out == "" {
+				out = fmt.Sprintf("data/%s-embeddings", a.project.Name)
+			}
+			report, err := embedding.Export(cmd.Context(), a.dbPool, a.project.ID, out, embedding.ExportOptions{
+				Level:     embedding.Level(level),
+				Format:    embedding.Format(format),
+				Metric:    embedding.Metric(metric),
+				Namespace: namespace,
+			})
+			if err != nil {
+				return err
+			}
+			log.Printf("[EMBEDDINGS] wrote %d %s vectors of %d dimensions to %v", report.Rows, level, report.Dimensions, report.Files)
+			return nil
+		},
+	}
+	fs := export.Flags()
+	fs.StringVar(&out, "out", "", "directory to write to, data/<project>-embeddings by default")
+	fs.StringVar(&level, "level", string(embedding.LevelChunk), "one vector per chunk or per paper")
+	fs.StringVar(&format, "format", string(embedding.FormatNPY), "npy or faiss")
+	fs.StringVar(&metric, "metric", string(embedding.MetricIP), "distance of the faiss index, ip or l2")
+	fs.StringVar(&namespace, "namespace", db.DefaultNamespace, "embedding namespace to export")
+
+	namespaces := &cobra.Command{
+		Use:   "namespaces",
+		Short: "Lists the embedding namespaces",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespaces, err := db.EmbeddingNamespaces(cmd.Context(), a.dbPool)
+			if err != nil {
+				return err
+			}
+			for _, n := range namespaces {
+				fmt.Printf("%s model=%s dims=%d vectors=%d\n", n.Name, n.Model, n.Dims, n.Vectors)
+			}
+			return nil
+		},
+	}
+
+	var model string
+	var dims int
+	register := &cobra.Command{
+		Use:   "register <namespace> --model m --dims n",
+		Short: "Embeds with another model side by side",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if model == "" {
+				return fmt.Errorf("%w: embeddings register <namespace> --model m --dims n", ErrUsage)
+			}
+			if err := db.RegisterNamespace(cmd.Context(), a.dbPool, args[0], model, dims); err != nil {
+				return err
+			}
+			log.Printf("[EMBEDDINGS] registered namespace %s, the embed stage fills it with %s", args[0], model)
+			return nil
+		},
+	}
+	register.Flags().StringVar(&model, "model", "", "embedding model the namespace is filled with")
+	register.Flags().IntVar(&dims, "dims", 0, "dimensions of the model's vectors")
+
+	return group(&cobra.Command{Use: "embeddings", Short: "Exports the vectors and registers embedding namespaces"}, export, namespaces, register)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/credentials"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// credentials set <source> | credentials list | credentials delete <source>
+// set reads the api key from stdin so it stays out of the shell history, keys are encrypted
+// under CREDENTIALS_MASTER_KEY and win over the environment
+func (a *app) credentialsCommand() *cobra.Command {
+	set := &cobra.Command{
+		Use:   "set <source>",
+		Short: "Stores the api key of a source read from stdin",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := credentials.FromEnv(a.dbPool, a.project.ID)
+			if err != nil {
+				return err
+			}
+			key, err := io.ReadAll(io.LimitReader(os.Stdin, 64<<10))
+			if err != nil {
+				return fmt.Errorf("failed to read api key: %w", err)
+			}
+			if err := store.Set(cmd.Context(), db.PaperSource(args[0]), string(key)); err != nil {
+				return err
+			}
+			log.Printf("[CREDENTIALS] stored %s api key of project %s", args[0], a.project.Name)
+			return nil
+		},
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the sources with a stored api key",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := credentials.FromEnv(a.dbPool, a.project.ID)
+			if err != nil {
+				return err
+			}
+			stored, err := store.List(cmd.Context())
+			if err != nil {
+				return err
+			}
+			for _, c := range stored {
+				fmt.Printf("%-16s key=%s updated=%s\n", c.Source, c.KeyID, c.UpdatedAt.Format(time.RFC3339))
+			}
+			return nil
+		},
+	}
+
+	del := &cobra.Command{
+		Use:   "delete <source>",
+		Short: "Deletes the stored api key of a source",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := credentials.FromEnv(a.dbPool, a.project.ID)
+			if err != nil {
+				return err
+			}
+			deleted, err := store.Delete(cmd.Context(), db.PaperSource(args[0]))
+			if err != nil {
+				return err
+			}
+			if !deleted {
+				return fmt.Errorf("project %s has no %s api key stored", a.project.Name, args[0])
+			}
+			log.Printf("[CREDENTIALS] deleted %s api key of project %s", args[0], a.project.Name)
+			return nil
+		},
+	}
+
+	return group(&cobra.Command{Use: "credentials", Short: "Manages the stored api keys"}, set, list, del)
+}
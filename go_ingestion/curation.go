@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/ingest"
+	"go_ingestion/internal/paper"
+	"go_ingestion/internal/sink"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// dedupe review | dedupe resolve <review id> merge|distinct
+func (a *app) dedupeCommand() *cobra.Command {
+	review := &cobra.Command{
+		Use:   "review",
+		Short: "Lists the pending possible duplicates",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reviews, err := db.ListPendingDuplicateReviews(cmd.Context(), a.dbPool, a.project.ID)
+			if err != nil {
+				return err
+			}
+
+			for _, r := range reviews {
+				fmt.Printf("#%d score=%.3f\n  new      id=%d %q\n  existing id=%d %q\n", r.ID, r.Score, r.PaperID, r.PaperTitle, r.CandidateID, r.CandidateTitle)
+			}
+			log.Printf("[DEDUPE] %d pending reviews", len(reviews))
+			return nil
+		},
+	}
+
+	resolve := &cobra.Command{
+		Use:   "resolve <review id> merge|distinct",
+		Short: "Merges a possible duplicate or keeps it apart",
+		Args:  usageArgs(cobra.ExactArgs(2)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reviewID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: invalid review id %q: %w", ErrUsage, args[0], err)
+			}
+
+			status := db.ReviewDistinct
+			if args[1] == "merge" {
+				status = db.ReviewMerged
+			} else if args[1] != "distinct" {
+				return fmt.Errorf("%w: expected merge or distinct, got %q", ErrUsage, args[1])
+			}
+
+			return db.ResolveDuplicateReview(cmd.Context(), a.dbPool, a.project.ID, reviewID, status)
+		},
+	}
+
+	return group(&cobra.Command{Use: "dedupe", Short: "Reviews possible duplicates"}, review, resolve)
+}
+
+// review list [-n 50] | review approve <review id> | review reject <review id>
+// Approved papers are stored like freshly fetched ones, dedupe included.
+func (a *app) reviewCommand() *cobra.Command {
+	var n *int
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the papers held for weak metadata",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reviews, err := db.PendingPaperReviews(cmd.Context(), a.dbPool, a.project.ID, *n)
+			if err != nil {
+				return err
+			}
+			for _, r := range reviews {
+				fmt.Printf("#%d %s %s %q (%s)\n", r.ID, r.Source, r.SourceID, r.Title, strings.Join(r.Reasons, ", "))
+			}
+			log.Printf("[REVIEW] %d pending reviews shown", len(reviews))
+			return nil
+		},
+	}
+	n = countFlag(list.Flags(), 50, "number of reviews to show")
+
+	approve := &cobra.Command{
+		Use:   "approve <review id>",
+		Short: "Stores a held paper",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			reviewID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: invalid review id %q: %w", ErrUsage, args[0], err)
+			}
+
+			review, err := db.DecidePaperReview(ctx, a.dbPool, a.project.ID, reviewID, db.ReviewApproved)
+			if err != nil {
+				return err
+			}
+			store, err := a.runner().NewStore(sink.KindPostgres, "")
+			if err != nil {
+				return err
+			}
+			defer ingest.CloseSink(store)
+
+			if err := store.SaveApproved(ctx, review.Paper); err != nil {
+				// NOTE: the review stays pending so the approval can be retried
+				if err := db.ReopenPaperReview(ctx, a.dbPool, a.project.ID, reviewID); err != nil {
+					log.Printf("[REVIEW] %v", err)
+				}
+				return err
+			}
+			log.Printf("[REVIEW] approved %q", review.Title)
+			store.Stats.Print(os.Stdout)
+			return nil
+		},
+	}
+
+	reject := &cobra.Command{
+		Use:   "reject <review id>",
+		Short: "Drops a held paper",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reviewID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: invalid review id %q: %w", ErrUsage, args[0], err)
+			}
+			_, err = db.DecidePaperReview(cmd.Context(), a.dbPool, a.project.ID, reviewID, db.ReviewRejected)
+			return err
+		},
+	}
+
+	return group(&cobra.Command{Use: "review", Short: "Curates papers held for weak metadata"}, list, approve, reject)
+}
+
+// quarantine list [-n 20] [--payload] | quarantine release <source> <source id>
+func (a *app) quarantineCommand() *cobra.Command {
+	var n *int
+	var withPayload bool
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the records that failed to map",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			records, err := db.ListQuarantined(cmd.Context(), a.dbPool, a.project.ID, *n)
+			if err != nil {
+				return err
+			}
+			for _, r := range records {
+				state := "failing"
+				if r.QuarantinedAt != nil {
+					state = "quarantined"
+				}
+				fmt.Printf("%s %s %s failures=%d last=%s: %s\n", r.Source, r.SourceID, state, r.Failures, r.LastFailedAt.Format(time.DateTime), r.LastError)
+				if withPayload && r.Payload != nil {
+					fmt.Printf("  %s\n", r.Payload)
+				}
+			}
+			return nil
+		},
+	}
+	n = countFlag(list.Flags(), 20, "number of records to show")
+	list.Flags().BoolVar(&withPayload, "payload", false, "also print the raw record")
+
+	release := &cobra.Command{
+		Use:   "release <source> <source id>",
+		Short: "Maps a quarantined record again on the next page that has it",
+		Args:  usageArgs(cobra.ExactArgs(2)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			released, err := db.ReleaseQuarantined(cmd.Context(), a.dbPool, a.project.ID, db.PaperSource(args[0]), args[1])
+			if err != nil {
+				return err
+			}
+			if released {
+				log.Printf("[QUARANTINE] released %s %s, it is mapped again on the next page that has it", args[0], args[1])
+			}
+			return nil
+		},
+	}
+
+	return group(&cobra.Command{Use: "quarantine", Short: "Lists and releases records that keep failing to map"}, list, release)
+}
+
+// identifiers find <scheme> <value> | identifiers list <paper id>
+// schemes are arxiv, pmid, pmcid, mag, acl, dblp, corpusid, s2, openalex and core
+func (a *app) identifiersCommand() *cobra.Command {
+	find := &cobra.Command{
+		Use:   "find <scheme> <value>",
+		Short: "Prints the id of the paper with an identifier",
+		Args:  usageArgs(cobra.ExactArgs(2)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			scheme, ok := paper.Scheme(args[0])
+			if !ok {
+				return fmt.Errorf("%w: unknown identifier scheme %q", ErrUsage, args[0])
+			}
+			id, found, err := db.FindPaperByIdentifier(cmd.Context(), a.dbPool, a.project.ID, scheme, paper.NormalizeIdentifier(scheme, args[1]))
+			if err != nil {
+				return err
+			}
+			if !found {
+				return fmt.Errorf("no paper has %s %s", scheme, args[1])
+			}
+			fmt.Println(id)
+			return nil
+		},
+	}
+
+	list := &cobra.Command{
+		Use:   "list <paper id>",
+		Short: "Lists the identifiers of a paper",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: invalid paper id %q: %w", ErrUsage, args[0], err)
+			}
+			identifiers, err := db.PaperIdentifiers(cmd.Context(), a.dbPool, a.project.ID, id)
+			if err != nil {
+				return err
+			}
+			for _, identifier := range identifiers {
+				fmt.Printf("%-9s %s\n", identifier.Scheme, identifier.Value)
+			}
+			return nil
+		},
+	}
+
+	return group(&cobra.Command{Use: "identifiers", Short: "Finds papers by their identifiers at the sources"}, find, list)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"go_ingestion/ingest"
+	"go_ingestion/internal/daemon"
+	"go_ingestion/internal/maintenance"
+	"go_ingestion/internal/orchestrator"
+	"go_ingestion/internal/ratelimit"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"log"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+func (a *app) daemonCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "daemon",
+		Short: "Runs the scheduled ingestion and maintenance jobs",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runDaemon(cmd.Context())
+		},
+	}
+}
+
+// daemon runs jobs on every replica, only the elected leader schedules them
+func (a *app) runDaemon(ctx context.Context) error {
+	d := &daemon.Daemon{
+		DBPool:         a.dbPool,
+		ProjectID:      a.project.ID,
+		PollInterval:   a.cfg.Daemon.PollInterval,
+		LeaderRetry:    a.cfg.Daemon.LeaderRetry,
+		JobLease:       a.cfg.Daemon.JobLease,
+		JobMaxAttempts: a.cfg.Daemon.JobMaxAttempts,
+		Handlers: map[string]daemon.Handler{
+			"retention": func(ctx context.Context, job db.Job) error {
+				report, err := maintenance.RunRetention(ctx, a.dbPool, a.project.ID, a.cfg.Retention, a.cfg.PDFDir)
+				if err == nil {
+					log.Printf("[RETENTION] %s", report)
+				}
+				return err
+			},
+		},
+	}
+
+	if a.cfg.Daemon.HealthEvery > 0 {
+		apiKeys, err := a.runner().APIKeys(ctx, nil)
+		if err != nil {
+			return err
+		}
+		limiters := map[db.PaperSource]ratelimit.Limiter{}
+		for _, p := range researchpaperapis.Providers() {
+			// NOTE: sources that require a key can't be probed without one
+			info := p.Info()
+			if info.KeyRequired && apiKeys[info.Source] == "" {
+				continue
+			}
+			limiters[info.Source] = ratelimit.ForSource(a.dbPool, a.cfg.RateLimits, string(info.Source))
+		}
+		monitor := a.runner().HealthMonitor(limiters, apiKeys)
+
+		d.Handlers["source-health"] = func(ctx context.Context, job db.Job) error {
+			failed := monitor.Check(ctx)
+			log.Printf("[HEALTH] probed %d sources, %d unavailable", len(limiters), len(failed))
+			return nil
+		}
+		d.Schedule = append(d.Schedule, daemon.ScheduleEntry{Kind: "source-health", Payload: struct{}{}, Every: a.cfg.Daemon.HealthEvery})
+	}
+
+	if a.cfg.Daemon.ResolveEvery > 0 {
+		d.Handlers["resolve-pdfs"] = func(ctx context.Context, job db.Job) error {
+			return a.resolveBacklog(ctx, a.cfg.Resolver)
+		}
+		d.Schedule = append(d.Schedule, daemon.ScheduleEntry{Kind: "resolve-pdfs", Payload: struct{}{}, Every: a.cfg.Daemon.ResolveEvery})
+	}
+
+	if a.cfg.Daemon.CrossrefEvery > 0 {
+		d.Handlers["crossref"] = func(ctx context.Context, job db.Job) error {
+			return a.enrichCrossref(ctx, a.cfg.Crossref.BatchSize)
+		}
+		d.Schedule = append(d.Schedule, daemon.ScheduleEntry{Kind: "crossref", Payload: struct{}{}, Every: a.cfg.Daemon.CrossrefEvery})
+	}
+
+	if a.cfg.Daemon.ReenrichEvery > 0 {
+		d.Handlers["reenrich"] = func(ctx context.Context, job db.Job) error {
+			return a.reenrich(ctx, a.cfg.Reenrich.BatchSize)
+		}
+		d.Schedule = append(d.Schedule, daemon.ScheduleEntry{Kind: "reenrich", Payload: struct{}{}, Every: a.cfg.Daemon.ReenrichEvery})
+	}
+
+	if a.cfg.Daemon.KeyphrasesEvery > 0 {
+		d.Handlers["keyphrases"] = func(ctx context.Context, job db.Job) error {
+			return a.extractKeyphrases(ctx, a.cfg.Keyphrases.BatchSize)
+		}
+		d.Schedule = append(d.Schedule, daemon.ScheduleEntry{Kind: "keyphrases", Payload: struct{}{}, Every: a.cfg.Daemon.KeyphrasesEvery})
+	}
+
+	if a.cfg.Daemon.GCEvery > 0 {
+		d.Handlers["gc"] = func(ctx context.Context, job db.Job) error {
+			report, err := maintenance.CollectGarbage(ctx, a.dbPool, a.cfg.PDFDir, maintenance.GCOptions{MinAge: a.cfg.GC.MinAge})
+			log.Printf("[GC] %s", report)
+			return err
+		}
+		d.Schedule = append(d.Schedule, daemon.ScheduleEntry{Kind: "gc", Payload: struct{}{}, Every: a.cfg.Daemon.GCEvery})
+	}
+
+	if a.cfg.Daemon.StuckRunsEvery > 0 {
+		d.Handlers["stuck-runs"] = func(ctx context.Context, job db.Job) error {
+			stuck, err := db.StuckWorkers(ctx, a.dbPool, a.project.ID, a.cfg.Runs.StuckAfter)
+			for _, w := range stuck {
+				log.Printf("[RUN] stuck: %s", describeStuck(w))
+			}
+			return err
+		}
+		d.Schedule = append(d.Schedule, daemon.ScheduleEntry{Kind: "stuck-runs", Payload: struct{}{}, Every: a.cfg.Daemon.StuckRunsEvery})
+	}
+
+	if a.cfg.Daemon.RetentionEvery > 0 {
+		d.Schedule = append(d.Schedule, daemon.ScheduleEntry{Kind: "retention", Payload: struct{}{}, Every: a.cfg.Daemon.RetentionEvery})
+	}
+
+	topics, err := a.topics(ctx)
+	if err != nil {
+		return err
+	}
+	if len(topics) > 0 {
+		d.Handlers["ingest-topic"] = func(ctx context.Context, job db.Job) error {
+			var topic topicJob
+			if err := json.Unmarshal(job.Payload, &topic); err != nil {
+				return fmt.Errorf("failed to parse ingest-topic payload: %w", err)
+			}
+			return a.runner().Ingest(ctx, topic.options())
+		}
+	}
+	for _, topic := range topics {
+		every, err := topic.Every()
+		if err != nil {
+			return err
+		}
+		job := newTopicJob(topic, a.cfg.PageSizing.Initial)
+		if _, err := ingest.ParseSources(job.options().Sources); err != nil {
+			return fmt.Errorf("topic %q: %w", topic.Query, err)
+		}
+		d.Schedule = append(d.Schedule, daemon.ScheduleEntry{Kind: "ingest-topic", Payload: job, Every: every, Priority: topic.Priority})
+	}
+
+	d.Run(ctx)
+	return nil
+}
+
+// orchestrate [--no-daemon] runs the daemon (ingestion and maintenance jobs) and every
+// configured processing stage in this process, until interrupted
+func (a *app) orchestrateCommand() *cobra.Command {
+	var noDaemon bool
+	cmd := &cobra.Command{
+		Use:   "orchestrate",
+		Short: "Runs the daemon and every processing stage",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.orchestrate(cmd.Context(), noDaemon)
+		},
+	}
+	cmd.Flags().BoolVar(&noDaemon, "no-daemon", false, "only run the processing stages, ingestion runs elsewhere")
+	return cmd
+}
+
+func (a *app) orchestrate(ctx context.Context, noDaemon bool) error {
+	cfg := a.cfg.Orchestrator
+	o := &orchestrator.Orchestrator{DBPool: a.dbPool, ProjectID: a.project.ID, PollInterval: cfg.PollInterval, BatchSize: cfg.BatchSize, ShutdownGrace: cfg.ShutdownGrace}
+	if cfg.Download.Workers > 0 {
+		o.Stages = append(o.Stages, orchestrator.Stage{Name: "DOWNLOAD", From: db.StatusIngested, To: db.StatusDownloaded, Workers: cfg.Download.Workers, Process: orchestrator.Download(a.dbPool, a.project.ID, a.cfg.PDFDir, cfg.PDF)})
+	}
+	routed := orchestrator.Routed(a.dbPool, a.project.ID, cfg.Routes)
+	pdfInfo := orchestrator.PDFInfo(a.dbPool)
+	for _, s := range []struct {
+		name     string
+		from, to db.PaperStatus
+		stage    config.Stage
+		env      orchestrator.Env
+	}{
+		{"EXTRACT", db.StatusDownloaded, db.StatusExtracted, cfg.Extract, pdfInfo},
+		{"CHUNK", db.StatusExtracted, db.StatusChunked, cfg.Chunk, orchestrator.Envs(routed, pdfInfo)},
+		{"EMBED", db.StatusChunked, db.StatusEmbedded, cfg.Embed, orchestrator.Envs(routed, pdfInfo)},
+	} {
+		if s.stage.Workers == 0 || len(s.stage.Command) == 0 {
+			continue
+		}
+		process := orchestrator.Command(s.stage.Command, a.cfg.PDFDir, s.env)
+		switch {
+		case s.name == "EXTRACT":
+			process = orchestrator.Extract(s.stage.Command, a.cfg.PDFDir, s.env, a.dbPool, cfg.PDF)
+		case s.name == "CHUNK" && s.stage.StoreChunks:
+			process = orchestrator.Chunk(s.stage.Command, a.cfg.PDFDir, s.env, a.dbPool)
+		case s.name == "EMBED":
+			process = orchestrator.Embed(s.stage.Command, a.cfg.PDFDir, s.env, a.dbPool)
+		}
+		process = orchestrator.SkipKinds(a.dbPool, s.name, cfg.PDF.Skip, process)
+		o.Stages = append(o.Stages, orchestrator.Stage{Name: s.name, From: s.from, To: s.to, Workers: s.stage.Workers, Process: process})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// NOTE: a daemon that fails to start takes the stages down with it
+	var (
+		wg        sync.WaitGroup
+		daemonErr error
+	)
+	if !noDaemon {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if daemonErr = a.runDaemon(ctx); daemonErr != nil {
+				cancel()
+			}
+		}()
+	}
+
+	o.Run(ctx)
+	wg.Wait()
+	return daemonErr
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/config"
+	"os"
+	"testing"
+	"time"
+)
+
+const benchProject = "bench"
+
+// BenchmarkInsertPage inserts pages of 25 papers into the "bench" project and deletes them
+// afterwards. It needs DATABASE_URL to point at a throwaway database with the Schema.
+func BenchmarkInsertPage(b *testing.B) {
+	if os.Getenv("DATABASE_URL") == "" {
+		b.Skip("DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	dbPool, err := ConnectToDb(config.Database{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer dbPool.Close()
+
+	project, err := GetOrCreateProject(ctx, dbPool, benchProject)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		if _, err := DeleteProjectPapers(context.Background(), dbPool, project.ID); err != nil {
+			b.Errorf("cleanup failed: %v", err)
+		}
+	})
+
+	const pageSize = 25
+	authors := []byte(`["Jane Doe","Richard Roe"]`)
+	metadata := []byte(`{"bench":true}`)
+	// NOTE: the unique ids must not repeat across the b.N rounds the benchmark runs
+	run := time.Now().UnixNano()
+
+	b.ReportAllocs()
+	for i := range b.N {
+		for j := range pageSize {
+			key := fmt.Sprintf("%d-%d-%d", run, i, j)
+			paper := ResearchPaper{
+				ProjectID: project.ID,
+				Source:    Arxiv,
+				SourceID:  &key,
+				Title:     "bench paper " + key,
+				PDFURL:    "https://example.org/" + key + ".pdf",
+				Authors:   &authors,
+				Metadata:  &metadata,
+				Topic:     benchProject,
+			}
+			if err := InsertIntoDb(ctx, dbPool, &paper); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
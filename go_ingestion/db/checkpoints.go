@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrCheckpointConflict is returned when another worker wrote the checkpoint since it was read.
+var ErrCheckpointConflict = errors.New("checkpoint was updated concurrently")
+
+// checkpointAttempts bounds AdvanceCheckpoint, every conflict means some other worker made progress
+const checkpointAttempts = 5
+
+// Checkpoint is how far ingest got through the results of a query on one source.
+type Checkpoint struct {
+	Source     PaperSource
+	Query      string
+	NextOffset uint64
+	// Version is 0 for a checkpoint that isn't stored yet
+	Version int64
+}
+
+// GetCheckpoint returns the stored checkpoint, false when the query wasn't ingested from source yet.
+func GetCheckpoint(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, source PaperSource, query string) (Checkpoint, bool, error) {
+	cp := Checkpoint{Source: source, Query: query}
+	err := dbPool.QueryRow(ctx, `
+		SELECT next_offset, version FROM ingest_checkpoints
+		WHERE project_id = $1 AND source = $2 AND query = $3;
+	`, projectID, source, query).Scan(&cp.NextOffset, &cp.Version)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return cp, false, nil
+	}
+	if err != nil {
+		return cp, false, fmt.Errorf("failed to get %s checkpoint: %w", source, err)
+	}
+	return cp, true, nil
+}
+
+// SaveCheckpoint writes cp only if the stored version is still cp.Version, and returns it
+// with the new version. A stale version returns ErrCheckpointConflict instead of silently
+// overwriting what another worker saved.
+func SaveCheckpoint(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, cp Checkpoint) (Checkpoint, error) {
+	var err error
+	if cp.Version == 0 {
+		err = dbPool.QueryRow(ctx, `
+			INSERT INTO ingest_checkpoints (project_id, source, query, next_offset)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (project_id, source, query) DO NOTHING
+			RETURNING version;
+		`, projectID, cp.Source, cp.Query, cp.NextOffset).Scan(&cp.Version)
+	} else {
+		err = dbPool.QueryRow(ctx, `
+			UPDATE ingest_checkpoints
+			SET next_offset = $4, version = version + 1, updated_at = now()
+			WHERE project_id = $1 AND source = $2 AND query = $3 AND version = $5
+			RETURNING version;
+		`, projectID, cp.Source, cp.Query, cp.NextOffset, cp.Version).Scan(&cp.Version)
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return cp, ErrCheckpointConflict
+	}
+	if err != nil {
+		return cp, fmt.Errorf("failed to save %s checkpoint: %w", cp.Source, err)
+	}
+	return cp, nil
+}
+
+// AdvanceCheckpoint moves the checkpoint of source forward to offset, it never moves back
+// when a worker on a later page already saved a higher one.
+func AdvanceCheckpoint(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, source PaperSource, query string, offset uint64) error {
+	for range checkpointAttempts {
+		cp, _, err := GetCheckpoint(ctx, dbPool, projectID, source, query)
+		if err != nil {
+			return err
+		}
+		if cp.NextOffset >= offset {
+			return nil
+		}
+
+		cp.NextOffset = offset
+		_, err = SaveCheckpoint(ctx, dbPool, projectID, cp)
+		if !errors.Is(err, ErrCheckpointConflict) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to advance %s checkpoint to %d: %w", source, offset, ErrCheckpointConflict)
+}
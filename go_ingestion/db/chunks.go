@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Chunk struct {
+	Index   int    `json:"index"`
+	Content string `json:"content"`
+}
+
+// ChunkDiff counts what ReplaceChunks did, only Added chunks need embedding.
+type ChunkDiff struct {
+	Kept    int
+	Added   int
+	Removed int
+}
+
+// ChunkHash fingerprints chunk content, whitespace differences from re-extraction don't count.
+func ChunkHash(content string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(content), " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// ReplaceChunks makes chunks the chunks of paper id. A stored chunk with the same content
+// keeps its id, and with it its vectors, stored chunks that are gone are deleted with
+// their vectors.
+func ReplaceChunks(ctx context.Context, dbPool *pgxpool.Pool, paperID uint64, chunks []Chunk) (ChunkDiff, error) {
+	var diff ChunkDiff
+
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return diff, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT id, COALESCE(content_hash, '') FROM embedding_chunks WHERE paper_id = $1 ORDER BY chunk_index;`, paperID)
+	if err != nil {
+		return diff, fmt.Errorf("failed to list chunks of paper %d: %w", paperID, err)
+	}
+	stored := map[string][]int64{}
+	for rows.Next() {
+		var id int64
+		var hash string
+		if err := rows.Scan(&id, &hash); err != nil {
+			rows.Close()
+			return diff, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		stored[hash] = append(stored[hash], id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return diff, err
+	}
+
+	for _, c := range chunks {
+		hash := ChunkHash(c.Content)
+		// NOTE: chunks stored before content_hash existed are under '' and never reused
+		if ids := stored[hash]; len(ids) > 0 {
+			stored[hash] = ids[1:]
+			if _, err := tx.Exec(ctx, `UPDATE embedding_chunks SET chunk_index = $2 WHERE id = $1;`, ids[0], c.Index); err != nil {
+				return diff, fmt.Errorf("failed to keep chunk %d: %w", ids[0], err)
+			}
+			diff.Kept++
+			continue
+		}
+
+		_, err := tx.Exec(ctx, `
+			INSERT INTO embedding_chunks (paper_id, chunk_index, content, content_hash)
+			VALUES ($1, $2, $3, $4);
+		`, paperID, c.Index, c.Content, hash)
+		if err != nil {
+			return diff, fmt.Errorf("failed to insert chunk %d of paper %d: %w", c.Index, paperID, err)
+		}
+		diff.Added++
+	}
+
+	var removed []int64
+	for _, ids := range stored {
+		removed = append(removed, ids...)
+	}
+	if len(removed) > 0 {
+		if _, err := tx.Exec(ctx, `DELETE FROM embedding_vectors WHERE embedding_chunk_id = ANY($1);`, removed); err != nil {
+			return diff, fmt.Errorf("failed to delete vectors of removed chunks: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM embedding_chunks WHERE id = ANY($1);`, removed); err != nil {
+			return diff, fmt.Errorf("failed to delete removed chunks: %w", err)
+		}
+		diff.Removed = len(removed)
+	}
+
+	return diff, tx.Commit(ctx)
+}
+
+// UnembeddedChunks returns the chunks of paper id that have no vector in namespace yet.
+func UnembeddedChunks(ctx context.Context, dbPool *pgxpool.Pool, paperID uint64, namespace string) ([]int64, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT c.id FROM embedding_chunks c
+		WHERE c.paper_id = $1
+			AND NOT EXISTS (SELECT 1 FROM embedding_vectors v WHERE v.embedding_chunk_id = c.id AND v.namespace = $2)
+		ORDER BY c.chunk_index;
+	`, paperID, orDefaultNamespace(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unembedded chunks of paper %d: %w", paperID, err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
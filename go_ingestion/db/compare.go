@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TopicComparison is how the corpora of two topics intersect.
+type TopicComparison struct {
+	A, B TopicCorpus
+	// Overlap are the papers of A that are also in B, by DOI or by title ignoring case and
+	// punctuation, usually the same work ingested from different sources
+	Overlap []OverlapPair
+	// SharedAuthors and SharedVenues are the top names in both topics, the Shared counts
+	// are how many there are in all
+	SharedAuthors      []SharedName
+	SharedAuthorsCount int
+	SharedVenues       []SharedName
+	SharedVenuesCount  int
+	// CitesAB counts references from papers of A to papers of B, CitesBA the other way
+	CitesAB int
+	CitesBA int
+}
+
+// TopicCorpus sizes one side of a comparison.
+type TopicCorpus struct {
+	Topic   string
+	Papers  int
+	Authors int
+	Venues  int
+	// WithReferences are the papers crossref listed references for, citation counts only
+	// cover those
+	WithReferences int
+}
+
+type OverlapPair struct {
+	A, B       uint64
+	TitleA     string
+	TitleB     string
+	MatchedDOI bool
+}
+
+// SharedName is an author or venue with its number of papers in either topic.
+type SharedName struct {
+	Name    string
+	PapersA int
+	PapersB int
+}
+
+// topicNames counts the papers per distinct name of a names query (id, name pairs)
+const topicNames = `
+	SELECT lower(name) AS key, min(name) AS name, count(DISTINCT id) AS papers
+	FROM (%s) named
+	WHERE name <> ''
+	GROUP BY 1
+`
+
+// authorNames and venueNames list the names of the papers of a topic, $1 is the project
+// and %s the topic parameter
+const (
+	authorNames = `
+		SELECT p.id, btrim(a) AS name
+		FROM research_papers p,
+			jsonb_array_elements_text(CASE WHEN jsonb_typeof(p.authors) = 'array' THEN p.authors ELSE '[]' END) a
+		WHERE p.project_id = $1 AND p.topic = %s
+	`
+	venueNames = `
+		SELECT id, COALESCE(NULLIF(btrim(venue), ''), btrim(conference), '') AS name
+		FROM research_papers
+		WHERE project_id = $1 AND topic = %s
+	`
+)
+
+// CompareTopics compares the papers of topics a and b, listing at most limit shared authors
+// and venues. Authors and venues match ignoring case.
+func CompareTopics(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, a, b string, limit int) (TopicComparison, error) {
+	c := TopicComparison{A: TopicCorpus{Topic: a}, B: TopicCorpus{Topic: b}}
+
+	for _, side := range []*TopicCorpus{&c.A, &c.B} {
+		err := dbPool.QueryRow(ctx, `
+			SELECT
+				(SELECT count(*) FROM research_papers WHERE project_id = $1 AND topic = $2),
+				(SELECT count(*) FROM (`+fmt.Sprintf(topicNames, fmt.Sprintf(authorNames, "$2"))+`) n),
+				(SELECT count(*) FROM (`+fmt.Sprintf(topicNames, fmt.Sprintf(venueNames, "$2"))+`) n),
+				(SELECT count(DISTINCT r.paper_id)
+				 FROM paper_references r
+				 JOIN research_papers p ON p.id = r.paper_id
+				 WHERE p.project_id = $1 AND p.topic = $2);
+		`, projectID, side.Topic).Scan(&side.Papers, &side.Authors, &side.Venues, &side.WithReferences)
+		if err != nil {
+			return c, fmt.Errorf("failed to size topic %q: %w", side.Topic, err)
+		}
+	}
+
+	overlap, err := topicOverlap(ctx, dbPool, projectID, a, b)
+	if err != nil {
+		return c, err
+	}
+	c.Overlap = overlap
+
+	if c.SharedAuthors, c.SharedAuthorsCount, err = sharedNames(ctx, dbPool, authorNames, projectID, a, b, limit); err != nil {
+		return c, fmt.Errorf("failed to find shared authors: %w", err)
+	}
+	if c.SharedVenues, c.SharedVenuesCount, err = sharedNames(ctx, dbPool, venueNames, projectID, a, b, limit); err != nil {
+		return c, fmt.Errorf("failed to find shared venues: %w", err)
+	}
+
+	err = dbPool.QueryRow(ctx, `
+		WITH cites AS (
+			SELECT p.topic AS citing, q.topic AS cited
+			FROM paper_references r
+			JOIN research_papers p ON p.id = r.paper_id
+			JOIN research_papers q ON q.project_id = p.project_id AND lower(q.doi) = r.cited_doi
+			WHERE p.project_id = $1 AND p.topic IN ($2, $3) AND q.topic IN ($2, $3)
+		)
+		SELECT
+			count(*) FILTER (WHERE citing = $2 AND cited = $3),
+			count(*) FILTER (WHERE citing = $3 AND cited = $2)
+		FROM cites;
+	`, projectID, a, b).Scan(&c.CitesAB, &c.CitesBA)
+	if err != nil {
+		return c, fmt.Errorf("failed to count citations between topics: %w", err)
+	}
+	return c, nil
+}
+
+func topicOverlap(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, a, b string) ([]OverlapPair, error) {
+	rows, err := dbPool.Query(ctx, `
+		WITH p AS (
+			SELECT id, topic, title, NULLIF(lower(btrim(doi)), '') AS doi,
+				lower(regexp_replace(title, '[^[:alnum:]]+', '', 'g')) AS norm_title
+			FROM research_papers
+			WHERE project_id = $1 AND topic IN ($2, $3)
+		)
+		SELECT a.id, b.id, a.title, b.title, a.doi IS NOT NULL AND a.doi = b.doi
+		FROM p a
+		JOIN p b ON a.doi = b.doi OR (a.norm_title <> '' AND a.norm_title = b.norm_title)
+		WHERE a.topic = $2 AND b.topic = $3
+		ORDER BY a.id, b.id;
+	`, projectID, a, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find overlapping papers: %w", err)
+	}
+	defer rows.Close()
+
+	var pairs []OverlapPair
+	for rows.Next() {
+		var pair OverlapPair
+		if err := rows.Scan(&pair.A, &pair.B, &pair.TitleA, &pair.TitleB, &pair.MatchedDOI); err != nil {
+			return nil, fmt.Errorf("failed to scan overlapping papers: %w", err)
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, rows.Err()
+}
+
+// sharedNames returns up to limit names of names (authorNames or venueNames) both topics
+// have, most papers first, and how many there are in all.
+func sharedNames(ctx context.Context, dbPool *pgxpool.Pool, names string, projectID uint64, a, b string, limit int) ([]SharedName, int, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT a.name, a.papers, b.papers, count(*) OVER ()
+		FROM (`+fmt.Sprintf(topicNames, fmt.Sprintf(names, "$2"))+`) a
+		JOIN (`+fmt.Sprintf(topicNames, fmt.Sprintf(names, "$3"))+`) b USING (key)
+		ORDER BY a.papers + b.papers DESC, a.name
+		LIMIT $4;
+	`, projectID, a, b, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var (
+		shared []SharedName
+		total  int
+	)
+	for rows.Next() {
+		var s SharedName
+		if err := rows.Scan(&s.Name, &s.PapersA, &s.PapersB, &total); err != nil {
+			return nil, 0, err
+		}
+		shared = append(shared, s)
+	}
+	return shared, total, rows.Err()
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// StoredCredential is an encrypted source credential of a project.
+type StoredCredential struct {
+	Source     string    `json:"source"`
+	Ciphertext []byte    `json:"-"`
+	KeyID      string    `json:"key_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SaveCredential stores the encrypted credential of a source, replacing the one it had.
+func SaveCredential(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, source string, ciphertext []byte, keyID string) error {
+	_, err := dbPool.Exec(ctx, `
+		INSERT INTO source_credentials (project_id, source, ciphertext, key_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (project_id, source) DO UPDATE
+		SET ciphertext = EXCLUDED.ciphertext, key_id = EXCLUDED.key_id, updated_at = now();
+	`, projectID, source, ciphertext, keyID)
+	if err != nil {
+		return fmt.Errorf("failed to save %s credential: %w", source, err)
+	}
+	return nil
+}
+
+// GetCredential returns the credential of a source, false when the project has none.
+func GetCredential(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, source string) (StoredCredential, bool, error) {
+	c := StoredCredential{Source: source}
+	err := dbPool.QueryRow(ctx, `
+		SELECT ciphertext, key_id, created_at, updated_at
+		FROM source_credentials
+		WHERE project_id = $1 AND source = $2;
+	`, projectID, source).Scan(&c.Ciphertext, &c.KeyID, &c.CreatedAt, &c.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return StoredCredential{}, false, nil
+	}
+	if err != nil {
+		return StoredCredential{}, false, fmt.Errorf("failed to get %s credential: %w", source, err)
+	}
+	return c, true, nil
+}
+
+// ListCredentials returns the credentials of a project without their ciphertext.
+func ListCredentials(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64) ([]StoredCredential, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT source, key_id, created_at, updated_at
+		FROM source_credentials
+		WHERE project_id = $1
+		ORDER BY source;
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list credentials: %w", err)
+	}
+	defer rows.Close()
+
+	var credentials []StoredCredential
+	for rows.Next() {
+		var c StoredCredential
+		if err := rows.Scan(&c.Source, &c.KeyID, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan credential: %w", err)
+		}
+		credentials = append(credentials, c)
+	}
+	return credentials, rows.Err()
+}
+
+// DeleteCredential removes the credential of a source, false when there was none.
+func DeleteCredential(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, source string) (bool, error) {
+	tag, err := dbPool.Exec(ctx, `DELETE FROM source_credentials WHERE project_id = $1 AND source = $2;`, projectID, source)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete %s credential: %w", source, err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Funder struct {
+	Name   string
+	DOI    string
+	Awards []string
+}
+
+type Affiliation struct {
+	AuthorPosition int
+	Author         string
+	Name           string
+}
+
+type CrossrefEnrichment struct {
+	Funders      []Funder
+	Affiliations []Affiliation
+	// References are the cited DOIs, lowercased
+	References []string
+	Retracted  bool
+}
+
+// PaperDOI is a paper waiting for enrichment.
+type PaperDOI struct {
+	ID  uint64
+	DOI string
+}
+
+// NameCount is how many papers of a topic a funder or affiliation appears on.
+type NameCount struct {
+	Name   string
+	Papers int
+}
+
+// PapersToEnrich returns up to limit papers with a DOI crossref wasn't asked about yet.
+func PapersToEnrich(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, limit int) ([]PaperDOI, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT id, doi FROM research_papers
+		WHERE project_id = $1 AND doi IS NOT NULL AND crossref_checked_at IS NULL
+		ORDER BY id
+		LIMIT $2;
+	`, projectID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list papers to enrich: %w", err)
+	}
+	defer rows.Close()
+
+	var papers []PaperDOI
+	for rows.Next() {
+		var p PaperDOI
+		if err := rows.Scan(&p.ID, &p.DOI); err != nil {
+			return nil, fmt.Errorf("failed to scan paper doi: %w", err)
+		}
+		papers = append(papers, p)
+	}
+	return papers, rows.Err()
+}
+
+// SaveCrossrefEnrichment replaces the funders, affiliations and references of a paper and
+// marks it checked.
+func SaveCrossrefEnrichment(ctx context.Context, dbPool *pgxpool.Pool, paperID uint64, e CrossrefEnrichment) error {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM paper_funders WHERE paper_id = $1;`, paperID); err != nil {
+		return fmt.Errorf("failed to clear funders of paper %d: %w", paperID, err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM paper_affiliations WHERE paper_id = $1;`, paperID); err != nil {
+		return fmt.Errorf("failed to clear affiliations of paper %d: %w", paperID, err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM paper_references WHERE paper_id = $1;`, paperID); err != nil {
+		return fmt.Errorf("failed to clear references of paper %d: %w", paperID, err)
+	}
+
+	for _, f := range e.Funders {
+		awards := f.Awards
+		if awards == nil {
+			awards = []string{}
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO paper_funders (paper_id, name, funder_doi, awards) VALUES ($1, $2, NULLIF($3, ''), $4);`, paperID, f.Name, f.DOI, awards)
+		if err != nil {
+			return fmt.Errorf("failed to save funder of paper %d: %w", paperID, err)
+		}
+	}
+
+	for _, a := range e.Affiliations {
+		_, err := tx.Exec(ctx, `INSERT INTO paper_affiliations (paper_id, author_position, author, affiliation) VALUES ($1, $2, $3, $4);`, paperID, a.AuthorPosition, a.Author, a.Name)
+		if err != nil {
+			return fmt.Errorf("failed to save affiliation of paper %d: %w", paperID, err)
+		}
+	}
+
+	if len(e.References) > 0 {
+		_, err := tx.Exec(ctx, `INSERT INTO paper_references (paper_id, cited_doi) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING;`, paperID, e.References)
+		if err != nil {
+			return fmt.Errorf("failed to save references of paper %d: %w", paperID, err)
+		}
+	}
+
+	if e.Retracted {
+		// NOTE: only the first retraction notice is an event, later checks keep retracted_at
+		_, err := tx.Exec(ctx, `
+			INSERT INTO paper_events (project_id, paper_id, kind)
+			SELECT project_id, id, 'retracted' FROM research_papers
+			WHERE id = $1 AND retracted_at IS NULL;
+		`, paperID)
+		if err != nil {
+			return fmt.Errorf("failed to record retraction of paper %d: %w", paperID, err)
+		}
+	}
+
+	query := `
+		UPDATE research_papers
+		SET crossref_checked_at = now(),
+		    retracted_at = CASE WHEN $2 THEN COALESCE(retracted_at, now()) END
+		WHERE id = $1;
+	`
+	if _, err := tx.Exec(ctx, query, paperID, e.Retracted); err != nil {
+		return fmt.Errorf("failed to mark paper %d enriched: %w", paperID, err)
+	}
+	return tx.Commit(ctx)
+}
+
+// TopFunders counts papers per funder in a project, topic "" is all topics.
+func TopFunders(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, topic string, limit int) ([]NameCount, error) {
+	return countNames(ctx, dbPool, `
+		SELECT f.name, count(DISTINCT f.paper_id)
+		FROM paper_funders f
+		JOIN research_papers p ON p.id = f.paper_id
+		WHERE p.project_id = $1 AND ($2 = '' OR p.topic = $2)
+		GROUP BY f.name
+		ORDER BY 2 DESC, f.name
+		LIMIT $3;
+	`, projectID, topic, limit)
+}
+
+// TopAffiliations counts papers per author affiliation in a project, topic "" is all topics.
+func TopAffiliations(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, topic string, limit int) ([]NameCount, error) {
+	return countNames(ctx, dbPool, `
+		SELECT a.affiliation, count(DISTINCT a.paper_id)
+		FROM paper_affiliations a
+		JOIN research_papers p ON p.id = a.paper_id
+		WHERE p.project_id = $1 AND ($2 = '' OR p.topic = $2)
+		GROUP BY a.affiliation
+		ORDER BY 2 DESC, a.affiliation
+		LIMIT $3;
+	`, projectID, topic, limit)
+}
+
+func countNames(ctx context.Context, dbPool *pgxpool.Pool, query string, projectID uint64, topic string, limit int) ([]NameCount, error) {
+	rows, err := dbPool.Query(ctx, query, projectID, topic, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count names: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []NameCount
+	for rows.Next() {
+		var c NameCount
+		if err := rows.Scan(&c.Name, &c.Papers); err != nil {
+			return nil, fmt.Errorf("failed to scan count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
@@ -2,80 +2,124 @@ package db
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"log"
+	"go_ingestion/config"
+	"go_ingestion/internal/filter"
+	"io"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func ConnectToDb() *pgxpool.Pool {
+// ConnectToDb opens the pool of DATABASE_URL, a missing or malformed url is a
+// config.ErrConfig.
+func ConnectToDb(cfg config.Database) (*pgxpool.Pool, error) {
 	databaseURL := os.Getenv("DATABASE_URL")
 	if databaseURL == "" {
-		log.Fatal("DATABASE_URL not set in environment or .env file")
+		return nil, fmt.Errorf("%w: DATABASE_URL not set in the environment, .env, DATABASE_URL_FILE or the secrets provider", config.ErrConfig)
 	}
 
-	dbPool, err := pgxpool.New(context.Background(), databaseURL)
+	poolConfig, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to parse DATABASE_URL: %w", config.ErrConfig, err)
+	}
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		poolConfig.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.ConnectTimeout > 0 {
+		poolConfig.ConnConfig.ConnectTimeout = cfg.ConnectTimeout
+	}
+	// NOTE: DATABASE_URL may be rotated by the secrets refresh, new connections log in with
+	// its current user and password
+	poolConfig.BeforeConnect = func(ctx context.Context, cc *pgx.ConnConfig) error {
+		current := os.Getenv("DATABASE_URL")
+		if current == "" || current == databaseURL {
+			return nil
+		}
+		rotated, err := pgx.ParseConfig(current)
+		if err != nil {
+			return fmt.Errorf("failed to parse rotated DATABASE_URL: %w", err)
+		}
+		cc.User = rotated.User
+		cc.Password = rotated.Password
+		return nil
+	}
+
+	dbPool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to connect to database: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
 
-	return dbPool
+	return dbPool, nil
 }
 
-// CREATE TYPE paper_source AS ENUM (
-//     'arxiv',
-//     'semanticscholar',
-//     'springernature'
-// );
-//
-// CREATE TABLE research_papers (
-//     id BIGSERIAL PRIMARY KEY,
-//
-//     source paper_source NOT NULL,
-//     source_id TEXT UNIQUE,
-//     title TEXT UNIQUE NOT NULL,
-//     pdf_url TEXT UNIQUE NOT NULL,
-//
-//     authors JSONB,
-//     doi TEXT,
-//     metadata JSONB,
-//     embedding_processed BOOLEAN DEFAULT false,
-//     created_at TIMESTAMPTZ DEFAULT now()
-// );
-//
-// CREATE INDEX idx_research_papers_source
-//     ON research_papers(source);
-//
-// ALTER TABLE research_papers
-// ADD COLUMN topic TEXT;
-//
-// UPDATE research_papers
-// SET topic = 'natural language processing';
-//
-// ALTER TABLE research_papers
-// ALTER COLUMN topic SET NOT NULL;
-//
-// CREATE INDEX idx_research_papers_topic
-//     ON research_papers(topic);
-
 type ResearchPaper struct {
-	ID                 uint64      `db:"id"`
-	Source             PaperSource `db:"source"`
-	SourceID           *string     `db:"source_id"`
-	Title              string      `db:"title"`
-	PDFURL             string      `db:"pdf_url"`
-	Authors            *[]byte     `db:"authors"` // store JSONB as []byte
-	DOI                *string     `db:"doi"`
-	Metadata           *[]byte     `db:"metadata"` // store JSONB as []byte
-	EmbeddingProcessed bool        `db:"embedding_processed"`
-	Topic              string      `db:"topic"`
-	CreatedAt          time.Time   `db:"created_at"`
+	ID          uint64      `db:"id"`
+	ProjectID   uint64      `db:"project_id"`
+	Source      PaperSource `db:"source"`
+	SourceID    *string     `db:"source_id"`
+	Title       string      `db:"title"`
+	PDFURL      string      `db:"pdf_url"`
+	Authors     *[]byte     `db:"authors"` // store JSONB as []byte
+	DOI         *string     `db:"doi"`
+	Metadata    *[]byte     `db:"metadata"` // store JSONB as []byte
+	Status      PaperStatus `db:"status"`
+	Topic       string      `db:"topic"`
+	License     *string     `db:"license"`
+	TLDR        *string     `db:"tldr"`
+	Categories  *[]byte     `db:"categories"` // store JSONB as []byte
+	Keywords    []string    `db:"keywords"`
+	Conference  *string     `db:"conference"`
+	Abstract    *string     `db:"abstract"`
+	Language    *string     `db:"language"`
+	HasPDF      *bool       `db:"has_pdf"`
+	PublishedOn *time.Time  `db:"published_on"`
+	Provenance  *[]byte     `db:"provenance"` // store JSONB as []byte
+	ContentHash *string     `db:"content_hash"`
+	CreatedAt   time.Time   `db:"created_at"`
+	UpdatedAt   *time.Time  `db:"updated_at"`
+
+	// Attributes aren't stored, sources fill them for the filter rules
+	Attributes filter.Attributes `db:"-"`
+	// Search isn't stored either, sources fill it for search index sinks
+	Search SearchFields `db:"-"`
+	// Embargoed is set by sources that say the paper isn't open access yet, not stored
+	Embargoed bool `db:"-"`
+	// PDFCandidates go to pdf_candidates once the paper has an id
+	PDFCandidates []PDFCandidate `db:"-"`
+	// Subjects go to paper_subjects once the paper has an id
+	Subjects []Subject `db:"-"`
+	// Identifiers go to paper_identifiers once the paper has an id
+	Identifiers []Identifier `db:"-"`
+}
+
+// Category is a source classification like an arxiv category, at most one is primary.
+type Category struct {
+	Term    string `json:"term"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type SearchFields struct {
+	Venue string
+	Tags  []string
 }
 
 type PaperSource string
@@ -84,16 +128,40 @@ const (
 	Arxiv           PaperSource = "arxiv"
 	SemanticScholar PaperSource = "semanticscholar"
 	SpringerNature  PaperSource = "springernature"
+	Crossref        PaperSource = "crossref"
+	OpenAlex        PaperSource = "openalex"
+	PubMed          PaperSource = "pubmed"
+	IEEE            PaperSource = "ieee"
+	Core            PaperSource = "core"
+	DBLP            PaperSource = "dblp"
+	ACL             PaperSource = "acl"
 )
 
-func InsertIntoDb(ctx context.Context, dbPool *pgxpool.Pool, paper ResearchPaper) error {
+func InsertIntoDb(ctx context.Context, dbPool *pgxpool.Pool, paper *ResearchPaper) error {
 	query := `
-		INSERT INTO research_papers (source, source_id, title, pdf_url, authors, doi, metadata, topic)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id, created_at;
+		WITH paper AS (
+			INSERT INTO research_papers (project_id, source, source_id, title, pdf_url, authors, doi, metadata, topic, license, provenance, content_hash, tldr, categories, keywords, conference, abstract, language, has_pdf, venue, published_on)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, NULLIF($20, ''), $21)
+			RETURNING id, project_id, source, created_at
+		), event AS (
+			INSERT INTO paper_events (project_id, paper_id, kind, source)
+			SELECT project_id, id, 'ingested', source FROM paper
+		)
+		SELECT id, created_at FROM paper;
 	`
 
-	err := dbPool.QueryRow(ctx, query, paper.Source, paper.SourceID, paper.Title, paper.PDFURL, paper.Authors, paper.DOI, paper.Metadata, paper.Topic).Scan(&paper.ID, &paper.CreatedAt)
+	hash := ContentHash(*paper)
+	paper.ContentHash = &hash
+
+	if paper.Provenance == nil {
+		provenanceJSON, err := json.Marshal(NewProvenance(*paper))
+		if err != nil {
+			return fmt.Errorf("failed to marshal provenance: %w", err)
+		}
+		paper.Provenance = &provenanceJSON
+	}
+
+	err := dbPool.QueryRow(ctx, query, paper.ProjectID, paper.Source, paper.SourceID, paper.Title, paper.PDFURL, paper.Authors, paper.DOI, paper.Metadata, paper.Topic, paper.License, paper.Provenance, paper.ContentHash, paper.TLDR, paper.Categories, paper.Keywords, paper.Conference, paper.Abstract, paper.Language, paper.HasPDF, paper.Search.Venue, paper.PublishedOn).Scan(&paper.ID, &paper.CreatedAt)
 
 	if err != nil {
 		return fmt.Errorf("failed to insert paper: %w", err)
@@ -103,29 +171,71 @@ func InsertIntoDb(ctx context.Context, dbPool *pgxpool.Pool, paper ResearchPaper
 	return err
 }
 
-func GetCurrentlyProcessedDocuments(ctx context.Context, dbPool *pgxpool.Pool) (uint64, uint64, uint64) {
-	var arxivCount, semanticCount, springerCount uint64
+// ExistingSourceIDs returns which of the ids of source are already stored in the project with
+// their content hash (empty for rows stored before hashing), one round trip for a whole page.
+func ExistingSourceIDs(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, source PaperSource, ids []string) (map[string]string, error) {
+	rows, err := dbPool.Query(ctx, `SELECT source_id, COALESCE(content_hash, '') FROM research_papers WHERE project_id = $1 AND source = $2 AND source_id = ANY($3);`, projectID, source, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up source ids: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]string, len(ids))
+	for rows.Next() {
+		var id, hash string
+		if err := rows.Scan(&id, &hash); err != nil {
+			return nil, fmt.Errorf("failed to scan source id: %w", err)
+		}
+		existing[id] = hash
+	}
 
+	return existing, rows.Err()
+}
+
+// ContentHash fingerprints the fields a source can change between fetches, every column
+// UpdatePaperContent writes. The topic and project aren't part of it since they come from us.
+// NOTE: papers hashed before a field was added are rewritten once on their next fetch
+func ContentHash(paper ResearchPaper) string {
+	var publishedOn string
+	if paper.PublishedOn != nil {
+		publishedOn = paper.PublishedOn.Format(time.DateOnly)
+	}
+
+	h := sha256.New()
+	for _, field := range []string{
+		paper.Title, paper.PDFURL, nullableString(paper.DOI), nullableString(paper.License), byteSliceToString(paper.Authors), byteSliceToString(paper.Metadata),
+		nullableString(paper.TLDR), byteSliceToString(paper.Categories), strings.Join(paper.Keywords, "\x1f"), nullableString(paper.Conference),
+		nullableString(paper.Abstract), nullableString(paper.Language), paper.Search.Venue, publishedOn,
+	} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// UpdatePaperContent overwrites a re-fetched paper whose content hash changed, matched by
+// source and source id. It reports false when nothing was written.
+func UpdatePaperContent(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, paper ResearchPaper) (bool, error) {
 	query := `
-		SELECT 
-			COUNT(*) FILTER (WHERE source = $1) AS arxiv_count,
-			COUNT(*) FILTER (WHERE source = $2) AS semantic_count,
-			COUNT(*) FILTER (WHERE source = $3) AS springer_count
-		FROM research_papers;
+		UPDATE research_papers
+		SET title = $3, pdf_url = $4, authors = $5, doi = $6, metadata = $7, license = $8,
+		    content_hash = $9, tldr = $10, categories = $11,
+		    keywords = $12, conference = $13, abstract = $14, language = $15,
+		    venue = NULLIF($16, ''), published_on = $17, updated_at = now()
+		WHERE project_id = $1 AND source = $18 AND source_id = $2 AND content_hash IS DISTINCT FROM $9;
 	`
 
-	err := dbPool.QueryRow(ctx, query, string(Arxiv), string(SemanticScholar), string(SpringerNature)).Scan(&arxivCount, &semanticCount, &springerCount)
-
+	hash := ContentHash(paper)
+	tag, err := dbPool.Exec(ctx, query, projectID, paper.SourceID, paper.Title, paper.PDFURL, paper.Authors, paper.DOI, paper.Metadata, paper.License, hash, paper.TLDR, paper.Categories, paper.Keywords, paper.Conference, paper.Abstract, paper.Language, paper.Search.Venue, paper.PublishedOn, paper.Source)
 	if err != nil {
-		// NOTE: I can return 0,0,0 but its just computaion waste
-		log.Fatal("Do not proceed - ", err)
+		return false, fmt.Errorf("failed to update paper: %w", err)
 	}
-
-	return arxivCount, semanticCount, springerCount
+	return tag.RowsAffected() > 0, nil
 }
 
-// NOTE: sql to csv
-func GetFullData(ctx context.Context, dbPool *pgxpool.Pool) {
+// WriteCSV writes the papers of a project to w as csv, only those of topic unless it's "",
+// and returns how many it wrote.
+func WriteCSV(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, topic string, w io.Writer) (int, error) {
 	// NOTE: order is imp
 	query := `
 		SELECT
@@ -137,41 +247,30 @@ func GetFullData(ctx context.Context, dbPool *pgxpool.Pool) {
 			authors,
 			doi,
 			metadata,
-			embedding_processed,
+			status,
 			topic,
-			created_at
-		FROM research_papers;
+			created_at,
+			license,
+			updated_at,
+			tldr
+		FROM research_papers
+		WHERE project_id = $1 AND ($2 = '' OR topic = $2)
+		ORDER BY id;
 		`
 
-	rows, err := dbPool.Query(ctx, query)
-
+	rows, err := dbPool.Query(ctx, query, projectID, topic)
 	if err != nil {
-		log.Fatal("Do not proceed - ", err)
+		return 0, fmt.Errorf("failed to query papers: %w", err)
 	}
 	defer rows.Close()
 
-	if err := os.MkdirAll("data", 0755); err != nil {
-		// IMPORTANT: 0755 = file permissions
-		// ls -la = rwxr-xr-x
-		// 7 → owner: read + write + execute
-		// 5 → group: read + execute
-		// 5 → others: read + execute
-		log.Fatal("Failed to create data directory:", err)
-	}
-
-	file, err := os.Create("data/data.csv")
-	if err != nil {
-		log.Fatal("Failed to create CSV file:", err)
-	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	writer := csv.NewWriter(w)
+	n := 0
 
 	writer.Write([]string{
 		"id", "source", "source_id", "title", "pdf_url",
 		"authors", "doi", "metadata",
-		"embedding_processed", "topic", "created_at",
+		"status", "topic", "created_at", "license", "updated_at", "tldr",
 	})
 
 	for rows.Next() {
@@ -186,12 +285,21 @@ func GetFullData(ctx context.Context, dbPool *pgxpool.Pool) {
 			&paper.Authors,
 			&paper.DOI,
 			&paper.Metadata,
-			&paper.EmbeddingProcessed,
+			&paper.Status,
 			&paper.Topic,
 			&paper.CreatedAt,
+			&paper.License,
+			&paper.UpdatedAt,
+			&paper.TLDR,
 		)
 		if err != nil {
-			log.Fatal("Row scan failed:", err)
+			return n, fmt.Errorf("failed to scan paper: %w", err)
+		}
+		n++
+
+		updatedAt := ""
+		if paper.UpdatedAt != nil {
+			updatedAt = paper.UpdatedAt.Format(time.RFC3339)
 		}
 
 		writer.Write([]string{
@@ -203,15 +311,20 @@ func GetFullData(ctx context.Context, dbPool *pgxpool.Pool) {
 			byteSliceToString(paper.Authors),
 			nullableString(paper.DOI),
 			byteSliceToString(paper.Metadata),
-			strconv.FormatBool(paper.EmbeddingProcessed),
+			string(paper.Status),
 			paper.Topic,
 			paper.CreatedAt.Format(time.RFC3339),
+			nullableString(paper.License),
+			updatedAt,
+			nullableString(paper.TLDR),
 		})
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Fatal("Row iteration error:", err)
+		return n, fmt.Errorf("failed to read papers: %w", err)
 	}
+	writer.Flush()
+	return n, writer.Error()
 }
 
 func nullableString(s *string) string {
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/config"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testProject connects to DATABASE_URL and creates a project of its own for the test,
+// deleted with its papers and jobs afterwards. Tests that need it skip without a database,
+// like BenchmarkInsertPage it has to have the Schema.
+func testProject(t *testing.T) (*pgxpool.Pool, Project) {
+	t.Helper()
+	if os.Getenv("DATABASE_URL") == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	dbPool, err := ConnectToDb(config.Database{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dbPool.Close)
+
+	project, err := GetOrCreateProject(ctx, dbPool, fmt.Sprintf("test %s %d", t.Name(), time.Now().UnixNano()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		if _, err := dbPool.Exec(ctx, `DELETE FROM jobs WHERE project_id = $1;`, project.ID); err != nil {
+			t.Errorf("cleanup failed: %v", err)
+		}
+		if _, err := DeleteProjectPapers(ctx, dbPool, project.ID); err != nil {
+			t.Errorf("cleanup failed: %v", err)
+		}
+	})
+	return dbPool, project
+}
+
+// testPaper is a paper of project that only has what the constraints need.
+func testPaper(project Project, source PaperSource, sourceID string) ResearchPaper {
+	key := fmt.Sprintf("%s %s", source, sourceID)
+	return ResearchPaper{
+		ProjectID: project.ID,
+		Source:    source,
+		SourceID:  &sourceID,
+		Title:     "test paper " + key,
+		PDFURL:    "https://example.org/" + key + ".pdf",
+		Topic:     "test",
+	}
+}
+
+// NOTE: pubmed ids, ieee article numbers and core ids are all bare numbers
+func TestSourceIDsPerSource(t *testing.T) {
+	dbPool, project := testProject(t)
+	ctx := context.Background()
+
+	pubmed, ieee := testPaper(project, PubMed, "4242"), testPaper(project, IEEE, "4242")
+	if err := InsertIntoDb(ctx, dbPool, &pubmed); err != nil {
+		t.Fatal(err)
+	}
+	existing, err := ExistingSourceIDs(ctx, dbPool, project.ID, IEEE, []string{"4242"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(existing) != 0 {
+		t.Fatalf("the pubmed paper counts as an existing ieee paper: %v", existing)
+	}
+	if err := InsertIntoDb(ctx, dbPool, &ieee); err != nil {
+		t.Fatalf("the ieee paper with the id of a pubmed paper wasn't stored: %v", err)
+	}
+
+	ieee.Title = "test paper ieee 4242, revised"
+	updated, err := UpdatePaperContent(ctx, dbPool, project.ID, ieee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated {
+		t.Fatal("the ieee paper wasn't updated")
+	}
+
+	var title string
+	if err := dbPool.QueryRow(ctx, `SELECT title FROM research_papers WHERE id = $1;`, pubmed.ID).Scan(&title); err != nil {
+		t.Fatal(err)
+	}
+	if title != pubmed.Title {
+		t.Errorf("updating the ieee paper changed the pubmed paper's title to %q", title)
+	}
+}
+
+func TestContentHashFields(t *testing.T) {
+	published := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	str := func(s string) *string { return &s }
+	bytes := func(s string) *[]byte { b := []byte(s); return &b }
+	base := ResearchPaper{
+		Title:       "a paper",
+		PDFURL:      "https://example.org/a.pdf",
+		DOI:         str("10.1/a"),
+		License:     str("cc-by"),
+		Authors:     bytes(`["Jane Doe"]`),
+		Metadata:    bytes(`{}`),
+		TLDR:        str("short"),
+		Categories:  bytes(`[{"term":"cs.CL"}]`),
+		Keywords:    []string{"parsing"},
+		Conference:  str("ACL"),
+		Abstract:    str("the abstract"),
+		Language:    str("en"),
+		Search:      SearchFields{Venue: "ACL"},
+		PublishedOn: &published,
+	}
+	later := published.AddDate(0, 0, 1)
+
+	// every column UpdatePaperContent writes
+	changes := map[string]func(p *ResearchPaper){
+		"title":        func(p *ResearchPaper) { p.Title = "another paper" },
+		"pdf_url":      func(p *ResearchPaper) { p.PDFURL = "https://example.org/b.pdf" },
+		"doi":          func(p *ResearchPaper) { p.DOI = str("10.1/b") },
+		"license":      func(p *ResearchPaper) { p.License = nil },
+		"authors":      func(p *ResearchPaper) { p.Authors = bytes(`["Richard Roe"]`) },
+		"metadata":     func(p *ResearchPaper) { p.Metadata = bytes(`{"x":1}`) },
+		"tldr":         func(p *ResearchPaper) { p.TLDR = str("shorter") },
+		"categories":   func(p *ResearchPaper) { p.Categories = bytes(`[{"term":"cs.LG"}]`) },
+		"keywords":     func(p *ResearchPaper) { p.Keywords = []string{"parsing", "syntax"} },
+		"conference":   func(p *ResearchPaper) { p.Conference = str("EMNLP") },
+		"abstract":     func(p *ResearchPaper) { p.Abstract = str("the revised abstract") },
+		"language":     func(p *ResearchPaper) { p.Language = str("de") },
+		"venue":        func(p *ResearchPaper) { p.Search.Venue = "EMNLP" },
+		"published_on": func(p *ResearchPaper) { p.PublishedOn = &later },
+	}
+	for column, change := range changes {
+		paper := base
+		change(&paper)
+		if ContentHash(paper) == ContentHash(base) {
+			t.Errorf("changing %s doesn't change the hash", column)
+		}
+	}
+
+	unchanged := base
+	unchanged.Topic, unchanged.ProjectID = "another topic", 42
+	if ContentHash(unchanged) != ContentHash(base) {
+		t.Error("the topic and project change the hash")
+	}
+}
+
+func TestUpdatePaperContentAbstract(t *testing.T) {
+	dbPool, project := testProject(t)
+	ctx := context.Background()
+
+	paper := testPaper(project, Arxiv, "2401.00001v1")
+	abstract := "the abstract"
+	paper.Abstract = &abstract
+	if err := InsertIntoDb(ctx, dbPool, &paper); err != nil {
+		t.Fatal(err)
+	}
+	if updated, err := UpdatePaperContent(ctx, dbPool, project.ID, paper); err != nil || updated {
+		t.Fatalf("updated=%t err=%v, want the unchanged paper left alone", updated, err)
+	}
+
+	revised := "the revised abstract"
+	paper.Abstract = &revised
+	updated, err := UpdatePaperContent(ctx, dbPool, project.ID, paper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated {
+		t.Fatal("the paper with a changed abstract wasn't updated")
+	}
+
+	var stored string
+	if err := dbPool.QueryRow(ctx, `SELECT abstract FROM research_papers WHERE id = $1;`, paper.ID).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored != revised {
+		t.Errorf("abstract=%q, want %q", stored, revised)
+	}
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TitleCandidate struct {
+	ID    uint64
+	Title string
+	DOI   *string
+}
+
+type DuplicateReview struct {
+	ID             uint64
+	PaperID        uint64
+	PaperTitle     string
+	CandidateID    uint64
+	CandidateTitle string
+	Score          float64
+	CreatedAt      time.Time
+}
+
+const (
+	ReviewPending  = "pending"
+	ReviewMerged   = "merged"
+	ReviewDistinct = "distinct"
+)
+
+func FindPaperByDOI(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, doi string) (uint64, bool, error) {
+	var id uint64
+	err := dbPool.QueryRow(ctx, `
+		SELECT id FROM research_papers
+		WHERE project_id = $1 AND lower(doi) = lower($2)
+		LIMIT 1;
+	`, projectID, doi).Scan(&id)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to look up doi: %w", err)
+	}
+	return id, true, nil
+}
+
+// FindSimilarTitles returns up to limit papers whose trigram similarity to title is at least minSimilarity.
+func FindSimilarTitles(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, title string, minSimilarity float64, limit int) ([]TitleCandidate, error) {
+	// NOTE: `%` uses the trigram index (pg_trgm.similarity_threshold, 0.3 by default), similarity() narrows it down
+	rows, err := dbPool.Query(ctx, `
+		SELECT id, title, doi
+		FROM research_papers
+		WHERE project_id = $1
+			AND lower(title) % lower($2)
+			AND similarity(lower(title), lower($2)) >= $3
+		ORDER BY similarity(lower(title), lower($2)) DESC
+		LIMIT $4;
+	`, projectID, title, minSimilarity, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find similar titles: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []TitleCandidate
+	for rows.Next() {
+		var c TitleCandidate
+		if err := rows.Scan(&c.ID, &c.Title, &c.DOI); err != nil {
+			return nil, fmt.Errorf("failed to scan candidate: %w", err)
+		}
+		candidates = append(candidates, c)
+	}
+
+	return candidates, rows.Err()
+}
+
+func InsertDuplicateReview(ctx context.Context, dbPool *pgxpool.Pool, projectID, paperID, candidateID uint64, score float64) error {
+	_, err := dbPool.Exec(ctx, `
+		INSERT INTO duplicate_reviews (project_id, paper_id, candidate_id, score)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (paper_id, candidate_id) DO NOTHING;
+	`, projectID, paperID, candidateID, score)
+	if err != nil {
+		return fmt.Errorf("failed to queue duplicate review: %w", err)
+	}
+	return nil
+}
+
+func ListPendingDuplicateReviews(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64) ([]DuplicateReview, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT r.id, r.paper_id, p.title, r.candidate_id, c.title, r.score, r.created_at
+		FROM duplicate_reviews r
+		JOIN research_papers p ON p.id = r.paper_id
+		JOIN research_papers c ON c.id = r.candidate_id
+		WHERE r.project_id = $1 AND r.status = $2
+		ORDER BY r.score DESC;
+	`, projectID, ReviewPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list duplicate reviews: %w", err)
+	}
+	defer rows.Close()
+
+	var reviews []DuplicateReview
+	for rows.Next() {
+		var r DuplicateReview
+		if err := rows.Scan(&r.ID, &r.PaperID, &r.PaperTitle, &r.CandidateID, &r.CandidateTitle, &r.Score, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan duplicate review: %w", err)
+		}
+		reviews = append(reviews, r)
+	}
+
+	return reviews, rows.Err()
+}
+
+// ResolveDuplicateReview marks a review as merged (the newer paper is deleted) or distinct.
+func ResolveDuplicateReview(ctx context.Context, dbPool *pgxpool.Pool, projectID, reviewID uint64, status string) error {
+	if status != ReviewMerged && status != ReviewDistinct {
+		return fmt.Errorf("invalid review status %q", status)
+	}
+
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var paperID, candidateID uint64
+	err = tx.QueryRow(ctx, `
+		UPDATE duplicate_reviews
+		SET status = $3, resolved_at = now()
+		WHERE id = $1 AND project_id = $2 AND status = 'pending'
+		RETURNING paper_id, candidate_id;
+	`, reviewID, projectID, status).Scan(&paperID, &candidateID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("no pending review with id=%d", reviewID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resolve review: %w", err)
+	}
+
+	if status == ReviewMerged {
+		if _, err := tx.Exec(ctx, `DELETE FROM research_papers WHERE id = $1;`, paperID); err != nil {
+			return fmt.Errorf("failed to delete merged paper: %w", err)
+		}
+		if err := insertPaperEvent(ctx, tx, projectID, candidateID, EventMerged, nil, &paperID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SparsePaper is a paper with a DOI that lacks its venue or publication date.
+type SparsePaper struct {
+	ID    uint64
+	DOI   string
+	Title string
+}
+
+// DOIMetadata is what the DOI registry has on a paper, empty fields are left as they are.
+type DOIMetadata struct {
+	// Title replaces the stored title, only set when it is the same title written better
+	Title     string
+	Venue     string
+	Publisher string
+	Issued    *time.Time
+}
+
+// PapersWithSparseMetadata returns up to limit papers with a DOI but no venue or publication
+// date that doi.org wasn't asked about yet.
+func PapersWithSparseMetadata(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, limit int) ([]SparsePaper, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT id, doi, title FROM research_papers
+		WHERE project_id = $1 AND doi IS NOT NULL AND csl_checked_at IS NULL
+			AND (COALESCE(venue, '') = '' OR published_on IS NULL)
+		ORDER BY id
+		LIMIT $2;
+	`, projectID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list papers with sparse metadata: %w", err)
+	}
+	defer rows.Close()
+
+	var papers []SparsePaper
+	for rows.Next() {
+		var p SparsePaper
+		if err := rows.Scan(&p.ID, &p.DOI, &p.Title); err != nil {
+			return nil, fmt.Errorf("failed to scan sparse paper: %w", err)
+		}
+		papers = append(papers, p)
+	}
+	return papers, rows.Err()
+}
+
+// SaveDOIMetadata fills in what a paper is missing from m and marks it checked, nil only
+// marks it. A title another paper already has is left alone.
+func SaveDOIMetadata(ctx context.Context, dbPool *pgxpool.Pool, paperID uint64, m *DOIMetadata) error {
+	if m == nil {
+		m = &DOIMetadata{}
+	}
+
+	_, err := dbPool.Exec(ctx, `
+		UPDATE research_papers p
+		SET venue = COALESCE(NULLIF(p.venue, ''), NULLIF($2, '')),
+		    publisher = COALESCE(p.publisher, NULLIF($3, '')),
+		    published_on = COALESCE(p.published_on, $4),
+		    title = CASE
+		        WHEN $5 = '' OR EXISTS (SELECT 1 FROM research_papers o WHERE o.title = $5 AND o.id <> p.id) THEN p.title
+		        ELSE $5
+		    END,
+		    csl_checked_at = now()
+		WHERE p.id = $1;
+	`, paperID, m.Venue, m.Publisher, m.Issued, m.Title)
+	if err != nil {
+		return fmt.Errorf("failed to save doi metadata of paper %d: %w", paperID, err)
+	}
+	return nil
+}
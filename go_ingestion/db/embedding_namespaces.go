@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultNamespace holds the vectors of the models the orchestrator routes papers to.
+const DefaultNamespace = "default"
+
+// namespaceName keeps namespaces usable in index names
+var namespaceName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+type EmbeddingNamespace struct {
+	Name  string `json:"name"`
+	Model string `json:"model"`
+	Dims  int    `json:"dims"`
+	// Vectors is how many vectors the namespace holds across projects
+	Vectors   int64     `json:"vectors"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RegisterNamespace adds a namespace the embed stage fills with model, and the partial
+// index similarity searches in it use. Registering it again changes nothing.
+func RegisterNamespace(ctx context.Context, dbPool *pgxpool.Pool, name, model string, dims int) error {
+	if !namespaceName.MatchString(name) || name == DefaultNamespace {
+		return fmt.Errorf("invalid namespace %q, use lowercase letters, digits and _", name)
+	}
+	if dims <= 0 {
+		return fmt.Errorf("namespace %q needs the dimensions of %s", name, model)
+	}
+
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO embedding_namespaces (name, model, dims)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO NOTHING;
+	`, name, model, dims)
+	if err != nil {
+		return fmt.Errorf("failed to register namespace %q: %w", name, err)
+	}
+
+	// NOTE: name and dims are checked above, an index can't take them as parameters. The
+	// cast gives the index the fixed dimensions pgvector needs, SimilarPapers casts the same
+	_, err = tx.Exec(ctx, fmt.Sprintf(`
+		CREATE INDEX IF NOT EXISTS embedding_vectors_%[1]s_hnsw ON embedding_vectors
+		USING hnsw ((embedding::vector(%[2]d)) vector_cosine_ops)
+		WHERE namespace = '%[1]s';
+	`, name, dims))
+	if err != nil {
+		return fmt.Errorf("failed to index namespace %q: %w", name, err)
+	}
+	return tx.Commit(ctx)
+}
+
+// EmbeddingNamespaces returns the registered namespaces by name.
+func EmbeddingNamespaces(ctx context.Context, dbPool *pgxpool.Pool) ([]EmbeddingNamespace, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT n.name, n.model, n.dims,
+			(SELECT count(*) FROM embedding_vectors v WHERE v.namespace = n.name),
+			n.created_at
+		FROM embedding_namespaces n
+		ORDER BY n.name;
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list embedding namespaces: %w", err)
+	}
+	defer rows.Close()
+
+	var namespaces []EmbeddingNamespace
+	for rows.Next() {
+		var n EmbeddingNamespace
+		if err := rows.Scan(&n.Name, &n.Model, &n.Dims, &n.Vectors, &n.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan embedding namespace: %w", err)
+		}
+		namespaces = append(namespaces, n)
+	}
+	return namespaces, rows.Err()
+}
+
+// namespaceDims returns the dimensions of a registered namespace, 0 for default and
+// namespaces that aren't registered.
+func namespaceDims(ctx context.Context, dbPool *pgxpool.Pool, namespace string) (int, error) {
+	if namespace == DefaultNamespace {
+		return 0, nil
+	}
+	var dims int
+	err := dbPool.QueryRow(ctx, `
+		SELECT COALESCE((SELECT dims FROM embedding_namespaces WHERE name = $1), 0);
+	`, namespace).Scan(&dims)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up namespace %q: %w", namespace, err)
+	}
+	return dims, nil
+}
+
+func orDefaultNamespace(namespace string) string {
+	if namespace == "" {
+		return DefaultNamespace
+	}
+	return namespace
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Embedding is a vector and what it belongs to, ChunkID and ChunkIndex are 0 for paper
+// embeddings.
+type Embedding struct {
+	ChunkID    int64       `json:"chunk_id,omitempty"`
+	ChunkIndex int         `json:"chunk_index,omitempty"`
+	PaperID    uint64      `json:"paper_id"`
+	Source     PaperSource `json:"source"`
+	Title      string      `json:"title"`
+	DOI        *string     `json:"doi,omitempty"`
+	Topic      string      `json:"topic"`
+	Vector     []float32   `json:"-"`
+}
+
+// ForEachChunkEmbedding calls fn with every chunk vector of the project in namespace (default
+// when empty), by paper then chunk.
+func ForEachChunkEmbedding(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, namespace string, fn func(Embedding) error) error {
+	return forEachEmbedding(ctx, dbPool, `
+		SELECT c.id, c.chunk_index, p.id, p.source, p.title, p.doi, p.topic, v.embedding::real[]
+		FROM embedding_vectors v
+		JOIN embedding_chunks c ON c.id = v.embedding_chunk_id
+		JOIN research_papers p ON p.id = c.paper_id
+		WHERE p.project_id = $1 AND v.namespace = $2
+		ORDER BY p.id, c.chunk_index;
+	`, projectID, namespace, fn)
+}
+
+// ForEachPaperEmbedding calls fn with one vector per embedded paper of the project in
+// namespace (default when empty), the mean of its chunk vectors.
+func ForEachPaperEmbedding(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, namespace string, fn func(Embedding) error) error {
+	return forEachEmbedding(ctx, dbPool, `
+		SELECT 0::bigint, 0, p.id, p.source, p.title, p.doi, p.topic, avg(v.embedding)::real[]
+		FROM embedding_vectors v
+		JOIN embedding_chunks c ON c.id = v.embedding_chunk_id
+		JOIN research_papers p ON p.id = c.paper_id
+		WHERE p.project_id = $1 AND v.namespace = $2
+		GROUP BY p.id
+		ORDER BY p.id;
+	`, projectID, namespace, fn)
+}
+
+func forEachEmbedding(ctx context.Context, dbPool *pgxpool.Pool, query string, projectID uint64, namespace string, fn func(Embedding) error) error {
+	rows, err := dbPool.Query(ctx, query, projectID, orDefaultNamespace(namespace))
+	if err != nil {
+		return fmt.Errorf("failed to query embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e Embedding
+		if err := rows.Scan(&e.ChunkID, &e.ChunkIndex, &e.PaperID, &e.Source, &e.Title, &e.DOI, &e.Topic, &e.Vector); err != nil {
+			return fmt.Errorf("failed to scan embedding: %w", err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PaperEventKind string
+
+const (
+	EventIngested      PaperEventKind = "ingested"
+	EventPDFDownloaded PaperEventKind = "pdf_downloaded"
+	EventChunked       PaperEventKind = "chunked"
+	EventEmbedded      PaperEventKind = "embedded"
+	EventMerged        PaperEventKind = "merged"
+	EventRetracted     PaperEventKind = "retracted"
+)
+
+// statusEvents are the stages whose papers get an event when they reach them
+var statusEvents = map[PaperStatus]PaperEventKind{
+	StatusDownloaded: EventPDFDownloaded,
+	StatusChunked:    EventChunked,
+	StatusEmbedded:   EventEmbedded,
+}
+
+type PaperEvent struct {
+	ID        uint64         `json:"id"`
+	PaperID   uint64         `json:"paper_id"`
+	Kind      PaperEventKind `json:"kind"`
+	Source    *PaperSource   `json:"source,omitempty"`
+	MergedID  *uint64        `json:"merged_id,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// insertPaperEvent records an event inside the transaction that made the change, so the
+// feed never shows changes that were rolled back.
+func insertPaperEvent(ctx context.Context, tx pgx.Tx, projectID, paperID uint64, kind PaperEventKind, source *PaperSource, mergedID *uint64) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO paper_events (project_id, paper_id, kind, source, merged_id)
+		VALUES ($1, $2, $3, $4, $5);
+	`, projectID, paperID, kind, source, mergedID)
+	if err != nil {
+		return fmt.Errorf("failed to record %s event of paper %d: %w", kind, paperID, err)
+	}
+	return nil
+}
+
+// PaperEvents returns up to limit events of the project that come after the event with id
+// after, all of them when after is 0. Pass the id of the last event as after to poll for
+// the next ones.
+//
+// NOTE: ids are taken before their transaction commits, so polling by id alone could skip
+// an event of a slow transaction. Events are ordered by transaction instead and held back
+// until every older transaction finished, so nothing shows up behind a cursor later.
+func PaperEvents(ctx context.Context, dbPool *pgxpool.Pool, projectID, after uint64, limit int) ([]PaperEvent, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT id, paper_id, kind, source, merged_id, created_at
+		FROM paper_events
+		WHERE project_id = $1
+		  AND txid < pg_snapshot_xmin(pg_current_snapshot())
+		  AND ($2::bigint = 0 OR (txid, id) > (SELECT txid, id FROM paper_events WHERE id = $2))
+		ORDER BY txid, id
+		LIMIT $3;
+	`, projectID, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list paper events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []PaperEvent
+	for rows.Next() {
+		var e PaperEvent
+		if err := rows.Scan(&e.ID, &e.PaperID, &e.Kind, &e.Source, &e.MergedID, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan paper event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SourceHealth struct {
+	Source    PaperSource `db:"source"`
+	Healthy   bool        `db:"healthy"`
+	LastError *string     `db:"last_error"`
+	CheckedAt time.Time   `db:"checked_at"`
+}
+
+func RecordSourceHealth(ctx context.Context, dbPool *pgxpool.Pool, source PaperSource, healthy bool, lastError *string) error {
+	query := `
+		INSERT INTO source_health (source, healthy, last_error, checked_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (source)
+		DO UPDATE SET healthy = EXCLUDED.healthy, last_error = EXCLUDED.last_error, checked_at = EXCLUDED.checked_at;
+	`
+
+	if _, err := dbPool.Exec(ctx, query, source, healthy, lastError); err != nil {
+		return fmt.Errorf("failed to record %s health: %w", source, err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Identifier is an id a paper has in a scheme other than its source's, DOIs stay in
+// research_papers.doi.
+type Identifier struct {
+	Scheme string `json:"scheme"`
+	Value  string `json:"value"`
+}
+
+// SavePaperIdentifiers records the identifiers of paper id, values another paper of the
+// project already has are left to that paper.
+func SavePaperIdentifiers(ctx context.Context, dbPool *pgxpool.Pool, projectID, paperID uint64, identifiers []Identifier) error {
+	schemes := make([]string, len(identifiers))
+	values := make([]string, len(identifiers))
+	for i, id := range identifiers {
+		schemes[i], values[i] = id.Scheme, id.Value
+	}
+
+	_, err := dbPool.Exec(ctx, `
+		INSERT INTO paper_identifiers (paper_id, project_id, scheme, value)
+		SELECT $1, $2, i.scheme, i.value
+		FROM unnest($3::text[], $4::text[]) AS i(scheme, value)
+		ON CONFLICT DO NOTHING;
+	`, paperID, projectID, schemes, values)
+	if err != nil {
+		return fmt.Errorf("failed to save identifiers of paper %d: %w", paperID, err)
+	}
+	return nil
+}
+
+// FindPaperByIdentifier returns the paper of the project that has value in scheme.
+func FindPaperByIdentifier(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, scheme, value string) (uint64, bool, error) {
+	var id uint64
+	err := dbPool.QueryRow(ctx, `
+		SELECT paper_id FROM paper_identifiers
+		WHERE project_id = $1 AND scheme = $2 AND value = $3;
+	`, projectID, scheme, value).Scan(&id)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to look up %s %s: %w", scheme, value, err)
+	}
+	return id, true, nil
+}
+
+// FindPaperByIdentifiers returns the first paper of the project sharing any of identifiers.
+func FindPaperByIdentifiers(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, identifiers []Identifier) (uint64, bool, error) {
+	for _, identifier := range identifiers {
+		id, found, err := FindPaperByIdentifier(ctx, dbPool, projectID, identifier.Scheme, identifier.Value)
+		if err != nil || found {
+			return id, found, err
+		}
+	}
+	return 0, false, nil
+}
+
+func PaperIdentifiers(ctx context.Context, dbPool *pgxpool.Pool, projectID, paperID uint64) ([]Identifier, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT scheme, value FROM paper_identifiers
+		WHERE project_id = $1 AND paper_id = $2
+		ORDER BY scheme, value;
+	`, projectID, paperID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identifiers of paper %d: %w", paperID, err)
+	}
+	defer rows.Close()
+
+	var identifiers []Identifier
+	for rows.Next() {
+		var id Identifier
+		if err := rows.Scan(&id.Scheme, &id.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan identifier: %w", err)
+		}
+		identifiers = append(identifiers, id)
+	}
+	return identifiers, rows.Err()
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	IntentStarted   = "started"
+	IntentRedriving = "redriving"
+	IntentDone      = "done"
+	IntentSkipped   = "skipped"
+	// IntentInterrupted is a page the run stopped before on shutdown, the checkpoint of
+	// its query points at it so it isn't re-driven
+	IntentInterrupted = "interrupted"
+)
+
+// PageIntent is a page a worker was about to fetch and save.
+type PageIntent struct {
+	ID         uint64
+	RunID      *uint64
+	Source     PaperSource
+	Query      string
+	WindowFrom *time.Time
+	WindowTo   *time.Time
+	Offset     uint64
+	Limit      uint64
+	StartedAt  time.Time
+}
+
+// BeginPageIntent is written before a page is fetched, FinishPageIntent once it is saved.
+func BeginPageIntent(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, intent PageIntent) (uint64, error) {
+	query := `
+		INSERT INTO page_intents (project_id, run_id, source, query, window_from, window_to, page_offset, page_limit)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id;
+	`
+
+	var id uint64
+	err := dbPool.QueryRow(ctx, query, projectID, intent.RunID, intent.Source, intent.Query, intent.WindowFrom, intent.WindowTo, intent.Offset, intent.Limit).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write page intent: %w", err)
+	}
+	return id, nil
+}
+
+func FinishPageIntent(ctx context.Context, dbPool *pgxpool.Pool, id uint64, status string) error {
+	if _, err := dbPool.Exec(ctx, `UPDATE page_intents SET status = $2, finished_at = now() WHERE id = $1;`, id, status); err != nil {
+		return fmt.Errorf("failed to finish page intent %d: %w", id, err)
+	}
+	return nil
+}
+
+// ClaimAbandonedIntent hands out one abandoned intent: still started although its run
+// finished, or started longer than abandonAfter ago (the process died without finishing
+// the run). A claim that isn't finished within abandonAfter can be claimed again. ok is
+// false when there is nothing left to re-drive.
+func ClaimAbandonedIntent(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, sources []string, abandonAfter time.Duration) (PageIntent, bool, error) {
+	query := `
+		UPDATE page_intents SET status = 'redriving', started_at = now()
+		WHERE id = (
+			SELECT i.id
+			FROM page_intents i
+			LEFT JOIN runs r ON r.id = i.run_id
+			WHERE i.project_id = $1 AND i.source::text = ANY($2)
+			  AND ((i.status = 'started' AND r.finished_at IS NOT NULL) OR i.started_at < now() - $3)
+			  AND i.status IN ('started', 'redriving')
+			ORDER BY i.id
+			LIMIT 1
+			FOR UPDATE OF i SKIP LOCKED
+		)
+		RETURNING id, run_id, source, query, window_from, window_to, page_offset, page_limit, started_at;
+	`
+
+	var i PageIntent
+	err := dbPool.QueryRow(ctx, query, projectID, sources, abandonAfter).Scan(&i.ID, &i.RunID, &i.Source, &i.Query, &i.WindowFrom, &i.WindowTo, &i.Offset, &i.Limit, &i.StartedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return i, false, nil
+	}
+	if err != nil {
+		return i, false, fmt.Errorf("failed to claim page intent: %w", err)
+	}
+	return i, true, nil
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+type Job struct {
+	ID        uint64          `db:"id"`
+	ProjectID uint64          `db:"project_id"`
+	Kind      string          `db:"kind"`
+	Payload   json.RawMessage `db:"payload"`
+	Attempts  int             `db:"attempts"`
+	CreatedAt time.Time       `db:"created_at"`
+}
+
+// EnqueueJobIfIdle queues a job unless one of the same kind and payload is already
+// queued or running, so a scheduler firing twice doesn't double the work.
+func EnqueueJobIfIdle(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, kind string, payload any, priority int) (bool, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal job payload: %w", err)
+	}
+
+	tag, err := dbPool.Exec(ctx, `
+		INSERT INTO jobs (project_id, kind, payload, priority)
+		SELECT $1, $2, $3, $4
+		WHERE NOT EXISTS (
+			SELECT 1 FROM jobs
+			WHERE project_id = $1 AND kind = $2 AND payload = $3 AND status IN ('queued', 'running')
+		);
+	`, projectID, kind, payloadJSON, priority)
+	if err != nil {
+		return false, fmt.Errorf("failed to enqueue %s job: %w", kind, err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// ClaimJob takes the highest priority runnable job of the project, oldest first, nil when there is none.
+// The worker holds it for lease, see RenewJobLease. A running job whose lease ran out lost
+// its worker, it is claimed again until it was claimed maxAttempts times and failed after that.
+func ClaimJob(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, workerID string, lease time.Duration, maxAttempts int) (*Job, error) {
+	// NOTE: failed, not left running, so EnqueueJobIfIdle queues its kind again
+	tag, err := dbPool.Exec(ctx, `
+		UPDATE jobs
+		SET status = 'failed', last_error = 'lease expired, the worker running it stopped', locked_by = NULL, lease_until = NULL, updated_at = now()
+		WHERE project_id = $1 AND status = 'running' AND lease_until < now() AND attempts >= $2;
+	`, projectID, maxAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fail expired jobs: %w", err)
+	}
+	if n := tag.RowsAffected(); n > 0 {
+		log.Printf("[JOBS] failed %d jobs whose lease expired %d times", n, maxAttempts)
+	}
+
+	var job Job
+	err = dbPool.QueryRow(ctx, `
+		UPDATE jobs
+		SET status = 'running', locked_by = $2, attempts = attempts + 1,
+		    lease_until = now() + make_interval(secs => $3), updated_at = now()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE project_id = $1 AND run_after <= now()
+			  AND (status = 'queued' OR (status = 'running' AND lease_until < now() AND attempts < $4))
+			ORDER BY priority DESC, run_after, id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, project_id, kind, payload, attempts, created_at;
+	`, projectID, workerID, lease.Seconds(), maxAttempts).Scan(&job.ID, &job.ProjectID, &job.Kind, &job.Payload, &job.Attempts, &job.CreatedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	return &job, nil
+}
+
+// RenewJobLease extends the lease of a job workerID is running, false when the lease already
+// ran out and the job went to another worker.
+func RenewJobLease(ctx context.Context, dbPool *pgxpool.Pool, id uint64, workerID string, lease time.Duration) (bool, error) {
+	tag, err := dbPool.Exec(ctx, `
+		UPDATE jobs
+		SET lease_until = now() + make_interval(secs => $3)
+		WHERE id = $1 AND locked_by = $2 AND status = 'running';
+	`, id, workerID, lease.Seconds())
+	if err != nil {
+		return false, fmt.Errorf("failed to renew lease of job id=%d: %w", id, err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// FinishJob marks a job workerID ran as done or, with jobErr, failed. A job that went to
+// another worker in the meantime is left to it.
+func FinishJob(ctx context.Context, dbPool *pgxpool.Pool, id uint64, workerID string, jobErr error) error {
+	status, lastError := JobDone, (*string)(nil)
+	if jobErr != nil {
+		msg := jobErr.Error()
+		status, lastError = JobFailed, &msg
+	}
+
+	tag, err := dbPool.Exec(ctx, `
+		UPDATE jobs
+		SET status = $2, last_error = $3, locked_by = NULL, lease_until = NULL, updated_at = now()
+		WHERE id = $1 AND locked_by = $4 AND status = 'running';
+	`, id, status, lastError, workerID)
+	if err != nil {
+		return fmt.Errorf("failed to finish job id=%d: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("job id=%d isn't held by %s anymore, its lease expired", id, workerID)
+	}
+	return nil
+}
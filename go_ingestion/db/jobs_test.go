@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJobClaimFinish(t *testing.T) {
+	dbPool, project := testProject(t)
+	ctx := context.Background()
+
+	queued, err := EnqueueJobIfIdle(ctx, dbPool, project.ID, "gc", struct{}{}, 0)
+	if err != nil || !queued {
+		t.Fatalf("queued=%t err=%v, want the job queued", queued, err)
+	}
+	if queued, err := EnqueueJobIfIdle(ctx, dbPool, project.ID, "gc", struct{}{}, 0); err != nil || queued {
+		t.Fatalf("queued=%t err=%v, want the queued job to stop a second one", queued, err)
+	}
+
+	job, err := ClaimJob(ctx, dbPool, project.ID, "worker-1", time.Minute, 3)
+	if err != nil || job == nil {
+		t.Fatalf("job=%v err=%v, want the queued job", job, err)
+	}
+	if job.Kind != "gc" || job.Attempts != 1 {
+		t.Errorf("claimed kind=%s attempts=%d, want gc after 1 attempt", job.Kind, job.Attempts)
+	}
+	if other, err := ClaimJob(ctx, dbPool, project.ID, "worker-2", time.Minute, 3); err != nil || other != nil {
+		t.Fatalf("job=%v err=%v, want a running job with a lease left alone", other, err)
+	}
+	if queued, err := EnqueueJobIfIdle(ctx, dbPool, project.ID, "gc", struct{}{}, 0); err != nil || queued {
+		t.Fatalf("queued=%t err=%v, want the running job to stop a second one", queued, err)
+	}
+	if held, err := RenewJobLease(ctx, dbPool, job.ID, "worker-1", time.Minute); err != nil || !held {
+		t.Fatalf("held=%t err=%v, want the lease renewed", held, err)
+	}
+
+	if err := FinishJob(ctx, dbPool, job.ID, "worker-1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if queued, err := EnqueueJobIfIdle(ctx, dbPool, project.ID, "gc", struct{}{}, 0); err != nil || !queued {
+		t.Fatalf("queued=%t err=%v, want a finished job to allow the next one", queued, err)
+	}
+}
+
+// NOTE: a lease of a millisecond is over before the next statement
+func TestJobLeaseExpired(t *testing.T) {
+	dbPool, project := testProject(t)
+	ctx := context.Background()
+
+	if _, err := EnqueueJobIfIdle(ctx, dbPool, project.ID, "gc", struct{}{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	crashed, err := ClaimJob(ctx, dbPool, project.ID, "worker-1", time.Millisecond, 2)
+	if err != nil || crashed == nil {
+		t.Fatalf("job=%v err=%v, want the queued job", crashed, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// the job of a worker that stopped renewing it is claimed again
+	requeued, err := ClaimJob(ctx, dbPool, project.ID, "worker-2", time.Millisecond, 2)
+	if err != nil || requeued == nil {
+		t.Fatalf("job=%v err=%v, want the expired job claimed again", requeued, err)
+	}
+	if requeued.ID != crashed.ID || requeued.Attempts != 2 {
+		t.Errorf("claimed id=%d attempts=%d, want id=%d after 2 attempts", requeued.ID, requeued.Attempts, crashed.ID)
+	}
+	if held, err := RenewJobLease(ctx, dbPool, crashed.ID, "worker-1", time.Minute); err != nil || held {
+		t.Errorf("held=%t err=%v, want the first worker's lease gone", held, err)
+	}
+	if err := FinishJob(ctx, dbPool, crashed.ID, "worker-1", nil); err == nil {
+		t.Error("the first worker finished a job that went to another")
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// out of attempts it fails, and its schedule can queue it again
+	if job, err := ClaimJob(ctx, dbPool, project.ID, "worker-3", time.Minute, 2); err != nil || job != nil {
+		t.Fatalf("job=%v err=%v, want no job claimed a third time", job, err)
+	}
+	var status string
+	if err := dbPool.QueryRow(ctx, `SELECT status FROM jobs WHERE id = $1;`, crashed.ID).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != JobFailed {
+		t.Errorf("status=%s, want %s", status, JobFailed)
+	}
+	if queued, err := EnqueueJobIfIdle(ctx, dbPool, project.ID, "gc", struct{}{}, 0); err != nil || !queued {
+		t.Fatalf("queued=%t err=%v, want the failed job to allow the next one", queued, err)
+	}
+	if err := FinishJob(ctx, dbPool, crashed.ID, "worker-2", errors.New("too late")); err == nil {
+		t.Error("the second worker finished a job that already failed")
+	}
+}
+
+func TestJobFailed(t *testing.T) {
+	dbPool, project := testProject(t)
+	ctx := context.Background()
+
+	if _, err := EnqueueJobIfIdle(ctx, dbPool, project.ID, "gc", struct{}{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	job, err := ClaimJob(ctx, dbPool, project.ID, "worker-1", time.Minute, 3)
+	if err != nil || job == nil {
+		t.Fatalf("job=%v err=%v, want the queued job", job, err)
+	}
+	if err := FinishJob(ctx, dbPool, job.ID, "worker-1", errors.New("disk full")); err != nil {
+		t.Fatal(err)
+	}
+
+	var status, lastError string
+	if err := dbPool.QueryRow(ctx, `SELECT status, last_error FROM jobs WHERE id = $1;`, job.ID).Scan(&status, &lastError); err != nil {
+		t.Fatal(err)
+	}
+	if status != JobFailed || lastError != "disk full" {
+		t.Errorf("status=%s last_error=%q, want %s with the handler's error", status, lastError, JobFailed)
+	}
+	if other, err := ClaimJob(ctx, dbPool, project.ID, "worker-2", time.Minute, 3); err != nil || other != nil {
+		t.Fatalf("job=%v err=%v, want a failed job left alone", other, err)
+	}
+	if queued, err := EnqueueJobIfIdle(ctx, dbPool, project.ID, "gc", struct{}{}, 0); err != nil || !queued {
+		t.Fatalf("queued=%t err=%v, want the failed job to allow the next one", queued, err)
+	}
+}
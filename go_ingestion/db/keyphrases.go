@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ChunkText is a chunk waiting for keyphrases, Language is its paper's ("" when unknown).
+type ChunkText struct {
+	ID       int64
+	PaperID  uint64
+	Language string
+	Content  string
+}
+
+// Keyphrase is a phrase of a chunk and its score.
+type Keyphrase struct {
+	Phrase string
+	Score  float64
+}
+
+// ChunksWithoutKeyphrases returns up to limit chunks of the project whose keyphrases
+// weren't extracted yet, oldest first.
+func ChunksWithoutKeyphrases(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, limit int) ([]ChunkText, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT c.id, c.paper_id, COALESCE(p.language, ''), c.content
+		FROM embedding_chunks c
+		JOIN research_papers p ON p.id = c.paper_id
+		WHERE p.project_id = $1 AND c.keyphrases_at IS NULL
+		ORDER BY c.id
+		LIMIT $2;
+	`, projectID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunks without keyphrases: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []ChunkText
+	for rows.Next() {
+		var c ChunkText
+		if err := rows.Scan(&c.ID, &c.PaperID, &c.Language, &c.Content); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, rows.Err()
+}
+
+// SaveKeyphrases replaces the keyphrases of a chunk and marks it extracted, also when
+// phrases is empty so it isn't picked up again.
+func SaveKeyphrases(ctx context.Context, dbPool *pgxpool.Pool, chunkID int64, paperID uint64, phrases []Keyphrase) error {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM chunk_keyphrases WHERE chunk_id = $1;`, chunkID); err != nil {
+		return fmt.Errorf("failed to clear keyphrases of chunk %d: %w", chunkID, err)
+	}
+
+	if len(phrases) > 0 {
+		texts := make([]string, len(phrases))
+		scores := make([]float64, len(phrases))
+		for i, p := range phrases {
+			texts[i], scores[i] = p.Phrase, p.Score
+		}
+		_, err := tx.Exec(ctx, `
+			INSERT INTO chunk_keyphrases (chunk_id, paper_id, phrase, score)
+			SELECT $1, $2, phrase, score
+			FROM unnest($3::text[], $4::real[]) AS k(phrase, score)
+			ON CONFLICT DO NOTHING;
+		`, chunkID, paperID, texts, scores)
+		if err != nil {
+			return fmt.Errorf("failed to save keyphrases of chunk %d: %w", chunkID, err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE embedding_chunks SET keyphrases_at = now() WHERE id = $1;`, chunkID); err != nil {
+		return fmt.Errorf("failed to mark chunk %d: %w", chunkID, err)
+	}
+	return tx.Commit(ctx)
+}
+
+// KeyphraseCount is a phrase with how many papers and chunks it was extracted from.
+type KeyphraseCount struct {
+	Phrase string
+	Papers int
+	Chunks int
+	// Score sums the scores of the phrase over its chunks
+	Score float64
+}
+
+// TopKeyphrases returns the n phrases of the project found in the most papers, all topics
+// when topic is "".
+func TopKeyphrases(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, topic string, n int) ([]KeyphraseCount, error) {
+	return keyphraseCounts(ctx, dbPool, `
+		SELECT k.phrase, count(DISTINCT k.paper_id), count(*), sum(k.score)
+		FROM chunk_keyphrases k
+		JOIN research_papers p ON p.id = k.paper_id
+		WHERE p.project_id = $1 AND ($2 = '' OR p.topic = $2)
+		GROUP BY k.phrase
+		ORDER BY 2 DESC, 4 DESC
+		LIMIT $3;
+	`, projectID, topic, n)
+}
+
+// PaperKeyphrases returns the n best scored phrases over the chunks of a paper.
+func PaperKeyphrases(ctx context.Context, dbPool *pgxpool.Pool, projectID, paperID uint64, n int) ([]KeyphraseCount, error) {
+	return keyphraseCounts(ctx, dbPool, `
+		SELECT k.phrase, 1, count(*), sum(k.score)
+		FROM chunk_keyphrases k
+		JOIN research_papers p ON p.id = k.paper_id
+		WHERE p.project_id = $1 AND p.id = $2
+		GROUP BY k.phrase
+		ORDER BY 4 DESC
+		LIMIT $3;
+	`, projectID, paperID, n)
+}
+
+func keyphraseCounts(ctx context.Context, dbPool *pgxpool.Pool, query string, args ...any) ([]KeyphraseCount, error) {
+	rows, err := dbPool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count keyphrases: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []KeyphraseCount
+	for rows.Next() {
+		var c KeyphraseCount
+		if err := rows.Scan(&c.Phrase, &c.Papers, &c.Chunks, &c.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan keyphrase count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// KeyphrasePaper is a paper a phrase was extracted from.
+type KeyphrasePaper struct {
+	ID     uint64
+	Source PaperSource
+	Title  string
+	Chunks int
+	Score  float64
+}
+
+// PapersWithKeyphrase returns up to n papers of the project the phrase was extracted from,
+// best scored first.
+func PapersWithKeyphrase(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, phrase string, n int) ([]KeyphrasePaper, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT p.id, p.source, p.title, count(*), sum(k.score)
+		FROM chunk_keyphrases k
+		JOIN research_papers p ON p.id = k.paper_id
+		WHERE p.project_id = $1 AND k.phrase = lower($2)
+		GROUP BY p.id
+		ORDER BY 5 DESC
+		LIMIT $3;
+	`, projectID, phrase, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find papers with keyphrase %q: %w", phrase, err)
+	}
+	defer rows.Close()
+
+	var papers []KeyphrasePaper
+	for rows.Next() {
+		var p KeyphrasePaper
+		if err := rows.Scan(&p.ID, &p.Source, &p.Title, &p.Chunks, &p.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan paper: %w", err)
+		}
+		papers = append(papers, p)
+	}
+	return papers, rows.Err()
+}
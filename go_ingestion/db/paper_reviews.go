@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// PaperReview is a paper waiting for a curator, Paper is what is stored when it is approved.
+type PaperReview struct {
+	ID        uint64
+	Source    PaperSource
+	SourceID  string
+	Title     string
+	Reasons   []string
+	Status    string
+	Paper     ResearchPaper
+	CreatedAt time.Time
+}
+
+// HoldForReview queues paper for a curator instead of storing it. A paper that was held
+// before keeps its review, so rejected papers aren't asked about again.
+func HoldForReview(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, paper ResearchPaper, reasons []string) error {
+	if paper.SourceID == nil {
+		return fmt.Errorf("paper %q has no source id to review it by", paper.Title)
+	}
+	data, err := json.Marshal(paper)
+	if err != nil {
+		return fmt.Errorf("failed to encode paper for review: %w", err)
+	}
+
+	_, err = dbPool.Exec(ctx, `
+		INSERT INTO paper_reviews (project_id, source, source_id, title, reasons, paper)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (project_id, source, source_id) DO NOTHING;
+	`, projectID, paper.Source, *paper.SourceID, paper.Title, reasons, data)
+	if err != nil {
+		return fmt.Errorf("failed to hold paper for review: %w", err)
+	}
+	return nil
+}
+
+// PendingPaperReviews returns up to limit papers waiting for a curator, oldest first.
+func PendingPaperReviews(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, limit int) ([]PaperReview, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT id, source, source_id, title, reasons, status, paper, created_at
+		FROM paper_reviews
+		WHERE project_id = $1 AND status = $2
+		ORDER BY id
+		LIMIT $3;
+	`, projectID, ReviewPending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list paper reviews: %w", err)
+	}
+	defer rows.Close()
+
+	var reviews []PaperReview
+	for rows.Next() {
+		r, err := scanPaperReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, r)
+	}
+	return reviews, rows.Err()
+}
+
+// DecidePaperReview sets a pending review to approved or rejected and returns it. Approved
+// papers are then stored by the caller, see PaperStore.SaveApproved.
+func DecidePaperReview(ctx context.Context, dbPool *pgxpool.Pool, projectID, reviewID uint64, status string) (PaperReview, error) {
+	if status != ReviewApproved && status != ReviewRejected {
+		return PaperReview{}, fmt.Errorf("invalid review status %q", status)
+	}
+
+	r, err := scanPaperReview(dbPool.QueryRow(ctx, `
+		UPDATE paper_reviews
+		SET status = $3, decided_at = now()
+		WHERE id = $1 AND project_id = $2 AND status = 'pending'
+		RETURNING id, source, source_id, title, reasons, status, paper, created_at;
+	`, reviewID, projectID, status))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return PaperReview{}, fmt.Errorf("no pending paper review with id=%d", reviewID)
+	}
+	return r, err
+}
+
+// ReopenPaperReview puts a decided review back to pending, e.g. when storing an approved
+// paper failed.
+func ReopenPaperReview(ctx context.Context, dbPool *pgxpool.Pool, projectID, reviewID uint64) error {
+	_, err := dbPool.Exec(ctx, `
+		UPDATE paper_reviews SET status = 'pending', decided_at = NULL
+		WHERE id = $1 AND project_id = $2;
+	`, reviewID, projectID)
+	if err != nil {
+		return fmt.Errorf("failed to reopen paper review %d: %w", reviewID, err)
+	}
+	return nil
+}
+
+func scanPaperReview(row pgx.Row) (PaperReview, error) {
+	var (
+		r    PaperReview
+		data []byte
+	)
+	if err := row.Scan(&r.ID, &r.Source, &r.SourceID, &r.Title, &r.Reasons, &r.Status, &data, &r.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return r, err
+		}
+		return r, fmt.Errorf("failed to scan paper review: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.Paper); err != nil {
+		return r, fmt.Errorf("failed to decode paper of review %d: %w", r.ID, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PublicPaper is what the API shows of a paper, without its raw metadata and provenance.
+type PublicPaper struct {
+	ID         uint64      `json:"id"`
+	Source     PaperSource `json:"source"`
+	SourceID   *string     `json:"source_id,omitempty"`
+	Title      string      `json:"title"`
+	Authors    []string    `json:"authors"`
+	DOI        *string     `json:"doi,omitempty"`
+	Topic      string      `json:"topic"`
+	PDFURL     string      `json:"pdf_url"`
+	License    *string     `json:"license,omitempty"`
+	TLDR       *string     `json:"tldr,omitempty"`
+	Abstract   *string     `json:"abstract,omitempty"`
+	Conference *string     `json:"conference,omitempty"`
+	Language   *string     `json:"language,omitempty"`
+	Keywords   []string    `json:"keywords,omitempty"`
+	Status     PaperStatus `json:"status"`
+	CreatedAt  time.Time   `json:"created_at"`
+	// Rank is only set by searches, higher matches better
+	Rank float64 `json:"rank,omitempty"`
+}
+
+// PaperQuery narrows papers down, empty fields don't filter. Without Search papers come
+// ordered by id and are paged with AfterID, with it by rank and paged with Offset.
+type PaperQuery struct {
+	Topic  string
+	Source PaperSource
+	// Search is matched against title and abstract, in web search syntax ("a b" -c or d)
+	Search  string
+	AfterID uint64
+	Offset  int
+	// Limit 0 returns all papers
+	Limit int
+}
+
+const publicPaperColumns = `
+	id, source, source_id, title,
+	ARRAY(SELECT a->>'Name' FROM jsonb_array_elements(CASE WHEN jsonb_typeof(authors) = 'array' THEN authors ELSE '[]'::jsonb END) a),
+	doi, topic, pdf_url, license, tldr, abstract, conference, language, COALESCE(keywords, '{}'), status, created_at`
+
+// NOTE: no index backs the search vector, a corpus of a project is small enough to scan
+const searchVector = `to_tsvector('english', title || ' ' || COALESCE(abstract, ''))`
+
+// ForEachPublicPaper calls fn with every paper of the project q matches.
+func ForEachPublicPaper(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, q PaperQuery, fn func(PublicPaper) error) error {
+	query := `SELECT ` + publicPaperColumns + `, 0::float8
+		FROM research_papers
+		WHERE project_id = $1 AND ($2 = '' OR topic = $2) AND ($3 = '' OR source::text = $3) AND id > $4
+		ORDER BY id
+		LIMIT NULLIF($5::int, 0);`
+	args := []any{projectID, q.Topic, string(q.Source), q.AfterID, q.Limit}
+
+	if q.Search != "" {
+		query = `SELECT ` + publicPaperColumns + `, ts_rank(` + searchVector + `, websearch_to_tsquery('english', $4))::float8 AS rank
+			FROM research_papers
+			WHERE project_id = $1 AND ($2 = '' OR topic = $2) AND ($3 = '' OR source::text = $3)
+				AND ` + searchVector + ` @@ websearch_to_tsquery('english', $4)
+			ORDER BY rank DESC, id
+			LIMIT NULLIF($5::int, 0) OFFSET $6;`
+		args = []any{projectID, q.Topic, string(q.Source), q.Search, q.Limit, q.Offset}
+	}
+
+	rows, err := dbPool.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query papers: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPublicPaper(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ListPapers returns the papers of the project q matches.
+func ListPapers(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, q PaperQuery) ([]PublicPaper, error) {
+	var papers []PublicPaper
+	err := ForEachPublicPaper(ctx, dbPool, projectID, q, func(p PublicPaper) error {
+		papers = append(papers, p)
+		return nil
+	})
+	return papers, err
+}
+
+// GetPublicPaper returns a paper of the project, false when it has none with that id.
+func GetPublicPaper(ctx context.Context, dbPool *pgxpool.Pool, projectID, paperID uint64) (PublicPaper, bool, error) {
+	query := `SELECT ` + publicPaperColumns + `, 0::float8 FROM research_papers WHERE project_id = $1 AND id = $2;`
+
+	p, err := scanPublicPaper(dbPool.QueryRow(ctx, query, projectID, paperID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return PublicPaper{}, false, nil
+	}
+	if err != nil {
+		return PublicPaper{}, false, err
+	}
+	return p, true, nil
+}
+
+func scanPublicPaper(row pgx.Row) (PublicPaper, error) {
+	var p PublicPaper
+	err := row.Scan(&p.ID, &p.Source, &p.SourceID, &p.Title, &p.Authors, &p.DOI, &p.Topic, &p.PDFURL, &p.License, &p.TLDR, &p.Abstract, &p.Conference, &p.Language, &p.Keywords, &p.Status, &p.CreatedAt, &p.Rank)
+	if err != nil {
+		return p, fmt.Errorf("failed to scan paper: %w", err)
+	}
+	return p, nil
+}
+
+// PaperCount is how many papers of a topic came from a source.
+type PaperCount struct {
+	Topic    string
+	Source   PaperSource
+	Papers   int
+	Embedded int
+	Latest   time.Time
+}
+
+// CountPapers counts the papers of a project per topic and source, ordered by topic.
+func CountPapers(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64) ([]PaperCount, error) {
+	query := `
+		SELECT topic, source, COUNT(*), COUNT(*) FILTER (WHERE status = $2), MAX(created_at)
+		FROM research_papers
+		WHERE project_id = $1
+		GROUP BY topic, source
+		ORDER BY topic, source;`
+
+	rows, err := dbPool.Query(ctx, query, projectID, StatusEmbedded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count papers: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []PaperCount
+	for rows.Next() {
+		var c PaperCount
+		if err := rows.Scan(&c.Topic, &c.Source, &c.Papers, &c.Embedded, &c.Latest); err != nil {
+			return nil, fmt.Errorf("failed to scan paper count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
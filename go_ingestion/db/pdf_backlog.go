@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	BacklogPending   = "pending"
+	BacklogEmbargoed = "embargoed"
+	BacklogResolved  = "resolved"
+	BacklogNotFound  = "not_found"
+)
+
+// PDFBacklogEntry is a paper that was skipped for having a DOI but no PDF URL.
+type PDFBacklogEntry struct {
+	ID       uint64
+	Paper    ResearchPaper
+	Attempts int
+}
+
+// OALocation is where an open access copy of a backlog paper was found.
+type OALocation struct {
+	URL        string
+	Host       string
+	License    string
+	ResolvedBy string
+	// Candidates are all the PDFs the lookup found, URL first
+	Candidates []PDFCandidate
+}
+
+// QueuePDFBacklog records a paper without PDF so the resolver can look for one, papers
+// already queued are left alone. A non-zero embargoUntil queues it as embargoed, it isn't
+// looked up before then.
+func QueuePDFBacklog(ctx context.Context, dbPool *pgxpool.Pool, paper ResearchPaper, embargoUntil time.Time) error {
+	query := `
+		INSERT INTO pdf_backlog (project_id, source, source_id, doi, title, authors, metadata, topic, license, status, recheck_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT DO NOTHING;
+	`
+
+	status, recheckAt := BacklogPending, (*time.Time)(nil)
+	if !embargoUntil.IsZero() {
+		status, recheckAt = BacklogEmbargoed, &embargoUntil
+	}
+
+	if _, err := dbPool.Exec(ctx, query, paper.ProjectID, paper.Source, paper.SourceID, paper.DOI, paper.Title, paper.Authors, paper.Metadata, paper.Topic, paper.License, status, recheckAt); err != nil {
+		return fmt.Errorf("failed to queue pdf backlog: %w", err)
+	}
+	return nil
+}
+
+// PendingPDFBacklog returns up to limit pending entries not checked within recheckAfter and
+// embargoed entries whose embargo is over, oldest check first.
+func PendingPDFBacklog(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, limit int, recheckAfter time.Duration) ([]PDFBacklogEntry, error) {
+	query := `
+		SELECT id, source, source_id, doi, title, authors, metadata, topic, license, attempts
+		FROM pdf_backlog
+		WHERE project_id = $1
+		  AND ((status = 'pending' AND (checked_at IS NULL OR checked_at < now() - $2::interval))
+		    OR (status = 'embargoed' AND recheck_at <= now()))
+		ORDER BY checked_at NULLS FIRST, id
+		LIMIT $3;
+	`
+
+	rows, err := dbPool.Query(ctx, query, projectID, recheckAfter, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pdf backlog: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []PDFBacklogEntry
+	for rows.Next() {
+		e := PDFBacklogEntry{Paper: ResearchPaper{ProjectID: projectID}}
+		if err := rows.Scan(&e.ID, &e.Paper.Source, &e.Paper.SourceID, &e.Paper.DOI, &e.Paper.Title, &e.Paper.Authors, &e.Paper.Metadata, &e.Paper.Topic, &e.Paper.License, &e.Attempts); err != nil {
+			return nil, fmt.Errorf("failed to scan pdf backlog: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func ResolvePDFBacklog(ctx context.Context, dbPool *pgxpool.Pool, id uint64, loc OALocation) error {
+	query := `
+		UPDATE pdf_backlog
+		SET status = 'resolved', attempts = attempts + 1, checked_at = now(),
+		    oa_url = $2, oa_host = $3, oa_license = NULLIF($4, ''), resolved_by = $5
+		WHERE id = $1;
+	`
+
+	if _, err := dbPool.Exec(ctx, query, id, loc.URL, loc.Host, loc.License, loc.ResolvedBy); err != nil {
+		return fmt.Errorf("failed to resolve pdf backlog id=%d: %w", id, err)
+	}
+	return nil
+}
+
+// MissPDFBacklog counts a lookup that found nothing, after maxAttempts the entry is given up on.
+// An embargoed entry that is still closed becomes pending, so it is re-checked like any other.
+func MissPDFBacklog(ctx context.Context, dbPool *pgxpool.Pool, id uint64, maxAttempts int) error {
+	query := `
+		UPDATE pdf_backlog
+		SET attempts = attempts + 1, checked_at = now(),
+		    status = CASE WHEN attempts + 1 >= $2 THEN 'not_found' ELSE 'pending' END
+		WHERE id = $1;
+	`
+
+	if _, err := dbPool.Exec(ctx, query, id, maxAttempts); err != nil {
+		return fmt.Errorf("failed to update pdf backlog id=%d: %w", id, err)
+	}
+	return nil
+}
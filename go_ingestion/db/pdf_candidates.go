@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	PDFArxiv      = "arxiv"
+	PDFPublisher  = "publisher"
+	PDFRepository = "repository"
+)
+
+// PDFCandidate is one of the places a source says the PDF of a paper can be downloaded from.
+type PDFCandidate struct {
+	URL  string
+	Host string
+	Kind string
+}
+
+// NewPDFCandidate fills in the host of rawURL, arxiv hosts are always of kind arxiv.
+func NewPDFCandidate(rawURL, kind string) PDFCandidate {
+	c := PDFCandidate{URL: strings.TrimSpace(rawURL), Kind: kind}
+	if u, err := url.Parse(c.URL); err == nil {
+		c.Host = strings.ToLower(u.Hostname())
+	}
+	if c.Host == "arxiv.org" || strings.HasSuffix(c.Host, ".arxiv.org") {
+		c.Kind = PDFArxiv
+	}
+	return c
+}
+
+// SavePDFCandidates stores the candidates of a paper in the given order, ranks of URLs that
+// were already stored are updated.
+func SavePDFCandidates(ctx context.Context, dbPool *pgxpool.Pool, paperID uint64, candidates []PDFCandidate) error {
+	urls := make([]string, len(candidates))
+	hosts := make([]string, len(candidates))
+	kinds := make([]string, len(candidates))
+	ranks := make([]int32, len(candidates))
+	for i, c := range candidates {
+		urls[i], hosts[i], kinds[i], ranks[i] = c.URL, c.Host, c.Kind, int32(i)
+	}
+
+	_, err := dbPool.Exec(ctx, `
+		INSERT INTO pdf_candidates (paper_id, url, host, kind, rank)
+		SELECT $1, c.url, c.host, c.kind, c.rank
+		FROM unnest($2::text[], $3::text[], $4::text[], $5::int[]) AS c(url, host, kind, rank)
+		ON CONFLICT (paper_id, url) DO UPDATE SET rank = EXCLUDED.rank;
+	`, paperID, urls, hosts, kinds, ranks)
+	if err != nil {
+		return fmt.Errorf("failed to save pdf candidates of paper %d: %w", paperID, err)
+	}
+	return nil
+}
+
+// PDFCandidates returns the candidates of a paper, preferred first.
+func PDFCandidates(ctx context.Context, dbPool *pgxpool.Pool, paperID uint64) ([]PDFCandidate, error) {
+	rows, err := dbPool.Query(ctx, `SELECT url, host, kind FROM pdf_candidates WHERE paper_id = $1 ORDER BY rank;`, paperID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pdf candidates of paper %d: %w", paperID, err)
+	}
+	defer rows.Close()
+
+	var candidates []PDFCandidate
+	for rows.Next() {
+		var c PDFCandidate
+		if err := rows.Scan(&c.URL, &c.Host, &c.Kind); err != nil {
+			return nil, fmt.Errorf("failed to scan pdf candidate: %w", err)
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
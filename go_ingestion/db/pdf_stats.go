@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PDFStats is what is known about the downloaded PDF of a paper, 0 and "" when unknown.
+type PDFStats struct {
+	Pages      int
+	TextLength int
+	Kind       string
+}
+
+// SavePDFPages records the page count of a freshly downloaded PDF, the text length of an
+// older download no longer applies and is cleared.
+func SavePDFPages(ctx context.Context, dbPool *pgxpool.Pool, paperID uint64, pages int, kind string) error {
+	_, err := dbPool.Exec(ctx, `
+		INSERT INTO pdf_stats (paper_id, pages, text_length, kind)
+		VALUES ($1, NULLIF($2, 0), NULL, NULLIF($3, ''))
+		ON CONFLICT (paper_id) DO UPDATE
+		SET pages = EXCLUDED.pages, text_length = NULL, kind = EXCLUDED.kind, updated_at = now();
+	`, paperID, pages, kind)
+	if err != nil {
+		return fmt.Errorf("failed to save pdf pages of paper %d: %w", paperID, err)
+	}
+	return nil
+}
+
+// SavePDFTextLength records the length of the text extracted from a PDF and the kind it
+// makes the PDF.
+func SavePDFTextLength(ctx context.Context, dbPool *pgxpool.Pool, paperID uint64, textLength int, kind string) error {
+	_, err := dbPool.Exec(ctx, `
+		INSERT INTO pdf_stats (paper_id, text_length, kind)
+		VALUES ($1, $2, NULLIF($3, ''))
+		ON CONFLICT (paper_id) DO UPDATE
+		SET text_length = EXCLUDED.text_length, kind = EXCLUDED.kind, updated_at = now();
+	`, paperID, textLength, kind)
+	if err != nil {
+		return fmt.Errorf("failed to save pdf text length of paper %d: %w", paperID, err)
+	}
+	return nil
+}
+
+// GetPDFStats returns the stats of a paper's PDF, zero when none were recorded.
+func GetPDFStats(ctx context.Context, dbPool *pgxpool.Pool, paperID uint64) (PDFStats, error) {
+	var stats PDFStats
+	err := dbPool.QueryRow(ctx, `
+		SELECT COALESCE(pages, 0), COALESCE(text_length, 0), COALESCE(kind, '')
+		FROM pdf_stats
+		WHERE paper_id = $1;
+	`, paperID).Scan(&stats.Pages, &stats.TextLength, &stats.Kind)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return PDFStats{}, nil
+	}
+	if err != nil {
+		return PDFStats{}, fmt.Errorf("failed to get pdf stats of paper %d: %w", paperID, err)
+	}
+	return stats, nil
+}
+
+// PDFKindCount is how many papers of a project have PDFs of a kind, "" for unknown.
+type PDFKindCount struct {
+	Kind   string `json:"kind"`
+	Papers int    `json:"papers"`
+}
+
+// CountPDFKinds counts the downloaded PDFs of a project per kind.
+func CountPDFKinds(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64) ([]PDFKindCount, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT COALESCE(s.kind, ''), count(*)
+		FROM pdf_stats s
+		JOIN research_papers p ON p.id = s.paper_id
+		WHERE p.project_id = $1
+		GROUP BY 1
+		ORDER BY 2 DESC;
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count pdf kinds: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []PDFKindCount
+	for rows.Next() {
+		var c PDFKindCount
+		if err := rows.Scan(&c.Kind, &c.Papers); err != nil {
+			return nil, fmt.Errorf("failed to scan pdf kind count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
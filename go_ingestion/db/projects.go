@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const DefaultProject = "default"
+
+type Project struct {
+	ID        uint64    `db:"id"`
+	Name      string    `db:"name"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// GetOrCreateProject returns the project with the given name, creating it on first use.
+func GetOrCreateProject(ctx context.Context, dbPool *pgxpool.Pool, name string) (Project, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = DefaultProject
+	}
+
+	// NOTE: DO UPDATE (not DO NOTHING) so RETURNING also gives back existing rows
+	query := `
+		INSERT INTO projects (name)
+		VALUES ($1)
+		ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id, name, created_at;
+	`
+
+	var project Project
+	err := dbPool.QueryRow(ctx, query, name).Scan(&project.ID, &project.Name, &project.CreatedAt)
+	if err != nil {
+		return Project{}, fmt.Errorf("failed to get project %q: %w", name, err)
+	}
+
+	return project, nil
+}
+
+func DeleteProjectPapers(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64) (int64, error) {
+	tag, err := dbPool.Exec(ctx, `DELETE FROM research_papers WHERE project_id = $1;`, projectID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete project papers: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Provenance records which source supplied each normalized field, and what other
+// sources said when they disagreed.
+type Provenance struct {
+	Fields    map[string]PaperSource            `json:"fields"`
+	Conflicts map[string]map[PaperSource]string `json:"conflicts,omitempty"`
+}
+
+// NewProvenance attributes every non-empty field of a freshly inserted paper to its source.
+func NewProvenance(paper ResearchPaper) Provenance {
+	prov := Provenance{Fields: map[string]PaperSource{}}
+	for field, value := range MergeableFields(paper) {
+		if value != "" {
+			prov.Fields[field] = paper.Source
+		}
+	}
+	return prov
+}
+
+func (p *Provenance) AddConflict(field string, source PaperSource, value string) {
+	if p.Conflicts == nil {
+		p.Conflicts = map[string]map[PaperSource]string{}
+	}
+	if p.Conflicts[field] == nil {
+		p.Conflicts[field] = map[PaperSource]string{}
+	}
+	p.Conflicts[field][source] = value
+}
+
+// MergeableFields are the normalized columns that can come from different sources.
+func MergeableFields(paper ResearchPaper) map[string]string {
+	return map[string]string{
+		"title":   paper.Title,
+		"pdf_url": paper.PDFURL,
+		"doi":     nullableString(paper.DOI),
+		"license": nullableString(paper.License),
+		"authors": authorsString(paper.Authors),
+		"tldr":    nullableString(paper.TLDR),
+	}
+}
+
+func authorsString(authors *[]byte) string {
+	s := byteSliceToString(authors)
+	if s == "[]" || s == "null" {
+		return ""
+	}
+	return s
+}
+
+// MergeIntoPaper loads paper id under a row lock, lets merge update it and its
+// provenance with the record of source, and writes it back with a merged event if merge
+// reports a change.
+func MergeIntoPaper(ctx context.Context, dbPool *pgxpool.Pool, id uint64, source PaperSource, merge func(existing *ResearchPaper, prov *Provenance) bool) error {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var existing ResearchPaper
+	var provJSON []byte
+	err = tx.QueryRow(ctx, `
+		SELECT id, project_id, source, title, pdf_url, authors, doi, license, tldr, provenance
+		FROM research_papers
+		WHERE id = $1
+		FOR UPDATE;
+	`, id).Scan(&existing.ID, &existing.ProjectID, &existing.Source, &existing.Title, &existing.PDFURL, &existing.Authors, &existing.DOI, &existing.License, &existing.TLDR, &provJSON)
+	if err != nil {
+		return fmt.Errorf("failed to load paper id=%d for merge: %w", id, err)
+	}
+
+	prov := NewProvenance(existing)
+	if len(provJSON) > 0 {
+		if err := json.Unmarshal(provJSON, &prov); err != nil {
+			return fmt.Errorf("invalid provenance for paper id=%d: %w", id, err)
+		}
+	}
+
+	if !merge(&existing, &prov) {
+		return nil
+	}
+
+	provJSON, err = json.Marshal(prov)
+	if err != nil {
+		return fmt.Errorf("failed to marshal provenance: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE research_papers
+		SET title = $2, pdf_url = $3, authors = $4, doi = $5, license = $6, tldr = $7, provenance = $8
+		WHERE id = $1;
+	`, id, existing.Title, existing.PDFURL, existing.Authors, existing.DOI, existing.License, existing.TLDR, provJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update merged paper id=%d: %w", id, err)
+	}
+	if err := insertPaperEvent(ctx, tx, existing.ProjectID, id, EventMerged, &source, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
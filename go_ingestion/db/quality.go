@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TopicQuality counts what is missing or suspicious about the papers of a topic.
+type TopicQuality struct {
+	Topic           string
+	Papers          int
+	MissingAbstract int
+	MissingDOI      int
+	// Duplicates share their DOI or their title, ignoring case and punctuation, with another
+	// paper of the project
+	Duplicates int
+	// PendingReviews are papers in a duplicate review nobody resolved yet
+	PendingReviews  int
+	NonEnglish      int
+	UnknownLanguage int
+}
+
+// Add sums q into t, for totals over topics.
+func (t *TopicQuality) Add(q TopicQuality) {
+	t.Papers += q.Papers
+	t.MissingAbstract += q.MissingAbstract
+	t.MissingDOI += q.MissingDOI
+	t.Duplicates += q.Duplicates
+	t.PendingReviews += q.PendingReviews
+	t.NonEnglish += q.NonEnglish
+	t.UnknownLanguage += q.UnknownLanguage
+}
+
+// TopicQualities returns the quality counts of every topic of the project.
+func TopicQualities(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64) ([]TopicQuality, error) {
+	query := `
+		WITH p AS (
+			SELECT id, topic, abstract, NULLIF(lower(btrim(doi)), '') AS doi, language,
+				lower(regexp_replace(title, '[^[:alnum:]]+', '', 'g')) AS norm_title
+			FROM research_papers
+			WHERE project_id = $1
+		),
+		dup_doi AS (
+			SELECT doi FROM p WHERE doi IS NOT NULL GROUP BY doi HAVING count(*) > 1
+		),
+		dup_title AS (
+			SELECT norm_title FROM p WHERE norm_title <> '' GROUP BY norm_title HAVING count(*) > 1
+		),
+		reviewed AS (
+			SELECT paper_id AS id FROM duplicate_reviews WHERE project_id = $1 AND status = 'pending'
+			UNION
+			SELECT candidate_id FROM duplicate_reviews WHERE project_id = $1 AND status = 'pending'
+		)
+		SELECT
+			p.topic,
+			count(*),
+			count(*) FILTER (WHERE p.abstract IS NULL OR btrim(p.abstract) = ''),
+			count(*) FILTER (WHERE p.doi IS NULL),
+			count(*) FILTER (WHERE p.doi IN (SELECT doi FROM dup_doi) OR p.norm_title IN (SELECT norm_title FROM dup_title)),
+			count(*) FILTER (WHERE p.id IN (SELECT id FROM reviewed)),
+			count(*) FILTER (WHERE p.language IS NOT NULL AND p.language NOT IN ('', 'en')),
+			count(*) FILTER (WHERE p.language IS NULL OR p.language = '')
+		FROM p
+		GROUP BY p.topic
+		ORDER BY p.topic;
+	`
+
+	rows, err := dbPool.Query(ctx, query, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count paper quality: %w", err)
+	}
+	defer rows.Close()
+
+	var topics []TopicQuality
+	for rows.Next() {
+		var t TopicQuality
+		if err := rows.Scan(&t.Topic, &t.Papers, &t.MissingAbstract, &t.MissingDOI, &t.Duplicates, &t.PendingReviews, &t.NonEnglish, &t.UnknownLanguage); err != nil {
+			return nil, fmt.Errorf("failed to scan paper quality: %w", err)
+		}
+		topics = append(topics, t)
+	}
+	return topics, rows.Err()
+}
+
+type PDFLink struct {
+	PaperID uint64
+	Topic   string
+	URL     string
+}
+
+// SamplePDFLinks returns up to perTopic random pdf_urls per topic of papers that aren't
+// downloaded yet, the links of downloaded ones are known to work.
+func SamplePDFLinks(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, perTopic int) ([]PDFLink, error) {
+	query := `
+		SELECT id, topic, pdf_url
+		FROM (
+			SELECT id, topic, pdf_url, row_number() OVER (PARTITION BY topic ORDER BY random()) AS n
+			FROM research_papers
+			WHERE project_id = $1 AND status = 'ingested'
+		) sampled
+		WHERE n <= $2
+		ORDER BY topic, id;
+	`
+
+	rows, err := dbPool.Query(ctx, query, projectID, perTopic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample pdf links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []PDFLink
+	for rows.Next() {
+		var l PDFLink
+		if err := rows.Scan(&l.PaperID, &l.Topic, &l.URL); err != nil {
+			return nil, fmt.Errorf("failed to scan pdf link: %w", err)
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
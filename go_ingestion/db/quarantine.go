@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type QuarantinedRecord struct {
+	Source        PaperSource
+	SourceID      string
+	Failures      int
+	LastError     string
+	Payload       []byte
+	LastFailedAt  time.Time
+	QuarantinedAt *time.Time
+}
+
+// RecordMappingFailure counts a failure to map a record and reports whether the record is
+// quarantined now, which happens once it failed after times.
+func RecordMappingFailure(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, source PaperSource, sourceID string, payload []byte, reason string, after int) (bool, error) {
+	var quarantined bool
+	err := dbPool.QueryRow(ctx, `
+		INSERT INTO quarantined_records (project_id, source, source_id, last_error, payload, quarantined_at)
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $6 <= 1 THEN now() END)
+		ON CONFLICT (project_id, source, source_id) DO UPDATE
+		SET failures = quarantined_records.failures + 1,
+		    last_error = EXCLUDED.last_error,
+		    payload = EXCLUDED.payload,
+		    last_failed_at = now(),
+		    quarantined_at = COALESCE(quarantined_records.quarantined_at,
+		        CASE WHEN quarantined_records.failures + 1 >= $6 THEN now() END)
+		RETURNING quarantined_at IS NOT NULL;
+	`, projectID, source, sourceID, reason, payload, after).Scan(&quarantined)
+	if err != nil {
+		return false, fmt.Errorf("failed to record mapping failure of %s %s: %w", source, sourceID, err)
+	}
+	return quarantined, nil
+}
+
+// QuarantinedSourceIDs returns the source ids of a source that pages skip.
+func QuarantinedSourceIDs(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, source PaperSource) ([]string, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT source_id FROM quarantined_records
+		WHERE project_id = $1 AND source = $2 AND quarantined_at IS NOT NULL;
+	`, projectID, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quarantined %s records: %w", source, err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan source id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ListQuarantined returns the records that failed to map, quarantined or not, latest failure first.
+func ListQuarantined(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, limit int) ([]QuarantinedRecord, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT source, source_id, failures, last_error, payload, last_failed_at, quarantined_at
+		FROM quarantined_records
+		WHERE project_id = $1
+		ORDER BY last_failed_at DESC
+		LIMIT $2;
+	`, projectID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quarantined records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []QuarantinedRecord
+	for rows.Next() {
+		var r QuarantinedRecord
+		if err := rows.Scan(&r.Source, &r.SourceID, &r.Failures, &r.LastError, &r.Payload, &r.LastFailedAt, &r.QuarantinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan quarantined record: %w", err)
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// ReleaseQuarantined forgets a record's failures so the next page that has it maps it again.
+func ReleaseQuarantined(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, source PaperSource, sourceID string) (bool, error) {
+	tag, err := dbPool.Exec(ctx, `DELETE FROM quarantined_records WHERE project_id = $1 AND source = $2 AND source_id = $3;`, projectID, source, sourceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to release %s %s: %w", source, sourceID, err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RebuildReport counts what a rebuild cleared, the stages regenerate it from there.
+type RebuildReport struct {
+	Chunks  int64
+	Vectors int64
+	// Rewound papers were sent back to the status before the cleared layer
+	Rewound int64
+}
+
+func (r RebuildReport) String() string {
+	return fmt.Sprintf("chunks=%d vectors=%d rewound=%d", r.Chunks, r.Vectors, r.Rewound)
+}
+
+// ClearChunks deletes the chunks (with their vectors and keyphrases) of the papers of a
+// topic, all topics when topic is "", and sends chunked and embedded papers back to
+// extracted so the chunk stage splits them again.
+func ClearChunks(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, topic string) (RebuildReport, error) {
+	return clearDerived(ctx, dbPool, projectID, topic, true, StatusExtracted)
+}
+
+// ClearEmbeddings deletes the vectors of the papers of a topic, all topics when topic is
+// "", and sends embedded papers back to chunked so the embed stage embeds them again.
+func ClearEmbeddings(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, topic string) (RebuildReport, error) {
+	return clearDerived(ctx, dbPool, projectID, topic, false, StatusChunked)
+}
+
+func clearDerived(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, topic string, chunks bool, rewindTo PaperStatus) (RebuildReport, error) {
+	var report RebuildReport
+
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		DELETE FROM embedding_vectors v
+		USING embedding_chunks c, research_papers p
+		WHERE v.embedding_chunk_id = c.id AND c.paper_id = p.id
+			AND p.project_id = $1 AND ($2 = '' OR p.topic = $2);
+	`, projectID, topic)
+	if err != nil {
+		return report, fmt.Errorf("failed to delete vectors: %w", err)
+	}
+	report.Vectors = tag.RowsAffected()
+
+	if chunks {
+		tag, err := tx.Exec(ctx, `
+			DELETE FROM embedding_chunks c
+			USING research_papers p
+			WHERE c.paper_id = p.id AND p.project_id = $1 AND ($2 = '' OR p.topic = $2);
+		`, projectID, topic)
+		if err != nil {
+			return report, fmt.Errorf("failed to delete chunks: %w", err)
+		}
+		report.Chunks = tag.RowsAffected()
+	}
+
+	tag, err = tx.Exec(ctx, `
+		UPDATE research_papers
+		SET status = $3, status_at = now()
+		WHERE project_id = $1 AND ($2 = '' OR topic = $2) AND status > $3;
+	`, projectID, topic, rewindTo)
+	if err != nil {
+		return report, fmt.Errorf("failed to send papers back to %s: %w", rewindTo, err)
+	}
+	report.Rewound = tag.RowsAffected()
+
+	return report, tx.Commit(ctx)
+}
+
+// ReplacePaperSubjects files paper id under subjects only, dropping the links it had.
+func ReplacePaperSubjects(ctx context.Context, dbPool *pgxpool.Pool, paperID uint64, source PaperSource, subjects []Subject) error {
+	if _, err := dbPool.Exec(ctx, `DELETE FROM paper_subjects WHERE paper_id = $1;`, paperID); err != nil {
+		return fmt.Errorf("failed to clear subjects of paper %d: %w", paperID, err)
+	}
+	if len(subjects) == 0 {
+		return nil
+	}
+	return LinkPaperSubjects(ctx, dbPool, paperID, source, subjects)
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PaperLookup is a paper to re-enrich with the id semantic scholar knows it by, its paperId
+// or a prefixed DOI:, ARXIV:, PMID:, ACL:, MAG: or CorpusId: id.
+type PaperLookup struct {
+	ID       uint64
+	LookupID string
+}
+
+// Reenrichment is what semantic scholar currently reports about a paper.
+type Reenrichment struct {
+	CitationCount int
+	OpenAccess    bool
+	// PDFCandidates are open copies, added after the candidates the paper already has
+	PDFCandidates []PDFCandidate
+}
+
+// PapersToReenrich returns up to limit papers that weren't re-enriched in the last maxAge,
+// never re-enriched ones first, then the stalest. Papers semantic scholar has no id for
+// are skipped.
+func PapersToReenrich(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, maxAge time.Duration, limit int) ([]PaperLookup, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT id, lookup_id FROM (
+			SELECT p.id, p.reenriched_at, COALESCE(
+				CASE WHEN p.source = 'semanticscholar' THEN p.source_id END,
+				(SELECT value FROM paper_identifiers WHERE paper_id = p.id AND scheme = 's2' LIMIT 1),
+				'DOI:' || NULLIF(btrim(p.doi), ''),
+				(SELECT 'ARXIV:' || value FROM paper_identifiers WHERE paper_id = p.id AND scheme = 'arxiv' LIMIT 1),
+				(SELECT 'PMID:' || value FROM paper_identifiers WHERE paper_id = p.id AND scheme = 'pmid' LIMIT 1),
+				(SELECT 'ACL:' || value FROM paper_identifiers WHERE paper_id = p.id AND scheme = 'acl' LIMIT 1),
+				(SELECT 'MAG:' || value FROM paper_identifiers WHERE paper_id = p.id AND scheme = 'mag' LIMIT 1),
+				(SELECT 'CorpusId:' || value FROM paper_identifiers WHERE paper_id = p.id AND scheme = 'corpusid' LIMIT 1)
+			) AS lookup_id
+			FROM research_papers p
+			WHERE p.project_id = $1 AND (p.reenriched_at IS NULL OR p.reenriched_at < now() - $2::interval)
+		) papers
+		WHERE lookup_id IS NOT NULL
+		ORDER BY reenriched_at NULLS FIRST, id
+		LIMIT $3;
+	`, projectID, maxAge, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list papers to re-enrich: %w", err)
+	}
+	defer rows.Close()
+
+	var papers []PaperLookup
+	for rows.Next() {
+		var p PaperLookup
+		if err := rows.Scan(&p.ID, &p.LookupID); err != nil {
+			return nil, fmt.Errorf("failed to scan paper lookup: %w", err)
+		}
+		papers = append(papers, p)
+	}
+	return papers, rows.Err()
+}
+
+// SaveReenrichment stores r and marks the paper re-enriched, r nil (semantic scholar
+// doesn't know the paper) only marks it, so it waits maxAge like the others.
+func SaveReenrichment(ctx context.Context, dbPool *pgxpool.Pool, paperID uint64, r *Reenrichment) error {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if r == nil {
+		if _, err := tx.Exec(ctx, `UPDATE research_papers SET reenriched_at = now() WHERE id = $1;`, paperID); err != nil {
+			return fmt.Errorf("failed to mark paper %d re-enriched: %w", paperID, err)
+		}
+		return tx.Commit(ctx)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE research_papers
+		SET citation_count = $2, open_access = $3, reenriched_at = now()
+		WHERE id = $1;
+	`, paperID, r.CitationCount, r.OpenAccess)
+	if err != nil {
+		return fmt.Errorf("failed to save re-enrichment of paper %d: %w", paperID, err)
+	}
+
+	for _, c := range r.PDFCandidates {
+		// NOTE: new copies rank last, the ranks of the stored ones are left as they are
+		_, err := tx.Exec(ctx, `
+			INSERT INTO pdf_candidates (paper_id, url, host, kind, rank)
+			SELECT $1, $2, $3, $4, COALESCE(max(rank) + 1, 0) FROM pdf_candidates WHERE paper_id = $1
+			ON CONFLICT (paper_id, url) DO NOTHING;
+		`, paperID, c.URL, c.Host, c.Kind)
+		if err != nil {
+			return fmt.Errorf("failed to save pdf candidate of paper %d: %w", paperID, err)
+		}
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PruneRawPayloads drops the raw upstream metadata of already embedded papers older than days.
+func PruneRawPayloads(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, days uint) (int64, error) {
+	query := `
+		UPDATE research_papers
+		SET metadata = NULL
+		WHERE project_id = $1
+			AND status = 'embedded'
+			AND metadata IS NOT NULL
+			AND created_at < now() - make_interval(days => $2);
+	`
+
+	tag, err := dbPool.Exec(ctx, query, projectID, int(days))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune raw payloads: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DeleteOrphanChunks removes chunks whose paper is gone and vectors whose chunk is gone.
+func DeleteOrphanChunks(ctx context.Context, dbPool *pgxpool.Pool) (int64, int64, error) {
+	chunkTag, err := dbPool.Exec(ctx, `
+		DELETE FROM embedding_chunks c
+		WHERE NOT EXISTS (SELECT 1 FROM research_papers p WHERE p.id = c.paper_id);
+	`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to delete orphan chunks: %w", err)
+	}
+
+	vectorTag, err := dbPool.Exec(ctx, `
+		DELETE FROM embedding_vectors v
+		WHERE NOT EXISTS (SELECT 1 FROM embedding_chunks c WHERE c.id = v.embedding_chunk_id);
+	`)
+	if err != nil {
+		return chunkTag.RowsAffected(), 0, fmt.Errorf("failed to delete orphan vectors: %w", err)
+	}
+
+	return chunkTag.RowsAffected(), vectorTag.RowsAffected(), nil
+}
+
+// CountOrphanChunks counts what DeleteOrphanChunks would remove, vectors of orphan chunks included.
+func CountOrphanChunks(ctx context.Context, dbPool *pgxpool.Pool) (int64, int64, error) {
+	var chunks, vectors int64
+	err := dbPool.QueryRow(ctx, `
+		WITH orphan_chunks AS (
+			SELECT c.id FROM embedding_chunks c
+			WHERE NOT EXISTS (SELECT 1 FROM research_papers p WHERE p.id = c.paper_id)
+		)
+		SELECT
+			(SELECT count(*) FROM orphan_chunks),
+			(SELECT count(*) FROM embedding_vectors v
+				WHERE NOT EXISTS (SELECT 1 FROM embedding_chunks c WHERE c.id = v.embedding_chunk_id)
+					OR v.embedding_chunk_id IN (SELECT id FROM orphan_chunks));
+	`).Scan(&chunks, &vectors)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count orphan chunks: %w", err)
+	}
+	return chunks, vectors, nil
+}
+
+// ExistingPaperIDs returns the subset of ids that still exist in research_papers.
+func ExistingPaperIDs(ctx context.Context, dbPool *pgxpool.Pool, ids []int64) (map[int64]bool, error) {
+	rows, err := dbPool.Query(ctx, `SELECT id FROM research_papers WHERE id = ANY($1);`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up paper ids: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[int64]bool, len(ids))
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan paper id: %w", err)
+		}
+		existing[id] = true
+	}
+
+	return existing, rows.Err()
+}
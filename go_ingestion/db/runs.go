@@ -0,0 +1,264 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Run struct {
+	ID         uint64     `db:"id"`
+	ProjectID  uint64     `db:"project_id"`
+	Command    string     `db:"command"`
+	Query      string     `db:"query"`
+	StartedAt  time.Time  `db:"started_at"`
+	FinishedAt *time.Time `db:"finished_at"`
+	Sources    []RunSource
+}
+
+type RunSource struct {
+	Source   PaperSource    `db:"source"`
+	Fetched  int            `db:"fetched"`
+	Inserted int            `db:"inserted"`
+	Reviewed int            `db:"reviewed"`
+	Updated  int            `db:"updated"`
+	Skipped  map[string]int `db:"skipped"`
+}
+
+func StartRun(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, command, query string) (uint64, error) {
+	var id uint64
+	err := dbPool.QueryRow(ctx, `INSERT INTO runs (project_id, command, query) VALUES ($1, $2, $3) RETURNING id;`, projectID, command, query).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start run: %w", err)
+	}
+	return id, nil
+}
+
+// FinishRun stores the per source counts of a run and marks it finished.
+func FinishRun(ctx context.Context, dbPool *pgxpool.Pool, runID uint64, sources []RunSource) error {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, s := range sources {
+		skipped, err := json.Marshal(s.Skipped)
+		if err != nil {
+			return fmt.Errorf("failed to marshal skip reasons: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO run_sources (run_id, source, fetched, inserted, reviewed, updated, skipped)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (run_id, source)
+			DO UPDATE SET fetched = EXCLUDED.fetched, inserted = EXCLUDED.inserted, reviewed = EXCLUDED.reviewed, updated = EXCLUDED.updated, skipped = EXCLUDED.skipped;
+		`, runID, s.Source, s.Fetched, s.Inserted, s.Reviewed, s.Updated, skipped)
+		if err != nil {
+			return fmt.Errorf("failed to save %s counts of run %d: %w", s.Source, runID, err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE runs SET finished_at = now() WHERE id = $1;`, runID); err != nil {
+		return fmt.Errorf("failed to finish run %d: %w", runID, err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Heartbeat records that the worker of source in a run is alive at offset (nil when its
+// pager has none), progressed when it just saved or skipped a page.
+func Heartbeat(ctx context.Context, dbPool *pgxpool.Pool, runID uint64, source PaperSource, offset *uint64, progressed bool) error {
+	_, err := dbPool.Exec(ctx, `
+		INSERT INTO run_sources (run_id, source, last_offset, heartbeat_at, progress_at)
+		VALUES ($1, $2, $3, now(), CASE WHEN $4 THEN now() END)
+		ON CONFLICT (run_id, source)
+		DO UPDATE SET
+			last_offset = COALESCE(EXCLUDED.last_offset, run_sources.last_offset),
+			heartbeat_at = now(),
+			progress_at = COALESCE(EXCLUDED.progress_at, run_sources.progress_at),
+			stopped_at = NULL;
+	`, runID, source, offset, progressed)
+	if err != nil {
+		return fmt.Errorf("failed to record heartbeat of %s in run %d: %w", source, runID, err)
+	}
+	return nil
+}
+
+// StopHeartbeat records that the worker of source in a run returned, it can't be stuck anymore.
+func StopHeartbeat(ctx context.Context, dbPool *pgxpool.Pool, runID uint64, source PaperSource) error {
+	_, err := dbPool.Exec(ctx, `UPDATE run_sources SET stopped_at = now() WHERE run_id = $1 AND source = $2;`, runID, source)
+	if err != nil {
+		return fmt.Errorf("failed to stop heartbeat of %s in run %d: %w", source, runID, err)
+	}
+	return nil
+}
+
+// StuckWorker is the worker of a source in an unfinished run that got past no page since
+// the cutoff. Source is nil when the run never got to start a worker.
+type StuckWorker struct {
+	RunID       uint64       `json:"run_id"`
+	Command     string       `json:"command"`
+	Query       string       `json:"query"`
+	StartedAt   time.Time    `json:"started_at"`
+	Source      *PaperSource `json:"source,omitempty"`
+	LastOffset  *uint64      `json:"last_offset,omitempty"`
+	HeartbeatAt *time.Time   `json:"heartbeat_at,omitempty"`
+	ProgressAt  *time.Time   `json:"progress_at,omitempty"`
+}
+
+// StuckWorkers returns the workers of unfinished runs without progress since stuckAfter
+// ago, oldest run first. Runs of a process that died stay unfinished and show up too.
+func StuckWorkers(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, stuckAfter time.Duration) ([]StuckWorker, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT r.id, r.command, r.query, r.started_at, s.source, s.last_offset, s.heartbeat_at, s.progress_at
+		FROM runs r
+		LEFT JOIN run_sources s ON s.run_id = r.id
+		WHERE r.project_id = $1 AND r.finished_at IS NULL AND s.stopped_at IS NULL
+			AND COALESCE(s.progress_at, r.started_at) < $2
+		ORDER BY r.started_at, s.source;
+	`, projectID, time.Now().Add(-stuckAfter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stuck runs: %w", err)
+	}
+	defer rows.Close()
+
+	var workers []StuckWorker
+	for rows.Next() {
+		var w StuckWorker
+		if err := rows.Scan(&w.RunID, &w.Command, &w.Query, &w.StartedAt, &w.Source, &w.LastOffset, &w.HeartbeatAt, &w.ProgressAt); err != nil {
+			return nil, fmt.Errorf("failed to scan stuck run: %w", err)
+		}
+		workers = append(workers, w)
+	}
+	return workers, rows.Err()
+}
+
+// ListRuns returns the latest runs of a project with their per source counts, newest first.
+func ListRuns(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, limit int) ([]Run, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT r.id, r.project_id, r.command, r.query, r.started_at, r.finished_at,
+			s.source, s.fetched, s.inserted, s.reviewed, s.updated, s.skipped
+		FROM (
+			SELECT * FROM runs WHERE project_id = $1 ORDER BY started_at DESC LIMIT $2
+		) r
+		LEFT JOIN run_sources s ON s.run_id = r.id
+		ORDER BY r.started_at DESC, s.source;
+	`, projectID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		var (
+			run      Run
+			source   *PaperSource
+			fetched  *int
+			inserted *int
+			reviewed *int
+			updated  *int
+			skipped  []byte
+		)
+		err := rows.Scan(&run.ID, &run.ProjectID, &run.Command, &run.Query, &run.StartedAt, &run.FinishedAt, &source, &fetched, &inserted, &reviewed, &updated, &skipped)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan run: %w", err)
+		}
+
+		if len(runs) == 0 || runs[len(runs)-1].ID != run.ID {
+			runs = append(runs, run)
+		}
+		if source == nil {
+			continue
+		}
+
+		rs := RunSource{Source: *source, Fetched: *fetched, Inserted: *inserted, Reviewed: *reviewed, Updated: *updated}
+		if err := json.Unmarshal(skipped, &rs.Skipped); err != nil {
+			return nil, fmt.Errorf("failed to parse skip reasons of run %d: %w", run.ID, err)
+		}
+		last := &runs[len(runs)-1]
+		last.Sources = append(last.Sources, rs)
+	}
+
+	return runs, rows.Err()
+}
+
+// GetRun returns a run of the project without its per source counts.
+func GetRun(ctx context.Context, dbPool *pgxpool.Pool, projectID, runID uint64) (Run, error) {
+	var run Run
+	err := dbPool.QueryRow(ctx, `
+		SELECT id, project_id, command, query, started_at, finished_at
+		FROM runs
+		WHERE project_id = $1 AND id = $2;
+	`, projectID, runID).Scan(&run.ID, &run.ProjectID, &run.Command, &run.Query, &run.StartedAt, &run.FinishedAt)
+	if err != nil {
+		return run, fmt.Errorf("failed to get run %d: %w", runID, err)
+	}
+	return run, nil
+}
+
+const (
+	ChangeAdded     = "added"
+	ChangeUpdated   = "updated"
+	ChangeRetracted = "retracted"
+)
+
+// PaperChange is one line of a run diff, a paper shows up once per kind of change.
+type PaperChange struct {
+	Change   string      `json:"change"`
+	PaperID  uint64      `json:"paper_id"`
+	Source   PaperSource `json:"source"`
+	SourceID *string     `json:"source_id"`
+	Title    string      `json:"title"`
+	DOI      *string     `json:"doi"`
+	At       time.Time   `json:"at"`
+}
+
+// RunDiff returns what changed in the papers of a topic after run from finished until run
+// to finished (or now when it is still running).
+//
+// NOTE: papers aren't tagged with the run that wrote them, so changes by other runs of the
+// topic in between are included too
+func RunDiff(ctx context.Context, dbPool *pgxpool.Pool, from, to Run) ([]PaperChange, error) {
+	since := from.StartedAt
+	if from.FinishedAt != nil {
+		since = *from.FinishedAt
+	}
+	until := time.Now()
+	if to.FinishedAt != nil {
+		until = *to.FinishedAt
+	}
+
+	rows, err := dbPool.Query(ctx, `
+		SELECT 'added', id, source, source_id, title, doi, created_at
+		FROM research_papers
+		WHERE project_id = $1 AND topic = $2 AND created_at > $3 AND created_at <= $4
+		UNION ALL
+		SELECT 'updated', id, source, source_id, title, doi, updated_at
+		FROM research_papers
+		WHERE project_id = $1 AND topic = $2 AND created_at <= $3 AND updated_at > $3 AND updated_at <= $4
+		UNION ALL
+		SELECT 'retracted', id, source, source_id, title, doi, retracted_at
+		FROM research_papers
+		WHERE project_id = $1 AND topic = $2 AND retracted_at > $3 AND retracted_at <= $4
+		ORDER BY 7, 2;
+	`, to.ProjectID, to.Query, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff runs %d and %d: %w", from.ID, to.ID, err)
+	}
+	defer rows.Close()
+
+	var changes []PaperChange
+	for rows.Next() {
+		var c PaperChange
+		if err := rows.Scan(&c.Change, &c.PaperID, &c.Source, &c.SourceID, &c.Title, &c.DOI, &c.At); err != nil {
+			return nil, fmt.Errorf("failed to scan change: %w", err)
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"embed"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// NOTE: schema/<file>.sql is the DDL of the tables <file>.go uses, in the order production
+// migrated. Schema puts it back together so the benchmarks and the e2e test create the same
+// database, instead of a copy that drifts
+//
+//go:embed schema/*.sql
+var ddlSources embed.FS
+
+var (
+	ddlStart      = regexp.MustCompile(`^(CREATE|ALTER|INSERT|UPDATE|DROP)\s`)
+	ddlTable      = regexp.MustCompile(`^CREATE TABLE (?:IF NOT EXISTS )?(\w+)`)
+	ddlTarget     = regexp.MustCompile(`^(?:ALTER TABLE|CREATE (?:UNIQUE )?INDEX(?: IF NOT EXISTS)? \w+\s+ON)\s+(\w+)`)
+	ddlReferences = regexp.MustCompile(`REFERENCES (\w+)`)
+)
+
+// ddlStatement is one statement of a DDL file, in the order of its file.
+type ddlStatement struct {
+	file string
+	sql  string
+}
+
+// phase orders the statements: extensions, types, tables, the changes to them, indexes.
+func (s ddlStatement) phase() int {
+	switch {
+	case strings.HasPrefix(s.sql, "CREATE EXTENSION"):
+		return 0
+	case strings.HasPrefix(s.sql, "CREATE TYPE"), strings.HasPrefix(s.sql, "ALTER TYPE"):
+		return 1
+	case strings.HasPrefix(s.sql, "CREATE TABLE"):
+		return 2
+	case strings.HasPrefix(s.sql, "CREATE INDEX"), strings.HasPrefix(s.sql, "CREATE UNIQUE INDEX"):
+		return 4
+	}
+	return 3
+}
+
+// Schema returns the DDL files of the db package as one script for an empty database,
+// its statements in the order they apply: tables after the tables they reference and
+// indexes after every column exists. The embedding tables belong to the embedding_engine
+// submodule and only list the columns used here, they and what depends on them are left out.
+func Schema() (string, error) {
+	statements, err := ddlStatements()
+	if err != nil {
+		return "", err
+	}
+
+	// NOTE: a placeholder column (...) marks a table created elsewhere
+	external := map[string]bool{}
+	for _, s := range statements {
+		if m := ddlTable.FindStringSubmatch(s.sql); m != nil && strings.Contains(s.sql, "...") {
+			external[m[1]] = true
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, s := range statements {
+			m := ddlTable.FindStringSubmatch(s.sql)
+			if m == nil || external[m[1]] {
+				continue
+			}
+			for _, ref := range ddlReferences.FindAllStringSubmatch(s.sql, -1) {
+				if external[ref[1]] {
+					external[m[1]], changed = true, true
+					break
+				}
+			}
+		}
+	}
+
+	phases := make([][]ddlStatement, 5)
+	for _, s := range statements {
+		if m := ddlTable.FindStringSubmatch(s.sql); m != nil && external[m[1]] {
+			continue
+		}
+		if m := ddlTarget.FindStringSubmatch(s.sql); m != nil && external[m[1]] {
+			continue
+		}
+		phases[s.phase()] = append(phases[s.phase()], s)
+	}
+	if phases[2], err = sortTables(phases[2]); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, phase := range phases {
+		for _, s := range phase {
+			fmt.Fprintf(&b, "-- db/schema/%s\n%s\n\n", s.file, s.sql)
+		}
+	}
+	return b.String(), nil
+}
+
+// ddlStatements reads the statements of every file, a file's in its order. The comments
+// between statements are left out.
+func ddlStatements() ([]ddlStatement, error) {
+	entries, err := ddlSources.ReadDir("schema")
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []ddlStatement
+	for _, entry := range entries {
+		data, err := ddlSources.ReadFile("schema/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		var lines []string
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimRight(line, " ")
+			if lines == nil && !ddlStart.MatchString(line) {
+				continue
+			}
+			lines = append(lines, line)
+
+			code, _, _ := strings.Cut(line, "--")
+			if strings.HasSuffix(strings.TrimSpace(code), ";") {
+				statements = append(statements, ddlStatement{file: entry.Name(), sql: strings.Join(lines, "\n")})
+				lines = nil
+			}
+		}
+		if lines != nil {
+			return nil, fmt.Errorf("db/schema/%s: statement %q isn't terminated", entry.Name(), lines[0])
+		}
+	}
+	return statements, nil
+}
+
+// sortTables puts every table after the tables it references, otherwise in file order.
+func sortTables(tables []ddlStatement) ([]ddlStatement, error) {
+	created := map[string]bool{}
+	sorted := make([]ddlStatement, 0, len(tables))
+	for len(tables) > 0 {
+		next := -1
+		for i, s := range tables {
+			name := ddlTable.FindStringSubmatch(s.sql)[1]
+			ready := true
+			for _, ref := range ddlReferences.FindAllStringSubmatch(s.sql, -1) {
+				if ref[1] != name && !created[ref[1]] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return nil, fmt.Errorf("tables reference missing tables or each other: db/%s", tables[0].file)
+		}
+		created[ddlTable.FindStringSubmatch(tables[next].sql)[1]] = true
+		sorted = append(sorted, tables[next])
+		tables = append(tables[:next], tables[next+1:]...)
+	}
+	return sorted, nil
+}
@@ -0,0 +1,9 @@
+CREATE TABLE ingest_checkpoints (
+    project_id BIGINT NOT NULL REFERENCES projects(id),
+    source paper_source NOT NULL,
+    query TEXT NOT NULL,
+    next_offset BIGINT NOT NULL,
+    version BIGINT NOT NULL DEFAULT 1,   -- bumped on every write, see SaveCheckpoint
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (project_id, source, query)
+);
@@ -0,0 +1,8 @@
+-- NOTE: embedding_chunks belongs to the embedding engine, chunks stored by the ingester
+-- (see orchestrator.Chunk) only rely on id, paper_id, chunk_index, content and this column
+
+ALTER TABLE embedding_chunks
+ADD COLUMN content_hash TEXT;
+
+CREATE INDEX idx_embedding_chunks_paper_hash
+    ON embedding_chunks(paper_id, content_hash);
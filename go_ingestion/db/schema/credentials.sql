@@ -0,0 +1,11 @@
+-- NOTE: only ciphertext is stored, see internal/credentials for the encryption
+
+CREATE TABLE source_credentials (
+    project_id BIGINT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    ciphertext BYTEA NOT NULL,
+    key_id TEXT NOT NULL,       -- which master key encrypted it
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (project_id, source)
+);
@@ -0,0 +1,32 @@
+-- set once crossref was asked, whether or not it knew the DOI
+ALTER TABLE research_papers
+ADD COLUMN crossref_checked_at TIMESTAMPTZ;
+
+-- set when crossref first reports a retraction notice for the paper
+ALTER TABLE research_papers
+ADD COLUMN retracted_at TIMESTAMPTZ;
+
+CREATE TABLE paper_funders (
+    paper_id BIGINT NOT NULL REFERENCES research_papers(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    funder_doi TEXT,             -- open funder registry id, e.g. 10.13039/100000001
+    awards TEXT[] NOT NULL DEFAULT '{}'
+);
+
+CREATE TABLE paper_affiliations (
+    paper_id BIGINT NOT NULL REFERENCES research_papers(id) ON DELETE CASCADE,
+    author_position INT NOT NULL,  -- index in the crossref author list
+    author TEXT NOT NULL,
+    affiliation TEXT NOT NULL
+);
+
+-- the DOIs a paper cites, lowercased, see TopicComparison
+CREATE TABLE paper_references (
+    paper_id BIGINT NOT NULL REFERENCES research_papers(id) ON DELETE CASCADE,
+    cited_doi TEXT NOT NULL,
+    PRIMARY KEY (paper_id, cited_doi)
+);
+
+CREATE INDEX idx_paper_references_doi ON paper_references(cited_doi);
+CREATE INDEX idx_paper_funders_paper ON paper_funders(paper_id);
+CREATE INDEX idx_paper_affiliations_paper ON paper_affiliations(paper_id);
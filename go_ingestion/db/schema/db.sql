@@ -0,0 +1,88 @@
+CREATE TYPE paper_source AS ENUM (
+    'arxiv',
+    'semanticscholar',
+    'springernature'
+);
+
+ALTER TYPE paper_source ADD VALUE 'crossref';
+ALTER TYPE paper_source ADD VALUE 'openalex';
+ALTER TYPE paper_source ADD VALUE 'pubmed';
+ALTER TYPE paper_source ADD VALUE 'ieee';
+ALTER TYPE paper_source ADD VALUE 'core';
+ALTER TYPE paper_source ADD VALUE 'dblp';
+ALTER TYPE paper_source ADD VALUE 'acl';
+
+CREATE TABLE research_papers (
+    id BIGSERIAL PRIMARY KEY,
+
+    source paper_source NOT NULL,
+    source_id TEXT UNIQUE,
+    title TEXT UNIQUE NOT NULL,
+    pdf_url TEXT UNIQUE NOT NULL,
+
+    authors JSONB,
+    doi TEXT,
+    metadata JSONB,
+    embedding_processed BOOLEAN DEFAULT false,   -- replaced by status, see status.go
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX idx_research_papers_source
+    ON research_papers(source);
+
+ALTER TABLE research_papers
+ADD COLUMN topic TEXT;
+
+UPDATE research_papers
+SET topic = 'natural language processing';
+
+ALTER TABLE research_papers
+ALTER COLUMN topic SET NOT NULL;
+
+CREATE INDEX idx_research_papers_topic
+    ON research_papers(topic);
+
+-- normalized, see internal/license
+ALTER TABLE research_papers
+ADD COLUMN license TEXT;
+
+-- see ContentHash, updated_at stays NULL until a re-fetch actually changed the paper
+ALTER TABLE research_papers
+ADD COLUMN content_hash TEXT,
+ADD COLUMN updated_at TIMESTAMPTZ;
+
+-- one sentence machine summary, only semantic scholar reports one
+ALTER TABLE research_papers
+ADD COLUMN tldr TEXT;
+
+-- [{"term": "cs.CL", "primary": true}, ...], primary first, see Category
+ALTER TABLE research_papers
+ADD COLUMN categories JSONB;
+
+-- author keywords and the conference of proceedings papers, only springer reports them
+ALTER TABLE research_papers
+ADD COLUMN keywords TEXT[],
+ADD COLUMN conference TEXT;
+
+-- plain text, see paper.CleanAbstract. Papers stored before only have it in metadata
+ALTER TABLE research_papers
+ADD COLUMN abstract TEXT;
+
+-- ISO 639-1, reported by the source or detected from title and abstract, see internal/language
+ALTER TABLE research_papers
+ADD COLUMN language TEXT;
+
+-- true when the pdf_url answered with a PDF before the paper was stored, NULL when it
+-- wasn't checked, see pdf_mirrors.prevalidate
+ALTER TABLE research_papers
+ADD COLUMN has_pdf BOOLEAN;
+
+-- the journal, proceedings or repository, see SearchFields.Venue. Papers stored before
+-- only have it in metadata
+ALTER TABLE research_papers
+ADD COLUMN venue TEXT;
+
+-- the day the source says the paper was published, NULL when it didn't say. Counted per
+-- topic by topic_daily_counts
+ALTER TABLE research_papers
+ADD COLUMN published_on DATE;
@@ -0,0 +1,20 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_research_papers_title_trgm
+    ON research_papers USING gin (lower(title) gin_trgm_ops);
+
+CREATE INDEX idx_research_papers_doi
+    ON research_papers(project_id, lower(doi));
+
+CREATE TABLE duplicate_reviews (
+    id BIGSERIAL PRIMARY KEY,
+    project_id BIGINT NOT NULL REFERENCES projects(id),
+    -- NOTE: SET NULL keeps the decision around after a merge deletes the paper
+    paper_id BIGINT REFERENCES research_papers(id) ON DELETE SET NULL,
+    candidate_id BIGINT REFERENCES research_papers(id) ON DELETE SET NULL,
+    score DOUBLE PRECISION NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending | merged | distinct
+    created_at TIMESTAMPTZ DEFAULT now(),
+    resolved_at TIMESTAMPTZ,
+    UNIQUE (paper_id, candidate_id)
+);
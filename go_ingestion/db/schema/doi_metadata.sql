@@ -0,0 +1,6 @@
+-- filled from the CSL-JSON doi.org serves for papers whose source left out the venue or
+-- publication date, see crossref.Enrich. Set once doi.org was asked, whether or not it
+-- knew the DOI
+ALTER TABLE research_papers
+ADD COLUMN publisher TEXT,
+ADD COLUMN csl_checked_at TIMESTAMPTZ;
@@ -0,0 +1,15 @@
+-- vectors of several embedding models side by side, e.g. to compare two models on the
+-- same corpus. Every vector belongs to a namespace, the ones from before namespaces to
+-- 'default', the vectors of the routed models
+ALTER TABLE embedding_vectors
+ADD COLUMN namespace TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX embedding_vectors_chunk_namespace ON embedding_vectors (embedding_chunk_id, namespace);
+
+-- the namespaces embedded next to default, each with a partial HNSW index over its
+-- vectors, see RegisterNamespace
+CREATE TABLE embedding_namespaces (
+    name TEXT PRIMARY KEY,
+    model TEXT NOT NULL,
+    dims INT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
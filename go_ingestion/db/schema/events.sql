@@ -0,0 +1,26 @@
+CREATE TYPE paper_event_kind AS ENUM (
+    'ingested',
+    'pdf_downloaded',
+    'chunked',
+    'embedded',
+    'merged',
+    'retracted'
+);
+
+-- NOTE: events are never updated or deleted and paper_id has no foreign key, so the
+-- feed outlives deleted papers
+CREATE TABLE paper_events (
+    id BIGSERIAL PRIMARY KEY,
+    project_id BIGINT NOT NULL REFERENCES projects(id),
+    paper_id BIGINT NOT NULL,
+    kind paper_event_kind NOT NULL,
+    -- the source of an ingested paper or of the record merged into it
+    source paper_source,
+    -- the duplicate folded into paper_id when a review was resolved as merged
+    merged_id BIGINT,
+    txid xid8 NOT NULL DEFAULT pg_current_xact_id(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_paper_events_project
+    ON paper_events(project_id, txid, id);
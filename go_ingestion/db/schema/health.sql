@@ -0,0 +1,6 @@
+CREATE TABLE source_health (
+    source paper_source PRIMARY KEY,
+    healthy BOOLEAN NOT NULL,
+    last_error TEXT,
+    checked_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,8 @@
+CREATE TABLE paper_identifiers (
+    paper_id BIGINT NOT NULL REFERENCES research_papers(id) ON DELETE CASCADE,
+    project_id BIGINT NOT NULL REFERENCES projects(id),
+    scheme TEXT NOT NULL,        -- arxiv | pmid | pmcid | mag | acl | dblp | corpusid | s2
+    value TEXT NOT NULL,         -- see paper.NormalizeIdentifier
+    PRIMARY KEY (paper_id, scheme, value),
+    UNIQUE (project_id, scheme, value)
+);
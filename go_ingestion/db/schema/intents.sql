@@ -0,0 +1,17 @@
+CREATE TABLE page_intents (
+    id BIGSERIAL PRIMARY KEY,
+    project_id BIGINT NOT NULL REFERENCES projects(id),
+    run_id BIGINT REFERENCES runs(id) ON DELETE SET NULL,
+    source paper_source NOT NULL,
+    query TEXT NOT NULL,
+    window_from DATE,
+    window_to DATE,
+    page_offset BIGINT NOT NULL,
+    page_limit BIGINT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'started', -- started | redriving | done | skipped | interrupted
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_page_intents_started
+    ON page_intents(project_id, started_at) WHERE status IN ('started', 'redriving');
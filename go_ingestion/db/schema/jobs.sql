@@ -0,0 +1,29 @@
+CREATE TABLE jobs (
+    id BIGSERIAL PRIMARY KEY,
+    project_id BIGINT NOT NULL REFERENCES projects(id),
+    kind TEXT NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'queued', -- queued | running | done | failed
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    locked_by TEXT,
+    run_after TIMESTAMPTZ NOT NULL DEFAULT now(),
+    priority INT NOT NULL DEFAULT 0,      -- higher is claimed first
+    created_at TIMESTAMPTZ DEFAULT now(),
+    updated_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX idx_jobs_queued
+    ON jobs(project_id, priority DESC, run_after) WHERE status = 'queued';
+
+-- renewed by the worker running the job, see ClaimJob. Jobs running before it existed
+-- count as expired
+ALTER TABLE jobs
+ADD COLUMN lease_until TIMESTAMPTZ;
+
+UPDATE jobs
+SET lease_until = updated_at
+WHERE status = 'running';
+
+CREATE INDEX idx_jobs_running
+    ON jobs(project_id, lease_until) WHERE status = 'running';
@@ -0,0 +1,16 @@
+ALTER TABLE embedding_chunks
+ADD COLUMN keyphrases_at TIMESTAMPTZ; -- NULL until keyphrases were extracted
+
+CREATE TABLE chunk_keyphrases (
+    chunk_id BIGINT NOT NULL REFERENCES embedding_chunks(id) ON DELETE CASCADE,
+    paper_id BIGINT NOT NULL REFERENCES research_papers(id) ON DELETE CASCADE,
+    phrase TEXT NOT NULL,
+    score REAL NOT NULL,
+    PRIMARY KEY (chunk_id, phrase)
+);
+
+CREATE INDEX idx_chunk_keyphrases_phrase
+    ON chunk_keyphrases(phrase);
+
+CREATE INDEX idx_chunk_keyphrases_paper
+    ON chunk_keyphrases(paper_id);
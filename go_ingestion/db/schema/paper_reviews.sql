@@ -0,0 +1,14 @@
+-- papers held back from research_papers until a curator approves them, see config review
+CREATE TABLE paper_reviews (
+    id BIGSERIAL PRIMARY KEY,
+    project_id BIGINT NOT NULL REFERENCES projects(id),
+    source paper_source NOT NULL,
+    source_id TEXT NOT NULL,
+    title TEXT NOT NULL,
+    reasons TEXT[] NOT NULL,       -- no_abstract | few_authors
+    paper JSONB NOT NULL,          -- the mapped ResearchPaper, stored as is once approved
+    status TEXT NOT NULL DEFAULT 'pending', -- pending | approved | rejected
+    created_at TIMESTAMPTZ DEFAULT now(),
+    decided_at TIMESTAMPTZ,
+    UNIQUE (project_id, source, source_id)
+);
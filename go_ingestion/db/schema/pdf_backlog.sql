@@ -0,0 +1,30 @@
+CREATE TABLE pdf_backlog (
+    id BIGSERIAL PRIMARY KEY,
+    project_id BIGINT NOT NULL REFERENCES projects(id),
+    source paper_source NOT NULL,
+    source_id TEXT,
+    doi TEXT NOT NULL,
+    title TEXT NOT NULL,
+    authors JSONB,
+    metadata JSONB,
+    topic TEXT NOT NULL,
+    license TEXT,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending | embargoed | resolved | not_found
+    attempts INT NOT NULL DEFAULT 0,
+    oa_url TEXT,
+    oa_host TEXT,       -- publisher | repository
+    oa_license TEXT,
+    resolved_by TEXT,   -- unpaywall | core | doi.org
+    checked_at TIMESTAMPTZ,
+    recheck_at TIMESTAMPTZ, -- embargoed only, first lookup once the embargo is over
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_pdf_backlog_doi
+    ON pdf_backlog(project_id, lower(doi));
+
+CREATE INDEX idx_pdf_backlog_pending
+    ON pdf_backlog(project_id, checked_at) WHERE status = 'pending';
+
+CREATE INDEX idx_pdf_backlog_embargoed
+    ON pdf_backlog(project_id, recheck_at) WHERE status = 'embargoed';
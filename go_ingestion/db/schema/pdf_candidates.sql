@@ -0,0 +1,9 @@
+CREATE TABLE pdf_candidates (
+    paper_id BIGINT NOT NULL REFERENCES research_papers(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    host TEXT NOT NULL,
+    kind TEXT NOT NULL,    -- arxiv | publisher | repository
+    rank INT NOT NULL,     -- 0 is the research_papers.pdf_url, see config pdf_mirrors
+    created_at TIMESTAMPTZ DEFAULT now(),
+    PRIMARY KEY (paper_id, url)
+);
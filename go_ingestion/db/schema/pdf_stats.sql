@@ -0,0 +1,13 @@
+-- NOTE: kept out of research_papers since it's derived from the downloaded PDF, a
+-- restored snapshot gets it back once its PDFs are downloaded or extracted again
+
+CREATE TABLE pdf_stats (
+    paper_id BIGINT PRIMARY KEY REFERENCES research_papers(id) ON DELETE CASCADE,
+    pages INT,        -- NULL when the page tree couldn't be read
+    text_length INT,  -- characters, NULL until the extract stage wrote text
+    kind TEXT,        -- full | abstract_only | volume, NULL when nothing is known
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_pdf_stats_kind
+    ON pdf_stats(kind);
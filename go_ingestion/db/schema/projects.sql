@@ -0,0 +1,35 @@
+CREATE TABLE projects (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+INSERT INTO projects (name) VALUES ('default');
+
+ALTER TABLE research_papers
+ADD COLUMN project_id BIGINT REFERENCES projects(id);
+
+UPDATE research_papers
+SET project_id = (SELECT id FROM projects WHERE name = 'default');
+
+ALTER TABLE research_papers
+ALTER COLUMN project_id SET NOT NULL;
+
+-- NOTE: uniqueness is per project now, two groups can ingest the same paper
+ALTER TABLE research_papers DROP CONSTRAINT research_papers_source_id_key;
+ALTER TABLE research_papers DROP CONSTRAINT research_papers_title_key;
+ALTER TABLE research_papers DROP CONSTRAINT research_papers_pdf_url_key;
+
+ALTER TABLE research_papers
+ADD CONSTRAINT research_papers_project_source_id_key UNIQUE (project_id, source_id),
+ADD CONSTRAINT research_papers_project_title_key UNIQUE (project_id, title),
+ADD CONSTRAINT research_papers_project_pdf_url_key UNIQUE (project_id, pdf_url);
+
+CREATE INDEX idx_research_papers_project_topic
+    ON research_papers(project_id, topic);
+
+-- NOTE: source ids are only unique within a source, a pubmed id can be an ieee article number
+ALTER TABLE research_papers DROP CONSTRAINT research_papers_project_source_id_key;
+
+ALTER TABLE research_papers
+ADD CONSTRAINT research_papers_project_source_source_id_key UNIQUE (project_id, source, source_id);
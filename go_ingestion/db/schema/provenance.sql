@@ -0,0 +1,5 @@
+ALTER TABLE research_papers
+ADD COLUMN provenance JSONB;
+
+-- {"fields": {"title": "arxiv", "doi": "springernature"},
+--  "conflicts": {"title": {"springernature": "Other Spelling Of The Title"}}}
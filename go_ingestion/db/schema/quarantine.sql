@@ -0,0 +1,12 @@
+CREATE TABLE quarantined_records (
+    project_id BIGINT NOT NULL REFERENCES projects(id),
+    source paper_source NOT NULL,
+    source_id TEXT NOT NULL,
+    failures INT NOT NULL DEFAULT 1,
+    last_error TEXT NOT NULL,
+    payload JSONB,                 -- the raw upstream record, for debugging offline
+    first_failed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_failed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    quarantined_at TIMESTAMPTZ,    -- set once failures reached the threshold, skipped from then on
+    PRIMARY KEY (project_id, source, source_id)
+);
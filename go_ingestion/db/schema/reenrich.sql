@@ -0,0 +1,7 @@
+-- kept fresh by the re-enrichment scheduler, see PapersToReenrich
+ALTER TABLE research_papers
+ADD COLUMN citation_count INT,
+ADD COLUMN open_access BOOLEAN,
+ADD COLUMN reenriched_at TIMESTAMPTZ;
+
+CREATE INDEX idx_research_papers_reenriched ON research_papers(project_id, reenriched_at NULLS FIRST, id);
@@ -0,0 +1,14 @@
+-- NOTE: the chunk/vector tables are owned by the embedding_engine submodule, only the
+-- columns used here are listed
+
+CREATE TABLE embedding_chunks (
+    id BIGSERIAL PRIMARY KEY,
+    paper_id BIGINT NOT NULL,
+    ...
+);
+
+CREATE TABLE embedding_vectors (
+    embedding_chunk_id BIGINT NOT NULL,
+    embedding VECTOR,
+    ...
+);
@@ -0,0 +1,29 @@
+CREATE TABLE runs (
+    id BIGSERIAL PRIMARY KEY,
+    project_id BIGINT NOT NULL REFERENCES projects(id),
+    command TEXT NOT NULL,             -- ingest | backfill | sample
+    query TEXT NOT NULL,
+    started_at TIMESTAMPTZ DEFAULT now(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE TABLE run_sources (
+    run_id BIGINT NOT NULL REFERENCES runs(id) ON DELETE CASCADE,
+    source paper_source NOT NULL,
+    fetched INT NOT NULL DEFAULT 0,
+    inserted INT NOT NULL DEFAULT 0,
+    reviewed INT NOT NULL DEFAULT 0,
+    updated INT NOT NULL DEFAULT 0,   -- re-fetched papers whose content changed
+    skipped JSONB NOT NULL DEFAULT '{}', -- reason -> count, see researchpaperapis.SkipReason
+    PRIMARY KEY (run_id, source)
+);
+
+CREATE INDEX idx_runs_project
+    ON runs(project_id, started_at DESC);
+
+-- heartbeats of the worker of each source, see Heartbeat
+ALTER TABLE run_sources
+    ADD COLUMN last_offset BIGINT,
+    ADD COLUMN heartbeat_at TIMESTAMPTZ,   -- last attempt at a page
+    ADD COLUMN progress_at TIMESTAMPTZ,    -- last page saved or skipped
+    ADD COLUMN stopped_at TIMESTAMPTZ;     -- the worker returned
@@ -0,0 +1,24 @@
+-- NOTE: enum values are declared in pipeline order, so status comparisons follow the pipeline
+
+CREATE TYPE paper_status AS ENUM (
+    'ingested',
+    'downloaded',
+    'extracted',
+    'chunked',
+    'embedded'
+);
+
+ALTER TABLE research_papers
+ADD COLUMN status paper_status NOT NULL DEFAULT 'ingested',
+ADD COLUMN status_at TIMESTAMPTZ;
+
+UPDATE research_papers
+SET status = 'embedded'
+WHERE embedding_processed;
+
+ALTER TABLE research_papers
+DROP COLUMN embedding_processed;
+
+-- every stage finds its backlog with an index scan
+CREATE INDEX idx_research_papers_status
+    ON research_papers(project_id, status, id);
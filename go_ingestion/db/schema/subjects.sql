@@ -0,0 +1,17 @@
+-- NOTE: subjects are shared by all projects, only the links are per paper
+
+CREATE TABLE subjects (
+    id BIGSERIAL PRIMARY KEY,
+    key TEXT UNIQUE NOT NULL,    -- see subject.Key
+    label TEXT NOT NULL          -- first spelling seen
+);
+
+CREATE TABLE paper_subjects (
+    paper_id BIGINT NOT NULL REFERENCES research_papers(id) ON DELETE CASCADE,
+    subject_id BIGINT NOT NULL REFERENCES subjects(id),
+    source paper_source NOT NULL,
+    PRIMARY KEY (paper_id, subject_id)
+);
+
+CREATE INDEX idx_paper_subjects_subject
+    ON paper_subjects(subject_id);
@@ -0,0 +1,15 @@
+CREATE TABLE topics (
+    id BIGSERIAL PRIMARY KEY,
+    project_id BIGINT NOT NULL REFERENCES projects(id),
+    name TEXT NOT NULL,
+    deleted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    UNIQUE (project_id, name)
+);
+
+INSERT INTO topics (project_id, name)
+SELECT DISTINCT project_id, topic FROM research_papers;
+
+-- set on topics registered for the daemon to ingest, see config.Topic.Every
+ALTER TABLE topics
+ADD COLUMN schedule TEXT;
@@ -0,0 +1,9 @@
+CREATE TABLE source_totals (
+    source paper_source NOT NULL,
+    query TEXT NOT NULL,
+    date_window TEXT NOT NULL DEFAULT '',   -- '' for the whole query
+    day DATE NOT NULL,
+    total BIGINT NOT NULL,
+    fetched_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (source, query, date_window, day)
+);
@@ -0,0 +1,15 @@
+-- papers per topic and day of publication, rebuilt from research_papers.published_on
+-- after every run of the topic, see RefreshTopicCounts
+CREATE TABLE topic_daily_counts (
+    project_id BIGINT NOT NULL REFERENCES projects(id),
+    topic TEXT NOT NULL,
+    day DATE NOT NULL,
+    papers INT NOT NULL,
+    PRIMARY KEY (project_id, topic, day)
+);
+
+INSERT INTO topic_daily_counts (project_id, topic, day, papers)
+SELECT project_id, topic, published_on, count(*)
+FROM research_papers
+WHERE published_on IS NOT NULL
+GROUP BY 1, 2, 3;
@@ -0,0 +1,10 @@
+-- NOTE: arxiv source ids end in the version (.../abs/2101.00001v2), a new version replaces
+-- the stored paper in place so its id, chunks and vectors carry over, see ReplacePaperVersion
+
+CREATE TABLE paper_versions (
+    paper_id BIGINT NOT NULL REFERENCES research_papers(id) ON DELETE CASCADE,
+    source_id TEXT NOT NULL,     -- the replaced version
+    content_hash TEXT,
+    replaced_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (paper_id, source_id)
+);
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaOrder(t *testing.T) {
+	schema, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// before is each statement that has to run before another
+	before := []struct{ first, then string }{
+		{"CREATE EXTENSION IF NOT EXISTS pg_trgm;", "CREATE INDEX idx_research_papers_title_trgm"},
+		{"CREATE TYPE paper_source AS ENUM (", "ALTER TYPE paper_source ADD VALUE 'acl';"},
+		{"ALTER TYPE paper_source ADD VALUE 'acl';", "CREATE TABLE research_papers ("},
+		{"CREATE TABLE projects (", "CREATE TABLE ingest_checkpoints ("},
+		{"CREATE TABLE runs (", "CREATE TABLE page_intents ("},
+		{"CREATE TABLE subjects (", "CREATE TABLE paper_subjects ("},
+		{"CREATE TABLE projects (", "ALTER TABLE research_papers\nADD COLUMN project_id"},
+		{"ALTER TABLE research_papers\nADD COLUMN project_id", "CREATE INDEX idx_research_papers_doi"},
+		{"ADD COLUMN reenriched_at TIMESTAMPTZ;", "CREATE INDEX idx_research_papers_reenriched"},
+	}
+	for _, b := range before {
+		first, then := strings.Index(schema, b.first), strings.Index(schema, b.then)
+		switch {
+		case first < 0:
+			t.Errorf("schema is missing %q", b.first)
+		case then < 0:
+			t.Errorf("schema is missing %q", b.then)
+		case first > then:
+			t.Errorf("%q runs after %q", b.first, b.then)
+		}
+	}
+
+	// NOTE: the embedding_engine submodule creates these
+	for _, external := range []string{"CREATE TABLE embedding_chunks", "CREATE TABLE chunk_keyphrases", "ALTER TABLE embedding_vectors", "...", "VECTOR"} {
+		if strings.Contains(schema, external) {
+			t.Errorf("schema contains %q", external)
+		}
+	}
+}
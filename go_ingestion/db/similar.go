@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SimilarPaper is a paper close to another one by embedding, Similarity is the cosine
+// similarity of its closest chunk to the other paper.
+type SimilarPaper struct {
+	ID         uint64      `json:"id"`
+	Source     PaperSource `json:"source"`
+	Title      string      `json:"title"`
+	Topic      string      `json:"topic"`
+	Similarity float64     `json:"similarity"`
+}
+
+// SimilarFilter narrows SimilarPapers down, empty fields don't filter.
+type SimilarFilter struct {
+	Source PaperSource
+	Topic  string
+	// Namespace picks the vectors compared, default when empty
+	Namespace string
+}
+
+// ErrNoEmbeddings is returned for papers that have no vectors yet.
+var ErrNoEmbeddings = errors.New("paper has no embeddings")
+
+// similarOversample is how many nearest chunks are looked at per paper returned, papers
+// have many chunks close to each other
+const similarOversample = 20
+
+// SimilarPapers returns the k papers of the project nearest to paper id, by the distance of
+// their chunks to the centroid of its chunks.
+//
+// NOTE: the nearest chunks are found with the vector index and only then grouped by paper,
+// so with narrow filters fewer than k papers may come back
+func SimilarPapers(ctx context.Context, dbPool *pgxpool.Pool, projectID, paperID uint64, k int, filter SimilarFilter) ([]SimilarPaper, error) {
+	namespace := orDefaultNamespace(filter.Namespace)
+	dims, err := namespaceDims(ctx, dbPool, namespace)
+	if err != nil {
+		return nil, err
+	}
+	// NOTE: a registered namespace is searched through its partial index, which only
+	// matches the vectors cast to its dimensions
+	embedding := "v.embedding"
+	if dims > 0 {
+		embedding = fmt.Sprintf("v.embedding::vector(%d)", dims)
+	}
+
+	var embedded bool
+	err = dbPool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM embedding_vectors v
+			JOIN embedding_chunks c ON c.id = v.embedding_chunk_id
+			JOIN research_papers p ON p.id = c.paper_id
+			WHERE p.project_id = $1 AND p.id = $2 AND v.namespace = $3
+		);
+	`, projectID, paperID, namespace).Scan(&embedded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up embeddings of paper %d: %w", paperID, err)
+	}
+	if !embedded {
+		return nil, fmt.Errorf("%w: %d", ErrNoEmbeddings, paperID)
+	}
+
+	rows, err := dbPool.Query(ctx, fmt.Sprintf(`
+		WITH target AS (
+			SELECT avg(%[1]s) AS embedding
+			FROM embedding_vectors v
+			JOIN embedding_chunks c ON c.id = v.embedding_chunk_id
+			WHERE c.paper_id = $2 AND v.namespace = $7
+		), nearest AS (
+			SELECT c.paper_id, %[1]s <=> (SELECT embedding FROM target) AS distance
+			FROM embedding_vectors v
+			JOIN embedding_chunks c ON c.id = v.embedding_chunk_id
+			JOIN research_papers p ON p.id = c.paper_id
+			WHERE p.project_id = $1 AND p.id <> $2 AND v.namespace = $7
+				AND ($3 = '' OR p.source::text = $3)
+				AND ($4 = '' OR p.topic = $4)
+			ORDER BY %[1]s <=> (SELECT embedding FROM target)
+			LIMIT $5
+		)
+		SELECT p.id, p.source, p.title, p.topic, 1 - min(n.distance)
+		FROM nearest n
+		JOIN research_papers p ON p.id = n.paper_id
+		GROUP BY p.id
+		ORDER BY min(n.distance)
+		LIMIT $6;
+	`, embedding), projectID, paperID, string(filter.Source), filter.Topic, k*similarOversample, k, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find papers similar to %d: %w", paperID, err)
+	}
+	defer rows.Close()
+
+	var papers []SimilarPaper
+	for rows.Next() {
+		var p SimilarPaper
+		if err := rows.Scan(&p.ID, &p.Source, &p.Title, &p.Topic, &p.Similarity); err != nil {
+			return nil, fmt.Errorf("failed to scan similar paper: %w", err)
+		}
+		papers = append(papers, p)
+	}
+	return papers, rows.Err()
+}
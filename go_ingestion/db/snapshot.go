@@ -0,0 +1,278 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// NOTE: chunks and vectors are exported as generic jsonb rows so snapshots don't depend on
+// the exact embedding_engine schema
+
+func TableExists(ctx context.Context, dbPool *pgxpool.Pool, table string) (bool, error) {
+	var exists bool
+	err := dbPool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL;`, table).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check table %s: %w", table, err)
+	}
+	return exists, nil
+}
+
+func ForEachProjectPaper(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, fn func(ResearchPaper) error) error {
+	return ForEachTopicPaper(ctx, dbPool, projectID, "", fn)
+}
+
+// ForEachTopicPaper calls fn with every paper of a topic, all topics when topic is "".
+func ForEachTopicPaper(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, topic string, fn func(ResearchPaper) error) error {
+	query := `
+		SELECT id, project_id, source, source_id, title, pdf_url, authors, doi, metadata, status, topic, license, provenance, content_hash, created_at, updated_at, tldr, categories, keywords, conference, abstract, language, has_pdf, COALESCE(venue, ''), published_on
+		FROM research_papers
+		WHERE project_id = $1 AND ($2 = '' OR topic = $2)
+		ORDER BY id;
+	`
+
+	rows, err := dbPool.Query(ctx, query, projectID, topic)
+	if err != nil {
+		return fmt.Errorf("failed to query papers: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var paper ResearchPaper
+		err := rows.Scan(
+			&paper.ID,
+			&paper.ProjectID,
+			&paper.Source,
+			&paper.SourceID,
+			&paper.Title,
+			&paper.PDFURL,
+			&paper.Authors,
+			&paper.DOI,
+			&paper.Metadata,
+			&paper.Status,
+			&paper.Topic,
+			&paper.License,
+			&paper.Provenance,
+			&paper.ContentHash,
+			&paper.CreatedAt,
+			&paper.UpdatedAt,
+			&paper.TLDR,
+			&paper.Categories,
+			&paper.Keywords,
+			&paper.Conference,
+			&paper.Abstract,
+			&paper.Language,
+			&paper.HasPDF,
+			&paper.Search.Venue,
+			&paper.PublishedOn,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan paper: %w", err)
+		}
+
+		if err := fn(paper); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func ForEachProjectChunk(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, fn func(json.RawMessage) error) error {
+	query := `
+		SELECT to_jsonb(c)
+		FROM embedding_chunks c
+		JOIN research_papers p ON p.id = c.paper_id
+		WHERE p.project_id = $1
+		ORDER BY c.id;
+	`
+	return forEachJSONRow(ctx, dbPool, query, projectID, fn)
+}
+
+func ForEachProjectVector(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, fn func(json.RawMessage) error) error {
+	query := `
+		SELECT to_jsonb(v)
+		FROM embedding_vectors v
+		JOIN embedding_chunks c ON c.id = v.embedding_chunk_id
+		JOIN research_papers p ON p.id = c.paper_id
+		WHERE p.project_id = $1
+		ORDER BY v.embedding_chunk_id;
+	`
+	return forEachJSONRow(ctx, dbPool, query, projectID, fn)
+}
+
+func forEachJSONRow(ctx context.Context, dbPool *pgxpool.Pool, query string, projectID uint64, fn func(json.RawMessage) error) error {
+	rows, err := dbPool.Query(ctx, query, projectID)
+	if err != nil {
+		return fmt.Errorf("failed to query rows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row json.RawMessage
+		if err := rows.Scan(&row); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// RestorePaper inserts a snapshot paper into the given project, keeping its status.
+func RestorePaper(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, paper ResearchPaper) (uint64, error) {
+	query := `
+		INSERT INTO research_papers (project_id, source, source_id, title, pdf_url, authors, doi, metadata, status, topic, license, provenance, content_hash, created_at, updated_at, tldr, categories, keywords, conference, abstract, language, has_pdf, venue, published_on)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, NULLIF($23, ''), $24)
+		RETURNING id;
+	`
+
+	var id uint64
+	err := dbPool.QueryRow(ctx, query, projectID, paper.Source, paper.SourceID, paper.Title, paper.PDFURL, paper.Authors, paper.DOI, paper.Metadata, paper.Status, paper.Topic, paper.License, paper.Provenance, paper.ContentHash, paper.CreatedAt, paper.UpdatedAt, paper.TLDR, paper.Categories, paper.Keywords, paper.Conference, paper.Abstract, paper.Language, paper.HasPDF, paper.Search.Venue, paper.PublishedOn).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to restore paper %q: %w", paper.Title, err)
+	}
+	return id, nil
+}
+
+// SnapshotSubject is a subject of a paper with the source that filed it there.
+type SnapshotSubject struct {
+	Key    string      `json:"key"`
+	Label  string      `json:"label"`
+	Source PaperSource `json:"source"`
+}
+
+// ProjectPaperIdentifiers returns the identifiers of every paper of the project by paper id.
+func ProjectPaperIdentifiers(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64) (map[uint64][]Identifier, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT paper_id, scheme, value FROM paper_identifiers
+		WHERE project_id = $1
+		ORDER BY paper_id, scheme, value;
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query identifiers: %w", err)
+	}
+	defer rows.Close()
+
+	identifiers := map[uint64][]Identifier{}
+	for rows.Next() {
+		var paperID uint64
+		var id Identifier
+		if err := rows.Scan(&paperID, &id.Scheme, &id.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan identifier: %w", err)
+		}
+		identifiers[paperID] = append(identifiers[paperID], id)
+	}
+	return identifiers, rows.Err()
+}
+
+// ProjectPaperSubjects returns the subjects of every paper of the project by paper id.
+func ProjectPaperSubjects(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64) (map[uint64][]SnapshotSubject, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT ps.paper_id, s.key, s.label, ps.source
+		FROM paper_subjects ps
+		JOIN subjects s ON s.id = ps.subject_id
+		JOIN research_papers p ON p.id = ps.paper_id
+		WHERE p.project_id = $1
+		ORDER BY ps.paper_id, s.key;
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subjects: %w", err)
+	}
+	defer rows.Close()
+
+	subjects := map[uint64][]SnapshotSubject{}
+	for rows.Next() {
+		var paperID uint64
+		var s SnapshotSubject
+		if err := rows.Scan(&paperID, &s.Key, &s.Label, &s.Source); err != nil {
+			return nil, fmt.Errorf("failed to scan subject: %w", err)
+		}
+		subjects[paperID] = append(subjects[paperID], s)
+	}
+	return subjects, rows.Err()
+}
+
+// ProjectPDFCandidates returns the candidates of every paper of the project by paper id,
+// preferred first.
+func ProjectPDFCandidates(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64) (map[uint64][]PDFCandidate, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT c.paper_id, c.url, c.host, c.kind
+		FROM pdf_candidates c
+		JOIN research_papers p ON p.id = c.paper_id
+		WHERE p.project_id = $1
+		ORDER BY c.paper_id, c.rank;
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pdf candidates: %w", err)
+	}
+	defer rows.Close()
+
+	candidates := map[uint64][]PDFCandidate{}
+	for rows.Next() {
+		var paperID uint64
+		var c PDFCandidate
+		if err := rows.Scan(&paperID, &c.URL, &c.Host, &c.Kind); err != nil {
+			return nil, fmt.Errorf("failed to scan pdf candidate: %w", err)
+		}
+		candidates[paperID] = append(candidates[paperID], c)
+	}
+	return candidates, rows.Err()
+}
+
+// RestoreChunk inserts a jsonb chunk row with a fresh id and returns it.
+func RestoreChunk(ctx context.Context, dbPool *pgxpool.Pool, row json.RawMessage) (int64, error) {
+	return insertJSONRow(ctx, dbPool, "embedding_chunks", row, "id", true)
+}
+
+func RestoreVector(ctx context.Context, dbPool *pgxpool.Pool, row json.RawMessage) error {
+	_, err := insertJSONRow(ctx, dbPool, "embedding_vectors", row, "id", false)
+	return err
+}
+
+func insertJSONRow(ctx context.Context, dbPool *pgxpool.Pool, table string, row json.RawMessage, omit string, returnID bool) (int64, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT column_name
+		FROM information_schema.columns
+		WHERE table_name = $1 AND column_name <> $2
+		ORDER BY ordinal_position;
+	`, table, omit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s columns: %w", table, err)
+	}
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		columns = append(columns, `"`+column+`"`)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	cols := strings.Join(columns, ", ")
+	query := fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM jsonb_populate_record(NULL::%s, $1)`, table, cols, cols, table)
+
+	if !returnID {
+		if _, err := dbPool.Exec(ctx, query, row); err != nil {
+			return 0, fmt.Errorf("failed to restore %s row: %w", table, err)
+		}
+		return 0, nil
+	}
+
+	var id int64
+	if err := dbPool.QueryRow(ctx, query+" RETURNING id", row).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to restore %s row: %w", table, err)
+	}
+	return id, nil
+}
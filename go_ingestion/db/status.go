@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PaperStatus string
+
+const (
+	StatusIngested   PaperStatus = "ingested"
+	StatusDownloaded PaperStatus = "downloaded"
+	StatusExtracted  PaperStatus = "extracted"
+	StatusChunked    PaperStatus = "chunked"
+	StatusEmbedded   PaperStatus = "embedded"
+)
+
+// PaperStatuses are the pipeline stages in order.
+var PaperStatuses = []PaperStatus{StatusIngested, StatusDownloaded, StatusExtracted, StatusChunked, StatusEmbedded}
+
+// ParsePaperStatus returns the status named s.
+func ParsePaperStatus(s string) (PaperStatus, error) {
+	for _, status := range PaperStatuses {
+		if string(status) == s {
+			return status, nil
+		}
+	}
+	return "", fmt.Errorf("unknown paper status %q, expected one of %v", s, PaperStatuses)
+}
+
+// AdvancePaperStatus moves a paper to status, it reports false when the paper already was
+// at or past it since a stage never moves a paper back. Reaching downloaded, chunked or
+// embedded is recorded as a paper event.
+func AdvancePaperStatus(ctx context.Context, dbPool *pgxpool.Pool, projectID, paperID uint64, status PaperStatus) (bool, error) {
+	query := `
+		UPDATE research_papers
+		SET status = $3, status_at = now()
+		WHERE project_id = $1 AND id = $2 AND status < $3;
+	`
+	args := []any{projectID, paperID, status}
+	if kind, ok := statusEvents[status]; ok {
+		query = `
+			WITH moved AS (
+				UPDATE research_papers
+				SET status = $3, status_at = now()
+				WHERE project_id = $1 AND id = $2 AND status < $3
+				RETURNING id
+			)
+			INSERT INTO paper_events (project_id, paper_id, kind)
+			SELECT $1, id, $4 FROM moved;
+		`
+		args = append(args, kind)
+	}
+
+	tag, err := dbPool.Exec(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to move paper %d to %s: %w", paperID, status, err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// PapersWithStatus returns up to limit papers waiting at status, oldest first, which is
+// the backlog of the stage after it.
+func PapersWithStatus(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, status PaperStatus, limit int) ([]uint64, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT id FROM research_papers
+		WHERE project_id = $1 AND status = $2
+		ORDER BY id
+		LIMIT $3;
+	`, projectID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s papers: %w", status, err)
+	}
+	defer rows.Close()
+
+	var ids []uint64
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan paper id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// PaperPDFURL returns the pdf_url of a paper of the project.
+func PaperPDFURL(ctx context.Context, dbPool *pgxpool.Pool, projectID, paperID uint64) (string, error) {
+	var pdfURL string
+	err := dbPool.QueryRow(ctx, `SELECT pdf_url FROM research_papers WHERE project_id = $1 AND id = $2;`, projectID, paperID).Scan(&pdfURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to get pdf url of paper %d: %w", paperID, err)
+	}
+	return pdfURL, nil
+}
+
+// PaperLanguage returns the language of a paper of the project, "" when it isn't known.
+func PaperLanguage(ctx context.Context, dbPool *pgxpool.Pool, projectID, paperID uint64) (string, error) {
+	var lang string
+	err := dbPool.QueryRow(ctx, `SELECT COALESCE(language, '') FROM research_papers WHERE project_id = $1 AND id = $2;`, projectID, paperID).Scan(&lang)
+	if err != nil {
+		return "", fmt.Errorf("failed to get language of paper %d: %w", paperID, err)
+	}
+	return lang, nil
+}
+
+// StatusCount is how many papers wait at a status and when the oldest of them got there.
+type StatusCount struct {
+	Status PaperStatus `json:"status"`
+	Papers int         `json:"papers"`
+	Oldest *time.Time  `json:"oldest,omitempty"`
+}
+
+// StatusFunnel counts the papers of a project per status, every status is listed in
+// pipeline order even when no paper is at it.
+func StatusFunnel(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64) ([]StatusCount, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT status, count(*), min(COALESCE(status_at, created_at))
+		FROM research_papers
+		WHERE project_id = $1
+		GROUP BY status;
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count paper statuses: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[PaperStatus]StatusCount, len(PaperStatuses))
+	for rows.Next() {
+		var c StatusCount
+		if err := rows.Scan(&c.Status, &c.Papers, &c.Oldest); err != nil {
+			return nil, fmt.Errorf("failed to scan status count: %w", err)
+		}
+		counts[c.Status] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	funnel := make([]StatusCount, 0, len(PaperStatuses))
+	for _, status := range PaperStatuses {
+		c := counts[status]
+		c.Status = status
+		funnel = append(funnel, c)
+	}
+	return funnel, nil
+}
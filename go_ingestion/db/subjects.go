@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Subject struct {
+	Key   string
+	Label string
+}
+
+// SubjectFacet is how many papers of a project are filed under a subject.
+type SubjectFacet struct {
+	Subject
+	Papers int
+}
+
+// LinkPaperSubjects files paper id under subjects, creating the subjects that are new.
+func LinkPaperSubjects(ctx context.Context, dbPool *pgxpool.Pool, paperID uint64, source PaperSource, subjects []Subject) error {
+	keys := make([]string, len(subjects))
+	labels := make([]string, len(subjects))
+	for i, s := range subjects {
+		keys[i], labels[i] = s.Key, s.Label
+	}
+
+	_, err := dbPool.Exec(ctx, `
+		WITH input AS (
+			SELECT * FROM unnest($3::text[], $4::text[]) AS s(key, label)
+		), upserted AS (
+			INSERT INTO subjects (key, label)
+			SELECT key, label FROM input
+			ON CONFLICT (key) DO UPDATE SET key = EXCLUDED.key
+			RETURNING id
+		)
+		INSERT INTO paper_subjects (paper_id, subject_id, source)
+		SELECT $1, id, $2 FROM upserted
+		ON CONFLICT DO NOTHING;
+	`, paperID, source, keys, labels)
+	if err != nil {
+		return fmt.Errorf("failed to link subjects of paper %d: %w", paperID, err)
+	}
+	return nil
+}
+
+// SubjectFacets returns the subjects of a project by paper count, at most limit of them.
+func SubjectFacets(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, limit int) ([]SubjectFacet, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT s.key, s.label, count(DISTINCT ps.paper_id)
+		FROM paper_subjects ps
+		JOIN subjects s ON s.id = ps.subject_id
+		JOIN research_papers p ON p.id = ps.paper_id
+		WHERE p.project_id = $1
+		GROUP BY s.id
+		ORDER BY 3 DESC, s.label
+		LIMIT $2;
+	`, projectID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count subjects: %w", err)
+	}
+	defer rows.Close()
+
+	var facets []SubjectFacet
+	for rows.Next() {
+		var f SubjectFacet
+		if err := rows.Scan(&f.Key, &f.Label, &f.Papers); err != nil {
+			return nil, fmt.Errorf("failed to scan subject: %w", err)
+		}
+		facets = append(facets, f)
+	}
+	return facets, rows.Err()
+}
+
+// PaperIDsBySubject returns the papers of a project filed under the subject key.
+func PaperIDsBySubject(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, key string) ([]uint64, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT p.id
+		FROM research_papers p
+		JOIN paper_subjects ps ON ps.paper_id = p.id
+		JOIN subjects s ON s.id = ps.subject_id
+		WHERE p.project_id = $1 AND s.key = $2
+		ORDER BY p.id;
+	`, projectID, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list papers of subject %q: %w", key, err)
+	}
+	defer rows.Close()
+
+	var ids []uint64
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan paper id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
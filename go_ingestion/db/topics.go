@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ScheduledTopic is a topic registered in the database rather than in the config.
+type ScheduledTopic struct {
+	Name     string
+	Schedule string
+}
+
+// RegisterTopic records name for the daemon to ingest on schedule, it reports false when
+// the project already had the topic.
+func RegisterTopic(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, name, schedule string) (bool, error) {
+	tag, err := dbPool.Exec(ctx, `
+		INSERT INTO topics (project_id, name, schedule)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (project_id, name) DO NOTHING;
+	`, projectID, name, schedule)
+	if err != nil {
+		return false, fmt.Errorf("failed to register topic %q: %w", name, err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ScheduledTopics returns the registered topics that aren't deleted.
+func ScheduledTopics(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64) ([]ScheduledTopic, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT name, schedule FROM topics
+		WHERE project_id = $1 AND schedule IS NOT NULL AND deleted_at IS NULL
+		ORDER BY name;
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled topics: %w", err)
+	}
+	defer rows.Close()
+
+	var topics []ScheduledTopic
+	for rows.Next() {
+		var t ScheduledTopic
+		if err := rows.Scan(&t.Name, &t.Schedule); err != nil {
+			return nil, fmt.Errorf("failed to scan topic: %w", err)
+		}
+		topics = append(topics, t)
+	}
+	return topics, rows.Err()
+}
+
+// RelatedTerms counts the subjects and keywords of a topic's papers, leaving out terms
+// that already are a topic of the project.
+func RelatedTerms(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, topic string, limit int) ([]NameCount, error) {
+	return countNames(ctx, dbPool, `
+		WITH terms AS (
+			SELECT p.id AS paper_id, s.label AS term
+			FROM research_papers p
+			JOIN paper_subjects ps ON ps.paper_id = p.id
+			JOIN subjects s ON s.id = ps.subject_id
+			WHERE p.project_id = $1 AND p.topic = $2
+			UNION ALL
+			SELECT p.id, k
+			FROM research_papers p, unnest(p.keywords) AS k
+			WHERE p.project_id = $1 AND p.topic = $2
+		)
+		SELECT min(term), count(DISTINCT paper_id)
+		FROM terms
+		WHERE lower(term) NOT IN (
+			SELECT lower(name) FROM topics WHERE project_id = $1
+			UNION
+			SELECT DISTINCT lower(topic) FROM research_papers WHERE project_id = $1
+		)
+		GROUP BY lower(term)
+		ORDER BY 2 DESC, 1
+		LIMIT $3;
+	`, projectID, topic, limit)
+}
+
+// MarkTopicDeleted soft deletes a topic, its papers are removed by the next retention run.
+func MarkTopicDeleted(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, name string) error {
+	query := `
+		INSERT INTO topics (project_id, name, deleted_at)
+		VALUES ($1, $2, now())
+		ON CONFLICT (project_id, name) DO UPDATE SET deleted_at = now();
+	`
+
+	if _, err := dbPool.Exec(ctx, query, projectID, name); err != nil {
+		return fmt.Errorf("failed to delete topic %q: %w", name, err)
+	}
+	return nil
+}
+
+// DeletePapersOfDeletedTopics removes papers (and the topic rows) of soft deleted topics.
+func DeletePapersOfDeletedTopics(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64) (int64, error) {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		DELETE FROM research_papers p
+		USING topics t
+		WHERE t.project_id = $1
+			AND t.deleted_at IS NOT NULL
+			AND p.project_id = t.project_id
+			AND p.topic = t.name;
+	`, projectID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete papers of deleted topics: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM topic_daily_counts c
+		USING topics t
+		WHERE t.project_id = $1
+			AND t.deleted_at IS NOT NULL
+			AND c.project_id = t.project_id
+			AND c.topic = t.name;
+	`, projectID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete daily counts of deleted topics: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM topics WHERE project_id = $1 AND deleted_at IS NOT NULL;`, projectID); err != nil {
+		return 0, fmt.Errorf("failed to delete topics: %w", err)
+	}
+
+	return tag.RowsAffected(), tx.Commit(ctx)
+}
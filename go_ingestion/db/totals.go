@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// NOTE: totals aren't per project, every project asking the same source the same thing
+// gets the same answer
+
+// GetSourceTotal returns the total fetched for source, query and window on day.
+func GetSourceTotal(ctx context.Context, dbPool *pgxpool.Pool, source PaperSource, query, window string, day time.Time) (uint64, bool, error) {
+	var total uint64
+	err := dbPool.QueryRow(ctx, `
+		SELECT total FROM source_totals
+		WHERE source = $1 AND query = $2 AND date_window = $3 AND day = $4;
+	`, source, query, window, day).Scan(&total)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get %s total: %w", source, err)
+	}
+	return total, true, nil
+}
+
+// LatestSourceTotal returns the most recent total fetched for source and query, any day.
+func LatestSourceTotal(ctx context.Context, dbPool *pgxpool.Pool, source PaperSource, query string) (uint64, bool, error) {
+	var total uint64
+	err := dbPool.QueryRow(ctx, `
+		SELECT total FROM source_totals
+		WHERE source = $1 AND query = $2 AND date_window = ''
+		ORDER BY day DESC
+		LIMIT 1;
+	`, source, query).Scan(&total)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get latest %s total: %w", source, err)
+	}
+	return total, true, nil
+}
+
+func SaveSourceTotal(ctx context.Context, dbPool *pgxpool.Pool, source PaperSource, query, window string, day time.Time, total uint64) error {
+	_, err := dbPool.Exec(ctx, `
+		INSERT INTO source_totals (source, query, date_window, day, total)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (source, query, date_window, day) DO UPDATE
+		SET total = EXCLUDED.total, fetched_at = now();
+	`, source, query, window, day, total)
+	if err != nil {
+		return fmt.Errorf("failed to save %s total: %w", source, err)
+	}
+	return nil
+}
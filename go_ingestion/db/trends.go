@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TrendBuckets are the periods a trend can be counted by
+var TrendBuckets = []string{"day", "week", "month", "year"}
+
+type TrendPoint struct {
+	// Bucket is the first day of the period
+	Bucket time.Time `json:"bucket"`
+	Papers int       `json:"papers"`
+	// Partial periods start before or end after the trend, their count isn't complete
+	Partial bool `json:"partial,omitempty"`
+}
+
+type Trend struct {
+	Topic  string       `json:"topic"`
+	By     string       `json:"by"`
+	Points []TrendPoint `json:"points"`
+	// Growth is how much the papers per period change from one period to the next, relative
+	// to the average period, see TrendGrowth
+	Growth float64 `json:"growth"`
+}
+
+// RefreshTopicCounts recounts the papers of topic per day of publication, papers without a
+// publication date aren't counted.
+func RefreshTopicCounts(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, topic string) error {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM topic_daily_counts WHERE project_id = $1 AND topic = $2;`, projectID, topic); err != nil {
+		return fmt.Errorf("failed to clear daily counts of topic %q: %w", topic, err)
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO topic_daily_counts (project_id, topic, day, papers)
+		SELECT project_id, topic, published_on, count(*)
+		FROM research_papers
+		WHERE project_id = $1 AND topic = $2 AND published_on IS NOT NULL
+		GROUP BY 1, 2, 3;
+	`, projectID, topic)
+	if err != nil {
+		return fmt.Errorf("failed to count daily papers of topic %q: %w", topic, err)
+	}
+	return tx.Commit(ctx)
+}
+
+// TopicTrend counts the papers of topic published from from until to (days, inclusive) per
+// bucket, one of TrendBuckets. Periods without papers are counted as 0.
+func TopicTrend(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, topic, by string, from, to time.Time) (Trend, error) {
+	trend := Trend{Topic: topic, By: by, Points: []TrendPoint{}}
+	if !slices.Contains(TrendBuckets, by) {
+		return trend, fmt.Errorf("invalid trend bucket %q, expected one of %v", by, TrendBuckets)
+	}
+
+	rows, err := dbPool.Query(ctx, `
+		WITH buckets AS (
+			SELECT generate_series(date_trunc($3, $4::timestamp), date_trunc($3, $5::timestamp), ('1 ' || $3)::interval)::date AS bucket
+		)
+		SELECT b.bucket, COALESCE(sum(c.papers), 0)::int,
+			b.bucket < $4::date OR (b.bucket + ('1 ' || $3)::interval)::date > $5::date + 1
+		FROM buckets b
+		LEFT JOIN topic_daily_counts c
+			ON c.project_id = $1 AND c.topic = $2
+			AND c.day BETWEEN $4::date AND $5::date
+			AND date_trunc($3, c.day::timestamp)::date = b.bucket
+		GROUP BY b.bucket
+		ORDER BY b.bucket;
+	`, projectID, topic, by, from, to)
+	if err != nil {
+		return trend, fmt.Errorf("failed to count the trend of topic %q: %w", topic, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p TrendPoint
+		if err := rows.Scan(&p.Bucket, &p.Papers, &p.Partial); err != nil {
+			return trend, fmt.Errorf("failed to scan trend point: %w", err)
+		}
+		trend.Points = append(trend.Points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return trend, err
+	}
+
+	trend.Growth = TrendGrowth(trend.Points)
+	return trend, nil
+}
+
+// ParseTrendRange reads from and to as YYYY-MM-DD, to defaults to today and from to two
+// years before to.
+func ParseTrendRange(from, to string, now time.Time) (time.Time, time.Time, error) {
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if to != "" {
+		t, err := time.Parse(time.DateOnly, to)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to %q, expected YYYY-MM-DD: %w", to, err)
+		}
+		end = t
+	}
+	start := end.AddDate(-2, 0, 0)
+	if from != "" {
+		t, err := time.Parse(time.DateOnly, from)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from %q, expected YYYY-MM-DD: %w", from, err)
+		}
+		start = t
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%s is before %s", end.Format(time.DateOnly), start.Format(time.DateOnly))
+	}
+	return start, end, nil
+}
+
+// TrendGrowth fits a line through the papers of the complete periods and returns its slope
+// divided by the average, 0.05 is 5% of an average period more every period. It is 0 with
+// fewer than two complete periods or no papers.
+func TrendGrowth(points []TrendPoint) float64 {
+	var ys []float64
+	for _, p := range points {
+		if !p.Partial {
+			ys = append(ys, float64(p.Papers))
+		}
+	}
+	n := float64(len(ys))
+	if n < 2 {
+		return 0
+	}
+
+	var sumX, sumY, sumXY, sumXX float64
+	for i, y := range ys {
+		x := float64(i)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	if sumY == 0 {
+		return 0
+	}
+	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	return slope / (sumY / n)
+}
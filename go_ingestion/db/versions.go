@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// StoredVersion is the version of a paper currently stored.
+type StoredVersion struct {
+	PaperID  uint64
+	SourceID string
+}
+
+// StoredVersions returns the stored papers of source whose source id is one of bases plus
+// a version suffix, keyed by base.
+func StoredVersions(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, source PaperSource, bases []string) (map[string]StoredVersion, error) {
+	rows, err := dbPool.Query(ctx, `
+		SELECT regexp_replace(source_id, 'v[0-9]+$', ''), id, source_id
+		FROM research_papers
+		WHERE project_id = $1 AND source = $2 AND regexp_replace(source_id, 'v[0-9]+$', '') = ANY($3);
+	`, projectID, source, bases)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up stored versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := make(map[string]StoredVersion)
+	for rows.Next() {
+		var base string
+		var v StoredVersion
+		if err := rows.Scan(&base, &v.PaperID, &v.SourceID); err != nil {
+			return nil, fmt.Errorf("failed to scan stored version: %w", err)
+		}
+		versions[base] = v
+	}
+	return versions, rows.Err()
+}
+
+// ReplacePaperVersion overwrites paper id with a newer version of it and sends it back
+// through the processing stages, the replaced source id is kept in paper_versions.
+func ReplacePaperVersion(ctx context.Context, dbPool *pgxpool.Pool, projectID, paperID uint64, paper ResearchPaper) error {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO paper_versions (paper_id, source_id, content_hash)
+		SELECT id, source_id, content_hash FROM research_papers
+		WHERE project_id = $1 AND id = $2
+		ON CONFLICT DO NOTHING;
+	`, projectID, paperID)
+	if err != nil {
+		return fmt.Errorf("failed to keep previous version of paper %d: %w", paperID, err)
+	}
+
+	hash := ContentHash(paper)
+	_, err = tx.Exec(ctx, `
+		UPDATE research_papers
+		SET source_id = $3, title = $4, pdf_url = $5, authors = $6, doi = $7, metadata = $8,
+		    license = $9, content_hash = $10, tldr = $11, categories = $12, keywords = $13,
+		    conference = $14, abstract = $15, language = $16, venue = NULLIF($17, ''), published_on = $18,
+		    status = 'ingested', status_at = now(), updated_at = now()
+		WHERE project_id = $1 AND id = $2;
+	`, projectID, paperID, paper.SourceID, paper.Title, paper.PDFURL, paper.Authors, paper.DOI, paper.Metadata, paper.License, hash, paper.TLDR, paper.Categories, paper.Keywords, paper.Conference, paper.Abstract, paper.Language, paper.Search.Venue, paper.PublishedOn)
+	if err != nil {
+		return fmt.Errorf("failed to replace paper %d with %s: %w", paperID, nullableString(paper.SourceID), err)
+	}
+
+	return tx.Commit(ctx)
+}
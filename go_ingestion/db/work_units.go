@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LockWorkUnit takes the session level advisory lock of unit, e.g. the topic of an ingest,
+// so two attempts of one orchestrator task never run side by side. ok is false when
+// another attempt holds it. unlock releases the lock and its connection.
+func LockWorkUnit(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, unit string) (unlock func(), ok bool, err error) {
+	// NOTE: the lock lives on this one connection, it must not go back to the pool while held
+	conn, err := dbPool.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	key := fmt.Sprintf("%d/%s", projectID, unit)
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(hashtextextended($1, 0));`, key).Scan(&ok); err != nil {
+		conn.Release()
+		return nil, false, fmt.Errorf("failed to try advisory lock of %q: %w", unit, err)
+	}
+	if !ok {
+		conn.Release()
+		return nil, false, nil
+	}
+
+	return func() {
+		// NOTE: background ctx, the unlock must happen even when ctx is already cancelled
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock(hashtextextended($1, 0));`, key); err != nil {
+			log.Printf("[LOCK] failed to release %q: %v", unit, err)
+		}
+		conn.Release()
+	}, true, nil
+}
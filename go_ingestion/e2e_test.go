@@ -0,0 +1,175 @@
+//go:build e2e
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"go_ingestion/ingest"
+	"go_ingestion/internal/credentials"
+	"go_ingestion/internal/sink"
+	"go_ingestion/internal/testsupport"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ory/dockertest/v3"
+)
+
+// startPostgres runs a throwaway postgres in docker with db.Schema applied, DATABASE_URL
+// points at it for the rest of the test.
+func startPostgres(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		t.Fatalf("failed to reach docker: %v", err)
+	}
+	pool.MaxWait = 2 * time.Minute
+
+	resource, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository: "postgres",
+		Tag:        "16",
+		Env:        []string{"POSTGRES_PASSWORD=postgres", "POSTGRES_DB=researchq_e2e"},
+	})
+	if err != nil {
+		t.Fatalf("failed to start postgres: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := pool.Purge(resource); err != nil {
+			t.Logf("failed to remove postgres: %v", err)
+		}
+	})
+	// NOTE: a test killed before its cleanup doesn't leave the container running for long
+	if err := resource.Expire(600); err != nil {
+		t.Logf("failed to set the postgres expiry: %v", err)
+	}
+
+	t.Setenv("DATABASE_URL", fmt.Sprintf("postgres://postgres:postgres@%s/researchq_e2e?sslmode=disable", resource.GetHostPort("5432/tcp")))
+	var dbPool *pgxpool.Pool
+	err = pool.Retry(func() error {
+		if dbPool, err = db.ConnectToDb(config.Database{}); err != nil {
+			return err
+		}
+		if err := dbPool.Ping(context.Background()); err != nil {
+			dbPool.Close()
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("postgres didn't come up: %v", err)
+	}
+	t.Cleanup(dbPool.Close)
+
+	schema, err := db.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbPool.Exec(context.Background(), schema); err != nil {
+		t.Fatalf("failed to create the schema: %v", err)
+	}
+	return dbPool
+}
+
+// TestIngestEndToEnd ingests from mock arxiv, semantic scholar and springer nature servers
+// into a dockerized postgres, each failing its first requests, and checks every source got
+// all its papers through. Run it with `go test -tags e2e -run TestIngestEndToEnd .`.
+func TestIngestEndToEnd(t *testing.T) {
+	dbPool := startPostgres(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		faults testsupport.Faults
+	}{
+		{name: "no faults"},
+		{name: "rate limited", faults: testsupport.Faults{Status: http.StatusTooManyRequests, Times: 1}},
+		{name: "unavailable", faults: testsupport.Faults{Status: http.StatusServiceUnavailable, Times: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers, err := testsupport.NewServers(tt.faults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer servers.Close()
+
+			project, err := db.GetOrCreateProject(ctx, dbPool, "e2e "+tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := config.Load(filepath.Join(t.TempDir(), "config.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// NOTE: no waiting between or after failed requests, and nothing leaves the machine
+			cfg.RateLimits = config.RateLimits{}
+			cfg.Retries = config.Retries{Default: config.RetryPolicy{
+				MaxRetries:        tt.faults.Times + 2,
+				InitialBackoff:    10 * time.Millisecond,
+				MaxBackoff:        100 * time.Millisecond,
+				Multiplier:        2,
+				RetryableStatuses: []int{429, 500, 502, 503, 504},
+			}}
+			cfg.Health.RecheckInterval = 10 * time.Millisecond
+			cfg.Cache.Backend = "memory"
+			cfg.Sink = config.Sink{Kind: sink.KindPostgres}
+			cfg.PDFMirrors.Prevalidate = false
+			cfg.Archive.Backend = ""
+			cfg.Resolver.Inline = false
+
+			// NOTE: the mock sources ignore keys, required ones only need to be there
+			sources := make([]string, 0, len(servers.All()))
+			for _, server := range servers.All() {
+				sources = append(sources, string(server.Source))
+				if ingest.KeyRequired(server.Source) {
+					t.Setenv(credentials.EnvVars[server.Source], "e2e")
+				}
+			}
+
+			r := &ingest.Runner{DBPool: dbPool, ProjectID: project.ID, Config: cfg, Doer: servers.Doer()}
+			err = r.Ingest(ctx, ingest.Options{
+				Query:   "e2e",
+				Sources: strings.Join(sources, ","),
+				Limit:   cfg.PageSizing.Initial,
+				Sink:    sink.KindPostgres,
+			})
+			// NOTE: pages lost to the injected faults are counted below, they don't fail the run here
+			if err != nil && !errors.Is(err, ingest.ErrPartial) {
+				t.Fatal(err)
+			}
+
+			runs, err := db.ListRuns(ctx, dbPool, project.ID, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(runs) == 0 {
+				t.Fatal("the run wasn't recorded")
+			}
+
+			for _, server := range servers.All() {
+				var counts db.RunSource
+				for _, rs := range runs[0].Sources {
+					if rs.Source == server.Source {
+						counts = rs
+					}
+				}
+				requests, faults := server.Requests()
+				if counts.Fetched != servers.Total() {
+					t.Errorf("%s: fetched %d of %d papers in %d requests", server.Source, counts.Fetched, servers.Total(), requests)
+				}
+				if faults != tt.faults.Times {
+					t.Errorf("%s: failed %d requests, want %d", server.Source, faults, tt.faults.Times)
+				}
+			}
+		})
+	}
+}
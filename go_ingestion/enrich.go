@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"go_ingestion/ingest"
+	"go_ingestion/internal/credentials"
+	"go_ingestion/internal/crossref"
+	"go_ingestion/internal/keyphrase"
+	"go_ingestion/internal/oa"
+	"go_ingestion/internal/ratelimit"
+	"go_ingestion/internal/reenrich"
+	"go_ingestion/internal/sink"
+	"log"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/cobra"
+)
+
+// resolve-pdfs [--batch 200]
+func (a *app) resolvePDFsCommand() *cobra.Command {
+	cfg := a.cfg.Resolver
+	cmd := &cobra.Command{
+		Use:   "resolve-pdfs",
+		Short: "Looks up open access PDFs",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.resolveBacklog(cmd.Context(), cfg)
+		},
+	}
+	cmd.Flags().IntVar(&cfg.BatchSize, "batch", a.cfg.Resolver.BatchSize, "backlog entries to look up")
+	return cmd
+}
+
+func (a *app) resolveBacklog(ctx context.Context, cfg config.Resolver) error {
+	store, err := a.runner().NewStore(sink.KindPostgres, "")
+	if err != nil {
+		return err
+	}
+	defer ingest.CloseSink(store)
+
+	resolver := oa.NewResolver(cfg.UnpaywallEmail,
+		ratelimit.ForSource(a.dbPool, a.cfg.RateLimits, "unpaywall"),
+		ratelimit.ForSource(a.dbPool, a.cfg.RateLimits, "doi.org"))
+
+	// NOTE: CORE is asked with the key its source uses, papers are looked up there only with one
+	keys, err := credentials.FromEnv(a.dbPool, a.project.ID)
+	if err != nil {
+		return err
+	}
+	if resolver.CoreKey, err = keys.APIKey(ctx, db.Core); err != nil {
+		return err
+	}
+	resolver.Core = ratelimit.ForSource(a.dbPool, a.cfg.RateLimits, string(db.Core))
+
+	report, err := oa.ResolveBacklog(ctx, a.dbPool, store, resolver, cfg)
+	log.Printf("[OA] %s", report)
+	return err
+}
+
+// crossref enrich [--batch 200] | crossref funders|affiliations [--topic t] [-n 20]
+func (a *app) crossrefCommand() *cobra.Command {
+	var batch int
+	enrich := &cobra.Command{
+		Use:   "enrich",
+		Short: "Completes papers from crossref and doi.org",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.enrichCrossref(cmd.Context(), batch)
+		},
+	}
+	enrich.Flags().IntVar(&batch, "batch", a.cfg.Crossref.BatchSize, "papers to look up, and papers to complete from doi.org")
+
+	return group(&cobra.Command{Use: "crossref", Short: "Enriches papers from crossref and counts their funders and affiliations"},
+		enrich,
+		a.crossrefTopCommand("funders", "Counts the papers per funder", db.TopFunders),
+		a.crossrefTopCommand("affiliations", "Counts the papers per affiliation", db.TopAffiliations),
+	)
+}
+
+// crossrefTopCommand prints the names top counts the most papers of
+func (a *app) crossrefTopCommand(use, short string, top func(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, topic string, n int) ([]db.NameCount, error)) *cobra.Command {
+	var topic string
+	var n *int
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			counts, err := top(cmd.Context(), a.dbPool, a.project.ID, topic, *n)
+			if err != nil {
+				return err
+			}
+			for _, c := range counts {
+				fmt.Printf("%6d  %s\n", c.Papers, c.Name)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&topic, "topic", "", "only count papers of this topic")
+	n = countFlag(cmd.Flags(), 20, "number of names to show")
+	return cmd
+}
+
+// reenrich [--batch 500]
+// Runs one batch like the daemon job does, within the same daily budget.
+func (a *app) reenrichCommand() *cobra.Command {
+	var batch int
+	cmd := &cobra.Command{
+		Use:   "reenrich",
+		Short: "Refreshes the citation counts and open access status of the stalest papers",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if err := a.reenrich(ctx, batch); err != nil {
+				return err
+			}
+			if a.cfg.Reenrich.DailyBudget > 0 {
+				used, err := ratelimit.UsedToday(ctx, a.dbPool, reenrich.BudgetKey)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%d of %d lookups used today\n", used, a.cfg.Reenrich.DailyBudget)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&batch, "batch", a.cfg.Reenrich.BatchSize, "papers to look up")
+	return cmd
+}
+
+// keyphrases extract [--batch n] | keyphrases top [--topic t] [-n 20] |
+// keyphrases paper <paper id> [-n 20] | keyphrases find <phrase> [-n 20]
+func (a *app) keyphrasesCommand() *cobra.Command {
+	var batch int
+	extract := &cobra.Command{
+		Use:   "extract",
+		Short: "Extracts the keyphrases of a batch of chunks",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.extractKeyphrases(cmd.Context(), batch)
+		},
+	}
+	extract.Flags().IntVar(&batch, "batch", a.cfg.Keyphrases.BatchSize, "chunks to extract")
+
+	var topic string
+	var topN *int
+	top := &cobra.Command{
+		Use:   "top",
+		Short: "Lists the keyphrases of the most papers",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			counts, err := db.TopKeyphrases(cmd.Context(), a.dbPool, a.project.ID, topic, *topN)
+			if err != nil {
+				return err
+			}
+			for _, c := range counts {
+				fmt.Printf("%6d papers %7d chunks  %s\n", c.Papers, c.Chunks, c.Phrase)
+			}
+			return nil
+		},
+	}
+	top.Flags().StringVar(&topic, "topic", "", "only count papers of this topic")
+	topN = countFlag(top.Flags(), 20, "number of rows to show")
+
+	var paperN *int
+	paper := &cobra.Command{
+		Use:   "paper <paper id>",
+		Short: "Lists the keyphrases of a paper",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: invalid paper id %q: %w", ErrUsage, args[0], err)
+			}
+
+			counts, err := db.PaperKeyphrases(cmd.Context(), a.dbPool, a.project.ID, id, *paperN)
+			if err != nil {
+				return err
+			}
+			for _, c := range counts {
+				fmt.Printf("%8.2f  %s\n", c.Score, c.Phrase)
+			}
+			return nil
+		},
+	}
+	paperN = countFlag(paper.Flags(), 20, "number of rows to show")
+
+	var findN *int
+	find := &cobra.Command{
+		Use:   "find <phrase>",
+		Short: "Lists the papers with a keyphrase",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			papers, err := db.PapersWithKeyphrase(cmd.Context(), a.dbPool, a.project.ID, args[0], *findN)
+			if err != nil {
+				return err
+			}
+			for _, p := range papers {
+				fmt.Printf("%8.2f  #%d [%s] %s\n", p.Score, p.ID, p.Source, p.Title)
+			}
+			return nil
+		},
+	}
+	findN = countFlag(find.Flags(), 20, "number of rows to show")
+
+	return group(&cobra.Command{Use: "keyphrases", Short: "Extracts keyphrases and finds papers by them"}, extract, top, paper, find)
+}
+
+func (a *app) enrichCrossref(ctx context.Context, batch int) error {
+	client := crossref.NewClient(a.cfg.Crossref.Mailto, ratelimit.ForSource(a.dbPool, a.cfg.RateLimits, "crossref"))
+	client.DOILimiter = ratelimit.ForSource(a.dbPool, a.cfg.RateLimits, "doi.org")
+	report, err := crossref.Enrich(ctx, a.dbPool, a.project.ID, client, batch)
+	log.Printf("[CROSSREF] %s", report)
+	return err
+}
+
+func (a *app) reenrich(ctx context.Context, batch int) error {
+	keys, err := credentials.FromEnv(a.dbPool, a.project.ID)
+	if err != nil {
+		return err
+	}
+	apiKey, err := keys.APIKey(ctx, db.SemanticScholar)
+	if err != nil {
+		return err
+	}
+
+	report, err := reenrich.Run(ctx, a.dbPool, a.project.ID, reenrich.Options{
+		APIKey:      apiKey,
+		Limiter:     ratelimit.ForSource(a.dbPool, a.cfg.RateLimits, string(db.SemanticScholar)),
+		BatchSize:   batch,
+		DailyBudget: a.cfg.Reenrich.DailyBudget,
+		MaxAge:      a.cfg.Reenrich.MaxAge,
+	})
+	log.Printf("[REENRICH] %s", report)
+	return err
+}
+
+func (a *app) extractKeyphrases(ctx context.Context, batch int) error {
+	report, err := keyphrase.ExtractBatch(ctx, a.dbPool, a.project.ID, batch, a.cfg.Keyphrases.PerChunk)
+	log.Printf("[KEYPHRASES] %s", report)
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"go_ingestion/config"
+	"go_ingestion/ingest"
+	"go_ingestion/internal/ratelimit"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"log"
+	"os"
+)
+
+// Exit codes are stable, workflow tools (Airflow, Dagster) decide from them whether to
+// retry a task. Every command can be run again with the same flags: a query or backfill
+// window into postgres resumes where it stopped and skips what it already stored.
+const (
+	// exitFatal is any other failure, e.g. the database was unreachable, a retry may pass
+	exitFatal = 1
+	// exitUsage is a command, argument or flag the binary doesn't accept
+	exitUsage = 2
+	// exitConfig is a config, flag or api key that has to be fixed first, retrying won't help
+	exitConfig = 3
+	// exitQuota is an exhausted daily quota or a source still rate limiting, retry later
+	exitQuota = 4
+	// exitPartial is a run that ended but left pages or sources behind, retry to finish it
+	exitPartial = 5
+	// exitRunning is another attempt of the same work unit still running, retry later
+	exitRunning = 6
+	// exitInterrupted is a run stopped by SIGINT or SIGTERM, as a shell reports SIGINT
+	exitInterrupted = 130
+)
+
+// ErrUsage is a command, argument or flag the binary doesn't accept, commands wrap it into
+// their usage line or what was wrong with the argument.
+var ErrUsage = errors.New("usage")
+
+// exitCode picks the code of err. A run with several failures exits with the one that
+// needs the most attention, a bad api key before an exhausted quota before a partial run.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, config.ErrConfig), errors.Is(err, researchpaperapis.ErrAuth):
+		return exitConfig
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, ratelimit.ErrQuotaExhausted), errors.Is(err, researchpaperapis.ErrRateLimited):
+		return exitQuota
+	case errors.Is(err, ingest.ErrRunning):
+		return exitRunning
+	case errors.Is(err, ingest.ErrPartial):
+		return exitPartial
+	case errors.Is(err, ErrUsage):
+		return exitUsage
+	default:
+		return exitFatal
+	}
+}
+
+// exit logs err and exits with its code.
+func exit(err error) {
+	code := exitCode(err)
+	log.Printf("%v (exit %d)", err, code)
+	os.Exit(code)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/ingest"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"ok", nil, 0},
+		{"usage", fmt.Errorf("%w: unknown snapshot command %q", ErrUsage, "bogus"), exitUsage},
+		{"usage with cause", fmt.Errorf("%w: invalid paper id %q: %w", ErrUsage, "x", fmt.Errorf("not a number")), exitUsage},
+		{"config", fmt.Errorf("%w: bad yaml", config.ErrConfig), exitConfig},
+		{"interrupted", fmt.Errorf("run stopped: %w", context.Canceled), exitInterrupted},
+		{"partial", fmt.Errorf("%w: 2 pages left", ingest.ErrPartial), exitPartial},
+		{"other", fmt.Errorf("failed to get project %q: connection refused", "default"), exitFatal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
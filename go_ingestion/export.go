@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/export"
+	"go_ingestion/internal/progress"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// export [--format csv|jsonl] [--topic q] [--out path] [--manifest path] [--output text|json]
+// writes the project's papers, to data/data.<format> by default or stdout with --out -. Next
+// to a file goes <file>.manifest.json with its row count, sha256 and filters, see export
+// verify. --output json prints the result as a json object.
+//
+// export verify <manifest> [--output text|json]
+func (a *app) exportCommand() *cobra.Command {
+	var format, topic, out, manifestPath, output string
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Writes the papers to a file with a checksummed manifest",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != export.FormatCSV && format != export.FormatJSONL {
+				return fmt.Errorf("%w: unknown export format %q, use csv or jsonl", ErrUsage, format)
+			}
+			path := out
+			if path == "" {
+				path = filepath.Join("data", "data."+format)
+			}
+			p, err := progress.New(output, os.Stdout, 0)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrUsage, err)
+			}
+			if p != nil && path == "-" {
+				return fmt.Errorf("%w: --output json and --out - both write to stdout, export to a file", ErrUsage)
+			}
+			return p.Fail("export", a.export(cmd.Context(), p, format, topic, path, manifestPath))
+		},
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&format, "format", export.FormatCSV, "csv, every column, or jsonl, what the API shows of a paper")
+	fs.StringVar(&topic, "topic", "", "only export this topic")
+	fs.StringVar(&out, "out", "", "file to write, - is stdout")
+	fs.StringVar(&manifestPath, "manifest", "", "manifest to write, defaults to <out>.manifest.json, stdout exports get none")
+	fs.StringVar(&output, "output", progress.OutputText, "text, or a json result on stdout")
+
+	cmd.AddCommand(exportVerifyCommand())
+	return cmd
+}
+
+// exportVerifyCommand checks a file against the manifest export wrote next to it, it only
+// reads files
+func exportVerifyCommand() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "verify <manifest>",
+		Short: "Checks an export against its manifest",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := progress.New(output, os.Stdout, 0)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrUsage, err)
+			}
+
+			m, err := export.Verify(args[0])
+			if err != nil {
+				return p.Fail("export verify", err)
+			}
+			log.Printf("[EXPORT] %s matches its manifest: rows=%d sha256=%s", m.File, m.Rows, m.SHA256)
+			p.Emit(progress.Event{Event: progress.Finished, Command: "export verify", Rows: m.Rows, File: m.File, Manifest: args[0], SHA256: m.SHA256})
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&output, "output", progress.OutputText, "text, or a json result on stdout")
+	return offlineCommand(cmd)
+}
+
+func (a *app) export(ctx context.Context, p *progress.Writer, format, topic, path, manifestPath string) error {
+	if manifestPath == "" && path != "-" {
+		manifestPath = export.ManifestPath(path)
+	}
+
+	w := io.Writer(os.Stdout)
+	if path != "-" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create export directory: %w", err)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	digest := export.NewDigest(w)
+
+	var n int
+	var err error
+	if format == export.FormatCSV {
+		n, err = db.WriteCSV(ctx, a.dbPool, a.project.ID, topic, digest)
+	} else {
+		enc := json.NewEncoder(digest)
+		err = db.ForEachPublicPaper(ctx, a.dbPool, a.project.ID, db.PaperQuery{Topic: topic}, func(paper db.PublicPaper) error {
+			n++
+			return enc.Encode(paper)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if path != "-" {
+		log.Printf("[EXPORT] wrote %d papers to %s", n, path)
+	}
+
+	if manifestPath == "" {
+		p.Emit(progress.Event{Event: progress.Finished, Command: "export", Rows: n, File: path})
+		return nil
+	}
+	// NOTE: the manifest names the export relative to itself, keep the two together
+	m := digest.Manifest(a.project.Name, format, path, export.Filters{Topic: topic}, n)
+	if err := export.WriteManifest(manifestPath, m); err != nil {
+		return err
+	}
+	log.Printf("[EXPORT] wrote %s sha256=%s", manifestPath, m.SHA256)
+	p.Emit(progress.Event{Event: progress.Finished, Command: "export", Rows: n, File: path, Manifest: manifestPath, SHA256: m.SHA256})
+	return nil
+}
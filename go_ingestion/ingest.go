@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"go_ingestion/ingest"
+	"go_ingestion/internal/progress"
+	"go_ingestion/internal/sink"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ingest --query q [--sources arxiv,semanticscholar,springernature,crossref,openalex,pubmed,ieee,core,dblp,acl] [--limit n] [--max-papers n] [--max-pages n] [--max-duration d] [--sink postgres|jsonl|stdout] [--out path] [--manifest path] [--dry-run] [--skip-totals] [--sample n [--sample-years 10]] [--output text|json [--progress 10s]]
+//
+// With --output json stdout gets one json object per event of the run, see progress.Event.
+func (a *app) ingestCommand() *cobra.Command {
+	var o ingest.Options
+	var output string
+	var every time.Duration
+	cmd := &cobra.Command{
+		Use:   "ingest --query q",
+		Short: "Pages the sources for a topic",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if strings.TrimSpace(o.Query) == "" {
+				return fmt.Errorf("%w: ingest --query <query> [--sources ...] [--limit n] [--dry-run]", ErrUsage)
+			}
+			p, err := progress.New(output, os.Stdout, every)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrUsage, err)
+			}
+			if p != nil && o.Sink == sink.KindStdout {
+				return fmt.Errorf("%w: --output json and --sink stdout both write to stdout, use --sink jsonl", ErrUsage)
+			}
+
+			runner := a.runner()
+			runner.Progress = p
+			return p.Fail("ingest", runner.Ingest(cmd.Context(), o))
+		},
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&o.Query, "query", "", "search query, also stored as the papers topic")
+	fs.StringVar(&o.Sources, "sources", "", "comma separated sources to ingest from, every source that has its key when empty")
+	fs.Uint64Var(&o.Limit, "limit", a.cfg.PageSizing.Initial, "papers per page, only the first page size when page_sizing is adaptive")
+	fs.Uint64Var(&o.MaxPapers, "max-papers", 0, "stop all sources once this many papers were inserted, 0 is unlimited")
+	fs.Uint64Var(&o.MaxPages, "max-pages", 0, "stop all sources after fetching this many pages in total, 0 is unlimited")
+	fs.DurationVar(&o.MaxDuration, "max-duration", 0, "stop the run after this long, 0 is unlimited")
+	fs.StringVar(&o.Sink, "sink", a.cfg.Sink.Kind, "where papers are written: postgres, jsonl or stdout")
+	fs.StringVar(&o.Out, "out", a.cfg.Sink.Path, "file the jsonl sink appends to")
+	fs.StringVar(&o.Manifest, "manifest", "", "file listing the papers this run inserted, .csv or .jsonl, defaults to sink.manifest_dir")
+	fs.BoolVar(&o.DryRun, "dry-run", false, "fetch, map and dedupe the next page of each source and print what would be inserted")
+	fs.BoolVar(&o.SkipTotals, "skip-totals", false, "don't ask sources for their totals, page each one until an empty page")
+	fs.Uint64Var(&o.Sample, "sample", 0, "take about this many papers spread across years instead of the first ones by relevance")
+	fs.IntVar(&o.SampleYears, "sample-years", 10, "how many recent years --sample spreads over")
+	fs.StringVar(&output, "output", progress.OutputText, "text, or json events on stdout for workflow tools")
+	fs.DurationVar(&every, "progress", 10*time.Second, "how often --output json reports progress, 0 only at start and end")
+	return cmd
+}
+
+// runner ingests into the project of a
+func (a *app) runner() *ingest.Runner {
+	return &ingest.Runner{DBPool: a.dbPool, ProjectID: a.project.ID, Config: a.cfg}
+}
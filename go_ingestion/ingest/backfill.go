@@ -0,0 +1,148 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"go_ingestion/internal/pipeline"
+	"go_ingestion/internal/ratelimit"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackfillOptions are the backfill flags, From and To are months as YYYY-MM.
+// Sources is comma separated, all of them when empty.
+type BackfillOptions struct {
+	Query       string
+	From        string
+	To          string
+	Sources     string
+	Limit       uint64
+	MaxPapers   uint64
+	MaxPages    uint64
+	MaxDuration time.Duration
+	Sink        string
+	Out         string
+	Manifest    string
+	SkipTotals  bool
+}
+
+// Backfill walks each month from From to To, paging every window from offset 0. Into
+// postgres the query and months are the unit of work, see Ingest: running them again
+// pages them again and only stores what is new. Backfilling one month per task keeps
+// the retries of an orchestrator small.
+func (r *Runner) Backfill(ctx context.Context, o BackfillOptions) error {
+	if strings.TrimSpace(o.Query) == "" || o.From == "" {
+		return fmt.Errorf("%w: a query and the first month are required", config.ErrConfig)
+	}
+	if o.To == "" {
+		o.To = time.Now().Format("2006-01")
+	}
+
+	windows, err := researchpaperapis.MonthWindows(o.From, o.To)
+	if err != nil {
+		return fmt.Errorf("%w: %w", config.ErrConfig, err)
+	}
+
+	sources, apiKeys, err := r.Sources(ctx, o.Sources)
+	if err != nil {
+		return err
+	}
+
+	if o.MaxDuration > 0 {
+		var cancelRun context.CancelFunc
+		ctx, cancelRun = context.WithTimeout(ctx, o.MaxDuration)
+		defer cancelRun()
+	}
+
+	store, err := r.NewStore(o.Sink, o.Out)
+	if err != nil {
+		return err
+	}
+	defer CloseSink(store)
+
+	unlock, err := r.lockUnit(ctx, store.DBPool != nil, fmt.Sprintf("backfill:%s:%s..%s", o.Query, o.From, o.To))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	opts, err := r.PagerOptions(store.Stats)
+	if err != nil {
+		return err
+	}
+
+	runID, err := r.startRun(ctx, "backfill", o.Query)
+	if err != nil {
+		return err
+	}
+	defer r.finishRun(runID, o.Query, store.Stats)
+
+	if err := r.manifest(store, o.Manifest, runID); err != nil {
+		return err
+	}
+
+	budget := pipeline.NewBudget(store, o.MaxPapers, o.MaxPages)
+	limiters := r.sourceLimiters(ctx, sources, apiKeys)
+	r.redriveIntents(ctx, store, opts, sources, limiters, apiKeys)
+	totals := r.Totals(opts, o.SkipTotals)
+
+	var wg sync.WaitGroup
+	var out outcome
+	for source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter := limiters[source]
+			for _, window := range windows {
+				if ctx.Err() != nil {
+					out.add(source, ctx.Err())
+					return
+				}
+				if budget.Exhausted() {
+					return
+				}
+				err := r.backfillWindow(ctx, store, opts, totals, runID, limiter, budget, source, apiKeys[source], o.Query, &window, o.Limit)
+				if err != nil {
+					out.add(source, fmt.Errorf("window %s: %w", window, err))
+					if stopsUnit(err) {
+						return
+					}
+				}
+			}
+			log.Printf("[BACKFILL] %s finished %s..%s", source, o.From, o.To)
+		}()
+	}
+
+	wg.Wait()
+	log.Printf("[BACKFILL] completed, inserted=%d", store.Inserted())
+	return out.err()
+}
+
+// backfillWindow pages source for one window, the error is why it didn't get through it.
+func (r *Runner) backfillWindow(ctx context.Context, store *researchpaperapis.PaperStore, opts researchpaperapis.PagerOptions, totals *pipeline.Totals, runID uint64, limiter ratelimit.Limiter, budget *pipeline.Budget, source db.PaperSource, apiKey, query string, window *researchpaperapis.DateWindow, limit uint64) error {
+	if err := limiter.Wait(ctx); err != nil {
+		log.Printf("[BACKFILL] %s window=%s: %v", source, window, err)
+		return err
+	}
+
+	total, err := totals.Get(ctx, source, apiKey, query, window)
+	if err != nil {
+		log.Printf("[BACKFILL] %s window=%s skipped, failed to fetch total: %v", source, window, err)
+		return err
+	}
+	if total != researchpaperapis.UnknownTotal {
+		log.Printf("[BACKFILL] %s window=%s total=%d", source, window, total)
+	}
+
+	pager, err := researchpaperapis.NewPager(source, apiKey, query, window, 0, total, limit, opts)
+	if err != nil {
+		log.Printf("[BACKFILL] %s: %v", source, err)
+		return err
+	}
+	return pipeline.Run(ctx, source, store, pager, limiter, budget, r.Config.Retries.For(string(source)), r.intents(store, runID, query, window), r.heartbeat(runID))
+}
@@ -0,0 +1,592 @@
+// Package ingest runs the ingestion of a project: fetching papers from the sources,
+// deduping them and writing them to a sink. The ingest and backfill commands and the
+// daemon use it, other services embed it instead of running the binary.
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"go_ingestion/internal/archive"
+	"go_ingestion/internal/cache"
+	"go_ingestion/internal/credentials"
+	"go_ingestion/internal/health"
+	"go_ingestion/internal/mapping"
+	"go_ingestion/internal/mirror"
+	"go_ingestion/internal/oa"
+	"go_ingestion/internal/pipeline"
+	"go_ingestion/internal/progress"
+	"go_ingestion/internal/ratelimit"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"go_ingestion/internal/sink"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Runner ingests into ProjectID with the settings of Config. DBPool may only be nil for
+// runs that don't write to postgres.
+type Runner struct {
+	DBPool    *pgxpool.Pool
+	ProjectID uint64
+	Config    config.Config
+	// Doer sends every source request when set, e.g. to the mock sources of testsupport
+	Doer researchpaperapis.Doer
+	// Progress gets the events of a run, see the --output flag, nil writes none
+	Progress *progress.Writer
+}
+
+// Options are the ingest flags, the daemon builds them for scheduled topics.
+// Sources is comma separated, all of them when empty.
+type Options struct {
+	Query       string
+	Sources     string
+	Limit       uint64
+	MaxPapers   uint64
+	MaxPages    uint64
+	MaxDuration time.Duration
+	Sink        string
+	Out         string
+	DryRun      bool
+	// Manifest is the file listing the papers the run inserted, see Runner.manifest
+	Manifest string
+	// SkipTotals pages every source until an empty page instead of asking for its total
+	SkipTotals bool
+	// Sample > 0 takes that many papers spread across the last SampleYears instead, see Runner.sample
+	Sample      uint64
+	SampleYears int
+}
+
+// Ingest pages every source for Query from where the project left off, until the sources
+// run out or a limit of o is reached. Into postgres a query is the unit of work: running
+// it again resumes from the checkpoints and skips the papers already stored, while a second
+// run of it at the same time fails with ErrRunning. A run that left pages or sources behind
+// returns ErrPartial.
+func (r *Runner) Ingest(ctx context.Context, o Options) error {
+	if strings.TrimSpace(o.Query) == "" {
+		return fmt.Errorf("%w: a query is required", config.ErrConfig)
+	}
+
+	sources, apiKeys, err := r.Sources(ctx, o.Sources)
+	if err != nil {
+		return err
+	}
+
+	store, err := r.NewStore(o.Sink, o.Out)
+	if err != nil {
+		return err
+	}
+	defer CloseSink(store)
+
+	// NOTE: other sinks don't know what was stored before, they start from the first page.
+	// So does a query without a checkpoint, the papers stored by other topics say nothing
+	// about where in its results it stands
+	processed := map[db.PaperSource]uint64{}
+	if store.DBPool != nil {
+		unlock, err := r.lockUnit(ctx, true, "ingest:"+o.Query)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		for source := range sources {
+			cp, ok, err := db.GetCheckpoint(ctx, r.DBPool, r.ProjectID, source, o.Query)
+			if err != nil {
+				return err
+			}
+			if ok {
+				processed[source] = cp.NextOffset
+			}
+		}
+	}
+
+	opts, err := r.PagerOptions(store.Stats)
+	if err != nil {
+		return err
+	}
+	// NOTE: a dry run writes nothing to the database, records that fail to map aren't quarantined
+	if o.DryRun {
+		opts.Quarantine = nil
+	}
+
+	var runID uint64
+	event := func(name string) progress.Event {
+		return progress.Event{Event: name, Command: "ingest", Query: o.Query, RunID: runID, Inserted: store.Inserted(), Sources: store.Stats.Snapshot()}
+	}
+
+	if o.Sample > 0 {
+		if err := r.sample(ctx, store, opts, sources, apiKeys, o); err != nil {
+			return err
+		}
+		r.Progress.Emit(event(progress.Finished))
+		return nil
+	}
+
+	if o.DryRun {
+		store.DryRun = researchpaperapis.NewDryRunReport()
+
+		// NOTE: one page per source without the limiter, shared limiter state lives in the database
+		for source := range sources {
+			pager, err := researchpaperapis.NewPager(source, apiKeys[source], o.Query, nil, processed[source], processed[source]+o.Limit, o.Limit, opts)
+			if err != nil {
+				return err
+			}
+
+			papers, _, err := pager.NextPage(ctx)
+			if err != nil {
+				log.Printf("[%s] dry run failed: %v", pipeline.LogTag(source), err)
+				continue
+			}
+			store.SavePage(ctx, source, papers)
+		}
+
+		// NOTE: the report is only printed as text, json gets the counts
+		if r.Progress != nil {
+			r.Progress.Emit(event(progress.Finished))
+			return nil
+		}
+		store.DryRun.Print(os.Stdout, store.Stats)
+		return nil
+	}
+
+	if o.MaxDuration > 0 {
+		var cancelRun context.CancelFunc
+		ctx, cancelRun = context.WithTimeout(ctx, o.MaxDuration)
+		defer cancelRun()
+	}
+
+	runID, err = r.startRun(ctx, "ingest", o.Query)
+	if err != nil {
+		return err
+	}
+	defer r.finishRun(runID, o.Query, store.Stats)
+	r.Progress.Emit(event(progress.Started))
+	stopProgress := r.Progress.Track(func() progress.Event { return event(progress.Running) })
+
+	if err := r.manifest(store, o.Manifest, runID); err != nil {
+		return err
+	}
+
+	budget := pipeline.NewBudget(store, o.MaxPapers, o.MaxPages)
+	limiters := r.sourceLimiters(ctx, sources, apiKeys)
+	r.redriveIntents(ctx, store, opts, sources, limiters, apiKeys)
+	intents := r.intents(store, runID, o.Query, nil)
+	heartbeat := r.heartbeat(runID)
+	totals := r.Totals(opts, o.SkipTotals)
+
+	var wg sync.WaitGroup
+	var out outcome
+	for source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := limiters[source].Wait(ctx); err != nil {
+				out.add(source, err)
+				return
+			}
+
+			total, err := totals.Get(ctx, source, apiKeys[source], o.Query, nil)
+			if err != nil {
+				log.Printf("[TOTALS] %s failed, not ingesting it: %v", source, err)
+				out.add(source, err)
+				return
+			}
+			if total == researchpaperapis.UnknownTotal {
+				log.Printf("[TOTALS] %s skipped, paging until an empty page (processed=%d)", source, processed[source])
+			} else {
+				log.Printf("[TOTALS] %s=%d (processed=%d)", source, total, processed[source])
+			}
+
+			pager, err := researchpaperapis.NewPager(source, apiKeys[source], o.Query, nil, processed[source], total, o.Limit, opts)
+			if err != nil {
+				log.Printf("[%s] %v", pipeline.LogTag(source), err)
+				out.add(source, err)
+				return
+			}
+
+			log.Printf("[%s] worker started", pipeline.LogTag(source))
+			out.add(source, pipeline.Run(ctx, source, store, pager, limiters[source], budget, r.Config.Retries.For(string(source)), intents, heartbeat))
+			log.Printf("[%s] worker finished", pipeline.LogTag(source))
+		}()
+	}
+
+	wg.Wait()
+	stopProgress()
+	log.Printf("All ingestion pipelines completed, inserted=%d", store.Inserted())
+	if err := out.err(); err != nil {
+		return err
+	}
+	r.Progress.Emit(event(progress.Finished))
+	return nil
+}
+
+// NewStore writes to the sink of kind, only the postgres sink dedupes against and skips
+// papers already in the database.
+func (r *Runner) NewStore(kind, path string) (*researchpaperapis.PaperStore, error) {
+	cfg := r.Config.Sink
+	cfg.Kind, cfg.Path = kind, path
+
+	s, err := sink.New(cfg, r.DBPool)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &researchpaperapis.PaperStore{DBPool: r.DBPool, ProjectID: r.ProjectID, Dedupe: r.Config.Dedupe, Review: r.Config.Review, License: r.Config.License, Filters: r.Config.Filters, Sink: s, Embargo: r.Config.Resolver.EmbargoWindow, PreferPDFHosts: r.Config.PDFMirrors.PreferHosts, Stats: researchpaperapis.NewRunStats()}
+	if r.Config.PDFMirrors.Prevalidate {
+		store.Prevalidate = &mirror.Prevalidator{Client: &http.Client{Timeout: r.Config.PDFMirrors.PrevalidateTimeout}, Workers: r.Config.PDFMirrors.PrevalidateWorkers}
+	}
+	if r.Config.Resolver.Inline && r.Config.Resolver.UnpaywallEmail != "" {
+		// NOTE: doi.org is left to the backlog, the inline lookup never asks it
+		resolver := oa.NewResolver(r.Config.Resolver.UnpaywallEmail, ratelimit.ForSource(r.DBPool, r.Config.RateLimits, "unpaywall"), nil)
+		store.ResolvePDF = oa.UnpaywallOnly{Resolver: resolver}
+	}
+	if kind != sink.KindPostgres && kind != "" {
+		store.DBPool = nil
+	}
+	return store, nil
+}
+
+// manifest makes store list what it inserts in path, or in run-<id> of the configured
+// manifest dir when path is empty. Without either nothing is listed.
+func (r *Runner) manifest(store *researchpaperapis.PaperStore, path string, runID uint64) error {
+	if path == "" {
+		if r.Config.Sink.ManifestDir == "" {
+			return nil
+		}
+		format := r.Config.Sink.ManifestFormat
+		if format == "" {
+			format = sink.ManifestCSV
+		}
+		path = filepath.Join(r.Config.Sink.ManifestDir, fmt.Sprintf("run-%d.%s", runID, format))
+	}
+
+	m, err := sink.NewManifest(store.Sink, path)
+	if err != nil {
+		return err
+	}
+	store.Sink = m
+	log.Printf("[MANIFEST] listing inserted papers in %s", path)
+	return nil
+}
+
+// CloseSink closes the sink of store, logging a failure.
+func CloseSink(store *researchpaperapis.PaperStore) {
+	if err := store.Sink.Close(); err != nil {
+		log.Printf("[SINK] failed to close: %v", err)
+	}
+}
+
+// intents records the pages of a run so a crash can be resumed, only for the postgres sink.
+func (r *Runner) intents(store *researchpaperapis.PaperStore, runID uint64, query string, window *researchpaperapis.DateWindow) *pipeline.Intents {
+	if store.DBPool == nil {
+		return nil
+	}
+	// NOTE: only whole-query ingests are checkpointed, backfill pages every window from 0
+	return &pipeline.Intents{DBPool: r.DBPool, ProjectID: r.ProjectID, RunID: runID, Query: query, Window: window, Checkpoint: window == nil}
+}
+
+// redriveIntents fetches and saves again the pages earlier runs left in flight, before the
+// run fetches anything new. A page that fails again stays claimed until it is abandoned again.
+func (r *Runner) redriveIntents(ctx context.Context, store *researchpaperapis.PaperStore, opts researchpaperapis.PagerOptions, sources map[db.PaperSource]bool, limiters map[db.PaperSource]ratelimit.Limiter, apiKeys map[db.PaperSource]string) {
+	if store.DBPool == nil {
+		return
+	}
+
+	names := make([]string, 0, len(sources))
+	for source := range sources {
+		names = append(names, string(source))
+	}
+
+	for ctx.Err() == nil {
+		intent, ok, err := db.ClaimAbandonedIntent(ctx, r.DBPool, r.ProjectID, names, r.Config.Resume.AbandonAfter)
+		if err != nil {
+			log.Printf("[INTENT] %v", err)
+			return
+		}
+		if !ok {
+			return
+		}
+
+		var window *researchpaperapis.DateWindow
+		if intent.WindowFrom != nil && intent.WindowTo != nil {
+			window = &researchpaperapis.DateWindow{From: *intent.WindowFrom, To: *intent.WindowTo}
+		}
+		log.Printf("[INTENT] re-driving %s %q offset=%d from run #%d", intent.Source, intent.Query, intent.Offset, nullableID(intent.RunID))
+
+		pager, err := researchpaperapis.NewPager(intent.Source, apiKeys[intent.Source], intent.Query, window, intent.Offset, intent.Offset+intent.Limit, intent.Limit, opts)
+		if err != nil {
+			log.Printf("[INTENT] %v", err)
+			continue
+		}
+
+		if err := limiters[intent.Source].Wait(ctx); err != nil {
+			return
+		}
+
+		papers, _, err := pager.NextPage(ctx)
+		if err != nil {
+			log.Printf("[INTENT] %s offset=%d failed again: %v", intent.Source, intent.Offset, err)
+			continue
+		}
+		// NOTE: a fetched page is saved even when the run is stopping, see pipeline.Run
+		saveCtx := context.WithoutCancel(ctx)
+		store.SavePage(saveCtx, intent.Source, papers)
+
+		if err := db.FinishPageIntent(saveCtx, r.DBPool, intent.ID, db.IntentDone); err != nil {
+			log.Printf("[INTENT] %v", err)
+		}
+	}
+}
+
+func nullableID(id *uint64) uint64 {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+// PagerOptions are the configured cache, archive, mappings and page sizing shared by the
+// pagers of a run.
+func (r *Runner) PagerOptions(stats *researchpaperapis.RunStats) (researchpaperapis.PagerOptions, error) {
+	c, err := cache.New(r.Config.Cache)
+	if err != nil {
+		return researchpaperapis.PagerOptions{}, err
+	}
+	mappings, err := mapping.Compile(r.Config.Mappings)
+	if err != nil {
+		return researchpaperapis.PagerOptions{}, err
+	}
+	volumes, err := researchpaperapis.ParseVolumeMode(r.Config.Springer.Volumes)
+	if err != nil {
+		return researchpaperapis.PagerOptions{}, err
+	}
+	opts := researchpaperapis.PagerOptions{
+		Stats:      stats,
+		Cache:      c,
+		CacheTTL:   r.Config.Cache.PagesTTL,
+		Mappings:   mappings,
+		PageSizers: researchpaperapis.NewPageSizers(r.Config.PageSizing),
+		Volumes:    researchpaperapis.Volumes{Mode: volumes, MaxChapters: r.Config.Springer.MaxChapters},
+		Mailto:     r.Config.Crossref.Mailto,
+		Validation: r.Config.Validation,
+	}
+	if r.Doer != nil {
+		opts.Doer = r.Doer
+	} else if r.Config.Timeouts.Page > 0 {
+		opts.Doer = &http.Client{Timeout: r.Config.Timeouts.Page}
+	}
+	if r.DBPool != nil && r.Config.Quarantine.After > 0 {
+		opts.Quarantine = researchpaperapis.NewQuarantine(r.DBPool, r.ProjectID, r.Config.Quarantine.After)
+	}
+	pages, err := archive.New(r.Config.Archive)
+	if err != nil {
+		return researchpaperapis.PagerOptions{}, err
+	}
+	if pages != nil {
+		opts.Archive = archive.Pages{Store: pages}
+	}
+	return opts, nil
+}
+
+// Totals looks up source totals once a day, skipping the configured sources or all of them.
+func (r *Runner) Totals(opts researchpaperapis.PagerOptions, skipAll bool) *pipeline.Totals {
+	t := &pipeline.Totals{Cache: opts.Cache, TTL: r.Config.Cache.TotalsTTL, DBPool: r.DBPool, Doer: opts.Doer, Skip: map[db.PaperSource]bool{}, Timeout: r.Config.Timeouts.Totals}
+	for _, source := range r.Config.Totals.Skip {
+		t.Skip[db.PaperSource(source)] = true
+	}
+	if skipAll {
+		for _, source := range researchpaperapis.Sources() {
+			t.Skip[source] = true
+		}
+	}
+	return t
+}
+
+// startRun records a run of command, 0 without a database. Runs that don't write to
+// postgres are still recorded when the runner has one.
+func (r *Runner) startRun(ctx context.Context, command, query string) (uint64, error) {
+	if r.DBPool == nil {
+		return 0, nil
+	}
+	return db.StartRun(ctx, r.DBPool, r.ProjectID, command, query)
+}
+
+// heartbeat reports the progress of the workers of runID, nil without a database.
+func (r *Runner) heartbeat(runID uint64) *pipeline.Heartbeat {
+	if r.DBPool == nil {
+		return nil
+	}
+	return &pipeline.Heartbeat{DBPool: r.DBPool, RunID: runID}
+}
+
+// finishRun persists the counts of a run with a fresh context, so interrupted runs are recorded
+// too, and recounts the papers of topic per day when the run changed any. Without a database
+// the counts are only logged.
+func (r *Runner) finishRun(runID uint64, topic string, stats *researchpaperapis.RunStats) {
+	if r.DBPool == nil {
+		log.Printf("[RUN] finished")
+		stats.Print(log.Writer())
+		return
+	}
+
+	var (
+		sources []db.RunSource
+		changed int
+	)
+	for source, s := range stats.Snapshot() {
+		changed += s.Inserted + s.Updated
+		skipped := make(map[string]int, len(s.Skipped))
+		for reason, n := range s.Skipped {
+			skipped[string(reason)] = n
+		}
+		sources = append(sources, db.RunSource{Source: source, Fetched: s.Fetched, Inserted: s.Inserted, Reviewed: s.Reviewed, Updated: s.Updated, Skipped: skipped})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := db.FinishRun(ctx, r.DBPool, runID, sources); err != nil {
+		log.Printf("[RUN] %v", err)
+	}
+	if changed > 0 {
+		if err := db.RefreshTopicCounts(ctx, r.DBPool, r.ProjectID, topic); err != nil {
+			log.Printf("[RUN] %v", err)
+		}
+	}
+
+	log.Printf("[RUN] #%d finished", runID)
+	stats.Print(log.Writer())
+}
+
+// AllSources lists every registered source, comma separated
+var AllSources = researchpaperapis.AllSources()
+
+// Sources parses list, see ParseSources, and returns the api keys of the project. A source
+// named in list without the key it requires is an error, while an empty list leaves such
+// sources out, so registering a source that needs a key doesn't break runs that name none.
+func (r *Runner) Sources(ctx context.Context, list string) (map[db.PaperSource]bool, map[db.PaperSource]string, error) {
+	sources, err := ParseSources(list)
+	if err != nil {
+		return nil, nil, err
+	}
+	apiKeys, err := r.APIKeys(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if strings.TrimSpace(list) == "" {
+		for source := range sources {
+			if KeyRequired(source) && apiKeys[source] == "" {
+				log.Printf("[SOURCES] skipping %s, %s or a stored credential is required", source, credentials.EnvVars[source])
+				delete(sources, source)
+			}
+		}
+		if len(sources) == 0 {
+			return nil, nil, fmt.Errorf("%w: no source can be queried without an api key", config.ErrConfig)
+		}
+	}
+	if err := missingKeys(sources, apiKeys); err != nil {
+		return nil, nil, err
+	}
+	return sources, apiKeys, nil
+}
+
+// ParseSources checks a comma separated list of sources, all of them when it's empty.
+func ParseSources(list string) (map[db.PaperSource]bool, error) {
+	if strings.TrimSpace(list) == "" {
+		list = AllSources
+	}
+	sources := map[db.PaperSource]bool{}
+	for _, s := range strings.Split(list, ",") {
+		source := db.PaperSource(strings.TrimSpace(s))
+		if _, err := researchpaperapis.Lookup(source); err != nil {
+			return nil, fmt.Errorf("%w: %w", config.ErrConfig, err)
+		}
+		sources[source] = true
+	}
+	return sources, nil
+}
+
+// KeyRequired tells if source can't be queried without an api key.
+func KeyRequired(source db.PaperSource) bool {
+	p, err := researchpaperapis.Lookup(source)
+	return err == nil && p.Info().KeyRequired
+}
+
+// APIKeys returns the keys stored for the project, see credentials, falling back to
+// the environment. Sources that require a key fail without one.
+func (r *Runner) APIKeys(ctx context.Context, sources map[db.PaperSource]bool) (map[db.PaperSource]string, error) {
+	store, err := credentials.FromEnv(r.DBPool, r.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys := map[db.PaperSource]string{}
+	for source := range credentials.EnvVars {
+		if apiKeys[source], err = store.APIKey(ctx, source); err != nil {
+			return nil, err
+		}
+	}
+	if err := missingKeys(sources, apiKeys); err != nil {
+		return nil, err
+	}
+	return apiKeys, nil
+}
+
+func missingKeys(sources map[db.PaperSource]bool, apiKeys map[db.PaperSource]string) error {
+	for source := range sources {
+		if KeyRequired(source) && apiKeys[source] == "" {
+			return fmt.Errorf("%w: %s or a stored credential is required for %s", config.ErrConfig, credentials.EnvVars[source], source)
+		}
+	}
+	return nil
+}
+
+// sourceLimiters probes every source once and returns their limiters, gated so workers
+// of a source that is down wait for it to come back.
+func (r *Runner) sourceLimiters(ctx context.Context, sources map[db.PaperSource]bool, apiKeys map[db.PaperSource]string) map[db.PaperSource]ratelimit.Limiter {
+	limiters := map[db.PaperSource]ratelimit.Limiter{}
+	for source := range sources {
+		limiters[source] = ratelimit.ForSource(r.DBPool, r.Config.RateLimits, string(source))
+	}
+
+	monitor := r.HealthMonitor(limiters, apiKeys)
+	for source, err := range monitor.Check(ctx) {
+		log.Printf("[HEALTH] %s failed startup probe, its worker waits until it recovers: %v", source, err)
+	}
+
+	gated := map[db.PaperSource]ratelimit.Limiter{}
+	for source, limiter := range limiters {
+		gated[source] = monitor.Gate(limiter, source)
+	}
+	return gated
+}
+
+// HealthMonitor probes the sources of limiters by asking them for a total.
+func (r *Runner) HealthMonitor(limiters map[db.PaperSource]ratelimit.Limiter, apiKeys map[db.PaperSource]string) *health.Monitor {
+	probes := map[db.PaperSource]health.Probe{}
+	for source, limiter := range limiters {
+		probes[source] = func(ctx context.Context) error {
+			if err := limiter.Wait(ctx); err != nil {
+				return err
+			}
+			_, err := researchpaperapis.SourceTotal(ctx, r.Doer, source, apiKeys[source], "research", nil)
+			return err
+		}
+	}
+
+	return &health.Monitor{
+		DBPool:          r.DBPool,
+		Probes:          probes,
+		Timeout:         r.Config.Health.Timeout,
+		RecheckInterval: r.Config.Health.RecheckInterval,
+	}
+}
@@ -0,0 +1,71 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/pipeline"
+	"go_ingestion/internal/ratelimit"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"sync"
+)
+
+// ErrPartial is returned when a run ended but left work of its unit undone: a source
+// failed or pages were skipped. Running the same unit again picks up what is left.
+var ErrPartial = errors.New("partial run")
+
+// ErrRunning is returned when another attempt of the same unit still holds its lock.
+var ErrRunning = errors.New("another run of this unit is in progress")
+
+// outcome collects why the workers of a run stopped early, the sources run side by side.
+type outcome struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+// add records err of source. A worker stopped by --max-duration reached its bound and
+// isn't recorded, errors that don't say more than that the source failed become ErrPartial.
+func (o *outcome) add(source db.PaperSource, err error) {
+	if err == nil || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	if errors.Is(err, pipeline.ErrPagesSkipped) || !stopsUnit(err) {
+		err = fmt.Errorf("%w: %s: %w", ErrPartial, source, err)
+	} else {
+		err = fmt.Errorf("%s: %w", source, err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.errs = append(o.errs, err)
+}
+
+// stopsUnit reports whether err stops every later page of the source too, not only the
+// one that failed: the run was interrupted, the quota is gone or the api key was rejected.
+func stopsUnit(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, ratelimit.ErrQuotaExhausted) ||
+		errors.Is(err, researchpaperapis.ErrRateLimited) || errors.Is(err, researchpaperapis.ErrAuth)
+}
+
+func (o *outcome) err() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return errors.Join(o.errs...)
+}
+
+// lockUnit takes the lock of unit for runs that write to postgres, other sinks don't
+// remember what they stored so a second attempt can't clash with the first.
+func (r *Runner) lockUnit(ctx context.Context, postgres bool, unit string) (unlock func(), err error) {
+	if !postgres {
+		return func() {}, nil
+	}
+	unlock, ok, err := db.LockWorkUnit(ctx, r.DBPool, r.ProjectID, unit)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRunning, unit)
+	}
+	return unlock, nil
+}
@@ -0,0 +1,169 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/archive"
+	"go_ingestion/internal/pipeline"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"log"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"time"
+)
+
+// ReplayOptions pick the archived pages to map again. Sources is comma separated, all of
+// them when empty, Day (YYYY-MM-DD) and Query narrow the pages down.
+type ReplayOptions struct {
+	Sources string
+	Day     string
+	Query   string
+	Sink    string
+	Out     string
+}
+
+type ReplayReport struct {
+	Pages  int
+	Failed int
+	// Stats are what the store made of the papers of the pages
+	Stats *researchpaperapis.RunStats
+}
+
+// Replay pages the archived requests again with the archived bodies in place of the
+// sources and saves what the current mappers make of them. Papers already stored are
+// refreshed when their content changed. Nothing is fetched upstream.
+func (r *Runner) Replay(ctx context.Context, o ReplayOptions) (ReplayReport, error) {
+	var report ReplayReport
+
+	pages, err := archive.New(r.Config.Archive)
+	if err != nil {
+		return report, err
+	}
+	if pages == nil {
+		return report, errors.New("no page archive configured, see archive.backend")
+	}
+
+	sources, err := ParseSources(o.Sources)
+	if err != nil {
+		return report, err
+	}
+	var day time.Time
+	if o.Day != "" {
+		if day, err = time.Parse(time.DateOnly, o.Day); err != nil {
+			return report, fmt.Errorf("invalid day %q, use YYYY-MM-DD", o.Day)
+		}
+	}
+
+	store, err := r.NewStore(o.Sink, o.Out)
+	if err != nil {
+		return report, err
+	}
+	defer CloseSink(store)
+	report.Stats = store.Stats
+
+	opts, err := r.PagerOptions(store.Stats)
+	if err != nil {
+		return report, err
+	}
+	opts.Doer = offlineDoer{}
+	opts.Archive = nil
+	opts.PageSizers = nil
+
+	for _, source := range slices.Sorted(maps.Keys(sources)) {
+		keys, err := pages.List(ctx, archive.DayPrefix(source, day))
+		if err != nil {
+			return report, err
+		}
+
+		// NOTE: keys of one query and day share a directory, its pages are replayed together
+		// since a page may read the others, e.g. the chapters of a springer volume
+		for len(keys) > 0 {
+			dir := path.Dir(keys[0])
+			n := 1
+			for n < len(keys) && path.Dir(keys[n]) == dir {
+				n++
+			}
+			group := keys[:n]
+			keys = keys[n:]
+
+			if err := r.replayGroup(ctx, pages, store, opts, source, group, o.Query, &report); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+func (r *Runner) replayGroup(ctx context.Context, pages archive.Store, store *researchpaperapis.PaperStore, opts researchpaperapis.PagerOptions, source db.PaperSource, keys []string, query string, report *ReplayReport) error {
+	bodies := replayCache{}
+	var requests []researchpaperapis.ArchivedPage
+	for _, key := range keys {
+		page, err := archive.ReadPage(ctx, pages, key)
+		if err != nil {
+			return err
+		}
+		if query != "" && page.Query != query {
+			return nil
+		}
+		bodies["page:"+page.Key] = page.Body
+
+		// NOTE: one request may have been archived more than once a day, it is paged once
+		if !slices.ContainsFunc(requests, func(p researchpaperapis.ArchivedPage) bool {
+			return p.Offset == page.Offset && p.Limit == page.Limit && sameWindow(p.Window, page.Window)
+		}) {
+			requests = append(requests, page)
+		}
+	}
+	opts.Cache = bodies
+
+	for _, page := range requests {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		pager, err := researchpaperapis.NewPager(source, "", page.Query, page.Window, page.Offset, page.Offset+page.Limit, page.Limit, opts)
+		if err != nil {
+			return err
+		}
+		papers, _, err := pager.NextPage(ctx)
+		if err != nil {
+			log.Printf("[%s] replaying %q offset=%d failed: %v", pipeline.LogTag(source), page.Query, page.Offset, err)
+			report.Failed++
+			continue
+		}
+		store.SavePage(ctx, source, papers)
+		report.Pages++
+	}
+	return nil
+}
+
+func sameWindow(a, b *researchpaperapis.DateWindow) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.From.Equal(b.From) && a.To.Equal(b.To)
+}
+
+// replayCache serves the archived bodies of a query and day by request, see pageState.body.
+type replayCache map[string][]byte
+
+func (c replayCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	body, ok := c[key]
+	return body, ok, nil
+}
+
+func (c replayCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return nil
+}
+
+// offlineDoer fails the requests a replay would send upstream, a request that isn't
+// archived fails its page instead.
+type offlineDoer struct{}
+
+func (offlineDoer) Do(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("replaying archived pages, %s was not archived", req.URL.Host+req.URL.Path)
+}
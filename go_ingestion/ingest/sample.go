@@ -0,0 +1,117 @@
+package ingest
+
+import (
+	"context"
+	"go_ingestion/db"
+	"go_ingestion/internal/pipeline"
+	"go_ingestion/internal/ratelimit"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"log"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+)
+
+// sampleDuration boxes a sample run that didn't set --max-duration
+const sampleDuration = 5 * time.Minute
+
+// sample takes one page per source and year at a random offset within the year, so the
+// papers show what a topic looks like over time rather than its most relevant hits. It
+// neither reads nor advances checkpoints, a later full ingest starts where it would have.
+func (r *Runner) sample(ctx context.Context, store *researchpaperapis.PaperStore, opts researchpaperapis.PagerOptions, sources map[db.PaperSource]bool, apiKeys map[db.PaperSource]string, o Options) error {
+	duration := o.MaxDuration
+	if duration == 0 {
+		duration = sampleDuration
+	}
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	years := max(o.SampleYears, 1)
+	windows := researchpaperapis.YearWindows(years, time.Now())
+	// NOTE: rounded up, the budget stops the run once the sample is complete
+	perPage := max((o.Sample+uint64(len(sources)*years)-1)/uint64(len(sources)*years), 1)
+	budget := pipeline.NewBudget(store, o.Sample, 0)
+
+	if o.DryRun {
+		store.DryRun = researchpaperapis.NewDryRunReport()
+	} else {
+		runID, err := r.startRun(ctx, "sample", o.Query)
+		if err != nil {
+			return err
+		}
+		defer r.finishRun(runID, o.Query, store.Stats)
+
+		if err := r.manifest(store, o.Manifest, runID); err != nil {
+			return err
+		}
+	}
+
+	limiters := r.sourceLimiters(ctx, sources, apiKeys)
+	totals := r.Totals(opts, o.SkipTotals)
+	log.Printf("[SAMPLE] %d papers of %q over %d years, %d per source and year", o.Sample, o.Query, years, perPage)
+
+	var wg sync.WaitGroup
+	for source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, window := range windows {
+				if ctx.Err() != nil || budget.Exhausted() {
+					return
+				}
+				r.sampleWindow(ctx, store, opts, totals, limiters[source], source, apiKeys[source], o.Query, &window, perPage)
+			}
+		}()
+	}
+
+	wg.Wait()
+	if store.DryRun != nil {
+		store.DryRun.Print(os.Stdout, store.Stats)
+	}
+	log.Printf("[SAMPLE] completed, inserted=%d", store.Inserted())
+	return nil
+}
+
+func (r *Runner) sampleWindow(ctx context.Context, store *researchpaperapis.PaperStore, opts researchpaperapis.PagerOptions, totals *pipeline.Totals, limiter ratelimit.Limiter, source db.PaperSource, apiKey, query string, window *researchpaperapis.DateWindow, perPage uint64) {
+	if err := limiter.Wait(ctx); err != nil {
+		return
+	}
+
+	total, err := totals.Get(ctx, source, apiKey, query, window)
+	if err != nil {
+		log.Printf("[SAMPLE] %s window=%s skipped, failed to fetch total: %v", source, window, err)
+		return
+	}
+	if total == 0 {
+		return
+	}
+
+	// NOTE: without a total the sample is the window's first page
+	var offset uint64
+	if total != researchpaperapis.UnknownTotal && total > perPage {
+		offset = rand.Uint64N(total - perPage + 1)
+	}
+
+	pager, err := researchpaperapis.NewPager(source, apiKey, query, window, offset, offset+perPage, perPage, opts)
+	if err != nil {
+		log.Printf("[SAMPLE] %v", err)
+		return
+	}
+
+	if err := limiter.Wait(ctx); err != nil {
+		return
+	}
+
+	papers, _, err := pager.NextPage(ctx)
+	if err != nil {
+		log.Printf("[SAMPLE] %s window=%s offset=%d failed: %v", source, window, offset, err)
+		return
+	}
+	if total == researchpaperapis.UnknownTotal {
+		log.Printf("[SAMPLE] %s window=%s took %d at offset=%d", source, window, len(papers), offset)
+	} else {
+		log.Printf("[SAMPLE] %s window=%s took %d of %d at offset=%d", source, window, len(papers), total, offset)
+	}
+	store.SavePage(ctx, source, papers)
+}
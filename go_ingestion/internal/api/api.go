@@ -0,0 +1,149 @@
+// Package api serves the corpus of a project over HTTP.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go_ingestion/db"
+	"go_ingestion/internal/cache"
+	"go_ingestion/internal/credentials"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxSimilar caps k of the similar endpoint
+const maxSimilar = 100
+
+type Server struct {
+	DBPool    *pgxpool.Pool
+	ProjectID uint64
+	// Credentials are managed under /credentials when AdminToken is set
+	Credentials *credentials.Store
+	AdminToken  string
+	// Public never serves the admin endpoints and lets clients cache responses for CacheTTL
+	Public bool
+	// Cache keeps the responses of a public server for CacheTTL and search and similar
+	// results for QueryCacheTTL, nil doesn't cache
+	Cache         cache.Cache
+	CacheTTL      time.Duration
+	QueryCacheTTL time.Duration
+	// MaxLimit caps limit of the list and search endpoints, 0 doesn't
+	MaxLimit int
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /papers", s.cached(s.listPapers))
+	mux.HandleFunc("GET /papers/{id}", s.cached(s.getPaper))
+	mux.HandleFunc("GET /papers/{id}/similar", s.controlled(s.similar))
+	mux.HandleFunc("GET /search", s.controlled(s.search))
+	mux.HandleFunc("GET /export", s.export)
+	mux.HandleFunc("GET /events", s.events)
+	mux.HandleFunc("GET /trend", s.cached(s.trend))
+	if !s.Public && s.Credentials != nil && s.AdminToken != "" {
+		mux.HandleFunc("GET /credentials", s.admin(s.listCredentials))
+		mux.HandleFunc("PUT /credentials/{source}", s.admin(s.putCredential))
+		mux.HandleFunc("DELETE /credentials/{source}", s.admin(s.deleteCredential))
+	}
+	return mux
+}
+
+// Serve listens on addr until ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("[API] listening on %s", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// GET /papers/{id}/similar?k=10&source=arxiv&topic=...&namespace=...
+func (s *Server) similar(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid paper id")
+		return
+	}
+
+	k, ok := intParam(w, r, "k", 10, maxSimilar)
+	if !ok {
+		return
+	}
+
+	filter := db.SimilarFilter{Source: db.PaperSource(r.URL.Query().Get("source")), Topic: r.URL.Query().Get("topic"), Namespace: r.URL.Query().Get("namespace")}
+	key := struct {
+		ID     uint64
+		K      int
+		Filter db.SimilarFilter
+	}{id, k, filter}
+	result, err := s.queryResult(r.Context(), "similar", key, func() (any, error) {
+		papers, err := db.SimilarPapers(r.Context(), s.DBPool, s.ProjectID, id, k, filter)
+		if papers == nil {
+			papers = []db.SimilarPaper{}
+		}
+		return papers, err
+	})
+	if errors.Is(err, db.ErrNoEmbeddings) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("[API] %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to find similar papers")
+		return
+	}
+	writeRawJSON(w, http.StatusOK, result)
+}
+
+// intParam reads a positive number from the query, def when it's missing, capped at max
+// unless max is 0. It writes the error and returns false when the value is invalid.
+func intParam(w http.ResponseWriter, r *http.Request, name string, def, max int) (int, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		writeError(w, http.StatusBadRequest, name+" must be a positive number")
+		return 0, false
+	}
+	if max > 0 {
+		n = min(n, max)
+	}
+	return n, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[API] failed to write response: %v", err)
+	}
+}
+
+// writeRawJSON writes JSON that is encoded already.
+func writeRawJSON(w http.ResponseWriter, status int, data []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		log.Printf("[API] failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// cached answers a GET of a public server from Cache when it can, successful responses
+// are kept for CacheTTL and clients and proxies may cache them as long.
+func (s *Server) cached(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.Public || s.Cache == nil || s.CacheTTL <= 0 {
+			next(&recorder{ResponseWriter: w, server: s, status: http.StatusOK}, r)
+			return
+		}
+
+		key := "api:" + strconv.FormatUint(s.ProjectID, 10) + ":" + r.URL.RequestURI()
+		body, ok, err := s.Cache.Get(r.Context(), key)
+		if err != nil {
+			log.Printf("[API] cache: %v", err)
+		}
+		if ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Cache", "HIT")
+			s.cacheControl(w)
+			w.Write(body)
+			return
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		rec := &recorder{ResponseWriter: w, server: s, status: http.StatusOK, buf: &bytes.Buffer{}}
+		next(rec, r)
+		if rec.status != http.StatusOK {
+			return
+		}
+		if err := s.Cache.Set(r.Context(), key, rec.buf.Bytes(), s.CacheTTL); err != nil {
+			log.Printf("[API] cache: %v", err)
+		}
+	}
+}
+
+// controlled only sets Cache-Control, for handlers that cache their results themselves.
+func (s *Server) controlled(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(&recorder{ResponseWriter: w, server: s, status: http.StatusOK}, r)
+	}
+}
+
+// queryResult returns the JSON of run's result, from Cache when a query with the same
+// normalized key ran within the query ttl. Errors aren't cached.
+func (s *Server) queryResult(ctx context.Context, kind string, key any, run func() (any, error)) ([]byte, error) {
+	ttl := s.queryTTL()
+	if s.Cache == nil || ttl <= 0 {
+		v, err := run()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(v)
+	}
+
+	normalized, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(normalized)
+	cacheKey := "api:" + strconv.FormatUint(s.ProjectID, 10) + ":" + kind + ":" + hex.EncodeToString(sum[:])
+
+	cached, ok, err := s.Cache.Get(ctx, cacheKey)
+	if err != nil {
+		log.Printf("[API] cache: %v", err)
+	}
+	if ok {
+		return cached, nil
+	}
+
+	v, err := run()
+	if err != nil {
+		return nil, err
+	}
+	result, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Cache.Set(ctx, cacheKey, result, ttl); err != nil {
+		log.Printf("[API] cache: %v", err)
+	}
+	return result, nil
+}
+
+// queryTTL is QueryCacheTTL, public servers keep results at least as long as their responses.
+func (s *Server) queryTTL() time.Duration {
+	if s.Public {
+		return max(s.QueryCacheTTL, s.CacheTTL)
+	}
+	return s.QueryCacheTTL
+}
+
+func (s *Server) cacheControl(w http.ResponseWriter) {
+	if s.Public && s.CacheTTL > 0 {
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(s.CacheTTL.Seconds())))
+	}
+}
+
+// recorder sets Cache-Control on successful responses of a public server and keeps a copy
+// of the body in buf, if set.
+type recorder struct {
+	http.ResponseWriter
+	server *Server
+	status int
+	buf    *bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	if status == http.StatusOK && r.server != nil {
+		r.server.cacheControl(r.ResponseWriter)
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.buf != nil && r.status == http.StatusOK {
+		r.buf.Write(b)
+	}
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"go_ingestion/db"
+	"go_ingestion/internal/credentials"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// AdminTokenEnv holds the bearer token of the admin endpoints, they aren't served without one.
+const AdminTokenEnv = "API_ADMIN_TOKEN"
+
+// admin only lets requests with the admin token through.
+func (s *Server) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.AdminToken)) != 1 {
+			writeError(w, http.StatusUnauthorized, "admin token required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// GET /credentials lists the stored source credentials, never the keys
+func (s *Server) listCredentials(w http.ResponseWriter, r *http.Request) {
+	stored, err := s.Credentials.List(r.Context())
+	if err != nil {
+		log.Printf("[API] %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list credentials")
+		return
+	}
+	if stored == nil {
+		stored = []db.StoredCredential{}
+	}
+	writeJSON(w, http.StatusOK, stored)
+}
+
+// PUT /credentials/{source} {"api_key": "..."}
+func (s *Server) putCredential(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		APIKey string `json:"api_key"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "body must be {\"api_key\": \"...\"}")
+		return
+	}
+
+	err := s.Credentials.Set(r.Context(), db.PaperSource(r.PathValue("source")), body.APIKey)
+	switch {
+	case errors.Is(err, credentials.ErrUnknownSource):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, credentials.ErrNoCipher):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, credentials.ErrEmptyKey):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		log.Printf("[API] %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to store credential")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DELETE /credentials/{source}
+func (s *Server) deleteCredential(w http.ResponseWriter, r *http.Request) {
+	deleted, err := s.Credentials.Delete(r.Context(), db.PaperSource(r.PathValue("source")))
+	if err != nil {
+		log.Printf("[API] %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete credential")
+		return
+	}
+	if !deleted {
+		writeError(w, http.StatusNotFound, "no credential stored for "+r.PathValue("source"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
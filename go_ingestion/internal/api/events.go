@@ -0,0 +1,48 @@
+package api
+
+import (
+	"go_ingestion/db"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type eventsPage struct {
+	Events []db.PaperEvent `json:"events"`
+	// Cursor is the after of the next poll, the given after when there were no new events
+	Cursor uint64 `json:"cursor"`
+}
+
+// GET /events?after=0&limit=50 is the change feed of the papers, poll it with the cursor
+// of the previous response
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	limit, ok := intParam(w, r, "limit", listLimit, s.MaxLimit)
+	if !ok {
+		return
+	}
+
+	var after uint64
+	if v := r.URL.Query().Get("after"); v != "" {
+		var err error
+		if after, err = strconv.ParseUint(v, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid after")
+			return
+		}
+	}
+
+	events, err := db.PaperEvents(r.Context(), s.DBPool, s.ProjectID, after, limit)
+	if err != nil {
+		log.Printf("[API] %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list events")
+		return
+	}
+
+	page := eventsPage{Events: events, Cursor: after}
+	if page.Events == nil {
+		page.Events = []db.PaperEvent{}
+	}
+	if len(events) > 0 {
+		page.Cursor = events[len(events)-1].ID
+	}
+	writeJSON(w, http.StatusOK, page)
+}
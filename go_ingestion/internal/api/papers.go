@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"go_ingestion/db"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// listLimit is the page size of the list and search endpoints without limit
+const listLimit = 50
+
+type papersPage struct {
+	Papers []db.PublicPaper `json:"papers"`
+	// NextAfter is the after of the next page, 0 on the last one
+	NextAfter uint64 `json:"next_after,omitempty"`
+}
+
+// GET /papers?topic=&source=&after=0&limit=50 pages through the papers by id
+func (s *Server) listPapers(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.paperQuery(w, r)
+	if !ok {
+		return
+	}
+	if v := r.URL.Query().Get("after"); v != "" {
+		after, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid after")
+			return
+		}
+		q.AfterID = after
+	}
+
+	papers, err := db.ListPapers(r.Context(), s.DBPool, s.ProjectID, q)
+	if err != nil {
+		log.Printf("[API] %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list papers")
+		return
+	}
+
+	page := papersPage{Papers: papers}
+	if page.Papers == nil {
+		page.Papers = []db.PublicPaper{}
+	}
+	if len(papers) == q.Limit {
+		page.NextAfter = papers[len(papers)-1].ID
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// GET /papers/{id}
+func (s *Server) getPaper(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid paper id")
+		return
+	}
+
+	paper, found, err := db.GetPublicPaper(r.Context(), s.DBPool, s.ProjectID, id)
+	if err != nil {
+		log.Printf("[API] %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to get paper")
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "paper not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, paper)
+}
+
+// GET /search?q=...&topic=&source=&offset=0&limit=50 ranks papers by title and abstract
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.paperQuery(w, r)
+	if !ok {
+		return
+	}
+	// NOTE: the search is case insensitive, so differently spaced or cased queries share
+	// their cached result
+	q.Search = strings.ToLower(strings.Join(strings.Fields(r.URL.Query().Get("q")), " "))
+	if q.Search == "" {
+		writeError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, "invalid offset")
+			return
+		}
+		q.Offset = offset
+	}
+
+	result, err := s.queryResult(r.Context(), "search", q, func() (any, error) {
+		papers, err := db.ListPapers(r.Context(), s.DBPool, s.ProjectID, q)
+		if papers == nil {
+			papers = []db.PublicPaper{}
+		}
+		return papersPage{Papers: papers}, err
+	})
+	if err != nil {
+		log.Printf("[API] %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to search papers")
+		return
+	}
+	writeRawJSON(w, http.StatusOK, result)
+}
+
+// GET /export?topic=&source= streams every matching paper as NDJSON
+func (s *Server) export(w http.ResponseWriter, r *http.Request) {
+	q := db.PaperQuery{Topic: r.URL.Query().Get("topic"), Source: db.PaperSource(r.URL.Query().Get("source"))}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="papers.jsonl"`)
+	s.cacheControl(w)
+	w.WriteHeader(http.StatusOK)
+
+	// NOTE: the status is sent already, a failure halfway only shows as a truncated export
+	enc := json.NewEncoder(w)
+	err := db.ForEachPublicPaper(r.Context(), s.DBPool, s.ProjectID, q, func(p db.PublicPaper) error {
+		return enc.Encode(p)
+	})
+	if err != nil {
+		log.Printf("[API] export failed: %v", err)
+	}
+}
+
+func (s *Server) paperQuery(w http.ResponseWriter, r *http.Request) (db.PaperQuery, bool) {
+	limit, ok := intParam(w, r, "limit", listLimit, s.MaxLimit)
+	if !ok {
+		return db.PaperQuery{}, false
+	}
+	return db.PaperQuery{
+		Topic:  r.URL.Query().Get("topic"),
+		Source: db.PaperSource(r.URL.Query().Get("source")),
+		Limit:  limit,
+	}, true
+}
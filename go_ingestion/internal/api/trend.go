@@ -0,0 +1,41 @@
+package api
+
+import (
+	"go_ingestion/db"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// GET /trend?topic=...&by=month&from=YYYY-MM-DD&to=YYYY-MM-DD counts the papers of a topic
+// per period of publication, from defaults to two years before to and to to today
+func (s *Server) trend(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	topic := query.Get("topic")
+	if topic == "" {
+		writeError(w, http.StatusBadRequest, "topic is required")
+		return
+	}
+	by := query.Get("by")
+	if by == "" {
+		by = "month"
+	}
+	if !slices.Contains(db.TrendBuckets, by) {
+		writeError(w, http.StatusBadRequest, "by must be day, week, month or year")
+		return
+	}
+	from, to, err := db.ParseTrendRange(query.Get("from"), query.Get("to"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	trend, err := db.TopicTrend(r.Context(), s.DBPool, s.ProjectID, topic, by, from, to)
+	if err != nil {
+		log.Printf("[API] %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to count the trend")
+		return
+	}
+	writeJSON(w, http.StatusOK, trend)
+}
@@ -0,0 +1,89 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"io"
+	"time"
+)
+
+// pages are filed under pages/<source>/<day>/<query>/<offset>-<request>.gz, query and
+// request are hashes, the gzip header carries the ArchivedPage they stand for
+const pagesPrefix = "pages/"
+
+// Pages archives the pages of the pagers into Store, see PagerOptions.Archive.
+type Pages struct {
+	Store Store
+}
+
+func (p Pages) Archive(ctx context.Context, page researchpaperapis.ArchivedPage) error {
+	meta, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Extra = meta
+	gz.ModTime = page.FetchedAt
+	if _, err := gz.Write(page.Body); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return p.Store.Put(ctx, PageKey(page), buf.Bytes())
+}
+
+// PageKey is where page is filed, pages of one request and day share it.
+func PageKey(page researchpaperapis.ArchivedPage) string {
+	return fmt.Sprintf("%s%010d-%s.gz", QueryPrefix(page.Source, page.FetchedAt, page.Query), page.Offset, shortHash(page.Key))
+}
+
+// QueryPrefix holds the pages of query fetched from source on the day of at.
+func QueryPrefix(source db.PaperSource, at time.Time, query string) string {
+	return DayPrefix(source, at) + shortHash(query) + "/"
+}
+
+// DayPrefix holds the pages fetched from source on the day of at, all days when at is zero.
+func DayPrefix(source db.PaperSource, at time.Time) string {
+	if at.IsZero() {
+		return pagesPrefix + string(source) + "/"
+	}
+	return pagesPrefix + string(source) + "/" + at.UTC().Format(time.DateOnly) + "/"
+}
+
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ReadPage reads the archived page at key with its body.
+func ReadPage(ctx context.Context, store Store, key string) (researchpaperapis.ArchivedPage, error) {
+	var page researchpaperapis.ArchivedPage
+	data, err := store.Get(ctx, key)
+	if err != nil {
+		return page, fmt.Errorf("failed to read archived page %s: %w", key, err)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return page, fmt.Errorf("archived page %s: %w", key, err)
+	}
+	defer gz.Close()
+
+	if err := json.Unmarshal(gz.Extra, &page); err != nil {
+		return page, fmt.Errorf("archived page %s has no request: %w", key, err)
+	}
+	if page.Body, err = io.ReadAll(gz); err != nil {
+		return page, fmt.Errorf("archived page %s: %w", key, err)
+	}
+	return page, nil
+}
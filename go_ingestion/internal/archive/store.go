@@ -0,0 +1,208 @@
+// Package archive keeps the raw pages fetched from upstream in a directory or an S3
+// compatible bucket, so mappers can be re-run over them after a fix without calling the
+// sources again.
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/internal/sigv4"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Store keeps objects by slash separated key.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns the keys under prefix in lexical order
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// New builds the configured backend, nil when archiving is off.
+func New(cfg config.Archive) (Store, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case "dir":
+		if cfg.Dir == "" {
+			return nil, errors.New("archive dir needs archive.dir")
+		}
+		return Dir{Root: cfg.Dir}, nil
+	case "s3":
+		return NewS3(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown archive backend %q, use dir or s3", cfg.Backend)
+	}
+}
+
+// Dir files objects under Root, the key is the path.
+type Dir struct {
+	Root string
+}
+
+func (d Dir) Put(ctx context.Context, key string, data []byte) error {
+	path := filepath.Join(d.Root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create archive dir: %w", err)
+	}
+
+	// NOTE: written aside and renamed, so a crash never leaves half an object
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (d Dir) Get(ctx context.Context, key string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(d.Root, filepath.FromSlash(key)))
+}
+
+func (d Dir) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(d.Root, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		rel, err := filepath.Rel(d.Root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if e.IsDir() {
+			// NOTE: only directories on the way to prefix or under it are walked
+			if key != "." && !strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(key, prefix) && !strings.HasPrefix(e.Name(), ".archive-") {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// S3 files objects in a bucket with path style requests, which every S3 compatible store
+// understands.
+type S3 struct {
+	cfg    config.ArchiveS3
+	client *http.Client
+}
+
+func NewS3(cfg config.ArchiveS3) (*S3, error) {
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+	if cfg.Region == "" {
+		return nil, errors.New("archive s3 needs archive.s3.region or AWS_REGION")
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("archive s3 needs archive.s3.bucket")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	return &S3{cfg: cfg, client: &http.Client{Timeout: time.Minute}}, nil
+}
+
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, body []byte) ([]byte, error) {
+	creds, err := sigv4.FromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(s.cfg.Endpoint + "/" + s.cfg.Bucket + "/" + key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive s3 endpoint: %w", err)
+	}
+	u.RawQuery = sigv4.CanonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 request: %w", err)
+	}
+	payloadHash := sigv4.PayloadHash(body)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	sigv4.Sign(req, payloadHash, s.cfg.Region, "s3", creds, time.Now().UTC())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read s3 response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("s3 %s %s returned status %s: %s", method, key, res.Status, data)
+	}
+	return data, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.do(ctx, http.MethodPut, s.cfg.Prefix+key, nil, data)
+	return err
+}
+
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+	return s.do(ctx, http.MethodGet, s.cfg.Prefix+key, nil, nil)
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.cfg.Prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		data, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := xml.Unmarshal(data, &page); err != nil {
+			return nil, fmt.Errorf("failed to parse s3 listing: %w", err)
+		}
+		for _, c := range page.Contents {
+			keys = append(keys, strings.TrimPrefix(c.Key, s.cfg.Prefix))
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/config"
+	"sync"
+	"time"
+)
+
+// Cache stores upstream responses for a while so a restarted run doesn't pay for them twice.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// New builds the configured backend, nil when caching is off.
+func New(cfg config.Cache) (Cache, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case "memory":
+		return NewMemory(), nil
+	case "redis":
+		return NewRedis(cfg.RedisURL)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+}
+
+// Memory is a per process cache, expired entries are dropped when read. With Limit set
+// it holds at most Limit entries, dropping the expired ones and then those expiring first.
+type Memory struct {
+	Limit int
+
+	mu    sync.Mutex
+	items map[string]memoryItem
+}
+
+type memoryItem struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{items: map[string]memoryItem{}}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if time.Now().After(item.expiresAt) {
+		delete(m.items, key)
+		return nil, false, nil
+	}
+	return item.value, true, nil
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.items[key]; !ok && m.Limit > 0 && len(m.items) >= m.Limit {
+		m.evict()
+	}
+	m.items[key] = memoryItem{value: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (m *Memory) evict() {
+	now := time.Now()
+	var first string
+	var firstAt time.Time
+	for k, item := range m.items {
+		if now.After(item.expiresAt) {
+			delete(m.items, k)
+			continue
+		}
+		if first == "" || item.expiresAt.Before(firstAt) {
+			first, firstAt = k, item.expiresAt
+		}
+	}
+	if len(m.items) >= m.Limit {
+		delete(m.items, first)
+	}
+}
@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NOTE: keys are prefixed so the ingester can share a redis with other services
+const redisPrefix = "researchq:ingest:"
+
+// Redis shares the cache between every ingester instance pointed at it.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to url, e.g. redis://localhost:6379/0.
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	return &Redis{client: redis.NewClient(opts)}, nil
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := r.client.Get(ctx, redisPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read cache key %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := r.client.Set(ctx, redisPrefix+key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to write cache key %s: %w", key, err)
+	}
+	return nil
+}
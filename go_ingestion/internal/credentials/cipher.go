@@ -0,0 +1,77 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Cipher encrypts credentials before they are stored. A KMS backed one plugs in here,
+// KeyID is stored next to every ciphertext so a rotated key is told apart from a wrong one.
+type Cipher interface {
+	KeyID() string
+	Encrypt(plaintext, aad []byte) ([]byte, error)
+	Decrypt(ciphertext, aad []byte) ([]byte, error)
+}
+
+// LocalKey is AES-256-GCM under a master key the deployment keeps outside the database.
+type LocalKey struct {
+	aead cipher.AEAD
+	id   string
+}
+
+// NewLocalKey takes a base64 or hex encoded 32 byte master key, e.g. from
+// `openssl rand -base64 32`.
+func NewLocalKey(encoded string) (*LocalKey, error) {
+	encoded = strings.TrimSpace(encoded)
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		if key, err = hex.DecodeString(encoded); err != nil || len(key) != 32 {
+			return nil, errors.New("master key must be 32 bytes, base64 or hex encoded")
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: a fingerprint, not the key, and a short one since it only tells keys apart
+	sum := sha256.Sum256(append([]byte("researchq-credentials:"), key...))
+	return &LocalKey{aead: aead, id: "local:" + hex.EncodeToString(sum[:4])}, nil
+}
+
+func (k *LocalKey) KeyID() string {
+	return k.id
+}
+
+// Encrypt returns nonce || sealed plaintext, aad binds it to where it is stored.
+func (k *LocalKey) Encrypt(plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize(), k.aead.NonceSize()+len(plaintext)+k.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to read nonce: %w", err)
+	}
+	return k.aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func (k *LocalKey) Decrypt(ciphertext, aad []byte) ([]byte, error) {
+	if len(ciphertext) < k.aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:k.aead.NonceSize()], ciphertext[k.aead.NonceSize():]
+	plaintext, err := k.aead.Open(nil, nonce, sealed, aad)
+	if err != nil {
+		return nil, errors.New("failed to decrypt, the ciphertext was changed or moved")
+	}
+	return plaintext, nil
+}
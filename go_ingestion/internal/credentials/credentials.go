@@ -0,0 +1,130 @@
+// Package credentials keeps source API keys per project in the database, encrypted under
+// a master key, so tenants don't need their keys in the process environment.
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_ingestion/db"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MasterKeyEnv holds the local master key, credentials aren't read from or written to the
+// database without it.
+const MasterKeyEnv = "CREDENTIALS_MASTER_KEY"
+
+// EnvVars are the sources that take an API key and the variable it falls back to, see
+// researchpaperapis.ProviderInfo.
+var EnvVars = envVars()
+
+func envVars() map[db.PaperSource]string {
+	vars := map[db.PaperSource]string{}
+	for _, p := range researchpaperapis.Providers() {
+		if info := p.Info(); info.KeyEnv != "" {
+			vars[info.Source] = info.KeyEnv
+		}
+	}
+	return vars
+}
+
+// ErrNoCipher is returned when credentials are stored or read without a master key.
+var ErrNoCipher = fmt.Errorf("credentials store is disabled, set %s", MasterKeyEnv)
+
+var (
+	// ErrUnknownSource is returned for sources without an API key
+	ErrUnknownSource = errors.New("source takes no api key")
+	ErrEmptyKey      = errors.New("api key is empty")
+)
+
+// Store encrypts credentials with Cipher, a nil Cipher only has the environment.
+type Store struct {
+	DBPool    *pgxpool.Pool
+	ProjectID uint64
+	Cipher    Cipher
+}
+
+// FromEnv returns the store of a project with the master key of the environment, if any.
+func FromEnv(dbPool *pgxpool.Pool, projectID uint64) (*Store, error) {
+	s := &Store{DBPool: dbPool, ProjectID: projectID}
+	if key := os.Getenv(MasterKeyEnv); key != "" {
+		c, err := NewLocalKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", MasterKeyEnv, err)
+		}
+		s.Cipher = c
+	}
+	return s, nil
+}
+
+func (s *Store) enabled() bool {
+	return s != nil && s.Cipher != nil && s.DBPool != nil
+}
+
+// aad ties a ciphertext to its project and source, so it can't be copied to another row.
+func (s *Store) aad(source db.PaperSource) []byte {
+	return []byte(strconv.FormatUint(s.ProjectID, 10) + "/" + string(source))
+}
+
+// Set encrypts and stores the API key of a source.
+func (s *Store) Set(ctx context.Context, source db.PaperSource, apiKey string) error {
+	if _, ok := EnvVars[source]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownSource, source)
+	}
+	if !s.enabled() {
+		return ErrNoCipher
+	}
+	apiKey = strings.TrimSpace(apiKey)
+	if apiKey == "" {
+		return ErrEmptyKey
+	}
+
+	ciphertext, err := s.Cipher.Encrypt([]byte(apiKey), s.aad(source))
+	if err != nil {
+		return err
+	}
+	return db.SaveCredential(ctx, s.DBPool, s.ProjectID, string(source), ciphertext, s.Cipher.KeyID())
+}
+
+// Delete removes the stored API key of a source, false when there was none.
+func (s *Store) Delete(ctx context.Context, source db.PaperSource) (bool, error) {
+	if s == nil || s.DBPool == nil {
+		return false, ErrNoCipher
+	}
+	return db.DeleteCredential(ctx, s.DBPool, s.ProjectID, string(source))
+}
+
+// List returns what is stored, never the keys themselves.
+func (s *Store) List(ctx context.Context) ([]db.StoredCredential, error) {
+	if s == nil || s.DBPool == nil {
+		return nil, ErrNoCipher
+	}
+	return db.ListCredentials(ctx, s.DBPool, s.ProjectID)
+}
+
+// APIKey returns the stored key of a source, otherwise the one in its environment variable,
+// "" when neither is set.
+func (s *Store) APIKey(ctx context.Context, source db.PaperSource) (string, error) {
+	if s.enabled() {
+		stored, ok, err := db.GetCredential(ctx, s.DBPool, s.ProjectID, string(source))
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			if stored.KeyID != s.Cipher.KeyID() {
+				return "", fmt.Errorf("%s credential was encrypted with key %s, %s is %s", source, stored.KeyID, MasterKeyEnv, s.Cipher.KeyID())
+			}
+			apiKey, err := s.Cipher.Decrypt(stored.Ciphertext, s.aad(source))
+			if err != nil {
+				return "", fmt.Errorf("%s credential: %w", source, err)
+			}
+			return string(apiKey), nil
+		}
+	}
+	return os.Getenv(EnvVars[source]), nil
+}
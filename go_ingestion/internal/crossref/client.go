@@ -0,0 +1,123 @@
+// Package crossref enriches papers that have a DOI with the funders, author affiliations
+// and references registered at Crossref.
+package crossref
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/internal/ratelimit"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const worksURL = "https://api.crossref.org/works/%s"
+
+// Client looks up works, Mailto puts requests in Crossref's polite pool.
+type Client struct {
+	Mailto  string
+	Limiter ratelimit.Limiter
+	// DOILimiter paces the CSL lookups at doi.org, nil skips them
+	DOILimiter ratelimit.Limiter
+	Client     *http.Client
+}
+
+func NewClient(mailto string, limiter ratelimit.Limiter) *Client {
+	return &Client{Mailto: mailto, Limiter: limiter, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+type Work struct {
+	Funders []Funder `json:"funder"`
+	Authors []Author `json:"author"`
+	// UpdatedBy lists the notices amending the work, retractions among them
+	UpdatedBy []Update `json:"updated-by"`
+	// References are only listed when the publisher deposited them openly
+	References []Reference `json:"reference"`
+}
+
+// Reference is an entry of the reference list, DOI is empty when crossref couldn't match it.
+type Reference struct {
+	DOI string `json:"DOI"`
+}
+
+type Update struct {
+	Type string `json:"type"`
+	DOI  string `json:"DOI"`
+}
+
+// Retracted reports whether a retraction notice was registered for the work.
+func (w Work) Retracted() bool {
+	for _, u := range w.UpdatedBy {
+		if strings.EqualFold(u.Type, "retraction") {
+			return true
+		}
+	}
+	return false
+}
+
+type Funder struct {
+	Name   string   `json:"name"`
+	DOI    string   `json:"DOI"`
+	Awards []string `json:"award"`
+}
+
+type Author struct {
+	Given        string        `json:"given"`
+	Family       string        `json:"family"`
+	Name         string        `json:"name"` // organizations as authors
+	Affiliations []Affiliation `json:"affiliation"`
+}
+
+type Affiliation struct {
+	Name string `json:"name"`
+}
+
+// FullName is how the author is stored, crossref splits people into given and family names.
+func (a Author) FullName() string {
+	if a.Name != "" {
+		return strings.TrimSpace(a.Name)
+	}
+	return strings.TrimSpace(a.Given + " " + a.Family)
+}
+
+type worksResponse struct {
+	Message Work `json:"message"`
+}
+
+// Work returns what crossref knows about doi, nil when the DOI isn't registered there.
+func (c *Client) Work(ctx context.Context, doi string) (*Work, error) {
+	if err := c.Limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf(worksURL, url.PathEscape(doi))
+	if c.Mailto != "" {
+		u += "?mailto=" + url.QueryEscape(c.Mailto)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create crossref request: %w", err)
+	}
+
+	res, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("crossref returned status %s", res.Status)
+	}
+
+	var resp worksResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode crossref response: %w", err)
+	}
+	return &resp.Message, nil
+}
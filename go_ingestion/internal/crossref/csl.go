@@ -0,0 +1,119 @@
+package crossref
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// cslURL answers with CSL-JSON for DOIs of every registry, crossref, datacite and the others
+const cslURL = "https://doi.org/%s"
+
+// CSL is the part of the citation metadata doi.org serves that papers tend to miss.
+type CSL struct {
+	Title          cslText `json:"title"`
+	ContainerTitle cslText `json:"container-title"`
+	Publisher      string  `json:"publisher"`
+	Issued         cslDate `json:"issued"`
+}
+
+// cslText is a string, some registries send a list of them
+type cslText string
+
+func (t *cslText) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		if len(list) > 0 {
+			*t = cslText(list[0])
+		}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*t = cslText(s)
+	return nil
+}
+
+type cslDate struct {
+	DateParts [][]json.Number `json:"date-parts"`
+}
+
+// Time is the issued day, months and days that aren't given are the first. Zero when the
+// registry has no date.
+func (d cslDate) Time() time.Time {
+	if len(d.DateParts) == 0 || len(d.DateParts[0]) == 0 {
+		return time.Time{}
+	}
+	parts := [3]int{0, 1, 1}
+	for i, p := range d.DateParts[0] {
+		if i == len(parts) {
+			break
+		}
+		n, err := p.Int64()
+		if err != nil {
+			return time.Time{}
+		}
+		parts[i] = int(n)
+	}
+	if parts[0] == 0 {
+		return time.Time{}
+	}
+	return time.Date(parts[0], time.Month(parts[1]), parts[2], 0, 0, 0, 0, time.UTC)
+}
+
+// CSL returns the citation metadata of doi through content negotiation at doi.org, nil
+// when no registry knows the DOI. Requests are paced by DOILimiter.
+func (c *Client) CSL(ctx context.Context, doi string) (*CSL, error) {
+	if err := c.DOILimiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(cslURL, url.PathEscape(doi)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create doi.org request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.citationstyles.csl+json")
+
+	res, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doi.org returned status %s", res.Status)
+	}
+
+	var csl CSL
+	if err := json.NewDecoder(res.Body).Decode(&csl); err != nil {
+		return nil, fmt.Errorf("failed to decode doi.org response: %w", err)
+	}
+	return &csl, nil
+}
+
+// sameTitle reports whether registered is stored written differently, in another case,
+// spacing or punctuation, or cut short.
+func sameTitle(stored, registered string) bool {
+	s, r := titleKey(stored), titleKey(registered)
+	// NOTE: a stored title cut to less than half is more likely another work's
+	return s != "" && len(s)*2 >= len(r) && strings.HasPrefix(r, s)
+}
+
+func titleKey(title string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, title)
+}
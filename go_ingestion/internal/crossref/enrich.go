@@ -0,0 +1,151 @@
+package crossref
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/db"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type EnrichReport struct {
+	Checked   int
+	Enriched  int
+	Failed    int
+	Retracted int
+	// Completed papers got a missing venue, publisher or date from doi.org
+	Completed int
+}
+
+func (r EnrichReport) String() string {
+	return fmt.Sprintf("checked=%d enriched=%d retracted=%d completed=%d failed=%d", r.Checked, r.Enriched, r.Retracted, r.Completed, r.Failed)
+}
+
+// Enrich looks up a batch of papers with a DOI that weren't checked yet. Papers crossref
+// doesn't know are marked checked too, so they aren't asked for again. With a DOILimiter
+// a batch of papers missing their venue or date is then completed from doi.org.
+func Enrich(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, client *Client, batch int) (EnrichReport, error) {
+	var report EnrichReport
+	if err := enrichWorks(ctx, dbPool, projectID, client, batch, &report); err != nil {
+		return report, err
+	}
+	if client.DOILimiter == nil {
+		return report, nil
+	}
+	return report, completeSparse(ctx, dbPool, projectID, client, batch, &report)
+}
+
+func enrichWorks(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, client *Client, batch int, report *EnrichReport) error {
+	papers, err := db.PapersToEnrich(ctx, dbPool, projectID, batch)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range papers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		report.Checked++
+
+		// NOTE: a failed lookup leaves the paper unchecked, the next batch tries it again
+		work, err := client.Work(ctx, p.DOI)
+		if err != nil {
+			log.Printf("[CROSSREF] doi=%s: %v", p.DOI, err)
+			report.Failed++
+			continue
+		}
+
+		var enrichment db.CrossrefEnrichment
+		if work != nil {
+			enrichment = toEnrichment(*work)
+		}
+		if err := db.SaveCrossrefEnrichment(ctx, dbPool, p.ID, enrichment); err != nil {
+			return err
+		}
+		if len(enrichment.Funders) > 0 || len(enrichment.Affiliations) > 0 {
+			report.Enriched++
+		}
+		if enrichment.Retracted {
+			log.Printf("[CROSSREF] doi=%s was retracted", p.DOI)
+			report.Retracted++
+		}
+	}
+
+	return nil
+}
+
+// completeSparse fills in the venue, publisher, date and title of papers their source left
+// out from the CSL-JSON doi.org serves.
+func completeSparse(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, client *Client, batch int, report *EnrichReport) error {
+	papers, err := db.PapersWithSparseMetadata(ctx, dbPool, projectID, batch)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range papers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		csl, err := client.CSL(ctx, p.DOI)
+		if err != nil {
+			log.Printf("[DOI] doi=%s: %v", p.DOI, err)
+			report.Failed++
+			continue
+		}
+
+		var meta *db.DOIMetadata
+		if csl != nil {
+			meta = toDOIMetadata(p, *csl)
+		}
+		if err := db.SaveDOIMetadata(ctx, dbPool, p.ID, meta); err != nil {
+			return err
+		}
+		if meta != nil {
+			report.Completed++
+		}
+	}
+	return nil
+}
+
+func toDOIMetadata(p db.SparsePaper, csl CSL) *db.DOIMetadata {
+	meta := &db.DOIMetadata{
+		Venue:     strings.TrimSpace(string(csl.ContainerTitle)),
+		Publisher: strings.TrimSpace(csl.Publisher),
+	}
+	if issued := csl.Issued.Time(); !issued.IsZero() {
+		meta.Issued = &issued
+	}
+	// NOTE: the registered title only replaces a stored one that is the same title, a source
+	// that truncated or mangled it. A DOI pointing at another work must not rename the paper
+	if title := strings.TrimSpace(string(csl.Title)); title != p.Title && sameTitle(p.Title, title) {
+		meta.Title = title
+	}
+	return meta
+}
+
+func toEnrichment(work Work) db.CrossrefEnrichment {
+	e := db.CrossrefEnrichment{Retracted: work.Retracted()}
+	for _, f := range work.Funders {
+		if name := strings.TrimSpace(f.Name); name != "" {
+			e.Funders = append(e.Funders, db.Funder{Name: name, DOI: strings.TrimSpace(f.DOI), Awards: f.Awards})
+		}
+	}
+
+	for _, r := range work.References {
+		if doi := strings.ToLower(strings.TrimSpace(r.DOI)); doi != "" {
+			e.References = append(e.References, doi)
+		}
+	}
+
+	for i, a := range work.Authors {
+		for _, aff := range a.Affiliations {
+			if name := strings.TrimSpace(aff.Name); name != "" {
+				e.Affiliations = append(e.Affiliations, db.Affiliation{AuthorPosition: i, Author: a.FullName(), Name: name})
+			}
+		}
+	}
+	return e
+}
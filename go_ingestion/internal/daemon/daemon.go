@@ -0,0 +1,163 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/leader"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// NOTE: arbitrary but fixed, every replica must use the same class. The project is the
+// other key, each project's scheduler has a leader of its own
+const schedulerLockClass int32 = 727_001
+
+type Handler func(ctx context.Context, job db.Job) error
+
+type ScheduleEntry struct {
+	Kind    string
+	Payload any
+	Every   time.Duration
+	// Priority orders due jobs across workers, higher is claimed first
+	Priority int
+}
+
+// Daemon runs the job worker on every replica and the scheduler only on the elected leader.
+type Daemon struct {
+	DBPool       *pgxpool.Pool
+	ProjectID    uint64
+	Handlers     map[string]Handler
+	Schedule     []ScheduleEntry
+	PollInterval time.Duration
+	LeaderRetry  time.Duration
+	// JobLease is how long a job stays with its worker without a renewal, it is renewed
+	// while the job runs so only a worker that died loses its jobs
+	JobLease time.Duration
+	// JobMaxAttempts bounds how often a job that lost its worker is claimed again
+	JobMaxAttempts int
+}
+
+func (d *Daemon) Run(ctx context.Context) {
+	workerID := workerID()
+	log.Printf("[DAEMON] started worker=%s project=%d", workerID, d.ProjectID)
+
+	elector := leader.NewElector(d.DBPool, schedulerLockClass, int32(d.ProjectID), d.LeaderRetry)
+	go elector.Run(ctx, d.runScheduler)
+
+	d.runWorker(ctx, workerID)
+	log.Printf("[DAEMON] stopped worker=%s", workerID)
+}
+
+func (d *Daemon) runScheduler(ctx context.Context) {
+	last := make([]time.Time, len(d.Schedule))
+
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for i, entry := range d.Schedule {
+			if !last[i].IsZero() && time.Since(last[i]) < entry.Every {
+				continue
+			}
+
+			queued, err := db.EnqueueJobIfIdle(ctx, d.DBPool, d.ProjectID, entry.Kind, entry.Payload, entry.Priority)
+			if err != nil {
+				log.Printf("[SCHEDULER] %v", err)
+				continue
+			}
+			if queued {
+				log.Printf("[SCHEDULER] queued %s job", entry.Kind)
+			}
+			last[i] = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Daemon) runWorker(ctx context.Context, workerID string) {
+	for {
+		job, err := db.ClaimJob(ctx, d.DBPool, d.ProjectID, workerID, d.JobLease, d.JobMaxAttempts)
+		if err != nil {
+			log.Printf("[WORKER] %v", err)
+		}
+
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.PollInterval):
+			}
+			continue
+		}
+
+		jobCtx, cancel := context.WithCancel(ctx)
+		renewed := make(chan struct{})
+		go func() {
+			defer close(renewed)
+			d.renewLease(jobCtx, cancel, *job, workerID)
+		}()
+
+		jobErr := d.handle(jobCtx, *job)
+		cancel()
+		<-renewed
+		if jobErr != nil {
+			log.Printf("[WORKER] job id=%d kind=%s failed: %v", job.ID, job.Kind, jobErr)
+		}
+
+		// NOTE: background ctx so a job interrupted by shutdown is still marked
+		if err := db.FinishJob(context.Background(), d.DBPool, job.ID, workerID, jobErr); err != nil {
+			log.Printf("[WORKER] %v", err)
+		}
+	}
+}
+
+// renewLease keeps the lease of a running job until ctx is done. A job whose lease ran out
+// anyway belongs to another worker now, cancel stops it here.
+func (d *Daemon) renewLease(ctx context.Context, cancel context.CancelFunc, job db.Job, workerID string) {
+	ticker := time.NewTicker(d.JobLease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		held, err := db.RenewJobLease(ctx, d.DBPool, job.ID, workerID, d.JobLease)
+		if err != nil {
+			log.Printf("[WORKER] %v", err)
+			continue
+		}
+		if !held {
+			log.Printf("[WORKER] job id=%d kind=%s lost its lease, stopping it", job.ID, job.Kind)
+			cancel()
+			return
+		}
+	}
+}
+
+func (d *Daemon) handle(ctx context.Context, job db.Job) error {
+	handler, ok := d.Handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("no handler for job kind %q", job.Kind)
+	}
+	return handler(ctx, job)
+}
+
+func workerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
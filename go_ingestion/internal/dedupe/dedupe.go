@@ -0,0 +1,82 @@
+package dedupe
+
+import (
+	"context"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Verdict int
+
+const (
+	Unique Verdict = iota
+	Duplicate
+	Borderline
+)
+
+type Result struct {
+	Verdict     Verdict
+	CandidateID uint64
+	Score       float64
+}
+
+// Check looks for an existing paper in the project matching paper, by DOI or another
+// identifier first and by fuzzy title when either side has no DOI.
+func Check(ctx context.Context, dbPool *pgxpool.Pool, paper db.ResearchPaper, cfg config.Dedupe) (Result, error) {
+	doi := ""
+	if paper.DOI != nil {
+		doi = strings.TrimSpace(*paper.DOI)
+	}
+
+	if doi != "" {
+		id, found, err := db.FindPaperByDOI(ctx, dbPool, paper.ProjectID, doi)
+		if err != nil {
+			return Result{}, err
+		}
+		if found {
+			return Result{Verdict: Duplicate, CandidateID: id, Score: 1}, nil
+		}
+	}
+
+	if len(paper.Identifiers) > 0 {
+		id, found, err := db.FindPaperByIdentifiers(ctx, dbPool, paper.ProjectID, paper.Identifiers)
+		if err != nil {
+			return Result{}, err
+		}
+		if found {
+			return Result{Verdict: Duplicate, CandidateID: id, Score: 1}, nil
+		}
+	}
+
+	candidates, err := db.FindSimilarTitles(ctx, dbPool, paper.ProjectID, paper.Title, cfg.TrigramThreshold, 5)
+	if err != nil {
+		return Result{}, err
+	}
+
+	title := NormalizeTitle(paper.Title)
+	best := Result{Verdict: Unique}
+	for _, c := range candidates {
+		// NOTE: two different DOIs are two different papers no matter how close the titles are
+		if doi != "" && c.DOI != nil && strings.TrimSpace(*c.DOI) != "" {
+			continue
+		}
+
+		score := JaroWinkler(title, NormalizeTitle(c.Title))
+		if score > best.Score {
+			best.Score = score
+			best.CandidateID = c.ID
+		}
+	}
+
+	switch {
+	case best.Score >= cfg.MatchThreshold:
+		best.Verdict = Duplicate
+	case best.Score >= cfg.ReviewThreshold:
+		best.Verdict = Borderline
+	}
+
+	return best, nil
+}
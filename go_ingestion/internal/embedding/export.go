@@ -0,0 +1,128 @@
+package embedding
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	"os"
+	"path/filepath"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// export layout, rows of metadata.jsonl line up with the rows of the vectors:
+//
+//	embeddings.npy  (format npy)  float32 (rows, dim)
+//	index.faiss     (format faiss) IndexIDMap over IndexFlat, ids are chunk or paper ids
+//	metadata.jsonl
+
+type Level string
+
+const (
+	LevelChunk Level = "chunk"
+	LevelPaper Level = "paper"
+)
+
+type Format string
+
+const (
+	FormatNPY   Format = "npy"
+	FormatFaiss Format = "faiss"
+)
+
+type ExportOptions struct {
+	Level  Level
+	Format Format
+	// Metric only applies to FAISS indexes
+	Metric Metric
+	// Namespace picks the vectors exported, default when empty
+	Namespace string
+}
+
+type ExportReport struct {
+	Rows       int
+	Dimensions int
+	Files      []string
+}
+
+type vectorWriter interface {
+	Write(id int64, vec []float32) error
+	Close() error
+}
+
+// Export writes the embeddings of a project to dir, per chunk or per paper (the mean of
+// its chunks), so they can be used without access to pgvector.
+func Export(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, dir string, opts ExportOptions) (ExportReport, error) {
+	forEach := db.ForEachChunkEmbedding
+	switch opts.Level {
+	case LevelChunk:
+	case LevelPaper:
+		forEach = db.ForEachPaperEmbedding
+	default:
+		return ExportReport{}, fmt.Errorf("unknown level %q, expected chunk or paper", opts.Level)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return ExportReport{}, err
+	}
+
+	var (
+		vectors vectorWriter
+		path    string
+		err     error
+	)
+	switch opts.Format {
+	case FormatNPY:
+		path = filepath.Join(dir, "embeddings.npy")
+		vectors, err = newNPYWriter(path)
+	case FormatFaiss:
+		path = filepath.Join(dir, "index.faiss")
+		vectors, err = newFaissWriter(path, opts.Metric)
+	default:
+		return ExportReport{}, fmt.Errorf("unknown format %q, expected npy or faiss", opts.Format)
+	}
+	if err != nil {
+		return ExportReport{}, err
+	}
+
+	metaPath := filepath.Join(dir, "metadata.jsonl")
+	metaFile, err := os.Create(metaPath)
+	if err != nil {
+		vectors.Close()
+		return ExportReport{}, fmt.Errorf("failed to create %s: %w", metaPath, err)
+	}
+	defer metaFile.Close()
+	meta := bufio.NewWriter(metaFile)
+	enc := json.NewEncoder(meta)
+
+	report := ExportReport{Files: []string{path, metaPath}}
+	err = forEach(ctx, dbPool, projectID, opts.Namespace, func(e db.Embedding) error {
+		id := e.ChunkID
+		if opts.Level == LevelPaper {
+			id = int64(e.PaperID)
+		}
+		if err := vectors.Write(id, e.Vector); err != nil {
+			return fmt.Errorf("paper %d chunk %d: %w", e.PaperID, e.ChunkIndex, err)
+		}
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("failed to write metadata: %w", err)
+		}
+		report.Rows++
+		report.Dimensions = len(e.Vector)
+		return nil
+	})
+	if err != nil {
+		vectors.Close()
+		return report, err
+	}
+
+	if err := vectors.Close(); err != nil {
+		return report, err
+	}
+	if err := meta.Flush(); err != nil {
+		return report, fmt.Errorf("failed to flush metadata: %w", err)
+	}
+	return report, metaFile.Close()
+}
@@ -0,0 +1,110 @@
+package embedding
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// Metric is the distance a FAISS index ranks by.
+type Metric string
+
+const (
+	MetricIP Metric = "ip"
+	MetricL2 Metric = "l2"
+)
+
+// faiss_helper expects an IndexIDMap keyed by our ids, so that's what is written:
+//
+//	"IxMp" header  IndexIDMap
+//	"IxFI" header  IndexFlatIP ("IxF2" IndexFlatL2)
+//	u64 n*d, n*d f32 vectors
+//	u64 n, n i64 ids
+//
+// header is d i32, ntotal i64, two i64 dummies, is_trained u8, metric i32. Counts aren't
+// known up front so they are patched in on Close, the ids are kept until then.
+const faissHeaderLen = 4 + 4 + 8 + 8 + 8 + 1 + 4
+
+type faissWriter struct {
+	f      *os.File
+	w      *bufio.Writer
+	metric Metric
+	ids    []int64
+	dim    int
+	buf    []byte
+}
+
+func newFaissWriter(path string, metric Metric) (*faissWriter, error) {
+	if metric != MetricIP && metric != MetricL2 {
+		return nil, fmt.Errorf("unknown metric %q, expected ip or l2", metric)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	w := &faissWriter{f: f, w: bufio.NewWriter(f), metric: metric}
+	if _, err := w.w.Write(w.header()); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write faiss header: %w", err)
+	}
+	return w, nil
+}
+
+// header is everything before the vectors.
+func (w *faissWriter) header() []byte {
+	flat, metric := "IxFI", uint32(0)
+	if w.metric == MetricL2 {
+		flat, metric = "IxF2", 1
+	}
+
+	b := make([]byte, 0, 2*faissHeaderLen+8)
+	b = appendFaissHeader(b, "IxMp", w.dim, len(w.ids), metric)
+	b = appendFaissHeader(b, flat, w.dim, len(w.ids), metric)
+	return binary.LittleEndian.AppendUint64(b, uint64(len(w.ids)*w.dim))
+}
+
+func appendFaissHeader(b []byte, fourcc string, dim, total int, metric uint32) []byte {
+	b = append(b, fourcc...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(dim))
+	b = binary.LittleEndian.AppendUint64(b, uint64(total))
+	b = binary.LittleEndian.AppendUint64(b, 1<<20)
+	b = binary.LittleEndian.AppendUint64(b, 1<<20)
+	b = append(b, 1)
+	return binary.LittleEndian.AppendUint32(b, metric)
+}
+
+func (w *faissWriter) Write(id int64, vec []float32) error {
+	if len(w.ids) == 0 {
+		w.dim = len(vec)
+	} else if len(vec) != w.dim {
+		return fmt.Errorf("vector has %d dimensions, expected %d", len(vec), w.dim)
+	}
+
+	w.buf = appendFloats(w.buf[:0], vec)
+	if _, err := w.w.Write(w.buf); err != nil {
+		return fmt.Errorf("failed to write faiss vector: %w", err)
+	}
+	w.ids = append(w.ids, id)
+	return nil
+}
+
+func (w *faissWriter) Close() error {
+	defer w.f.Close()
+
+	ids := binary.LittleEndian.AppendUint64(nil, uint64(len(w.ids)))
+	for _, id := range w.ids {
+		ids = binary.LittleEndian.AppendUint64(ids, uint64(id))
+	}
+	if _, err := w.w.Write(ids); err != nil {
+		return fmt.Errorf("failed to write faiss ids: %w", err)
+	}
+	if err := w.w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush faiss index: %w", err)
+	}
+	if _, err := w.f.WriteAt(w.header(), 0); err != nil {
+		return fmt.Errorf("failed to write faiss header: %w", err)
+	}
+	return w.f.Close()
+}
@@ -0,0 +1,79 @@
+package embedding
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// npyHeaderLen leaves room for any shape, the header is rewritten once the row count is
+// known and has to keep its length.
+const npyHeaderLen = 128
+
+// npyWriter writes float32 rows to a .npy file (format 1.0), readable with numpy.load.
+type npyWriter struct {
+	f    *os.File
+	w    *bufio.Writer
+	rows int
+	dim  int
+	buf  []byte
+}
+
+func newNPYWriter(path string) (*npyWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	w := &npyWriter{f: f, w: bufio.NewWriter(f)}
+	if _, err := w.w.Write(npyHeader(0, 0)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write npy header: %w", err)
+	}
+	return w, nil
+}
+
+func npyHeader(rows, dim int) []byte {
+	dict := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%d, %d), }", rows, dim)
+	header := make([]byte, 0, npyHeaderLen)
+	header = append(header, "\x93NUMPY\x01\x00"...)
+	header = binary.LittleEndian.AppendUint16(header, npyHeaderLen-10)
+	header = append(header, dict...)
+	header = append(header, strings.Repeat(" ", npyHeaderLen-len(header)-1)...)
+	return append(header, '\n')
+}
+
+func (w *npyWriter) Write(_ int64, vec []float32) error {
+	if w.rows == 0 {
+		w.dim = len(vec)
+	} else if len(vec) != w.dim {
+		return fmt.Errorf("vector has %d dimensions, expected %d", len(vec), w.dim)
+	}
+
+	w.buf = appendFloats(w.buf[:0], vec)
+	if _, err := w.w.Write(w.buf); err != nil {
+		return fmt.Errorf("failed to write npy row: %w", err)
+	}
+	w.rows++
+	return nil
+}
+
+func (w *npyWriter) Close() error {
+	defer w.f.Close()
+	if err := w.w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush npy file: %w", err)
+	}
+	if _, err := w.f.WriteAt(npyHeader(w.rows, w.dim), 0); err != nil {
+		return fmt.Errorf("failed to write npy header: %w", err)
+	}
+	return w.f.Close()
+}
+
+func appendFloats(b []byte, vec []float32) []byte {
+	for _, v := range vec {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+	return b
+}
@@ -0,0 +1,176 @@
+// Package export describes exported datasets with a manifest, so a dataset built from the
+// corpus can be checked byte for byte and cited with what it was filtered by.
+package export
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// manifestVersion is the layout of the manifest itself
+const manifestVersion = 1
+
+// SchemaVersion is the layout of the exported rows, bump it when a column of the csv or a
+// field of the jsonl papers changes
+const SchemaVersion = 1
+
+// Filters are what the papers were selected by, empty fields didn't filter
+type Filters struct {
+	Topic string `json:"topic,omitempty"`
+}
+
+type Manifest struct {
+	Version       int       `json:"version"`
+	SchemaVersion int       `json:"schema_version"`
+	Project       string    `json:"project"`
+	CreatedAt     time.Time `json:"created_at"`
+	Format        string    `json:"format"`
+	Filters       Filters   `json:"filters"`
+	// File is the export, relative to the manifest
+	File   string `json:"file"`
+	Rows   int    `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// ManifestPath is where the manifest of the export at path goes by default.
+func ManifestPath(path string) string {
+	return path + ".manifest.json"
+}
+
+// Digest passes writes through to the export while hashing and counting them.
+type Digest struct {
+	w     io.Writer
+	h     hash.Hash
+	bytes int64
+}
+
+func NewDigest(w io.Writer) *Digest {
+	return &Digest{w: w, h: sha256.New()}
+}
+
+func (d *Digest) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	d.h.Write(p[:n])
+	d.bytes += int64(n)
+	return n, err
+}
+
+// Manifest describes the export written through d, call it once the export is complete.
+func (d *Digest) Manifest(project, format, path string, filters Filters, rows int) Manifest {
+	return Manifest{
+		Version:       manifestVersion,
+		SchemaVersion: SchemaVersion,
+		Project:       project,
+		CreatedAt:     time.Now().UTC(),
+		Format:        format,
+		Filters:       filters,
+		File:          filepath.Base(path),
+		Rows:          rows,
+		Bytes:         d.bytes,
+		SHA256:        hex.EncodeToString(d.h.Sum(nil)),
+	}
+}
+
+func WriteManifest(path string, m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write export manifest: %w", err)
+	}
+	return nil
+}
+
+// Verify checks the export described by the manifest at path against its checksum, size
+// and row count.
+func Verify(path string) (Manifest, error) {
+	var m Manifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, fmt.Errorf("failed to read export manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("failed to decode export manifest %s: %w", path, err)
+	}
+	if m.Version > manifestVersion {
+		return m, fmt.Errorf("export manifest version %d is newer than this build understands", m.Version)
+	}
+
+	f, err := os.Open(filepath.Join(filepath.Dir(path), m.File))
+	if err != nil {
+		return m, fmt.Errorf("failed to open export: %w", err)
+	}
+	defer f.Close()
+
+	d := NewDigest(io.Discard)
+	rows, err := countRows(m.Format, io.TeeReader(f, d))
+	if err != nil {
+		return m, err
+	}
+
+	var mismatches []error
+	if sum := hex.EncodeToString(d.h.Sum(nil)); sum != m.SHA256 {
+		mismatches = append(mismatches, fmt.Errorf("sha256 is %s, manifest says %s", sum, m.SHA256))
+	}
+	if d.bytes != m.Bytes {
+		mismatches = append(mismatches, fmt.Errorf("%d bytes, manifest says %d", d.bytes, m.Bytes))
+	}
+	if rows != m.Rows {
+		mismatches = append(mismatches, fmt.Errorf("%d rows, manifest says %d", rows, m.Rows))
+	}
+	if len(mismatches) > 0 {
+		return m, fmt.Errorf("export %s doesn't match its manifest: %w", m.File, errors.Join(mismatches...))
+	}
+	return m, nil
+}
+
+// countRows reads the whole export, csv rows are counted without the header.
+func countRows(format string, r io.Reader) (int, error) {
+	rows := 0
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		for {
+			_, err := cr.Read()
+			if err == io.EOF {
+				return max(rows-1, 0), nil
+			}
+			if err != nil {
+				return rows, fmt.Errorf("failed to read export: %w", err)
+			}
+			rows++
+		}
+	case FormatJSONL:
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 0, 64<<10), 64<<20)
+		for sc.Scan() {
+			if len(sc.Bytes()) > 0 {
+				rows++
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return rows, fmt.Errorf("failed to read export: %w", err)
+		}
+		return rows, nil
+	default:
+		return 0, fmt.Errorf("unknown export format %q", format)
+	}
+}
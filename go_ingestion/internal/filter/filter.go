@@ -0,0 +1,76 @@
+package filter
+
+import (
+	"fmt"
+	"go_ingestion/config"
+	"slices"
+	"strings"
+)
+
+// Attributes are the fields the rules look at, each source fills what it knows.
+// Zero values mean unknown and never reject a paper.
+type Attributes struct {
+	Year             int
+	FieldsOfStudy    []string
+	PublicationTypes []string
+	CitationCount    *int
+	Language         string
+	// Categories are source classifications like arxiv's cs.CL, primary first
+	Categories []string
+	// ContentType is springer's kind of record, e.g. Chapter or ReferenceWorkEntry
+	ContentType string
+}
+
+// Check returns a non-empty reason when the paper is rejected by the configured rules.
+func Check(rules config.Filters, attrs Attributes) string {
+	if rules.MinYear > 0 && attrs.Year > 0 && attrs.Year < rules.MinYear {
+		return fmt.Sprintf("year %d < %d", attrs.Year, rules.MinYear)
+	}
+
+	if len(rules.RequiredFieldsOfStudy) > 0 && len(attrs.FieldsOfStudy) > 0 && !anyEqualFold(attrs.FieldsOfStudy, rules.RequiredFieldsOfStudy) {
+		return fmt.Sprintf("fields of study %v not in %v", attrs.FieldsOfStudy, rules.RequiredFieldsOfStudy)
+	}
+
+	for _, t := range attrs.PublicationTypes {
+		if containsFold(rules.ExcludePublicationTypes, t) {
+			return fmt.Sprintf("publication type %q excluded", t)
+		}
+	}
+
+	if attrs.ContentType != "" {
+		if len(rules.IncludeContentTypes) > 0 && !containsFold(rules.IncludeContentTypes, attrs.ContentType) {
+			return fmt.Sprintf("content type %q not in %v", attrs.ContentType, rules.IncludeContentTypes)
+		}
+		if containsFold(rules.ExcludeContentTypes, attrs.ContentType) {
+			return fmt.Sprintf("content type %q excluded", attrs.ContentType)
+		}
+	}
+
+	if len(rules.Categories) > 0 && len(attrs.Categories) > 0 && !slices.ContainsFunc(attrs.Categories, func(c string) bool { return matchesCategory(rules.Categories, c) }) {
+		return fmt.Sprintf("categories %v not in %v", attrs.Categories, rules.Categories)
+	}
+
+	if rules.MinCitations > 0 && attrs.CitationCount != nil && *attrs.CitationCount < rules.MinCitations {
+		return fmt.Sprintf("citations %d < %d", *attrs.CitationCount, rules.MinCitations)
+	}
+
+	if len(rules.Languages) > 0 && attrs.Language != "" && !containsFold(rules.Languages, attrs.Language) {
+		return fmt.Sprintf("language %q not in %v", attrs.Language, rules.Languages)
+	}
+
+	return ""
+}
+
+// matchesCategory matches whole categories or their archive, "cs" keeps cs.CL and cs.LG.
+func matchesCategory(list []string, category string) bool {
+	archive, _, _ := strings.Cut(category, ".")
+	return containsFold(list, category) || containsFold(list, archive)
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(v string) bool { return strings.EqualFold(strings.TrimSpace(v), strings.TrimSpace(s)) })
+}
+
+func anyEqualFold(values, list []string) bool {
+	return slices.ContainsFunc(values, func(v string) bool { return containsFold(list, v) })
+}
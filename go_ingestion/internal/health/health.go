@@ -0,0 +1,121 @@
+package health
+
+import (
+	"context"
+	"go_ingestion/db"
+	"go_ingestion/internal/ratelimit"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Probe makes one cheap request against a source, nil means it is available.
+type Probe func(ctx context.Context) error
+
+// Monitor tracks which sources are up. Workers wait on an unhealthy source, re-probing it
+// every RecheckInterval, instead of burning their retry budget on it.
+type Monitor struct {
+	// DBPool records every probe in source_health when set
+	DBPool          *pgxpool.Pool
+	Probes          map[db.PaperSource]Probe
+	Timeout         time.Duration
+	RecheckInterval time.Duration
+
+	mu      sync.Mutex
+	healthy map[db.PaperSource]bool
+	// probing serializes re-probes so waiting workers of one source share a single request
+	probing sync.Mutex
+}
+
+// Check probes every source once and returns the unhealthy ones with their error.
+func (m *Monitor) Check(ctx context.Context) map[db.PaperSource]error {
+	failed := map[db.PaperSource]error{}
+	for source := range m.Probes {
+		if err := m.probe(ctx, source); err != nil {
+			failed[source] = err
+		}
+	}
+	return failed
+}
+
+func (m *Monitor) probe(ctx context.Context, source db.PaperSource) error {
+	probeCtx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.Probes[source](probeCtx)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	m.mu.Lock()
+	if m.healthy == nil {
+		m.healthy = map[db.PaperSource]bool{}
+	}
+	m.healthy[source] = err == nil
+	m.mu.Unlock()
+
+	var lastError *string
+	if err != nil {
+		msg := err.Error()
+		lastError = &msg
+		log.Printf("[HEALTH] %s unavailable: %v", source, err)
+	}
+
+	if m.DBPool != nil {
+		if recErr := db.RecordSourceHealth(ctx, m.DBPool, source, err == nil, lastError); recErr != nil {
+			log.Printf("[HEALTH] %v", recErr)
+		}
+	}
+	return err
+}
+
+// Healthy reports the last known state, a source that was never probed counts as healthy.
+func (m *Monitor) Healthy(source db.PaperSource) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	healthy, ok := m.healthy[source]
+	return !ok || healthy
+}
+
+// WaitHealthy blocks until source is healthy again or ctx is done.
+func (m *Monitor) WaitHealthy(ctx context.Context, source db.PaperSource) error {
+	for !m.Healthy(source) {
+		log.Printf("[HEALTH] %s is down, waiting %s before probing again", source, m.RecheckInterval)
+
+		timer := time.NewTimer(m.RecheckInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		m.probing.Lock()
+		if !m.Healthy(source) {
+			m.probe(ctx, source)
+		}
+		m.probing.Unlock()
+	}
+	return ctx.Err()
+}
+
+// Gate makes limiter wait for source to be healthy before handing out a request slot.
+func (m *Monitor) Gate(limiter ratelimit.Limiter, source db.PaperSource) ratelimit.Limiter {
+	return gated{monitor: m, limiter: limiter, source: source}
+}
+
+type gated struct {
+	monitor *Monitor
+	limiter ratelimit.Limiter
+	source  db.PaperSource
+}
+
+func (g gated) Wait(ctx context.Context) error {
+	if err := g.monitor.WaitHealthy(ctx, g.source); err != nil {
+		return err
+	}
+	return g.limiter.Wait(ctx)
+}
@@ -0,0 +1,57 @@
+// Package keyphrase extracts keyphrases from stored chunks, for faceted exploration and
+// keyword boosting of papers without their embeddings.
+package keyphrase
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/db"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Report struct {
+	Chunks  int
+	Phrases int
+	// Skipped chunks belong to papers in a language the stopwords don't cover
+	Skipped int
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("chunks=%d phrases=%d skipped=%d", r.Chunks, r.Phrases, r.Skipped)
+}
+
+// ExtractBatch extracts up to perChunk keyphrases from a batch of chunks that have none yet.
+//
+// NOTE: RAKE needs the stopwords of a language, only english ones are built in. Chunks of
+// papers known to be in another language are marked without phrases.
+func ExtractBatch(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, batch, perChunk int) (Report, error) {
+	var report Report
+
+	chunks, err := db.ChunksWithoutKeyphrases(ctx, dbPool, projectID, batch)
+	if err != nil {
+		return report, err
+	}
+
+	for _, c := range chunks {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+
+		var phrases []db.Keyphrase
+		if c.Language == "" || c.Language == "en" {
+			for _, p := range Extract(c.Content, perChunk) {
+				phrases = append(phrases, db.Keyphrase{Phrase: p.Text, Score: p.Score})
+			}
+		} else {
+			report.Skipped++
+		}
+
+		if err := db.SaveKeyphrases(ctx, dbPool, c.ID, c.PaperID, phrases); err != nil {
+			return report, err
+		}
+		report.Chunks++
+		report.Phrases += len(phrases)
+	}
+	return report, nil
+}
@@ -0,0 +1,133 @@
+package keyphrase
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Phrase is a keyphrase of a text with its RAKE score, higher is more salient.
+type Phrase struct {
+	Text  string
+	Score float64
+}
+
+// maxWords is the longest candidate phrase, longer runs of content words are mostly
+// sentence fragments rather than terms
+const maxWords = 3
+
+// stopwords split candidate phrases, the usual english function words and the filler
+// vocabulary of papers ("we propose", "results show").
+var stopwords = toSet(strings.Fields(`
+	a about above after again against all also although am an and any are as at be
+	because been before being below between both but by can could did do does doing
+	down during each either et etc few for from further had has have having he her
+	here hers him his how however i if in into is it its itself just may me might more
+	most must my neither no nor not of off on once only or other our ours out over own
+	per same she should since so some such than that the their theirs them then there
+	these they this those through thus to too under until up upon us very via was we
+	were what when where whether which while who whom why will with within without
+	would yet you your
+	al approach approaches based case cases show shows shown using used use uses paper
+	papers propose proposed present presented result results work works method methods
+	new novel different various several many one two three first second well also given
+	section figure table fig eq see however respectively following order able make made
+`))
+
+func toSet(words []string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+// Extract returns up to n keyphrases of an english text by RAKE: phrases are runs of
+// content words between stopwords and punctuation, a word scores its degree (the words
+// it co-occurs with in phrases) over its frequency and a phrase the sum of its words.
+func Extract(text string, n int) []Phrase {
+	var candidates [][]string
+	var run []string
+	flush := func() {
+		// NOTE: a lone short word ("ai", "x2") says little without the phrase around it
+		if len(run) > 0 && len(run) <= maxWords && (len(run) > 1 || len([]rune(run[0])) >= 3) {
+			candidates = append(candidates, run)
+		}
+		run = nil
+	}
+
+	for _, token := range tokenize(text) {
+		if token == "" || stopwords[token] || !hasLetter(token) {
+			flush()
+			continue
+		}
+		run = append(run, token)
+	}
+	flush()
+
+	freq := map[string]float64{}
+	degree := map[string]float64{}
+	for _, words := range candidates {
+		for _, w := range words {
+			freq[w]++
+			degree[w] += float64(len(words))
+		}
+	}
+
+	scores := map[string]float64{}
+	for _, words := range candidates {
+		var score float64
+		for _, w := range words {
+			score += degree[w] / freq[w]
+		}
+		scores[strings.Join(words, " ")] = score
+	}
+
+	phrases := make([]Phrase, 0, len(scores))
+	for text, score := range scores {
+		phrases = append(phrases, Phrase{Text: text, Score: score})
+	}
+	sort.Slice(phrases, func(i, j int) bool {
+		if phrases[i].Score != phrases[j].Score {
+			return phrases[i].Score > phrases[j].Score
+		}
+		return phrases[i].Text < phrases[j].Text
+	})
+	if len(phrases) > n {
+		phrases = phrases[:n]
+	}
+	return phrases
+}
+
+// tokenize lowercases text into words, every punctuation mark becomes an "" token so
+// phrases never span it. Hyphens and apostrophes inside a word are kept.
+func tokenize(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	end := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, strings.Trim(word.String(), "-'"))
+			word.Reset()
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(unicode.ToLower(r))
+		case (r == '-' || r == '\'') && word.Len() > 0:
+			word.WriteRune(r)
+		case unicode.IsSpace(r):
+			end()
+		default:
+			end()
+			tokens = append(tokens, "")
+		}
+	}
+	end()
+	return tokens
+}
+
+func hasLetter(s string) bool {
+	return strings.IndexFunc(s, unicode.IsLetter) >= 0
+}
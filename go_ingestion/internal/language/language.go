@@ -0,0 +1,138 @@
+// Package language tells the language of a paper from its title and abstract, good
+// enough to route papers to the right splitter and embedding model.
+package language
+
+import (
+	"strings"
+	"unicode"
+)
+
+// codes maps the names and ISO 639-2 codes sources report to ISO 639-1
+var codes = map[string]string{
+	"eng": "en", "english": "en",
+	"ger": "de", "deu": "de", "german": "de",
+	"fre": "fr", "fra": "fr", "french": "fr",
+	"spa": "es", "spanish": "es",
+	"ita": "it", "italian": "it",
+	"por": "pt", "portuguese": "pt",
+	"dut": "nl", "nld": "nl", "dutch": "nl",
+	"chi": "zh", "zho": "zh", "chinese": "zh",
+	"jpn": "ja", "japanese": "ja",
+	"kor": "ko", "korean": "ko",
+	"rus": "ru", "russian": "ru",
+	"ara": "ar", "arabic": "ar",
+}
+
+// Normalize returns the ISO 639-1 code of a reported language, "" when unknown.
+func Normalize(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if i := strings.IndexAny(s, "-_"); i > 0 {
+		s = s[:i]
+	}
+	if code, ok := codes[s]; ok {
+		return code
+	}
+	if len(s) == 2 {
+		return s
+	}
+	return ""
+}
+
+// stopwords are frequent words of the latin script languages, few enough to overlap rarely
+var stopwords = map[string][]string{
+	"en": {"the", "of", "and", "to", "in", "is", "that", "for", "with", "we", "this", "are", "on", "by", "from"},
+	"de": {"der", "die", "und", "das", "ist", "mit", "von", "den", "für", "wir", "ein", "eine", "auf", "werden", "nicht"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "pour", "dans", "du", "que", "sur", "nous", "par", "ce"},
+	"es": {"el", "la", "los", "las", "y", "de", "que", "en", "es", "una", "para", "con", "por", "del", "se"},
+	"it": {"il", "della", "di", "che", "è", "per", "una", "sono", "con", "del", "gli", "nel", "questo", "le", "si"},
+	"pt": {"o", "os", "da", "do", "que", "em", "é", "uma", "para", "com", "não", "dos", "das", "na", "no"},
+	"nl": {"de", "het", "een", "van", "en", "is", "dat", "voor", "met", "op", "zijn", "niet", "wordt", "deze", "ook"},
+}
+
+var stopwordLanguages = func() map[string][]string {
+	byWord := map[string][]string{}
+	for lang, words := range stopwords {
+		for _, w := range words {
+			byWord[w] = append(byWord[w], lang)
+		}
+	}
+	return byWord
+}()
+
+// minHits is how many stopwords the best language needs before it's trusted
+const minHits = 3
+
+// Detect returns the ISO 639-1 code of the language text is written in, "" when the text
+// is too short or too mixed to tell.
+func Detect(text string) string {
+	if lang := detectScript(text); lang != "" {
+		return lang
+	}
+
+	hits := map[string]int{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		for _, lang := range stopwordLanguages[word] {
+			hits[lang]++
+		}
+	}
+
+	best, tied := "", false
+	for lang, n := range hits {
+		switch {
+		case n > hits[best]:
+			best, tied = lang, false
+		case n == hits[best]:
+			tied = true
+		}
+	}
+	// NOTE: a tie says nothing, neither does a handful of words
+	if tied || hits[best] < minHits {
+		return ""
+	}
+	return best
+}
+
+// detectScript tells languages with their own script apart by counting letters, latin
+// text returns "".
+func detectScript(text string) string {
+	var letters, han, kana, hangul, cyrillic, arabic int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+		}
+	}
+
+	// NOTE: papers in these languages still carry latin formulas and names, a third is plenty
+	third := letters / 3
+	switch {
+	case letters == 0:
+		return ""
+	case kana > 0 && kana+han > third:
+		return "ja"
+	case han > third:
+		return "zh"
+	case hangul > third:
+		return "ko"
+	case cyrillic > third:
+		return "ru"
+	case arabic > third:
+		return "ar"
+	default:
+		return ""
+	}
+}
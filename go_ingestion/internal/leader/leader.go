@@ -0,0 +1,90 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Elector elects one leader among all instances sharing a database using a session
+// level advisory lock: whoever holds the lock is leader until its connection dies.
+// The lock is the two key kind, class says what is led and object which one of them,
+// so e.g. every project can have a leader of its own.
+type Elector struct {
+	dbPool     *pgxpool.Pool
+	lockClass  int32
+	lockObject int32
+	retry      time.Duration
+}
+
+func NewElector(dbPool *pgxpool.Pool, lockClass, lockObject int32, retry time.Duration) *Elector {
+	return &Elector{dbPool: dbPool, lockClass: lockClass, lockObject: lockObject, retry: retry}
+}
+
+// Run calls lead while this instance is leader and keeps campaigning until ctx is done.
+// The ctx passed to lead is cancelled as soon as leadership is lost.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	for {
+		if err := e.campaign(ctx, lead); err != nil {
+			log.Printf("[LEADER] %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.retry):
+		}
+	}
+}
+
+func (e *Elector) campaign(ctx context.Context, lead func(ctx context.Context)) error {
+	// NOTE: the lock lives on this one connection, it must not go back to the pool while held
+	conn, err := e.dbPool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var acquired bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1, $2);`, e.lockClass, e.lockObject).Scan(&acquired); err != nil {
+		return fmt.Errorf("failed to try advisory lock: %w", err)
+	}
+	if !acquired {
+		return nil
+	}
+
+	log.Printf("[LEADER] acquired leadership lock=%d/%d", e.lockClass, e.lockObject)
+	defer func() {
+		// NOTE: background ctx, the unlock must happen even when ctx is already cancelled
+		conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1, $2);`, e.lockClass, e.lockObject)
+		log.Printf("[LEADER] released leadership lock=%d/%d", e.lockClass, e.lockObject)
+	}()
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+
+	ticker := time.NewTicker(e.retry)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-ticker.C:
+			if err := conn.Ping(leadCtx); err != nil {
+				cancel()
+				<-done
+				return fmt.Errorf("lost leadership: %w", err)
+			}
+		}
+	}
+}
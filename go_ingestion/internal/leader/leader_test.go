@@ -0,0 +1,60 @@
+package leader
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// NOTE: not the scheduler's class, so a daemon on the same database doesn't get in the way
+const testLockClass int32 = 727_999
+
+func TestElector(t *testing.T) {
+	if os.Getenv("DATABASE_URL") == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	dbPool, err := pgxpool.New(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbPool.Close()
+
+	// led reports whether campaigning once made the elector leader
+	led := func(e *Elector) bool {
+		var leading bool
+		if err := e.campaign(ctx, func(context.Context) { leading = true }); err != nil {
+			t.Fatal(err)
+		}
+		return leading
+	}
+
+	first := NewElector(dbPool, testLockClass, 1, 10*time.Millisecond)
+	leadCtx, stop := context.WithCancel(ctx)
+	leading, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		first.Run(leadCtx, func(ctx context.Context) {
+			close(leading)
+			<-ctx.Done()
+		})
+	}()
+	<-leading
+
+	if led(NewElector(dbPool, testLockClass, 1, 10*time.Millisecond)) {
+		t.Error("a second elector of the same object became leader")
+	}
+	if !led(NewElector(dbPool, testLockClass, 2, 10*time.Millisecond)) {
+		t.Error("the elector of another object didn't become leader")
+	}
+
+	stop()
+	<-stopped
+	if !led(NewElector(dbPool, testLockClass, 1, 10*time.Millisecond)) {
+		t.Error("no elector became leader after the leader stopped")
+	}
+}
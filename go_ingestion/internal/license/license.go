@@ -0,0 +1,80 @@
+package license
+
+import (
+	"slices"
+	"strings"
+)
+
+// normalized license identifiers stored in research_papers.license
+const (
+	CCBY          = "cc-by"
+	CCBYSA        = "cc-by-sa"
+	CCBYNC        = "cc-by-nc"
+	CCBYNCSA      = "cc-by-nc-sa"
+	CCBYND        = "cc-by-nd"
+	CCBYNCND      = "cc-by-nc-nd"
+	CC0           = "cc0"
+	PublicDomain  = "public-domain"
+	PublisherOA   = "publisher-specific-oa"
+	OAUnspecified = "oa-unspecified"
+	Other         = "other"
+)
+
+// DefaultRedistributable are the licenses that allow republishing derived datasets.
+var DefaultRedistributable = []string{CCBY, CCBYSA, CC0, PublicDomain}
+
+// Normalize maps the different upstream spellings ("CCBY", "cc-by-nc-sa",
+// "http://creativecommons.org/licenses/by/4.0/", "other-oa") to one identifier,
+// empty input stays empty (unknown).
+func Normalize(raw string) string {
+	s := strings.ToLower(strings.TrimSpace(raw))
+	if s == "" {
+		return ""
+	}
+
+	if strings.Contains(s, "creativecommons.org") {
+		switch {
+		case strings.Contains(s, "/publicdomain/zero"):
+			return CC0
+		case strings.Contains(s, "/publicdomain/"):
+			return PublicDomain
+		case strings.Contains(s, "/licenses/"):
+			s = strings.TrimPrefix(s[strings.Index(s, "/licenses/")+len("/licenses/"):], "/")
+			s = "cc-" + strings.SplitN(s, "/", 2)[0]
+		}
+	}
+
+	compact := strings.NewReplacer("-", "", "_", "", " ", "", ".", "").Replace(s)
+	switch compact {
+	case "ccby":
+		return CCBY
+	case "ccbysa":
+		return CCBYSA
+	case "ccbync":
+		return CCBYNC
+	case "ccbyncsa":
+		return CCBYNCSA
+	case "ccbynd":
+		return CCBYND
+	case "ccbyncnd":
+		return CCBYNCND
+	case "cc0", "cczero":
+		return CC0
+	case "publicdomain", "pd":
+		return PublicDomain
+	case "publisherspecificoa":
+		return PublisherOA
+	case "otheroa", "openaccess", "true":
+		return OAUnspecified
+	}
+
+	return Other
+}
+
+// Redistributable reports whether license is one of allowed, unknown licenses never are.
+func Redistributable(license *string, allowed []string) bool {
+	if license == nil || *license == "" {
+		return false
+	}
+	return slices.Contains(allowed, *license)
+}
@@ -0,0 +1,135 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_ingestion/db"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GCReport counts the artifacts left behind by deleted or merged papers.
+type GCReport struct {
+	OrphanChunks  int64
+	OrphanVectors int64
+	OrphanPDFs    int64
+	// FreedBytes is the size of the orphan PDFs
+	FreedBytes int64
+	DryRun     bool
+}
+
+type GCOptions struct {
+	// DryRun only counts what would be removed
+	DryRun bool
+	// MinAge spares PDFs modified more recently, so a file written before its paper row
+	// commits isn't collected
+	MinAge time.Duration
+}
+
+// CollectGarbage removes PDFs (and their extracted text) in pdfDir without a paper, chunks
+// without a paper and vectors without a chunk. Chunks and PDFs aren't scoped to a project
+// since paper ids are unique across projects.
+func CollectGarbage(ctx context.Context, dbPool *pgxpool.Pool, pdfDir string, opts GCOptions) (GCReport, error) {
+	report := GCReport{DryRun: opts.DryRun}
+	var err error
+
+	if opts.DryRun {
+		report.OrphanChunks, report.OrphanVectors, err = db.CountOrphanChunks(ctx, dbPool)
+	} else {
+		report.OrphanChunks, report.OrphanVectors, err = db.DeleteOrphanChunks(ctx, dbPool)
+	}
+	if err != nil {
+		return report, err
+	}
+
+	report.OrphanPDFs, report.FreedBytes, err = removeOrphanPDFs(ctx, dbPool, pdfDir, opts)
+	return report, err
+}
+
+func (r GCReport) String() string {
+	return fmt.Sprintf(
+		"orphan_chunks=%d orphan_vectors=%d orphan_pdfs=%d freed_bytes=%d dry_run=%t",
+		r.OrphanChunks, r.OrphanVectors, r.OrphanPDFs, r.FreedBytes, r.DryRun,
+	)
+}
+
+// NOTE: pdfs are named <paper id>.pdf and their extracted text <paper id>.txt, anything else
+// in the dir is left alone
+func removeOrphanPDFs(ctx context.Context, dbPool *pgxpool.Pool, pdfDir string, opts GCOptions) (int64, int64, error) {
+	if pdfDir == "" {
+		return 0, 0, nil
+	}
+
+	entries, err := os.ReadDir(pdfDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read pdf dir: %w", err)
+	}
+
+	files := make(map[int64][]fs.DirEntry)
+	ids := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if entry.IsDir() || (ext != ".pdf" && ext != ".txt") {
+			continue
+		}
+
+		id, err := strconv.ParseInt(strings.TrimSuffix(name, ext), 10, 64)
+		if err != nil {
+			continue
+		}
+		if _, ok := files[id]; !ok {
+			ids = append(ids, id)
+		}
+		files[id] = append(files[id], entry)
+	}
+
+	if len(ids) == 0 {
+		return 0, 0, nil
+	}
+
+	existing, err := db.ExistingPaperIDs(ctx, dbPool, ids)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var removed, freed int64
+	for id, entries := range files {
+		if existing[id] {
+			continue
+		}
+
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			if opts.MinAge > 0 && time.Since(info.ModTime()) < opts.MinAge {
+				continue
+			}
+
+			path := filepath.Join(pdfDir, entry.Name())
+			if !opts.DryRun {
+				if err := os.Remove(path); err != nil {
+					log.Printf("[GC] failed removing %s: %v", path, err)
+					continue
+				}
+			}
+			removed++
+			freed += info.Size()
+		}
+	}
+
+	return removed, freed, nil
+}
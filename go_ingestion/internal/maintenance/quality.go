@@ -0,0 +1,134 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/db"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// QualityOptions say whether and how PDF links are checked, the other counts come from
+// the database alone.
+type QualityOptions struct {
+	// CheckLinks is how many links of papers not downloaded yet are requested per topic,
+	// 0 checks none
+	CheckLinks int
+	Workers    int
+	Timeout    time.Duration
+}
+
+type TopicQuality struct {
+	db.TopicQuality
+	LinksChecked int
+	DeadLinks    int
+}
+
+type QualityReport struct {
+	Topics []TopicQuality
+	Total  TopicQuality
+}
+
+// Quality counts missing abstracts and DOIs, suspected duplicates, non-English papers and,
+// when asked to, dead PDF links per topic of the project.
+func Quality(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, opts QualityOptions) (QualityReport, error) {
+	var report QualityReport
+
+	counts, err := db.TopicQualities(ctx, dbPool, projectID)
+	if err != nil {
+		return report, err
+	}
+	byTopic := make(map[string]int, len(counts))
+	for i, c := range counts {
+		byTopic[c.Topic] = i
+		report.Topics = append(report.Topics, TopicQuality{TopicQuality: c})
+		report.Total.Add(c)
+	}
+	report.Total.Topic = "total"
+
+	if opts.CheckLinks <= 0 {
+		return report, nil
+	}
+	links, err := db.SamplePDFLinks(ctx, dbPool, projectID, opts.CheckLinks)
+	if err != nil {
+		return report, err
+	}
+	dead := checkLinks(ctx, links, opts)
+	for i, l := range links {
+		t := &report.Topics[byTopic[l.Topic]]
+		t.LinksChecked++
+		report.Total.LinksChecked++
+		if dead[i] {
+			t.DeadLinks++
+			report.Total.DeadLinks++
+		}
+	}
+	return report, ctx.Err()
+}
+
+// checkLinks requests links with opts.Workers at a time and reports which are dead.
+func checkLinks(ctx context.Context, links []db.PDFLink, opts QualityOptions) []bool {
+	client := &http.Client{Timeout: opts.Timeout}
+	dead := make([]bool, len(links))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range max(opts.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				dead[i] = linkDead(ctx, client, links[i].URL)
+			}
+		}()
+	}
+	for i := range links {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(next)
+	wg.Wait()
+	return dead
+}
+
+// linkDead tells whether a link is gone: it doesn't answer, or answers with a client or
+// server error that isn't about access or rate limits. Servers that don't allow HEAD are
+// asked for the first byte instead.
+func linkDead(ctx context.Context, client *http.Client, url string) bool {
+	status, err := requestStatus(ctx, client, http.MethodHead, url)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = requestStatus(ctx, client, http.MethodGet, url)
+	}
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return false
+	}
+	return status >= 400
+}
+
+func requestStatus(ctx context.Context, client *http.Client, method, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	return res.StatusCode, nil
+}
@@ -0,0 +1,131 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_ingestion/db"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"go_ingestion/internal/sink"
+	"go_ingestion/internal/subject"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RebuildStage is a layer derived from the authoritative paper columns.
+type RebuildStage string
+
+const (
+	// RebuildChunks clears chunks and their vectors, the chunk and embed stages redo them
+	RebuildChunks RebuildStage = "chunks"
+	// RebuildEmbeddings clears vectors, the embed stage redoes them
+	RebuildEmbeddings RebuildStage = "embeddings"
+	// RebuildFTS re-indexes papers into OpenSearch
+	RebuildFTS RebuildStage = "fts"
+	// RebuildTags files papers under subjects again from their raw payload
+	RebuildTags RebuildStage = "tags"
+)
+
+var RebuildStages = []RebuildStage{RebuildChunks, RebuildEmbeddings, RebuildFTS, RebuildTags}
+
+// RebuildOptions are needed by some stages only.
+type RebuildOptions struct {
+	// Index is what fts rebuilds into
+	Index *sink.OpenSearch
+}
+
+type RebuildReport struct {
+	Stage   RebuildStage
+	Cleared db.RebuildReport
+	// Deleted documents from the search index
+	Deleted int64
+	Papers  int
+	// Kept papers have no raw payload left to rebuild tags from, their subjects stay
+	Kept   int
+	Failed int
+}
+
+func (r RebuildReport) String() string {
+	switch r.Stage {
+	case RebuildChunks, RebuildEmbeddings:
+		return fmt.Sprintf("stage=%s %s", r.Stage, r.Cleared)
+	case RebuildFTS:
+		return fmt.Sprintf("stage=%s deleted=%d indexed=%d failed=%d", r.Stage, r.Deleted, r.Papers, r.Failed)
+	default:
+		return fmt.Sprintf("stage=%s papers=%d kept=%d failed=%d", r.Stage, r.Papers, r.Kept, r.Failed)
+	}
+}
+
+// Rebuild truncates a derived layer for the papers of topic, all topics when topic is "",
+// and regenerates it. Chunks and embeddings are only cleared here, their papers are sent
+// back a status so the orchestrator's stages regenerate them with the current settings.
+func Rebuild(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, stage RebuildStage, topic string, opts RebuildOptions) (RebuildReport, error) {
+	report := RebuildReport{Stage: stage}
+	var err error
+
+	switch stage {
+	case RebuildChunks:
+		report.Cleared, err = db.ClearChunks(ctx, dbPool, projectID, topic)
+	case RebuildEmbeddings:
+		report.Cleared, err = db.ClearEmbeddings(ctx, dbPool, projectID, topic)
+	case RebuildFTS:
+		err = rebuildIndex(ctx, dbPool, projectID, topic, opts.Index, &report)
+	case RebuildTags:
+		err = rebuildTags(ctx, dbPool, projectID, topic, &report)
+	default:
+		err = fmt.Errorf("unknown stage %q, expected one of %v", stage, RebuildStages)
+	}
+	return report, err
+}
+
+func rebuildIndex(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, topic string, index *sink.OpenSearch, report *RebuildReport) error {
+	if index == nil {
+		return fmt.Errorf("no search index configured, see sink.opensearch")
+	}
+
+	var err error
+	report.Deleted, err = index.DeleteTopic(ctx, projectID, topic)
+	if err != nil {
+		return err
+	}
+
+	err = db.ForEachTopicPaper(ctx, dbPool, projectID, topic, func(row db.ResearchPaper) error {
+		// NOTE: venue and tags aren't stored, they come from the raw payload when it is left
+		if p, err := researchpaperapis.Remap(row); err == nil {
+			row.Search = db.SearchFields{Venue: p.Venue, Tags: p.Topics}
+		}
+		if err := index.Write(ctx, &row); err != nil {
+			log.Printf("[REBUILD] paper %d: %v", row.ID, err)
+			report.Failed++
+			return nil
+		}
+		report.Papers++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return index.Close()
+}
+
+func rebuildTags(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, topic string, report *RebuildReport) error {
+	return db.ForEachTopicPaper(ctx, dbPool, projectID, topic, func(row db.ResearchPaper) error {
+		p, err := researchpaperapis.Remap(row)
+		if errors.Is(err, researchpaperapis.ErrNoPayload) {
+			report.Kept++
+			return nil
+		}
+		if err != nil {
+			log.Printf("[REBUILD] paper %d: %v", row.ID, err)
+			report.Failed++
+			return nil
+		}
+
+		if err := db.ReplacePaperSubjects(ctx, dbPool, row.ID, row.Source, subject.Normalize(p.Subjects)); err != nil {
+			return err
+		}
+		report.Papers++
+		return nil
+	})
+}
@@ -0,0 +1,77 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RetentionReport struct {
+	PrunedPayloads int64
+	DroppedPapers  int64
+	OrphanChunks   int64
+	OrphanVectors  int64
+	OrphanPDFs     int64
+}
+
+func RunRetention(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, cfg config.Retention, pdfDir string) (RetentionReport, error) {
+	var report RetentionReport
+	var err error
+
+	if cfg.RawPayloadDays > 0 {
+		report.PrunedPayloads, err = db.PruneRawPayloads(ctx, dbPool, projectID, cfg.RawPayloadDays)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if cfg.DropDeletedTopics {
+		report.DroppedPapers, err = db.DeletePapersOfDeletedTopics(ctx, dbPool, projectID)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if cfg.VacuumOrphans {
+		gc, err := CollectGarbage(ctx, dbPool, pdfDir, GCOptions{})
+		report.OrphanChunks, report.OrphanVectors, report.OrphanPDFs = gc.OrphanChunks, gc.OrphanVectors, gc.OrphanPDFs
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// RunRetentionEvery runs the retention job on every tick until ctx is cancelled.
+func RunRetentionEvery(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, cfg config.Retention, pdfDir string, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		report, err := RunRetention(ctx, dbPool, projectID, cfg, pdfDir)
+		if err != nil {
+			log.Printf("[RETENTION] run failed: %v", err)
+		} else {
+			log.Printf("[RETENTION] %s", report)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r RetentionReport) String() string {
+	return fmt.Sprintf(
+		"pruned_payloads=%d dropped_papers=%d orphan_chunks=%d orphan_vectors=%d orphan_pdfs=%d",
+		r.PrunedPayloads, r.DroppedPapers, r.OrphanChunks, r.OrphanVectors, r.OrphanPDFs,
+	)
+}
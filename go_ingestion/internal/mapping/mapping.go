@@ -0,0 +1,140 @@
+// Package mapping lets the config override how upstream fields land in a paper, so a
+// field a source starts returning can be picked up without a release.
+package mapping
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/paper"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// Fields are the paper fields a mapping can set, the template output replaces the value
+// the built-in mapper produced unless it is empty.
+var Fields = []string{"title", "pdf_url", "doi", "abstract", "venue", "license", "published", "topics", "language"}
+
+var funcs = template.FuncMap{
+	"join":  join,
+	"first": first,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// Mapping is the compiled field templates of one source.
+type Mapping struct {
+	source db.PaperSource
+	fields map[string]*template.Template
+}
+
+// Set holds the mapping of every configured source.
+type Set map[db.PaperSource]*Mapping
+
+// Compile parses the templates of config.Mappings, keyed by source then paper field.
+func Compile(cfg map[string]map[string]string) (Set, error) {
+	set := Set{}
+	for source, fields := range cfg {
+		m := &Mapping{source: db.PaperSource(source), fields: map[string]*template.Template{}}
+		for field, text := range fields {
+			if !slices.Contains(Fields, field) {
+				return nil, fmt.Errorf("unknown field %q in %s mapping, expected one of %s", field, source, strings.Join(Fields, ", "))
+			}
+			tmpl, err := template.New(source + "." + field).Funcs(funcs).Option("missingkey=zero").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s mapping of %s: %w", field, source, err)
+			}
+			m.fields[field] = tmpl
+		}
+		set[m.source] = m
+	}
+	return set, nil
+}
+
+// For returns the mapping of source, nil when it has none.
+func (s Set) For(source db.PaperSource) *Mapping {
+	return s[source]
+}
+
+// Apply executes the templates on record and overrides the fields of p they produce.
+func (m *Mapping) Apply(p *paper.Paper, record any) error {
+	if m == nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	// NOTE: sorted so a failing mapping always reports the same field
+	for _, name := range slices.Sorted(maps.Keys(m.fields)) {
+		buf.Reset()
+		if err := m.fields[name].Execute(&buf, record); err != nil {
+			return fmt.Errorf("failed to map %s %s: %w", m.source, name, err)
+		}
+		value := strings.TrimSpace(buf.String())
+		if value == "" || value == "<no value>" {
+			continue
+		}
+		set(p, name, value)
+	}
+	return nil
+}
+
+func set(p *paper.Paper, field, value string) {
+	switch field {
+	case "title":
+		p.Title = value
+	case "pdf_url":
+		p.PDFURL = value
+	case "doi":
+		p.DOI = value
+	case "abstract":
+		p.Abstract = value
+	case "venue":
+		p.Venue = value
+	case "license":
+		p.License = value
+	case "published":
+		if t := paper.ParseDate(value); !t.IsZero() {
+			p.Published = t
+		}
+	case "topics":
+		var topics []string
+		for _, t := range strings.Split(value, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				topics = append(topics, t)
+			}
+		}
+		p.Topics = topics
+	case "language":
+		p.Attributes.Language = value
+	}
+}
+
+// join concatenates a list the template got from upstream JSON, where every value is any.
+func join(sep string, v any) string {
+	if v == nil {
+		return ""
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		parts = append(parts, fmt.Sprint(item))
+	}
+	return strings.Join(parts, sep)
+}
+
+func first(v any) any {
+	if items, ok := v.([]any); ok && len(items) > 0 {
+		return items[0]
+	}
+	return nil
+}
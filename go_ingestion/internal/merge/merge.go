@@ -0,0 +1,96 @@
+package merge
+
+import (
+	"context"
+	"go_ingestion/db"
+	"slices"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Precedence ranks sources per field, earlier wins, see config.Dedupe.Precedence.
+type Precedence map[string][]string
+
+// prefers reports whether incoming outranks current for field, sources that aren't listed
+// rank after the listed ones and unlisted fields never change hands.
+func (p Precedence) prefers(field string, incoming, current db.PaperSource) bool {
+	ranking, ok := p[field]
+	if !ok {
+		return false
+	}
+
+	rank := func(source db.PaperSource) int {
+		if i := slices.Index(ranking, string(source)); i >= 0 {
+			return i
+		}
+		return len(ranking)
+	}
+	return rank(incoming) < rank(current)
+}
+
+// Into merges incoming into the existing paper id: fields the existing row is missing
+// are filled from incoming, disagreements go to the better ranked source per precedence
+// and the losing value is kept as a provenance conflict.
+func Into(ctx context.Context, dbPool *pgxpool.Pool, id uint64, incoming db.ResearchPaper, precedence Precedence) error {
+	return db.MergeIntoPaper(ctx, dbPool, id, incoming.Source, func(existing *db.ResearchPaper, prov *db.Provenance) bool {
+		return Fields(existing, prov, incoming, precedence)
+	})
+}
+
+// Fields applies incoming onto existing and reports whether anything changed.
+func Fields(existing *db.ResearchPaper, prov *db.Provenance, incoming db.ResearchPaper, precedence Precedence) bool {
+	if incoming.Source == existing.Source {
+		return false
+	}
+
+	current := db.MergeableFields(*existing)
+	changed := false
+
+	for field, value := range db.MergeableFields(incoming) {
+		if value == "" || value == current[field] {
+			continue
+		}
+
+		if current[field] != "" {
+			owner, ok := prov.Fields[field]
+			if !ok {
+				owner = existing.Source
+			}
+			if !precedence.prefers(field, incoming.Source, owner) {
+				prov.AddConflict(field, incoming.Source, value)
+				changed = true
+				continue
+			}
+			prov.AddConflict(field, owner, current[field])
+		}
+
+		if !set(existing, incoming, field) {
+			continue
+		}
+		prov.Fields[field] = incoming.Source
+		changed = true
+	}
+
+	return changed
+}
+
+// NOTE: title and pdf_url are never empty on an existing row, they only change by precedence
+func set(existing *db.ResearchPaper, incoming db.ResearchPaper, field string) bool {
+	switch field {
+	case "title":
+		existing.Title = incoming.Title
+	case "pdf_url":
+		existing.PDFURL = incoming.PDFURL
+	case "doi":
+		existing.DOI = incoming.DOI
+	case "license":
+		existing.License = incoming.License
+	case "authors":
+		existing.Authors = incoming.Authors
+	case "tldr":
+		existing.TLDR = incoming.TLDR
+	default:
+		return false
+	}
+	return true
+}
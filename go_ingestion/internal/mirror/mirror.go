@@ -0,0 +1,36 @@
+// Package mirror picks which of the PDF URLs a paper has is downloaded from.
+package mirror
+
+import (
+	"go_ingestion/db"
+	"slices"
+	"strings"
+)
+
+// Rank orders candidates by the first entry of prefer they match, a host (arxiv.org also
+// matches export.arxiv.org) or a kind (arxiv, publisher, repository). Unmatched candidates
+// keep the source's order after the matched ones, duplicate URLs are dropped.
+func Rank(candidates []db.PDFCandidate, prefer []string) []db.PDFCandidate {
+	ranked := make([]db.PDFCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		if c.URL == "" || slices.ContainsFunc(ranked, func(r db.PDFCandidate) bool { return r.URL == c.URL }) {
+			continue
+		}
+		ranked = append(ranked, c)
+	}
+
+	slices.SortStableFunc(ranked, func(a, b db.PDFCandidate) int {
+		return score(a, prefer) - score(b, prefer)
+	})
+	return ranked
+}
+
+func score(c db.PDFCandidate, prefer []string) int {
+	for i, p := range prefer {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if c.Kind == p || c.Host == p || strings.HasSuffix(c.Host, "."+p) {
+			return i
+		}
+	}
+	return len(prefer)
+}
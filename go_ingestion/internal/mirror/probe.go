@@ -0,0 +1,110 @@
+package mirror
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type Verdict int
+
+const (
+	// Unknown links didn't answer clearly, they are kept as they are
+	Unknown Verdict = iota
+	// PDF links answered with a PDF
+	PDF
+	// Dead links are gone or serve something that isn't a PDF, such as a landing page
+	Dead
+)
+
+// Prevalidator requests PDF links before their papers are stored.
+type Prevalidator struct {
+	Client *http.Client
+	// Workers links are requested at a time
+	Workers int
+}
+
+// Check probes urls with Workers at a time, the verdicts line up with urls.
+func (p *Prevalidator) Check(ctx context.Context, urls []string) []Verdict {
+	verdicts := make([]Verdict, len(urls))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range max(p.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				verdicts[i] = Probe(ctx, p.Client, urls[i])
+			}
+		}()
+	}
+	for i := range urls {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(next)
+	wg.Wait()
+	return verdicts
+}
+
+// Probe requests a link with HEAD, following redirects, and tells by the status and content
+// type whether it serves a PDF. Servers that don't allow HEAD are asked for the first byte
+// instead. Failed requests, access denials, rate limits and server errors are Unknown
+// since they may pass.
+func Probe(ctx context.Context, client *http.Client, url string) Verdict {
+	res, err := request(ctx, client, http.MethodHead, url)
+	if err == nil && (res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented) {
+		res, err = request(ctx, client, http.MethodGet, url)
+	}
+	if err != nil {
+		return Unknown
+	}
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized, res.StatusCode == http.StatusForbidden, res.StatusCode == http.StatusTooManyRequests:
+		return Unknown
+	case res.StatusCode >= 500:
+		return Unknown
+	case res.StatusCode >= 400:
+		return Dead
+	}
+
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return Unknown
+	}
+	switch {
+	case mediaType == "application/pdf", mediaType == "application/x-pdf":
+		return PDF
+	// NOTE: some repositories serve every download as a generic binary
+	case mediaType == "application/octet-stream", mediaType == "binary/octet-stream":
+		return PDF
+	case strings.HasPrefix(mediaType, "text/"):
+		return Dead
+	}
+	return Unknown
+}
+
+func request(ctx context.Context, client *http.Client, method, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	return res, nil
+}
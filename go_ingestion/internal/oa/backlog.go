@@ -0,0 +1,75 @@
+package oa
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type BacklogReport struct {
+	Checked  int
+	Resolved int
+	Failed   int
+}
+
+func (r BacklogReport) String() string {
+	return fmt.Sprintf("checked=%d resolved=%d failed=%d", r.Checked, r.Resolved, r.Failed)
+}
+
+// ResolveBacklog looks up one batch of the pdf backlog, papers that get a PDF go through
+// store like any freshly fetched paper.
+func ResolveBacklog(ctx context.Context, dbPool *pgxpool.Pool, store *researchpaperapis.PaperStore, resolver *Resolver, cfg config.Resolver) (BacklogReport, error) {
+	var report BacklogReport
+
+	entries, err := db.PendingPDFBacklog(ctx, dbPool, store.ProjectID, cfg.BatchSize, cfg.RecheckAfter)
+	if err != nil {
+		return report, err
+	}
+
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		report.Checked++
+
+		// NOTE: a failed lookup counts as an attempt too, so a DOI the services choke on is given up eventually
+		loc, err := resolver.Resolve(ctx, *e.Paper.DOI)
+		if err != nil {
+			log.Printf("[OA] doi=%s: %v", *e.Paper.DOI, err)
+			report.Failed++
+		}
+
+		if loc == nil {
+			if err := db.MissPDFBacklog(ctx, dbPool, e.ID, cfg.MaxAttempts); err != nil {
+				return report, err
+			}
+			continue
+		}
+
+		paper := e.Paper
+		paper.PDFURL = loc.URL
+		paper.PDFCandidates = loc.Candidates
+		if paper.License == nil && loc.License != "" {
+			paper.License = &loc.License
+		}
+
+		if err := store.Save(ctx, paper); err != nil {
+			log.Printf("[OA] failed saving doi=%s: %v", *e.Paper.DOI, err)
+			report.Failed++
+			continue
+		}
+
+		if err := db.ResolvePDFBacklog(ctx, dbPool, e.ID, *loc); err != nil {
+			return report, err
+		}
+		log.Printf("[OA] doi=%s resolved by %s: %s", *e.Paper.DOI, loc.ResolvedBy, loc.URL)
+		report.Resolved++
+	}
+
+	return report, nil
+}
@@ -0,0 +1,176 @@
+package oa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/license"
+	"go_ingestion/internal/ratelimit"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	unpaywallURL = "https://api.unpaywall.org/v2/%s?email=%s"
+	doiURL       = "https://doi.org/%s"
+)
+
+// Resolver looks for an open access PDF of a DOI, Unpaywall first since it only reports
+// OA copies, then the repository copies CORE harvested, then the links the publisher
+// registered with doi.org.
+type Resolver struct {
+	// Email is required by Unpaywall, empty skips it
+	Email     string
+	Unpaywall ratelimit.Limiter
+	DOI       ratelimit.Limiter
+	// CoreKey is required by CORE, empty skips it
+	CoreKey string
+	Core    ratelimit.Limiter
+	Client  *http.Client
+}
+
+func NewResolver(email string, unpaywall, doi ratelimit.Limiter) *Resolver {
+	return &Resolver{Email: email, Unpaywall: unpaywall, DOI: doi, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Resolve returns the best OA location of doi, nil when neither service knows a PDF.
+func (r *Resolver) Resolve(ctx context.Context, doi string) (*db.OALocation, error) {
+	if r.Email != "" {
+		loc, err := r.unpaywall(ctx, doi)
+		if err != nil || loc != nil {
+			return loc, err
+		}
+	}
+	if r.CoreKey != "" {
+		loc, err := r.core(ctx, doi)
+		if err != nil || loc != nil {
+			return loc, err
+		}
+	}
+	return r.contentNegotiation(ctx, doi)
+}
+
+// UnpaywallOnly resolves with Unpaywall alone, one quick lookup that can run while a page
+// is saved, see PaperStore.ResolvePDF. The slower services are left to the backlog.
+type UnpaywallOnly struct {
+	*Resolver
+}
+
+func (u UnpaywallOnly) Resolve(ctx context.Context, doi string) (*db.OALocation, error) {
+	return u.unpaywall(ctx, doi)
+}
+
+type unpaywallLocation struct {
+	URLForPDF *string `json:"url_for_pdf"`
+	HostType  string  `json:"host_type"`
+	License   *string `json:"license"`
+}
+
+type unpaywallResponse struct {
+	IsOA           bool                `json:"is_oa"`
+	BestOALocation *unpaywallLocation  `json:"best_oa_location"`
+	OALocations    []unpaywallLocation `json:"oa_locations"`
+}
+
+func (r *Resolver) unpaywall(ctx context.Context, doi string) (*db.OALocation, error) {
+	var resp unpaywallResponse
+	found, err := r.getJSON(ctx, r.Unpaywall, fmt.Sprintf(unpaywallURL, url.PathEscape(doi), url.QueryEscape(r.Email)), "application/json", &resp)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	best := resp.BestOALocation
+	if !resp.IsOA || best == nil || best.URLForPDF == nil || *best.URLForPDF == "" {
+		return nil, nil
+	}
+
+	loc := &db.OALocation{URL: *best.URLForPDF, Host: best.HostType, ResolvedBy: "unpaywall"}
+	if best.License != nil {
+		loc.License = license.Normalize(*best.License)
+	}
+
+	// NOTE: host_type is publisher or repository, same as the candidate kinds
+	loc.Candidates = []db.PDFCandidate{db.NewPDFCandidate(loc.URL, best.HostType)}
+	for _, l := range resp.OALocations {
+		if l.URLForPDF != nil && *l.URLForPDF != "" {
+			loc.Candidates = append(loc.Candidates, db.NewPDFCandidate(*l.URLForPDF, l.HostType))
+		}
+	}
+	return loc, nil
+}
+
+func (r *Resolver) core(ctx context.Context, doi string) (*db.OALocation, error) {
+	if err := r.Core.Wait(ctx); err != nil {
+		return nil, err
+	}
+	w, found, err := researchpaperapis.FindCoreWork(ctx, r.Client, r.CoreKey, doi)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	candidates := researchpaperapis.CorePDFCandidates(w)
+	return &db.OALocation{URL: candidates[0].URL, Host: db.PDFRepository, ResolvedBy: "core", Candidates: candidates}, nil
+}
+
+type cslResponse struct {
+	Link []struct {
+		URL         string `json:"URL"`
+		ContentType string `json:"content-type"`
+	} `json:"link"`
+}
+
+// NOTE: publisher links aren't necessarily open access, the downloader still has to cope with paywalls
+func (r *Resolver) contentNegotiation(ctx context.Context, doi string) (*db.OALocation, error) {
+	var resp cslResponse
+	found, err := r.getJSON(ctx, r.DOI, fmt.Sprintf(doiURL, doi), "application/vnd.citationstyles.csl+json", &resp)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	var loc *db.OALocation
+	for _, l := range resp.Link {
+		if !strings.EqualFold(l.ContentType, "application/pdf") || l.URL == "" {
+			continue
+		}
+		if loc == nil {
+			loc = &db.OALocation{URL: l.URL, Host: db.PDFPublisher, ResolvedBy: "doi.org"}
+		}
+		loc.Candidates = append(loc.Candidates, db.NewPDFCandidate(l.URL, db.PDFPublisher))
+	}
+	return loc, nil
+}
+
+// getJSON decodes the response into v, a 404 is reported as not found rather than an error.
+func (r *Resolver) getJSON(ctx context.Context, limiter ratelimit.Limiter, u, accept string, v any) (bool, error) {
+	if err := limiter.Wait(ctx); err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", accept)
+
+	res, err := r.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s returned status %s", req.URL.Host, res.Status)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return false, fmt.Errorf("failed to decode %s response: %w", req.URL.Host, err)
+	}
+	return true, nil
+}
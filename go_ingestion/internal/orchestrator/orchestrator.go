@@ -0,0 +1,150 @@
+// Package orchestrator runs the processing stages after ingestion (download, extract,
+// chunk, embed) as worker pools in one process, each stage working off the papers the
+// stage before it left at its status.
+package orchestrator
+
+import (
+	"context"
+	"go_ingestion/db"
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Processor does the work of a stage for one paper.
+type Processor func(ctx context.Context, paperID uint64) error
+
+// Stage moves papers from status From to To.
+type Stage struct {
+	Name    string
+	From    db.PaperStatus
+	To      db.PaperStatus
+	Workers int
+	Process Processor
+}
+
+// Orchestrator polls the backlog of every stage and hands it to the stage's workers.
+//
+// NOTE: papers are only handed out once within the process, running a stage in two
+// processes at the same time can process a paper twice
+type Orchestrator struct {
+	DBPool       *pgxpool.Pool
+	ProjectID    uint64
+	Stages       []Stage
+	PollInterval time.Duration
+	BatchSize    int
+	// ShutdownGrace is how long papers in flight may finish once ctx is cancelled
+	ShutdownGrace time.Duration
+}
+
+// Run blocks until ctx is cancelled and the papers in flight finished or ran out of grace.
+func (o *Orchestrator) Run(ctx context.Context) {
+	// NOTE: papers in flight get their own context so a shutdown doesn't abort them right away
+	work, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	go func() {
+		<-ctx.Done()
+		select {
+		case <-time.After(o.ShutdownGrace):
+			log.Printf("[ORCHESTRATOR] shutdown grace of %s is over, aborting papers in flight", o.ShutdownGrace)
+			cancelWork()
+		case <-work.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, stage := range o.Stages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			o.runStage(ctx, work, stage)
+		}()
+	}
+
+	wg.Wait()
+	log.Printf("[ORCHESTRATOR] all stages stopped")
+}
+
+func (o *Orchestrator) runStage(ctx, work context.Context, stage Stage) {
+	log.Printf("[%s] %d workers moving %s papers to %s", stage.Name, stage.Workers, stage.From, stage.To)
+
+	ticker := time.NewTicker(o.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		backlog, err := db.PapersWithStatus(ctx, o.DBPool, o.ProjectID, stage.From, o.BatchSize)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[%s] %v", stage.Name, err)
+		}
+
+		// NOTE: a full batch that moved papers means there is probably more waiting, poll
+		// again right away. The whole batch finishes first so no paper is handed out twice.
+		if o.processBatch(ctx, work, stage, backlog) > 0 && len(backlog) == o.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processBatch runs backlog through the stage's workers and returns how many papers moved on,
+// no new paper is started once ctx is cancelled.
+func (o *Orchestrator) processBatch(ctx, work context.Context, stage Stage, backlog []uint64) int {
+	ids := make(chan uint64)
+	var (
+		wg    sync.WaitGroup
+		moved atomic.Int64
+	)
+	for range min(max(stage.Workers, 1), len(backlog)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				if o.process(work, stage, id) {
+					moved.Add(1)
+				}
+			}
+		}()
+	}
+
+	for _, id := range backlog {
+		if ctx.Err() != nil {
+			break
+		}
+		ids <- id
+	}
+	close(ids)
+	wg.Wait()
+	return int(moved.Load())
+}
+
+// process leaves a failed paper at its status, it is retried with a later batch.
+//
+// NOTE: a paper that keeps failing keeps its place in every batch, see status backlog
+func (o *Orchestrator) process(ctx context.Context, stage Stage, id uint64) (moved bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[%s] paper %d panicked: %v\n%s", stage.Name, id, r, debug.Stack())
+			moved = false
+		}
+	}()
+
+	if err := stage.Process(ctx, id); err != nil {
+		log.Printf("[%s] paper %d: %v", stage.Name, id, err)
+		return false
+	}
+
+	if _, err := db.AdvancePaperStatus(ctx, o.DBPool, o.ProjectID, id, stage.To); err != nil {
+		log.Printf("[%s] %v", stage.Name, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,313 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"go_ingestion/internal/pdfcheck"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PDFPath is where the PDF of a paper is downloaded to.
+func PDFPath(pdfDir string, paperID uint64) string {
+	return filepath.Join(pdfDir, strconv.FormatUint(paperID, 10)+".pdf")
+}
+
+// TextPath is where the extract command may write the text of a paper, see Extract.
+func TextPath(pdfDir string, paperID uint64) string {
+	return filepath.Join(pdfDir, strconv.FormatUint(paperID, 10)+".txt")
+}
+
+// Download fetches the pdf_url of a paper into pdfDir and records its page count.
+func Download(dbPool *pgxpool.Pool, projectID uint64, pdfDir string, check config.PDFCheck) Processor {
+	client := &http.Client{Timeout: 2 * time.Minute}
+
+	return func(ctx context.Context, paperID uint64) error {
+		pdfURL, err := db.PaperPDFURL(ctx, dbPool, projectID, paperID)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, pdfURL, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s returned status %s", req.URL.Host, res.Status)
+		}
+
+		if err := os.MkdirAll(pdfDir, 0755); err != nil {
+			return err
+		}
+
+		// NOTE: written next to the final name first, so a half downloaded file is never taken for a PDF
+		path := PDFPath(pdfDir, paperID)
+		tmp, err := os.CreateTemp(pdfDir, filepath.Base(path)+".*.part")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+
+		if _, err := io.Copy(tmp, res.Body); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to download %s: %w", pdfURL, err)
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			return err
+		}
+
+		pdf, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		pages := pdfcheck.CountPages(pdf)
+		return db.SavePDFPages(ctx, dbPool, paperID, pages, pdfcheck.Classify(pages, 0, check))
+	}
+}
+
+// Env returns extra environment variables for the command of a paper.
+type Env func(ctx context.Context, paperID uint64) ([]string, error)
+
+// Routed hands a command the LANGUAGE of the paper and the SPLITTER and EMBEDDING_MODEL
+// routes picks for it.
+func Routed(dbPool *pgxpool.Pool, projectID uint64, routes config.Routes) Env {
+	return func(ctx context.Context, paperID uint64) ([]string, error) {
+		lang, err := db.PaperLanguage(ctx, dbPool, projectID, paperID)
+		if err != nil {
+			return nil, err
+		}
+		route := routes.For(lang)
+		return []string{"LANGUAGE=" + lang, "SPLITTER=" + route.Splitter, "EMBEDDING_MODEL=" + route.Model}, nil
+	}
+}
+
+// Pending hands the embed command CHUNK_IDS, the comma separated chunks of the paper that
+// have no vector in namespace yet, so chunks kept across versions aren't embedded again,
+// and EMBEDDING_NAMESPACE, where the vectors go.
+func Pending(dbPool *pgxpool.Pool, namespace string) Env {
+	return func(ctx context.Context, paperID uint64) ([]string, error) {
+		ids, err := db.UnembeddedChunks(ctx, dbPool, paperID, namespace)
+		if err != nil {
+			return nil, err
+		}
+		return []string{"CHUNK_IDS=" + chunkList(ids), "EMBEDDING_NAMESPACE=" + namespace}, nil
+	}
+}
+
+func chunkList(ids []int64) string {
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(list, ",")
+}
+
+// Embed runs the embed command for the default namespace with env, then once per
+// registered namespace with its EMBEDDING_MODEL, for the chunks that namespace lacks.
+// A paper is embedded once every namespace has its vectors.
+func Embed(args []string, pdfDir string, env Env, dbPool *pgxpool.Pool) Processor {
+	embedDefault := Command(args, pdfDir, Envs(env, Pending(dbPool, db.DefaultNamespace)))
+	return func(ctx context.Context, paperID uint64) error {
+		if err := embedDefault(ctx, paperID); err != nil {
+			return err
+		}
+
+		namespaces, err := db.EmbeddingNamespaces(ctx, dbPool)
+		if err != nil {
+			return err
+		}
+		for _, ns := range namespaces {
+			ids, err := db.UnembeddedChunks(ctx, dbPool, paperID, ns.Name)
+			if err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				continue
+			}
+			// NOTE: the model of the namespace comes after env, the routed model is overridden
+			vars := []string{"CHUNK_IDS=" + chunkList(ids), "EMBEDDING_NAMESPACE=" + ns.Name, "EMBEDDING_MODEL=" + ns.Model}
+			process := Command(args, pdfDir, Envs(env, func(context.Context, uint64) ([]string, error) { return vars, nil }))
+			if err := process(ctx, paperID); err != nil {
+				return fmt.Errorf("namespace %s: %w", ns.Name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// PDFInfo hands a command PDF_PAGES, PDF_TEXT_LENGTH and PDF_KIND of the paper's PDF,
+// empty when they aren't known.
+func PDFInfo(dbPool *pgxpool.Pool) Env {
+	return func(ctx context.Context, paperID uint64) ([]string, error) {
+		stats, err := db.GetPDFStats(ctx, dbPool, paperID)
+		if err != nil {
+			return nil, err
+		}
+		vars := []string{"PDF_PAGES=", "PDF_TEXT_LENGTH=", "PDF_KIND=" + stats.Kind}
+		if stats.Pages > 0 {
+			vars[0] += strconv.Itoa(stats.Pages)
+		}
+		if stats.TextLength > 0 {
+			vars[1] += strconv.Itoa(stats.TextLength)
+		}
+		return vars, nil
+	}
+}
+
+// Envs combines envs, nil ones are skipped.
+func Envs(envs ...Env) Env {
+	return func(ctx context.Context, paperID uint64) ([]string, error) {
+		var vars []string
+		for _, env := range envs {
+			if env == nil {
+				continue
+			}
+			v, err := env(ctx, paperID)
+			if err != nil {
+				return nil, err
+			}
+			vars = append(vars, v...)
+		}
+		return vars, nil
+	}
+}
+
+// Command runs an external program per paper, with the paper id appended to args and
+// PAPER_ID, PDF_PATH, TEXT_PATH and whatever env returns (env may be nil) in its
+// environment. A non-zero exit fails the paper.
+func Command(args []string, pdfDir string, env Env) Processor {
+	return func(ctx context.Context, paperID uint64) error {
+		cmd, err := command(ctx, args, pdfDir, env, paperID)
+		if err != nil {
+			return err
+		}
+		cmd.Stdout = os.Stdout
+
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s failed: %w", args[0], err)
+		}
+		return nil
+	}
+}
+
+// Extract runs the extractor like Command, text it writes to TEXT_PATH is measured and
+// classifies the PDF again, see pdfcheck.Classify.
+func Extract(args []string, pdfDir string, env Env, dbPool *pgxpool.Pool, check config.PDFCheck) Processor {
+	run := Command(args, pdfDir, env)
+
+	return func(ctx context.Context, paperID uint64) error {
+		if err := run(ctx, paperID); err != nil {
+			return err
+		}
+
+		text, err := os.ReadFile(TextPath(pdfDir, paperID))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		stats, err := db.GetPDFStats(ctx, dbPool, paperID)
+		if err != nil {
+			return err
+		}
+		length := utf8.RuneCount(bytes.TrimSpace(text))
+		return db.SavePDFTextLength(ctx, dbPool, paperID, length, pdfcheck.Classify(stats.Pages, length, check))
+	}
+}
+
+// SkipKinds passes over papers whose PDF is of one of kinds, they move on without process
+// running for them.
+func SkipKinds(dbPool *pgxpool.Pool, stage string, kinds []string, process Processor) Processor {
+	if len(kinds) == 0 {
+		return process
+	}
+
+	return func(ctx context.Context, paperID uint64) error {
+		stats, err := db.GetPDFStats(ctx, dbPool, paperID)
+		if err != nil {
+			return err
+		}
+		if stats.Kind != "" && slices.Contains(kinds, stats.Kind) {
+			log.Printf("[%s] paper %d skipped, its pdf looks %s (pages=%d text=%d)", stage, paperID, stats.Kind, stats.Pages, stats.TextLength)
+			return nil
+		}
+		return process(ctx, paperID)
+	}
+}
+
+// Chunk runs the chunker like Command but reads the chunks from its stdout, one json
+// object {"index": 0, "content": "..."} per line, and stores them itself so chunks whose
+// content didn't change keep their id and vectors, see db.ReplaceChunks.
+func Chunk(args []string, pdfDir string, env Env, dbPool *pgxpool.Pool) Processor {
+	return func(ctx context.Context, paperID uint64) error {
+		cmd, err := command(ctx, args, pdfDir, env, paperID)
+		if err != nil {
+			return err
+		}
+		out, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("%s failed: %w", args[0], err)
+		}
+
+		var chunks []db.Chunk
+		dec := json.NewDecoder(bytes.NewReader(out))
+		for dec.More() {
+			var c db.Chunk
+			if err := dec.Decode(&c); err != nil {
+				return fmt.Errorf("invalid chunk from %s: %w", args[0], err)
+			}
+			chunks = append(chunks, c)
+		}
+
+		diff, err := db.ReplaceChunks(ctx, dbPool, paperID, chunks)
+		if err != nil {
+			return err
+		}
+		log.Printf("[CHUNK] paper %d kept=%d added=%d removed=%d", paperID, diff.Kept, diff.Added, diff.Removed)
+		return nil
+	}
+}
+
+func command(ctx context.Context, args []string, pdfDir string, env Env, paperID uint64) (*exec.Cmd, error) {
+	id := strconv.FormatUint(paperID, 10)
+
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], id)...)
+	cmd.Env = append(os.Environ(), "PAPER_ID="+id, "PDF_PATH="+PDFPath(pdfDir, paperID), "TEXT_PATH="+TextPath(pdfDir, paperID))
+	if env != nil {
+		vars, err := env(ctx, paperID)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Env = append(cmd.Env, vars...)
+	}
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
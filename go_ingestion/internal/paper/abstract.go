@@ -0,0 +1,50 @@
+package paper
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	// headings of structured abstracts, html or JATS (<jats:title>), the text is kept as a label
+	abstractHeading = regexp.MustCompile(`(?is)<(?:[\w-]+:)?(?:h[1-6]|title)\b[^>]*>(.*?)</(?:[\w-]+:)?(?:h[1-6]|title)\s*>`)
+	// tags that end a paragraph
+	abstractBlockTag = regexp.MustCompile(`(?i)</?(?:[\w-]+:)?(?:p|div|sec|section|abstract|br|li|list)\b[^>]*>`)
+	// NOTE: a tag has to start with a letter so "p <0.05" survives
+	abstractTag       = regexp.MustCompile(`</?[a-zA-Z][\w:.-]*(?:\s[^<>]*)?/?>`)
+	abstractParagraph = regexp.MustCompile(`\n\s*\n`)
+	abstractLabel     = regexp.MustCompile(`(?i)^abstract\b[\s:.\-–—]*`)
+	// labelEnd marks where a heading label ends, the paragraph after it joins the label
+	labelEnd = regexp.MustCompile(`\x00\s*`)
+)
+
+// CleanAbstract turns an abstract with html or JATS markup into plain text: tags are
+// stripped, entities decoded, whitespace collapsed within paragraphs and paragraphs
+// separated by a blank line. A leading "Abstract" heading is dropped, other headings of a
+// structured abstract become "Heading: " labels.
+func CleanAbstract(s string) string {
+	if s = strings.TrimSpace(s); s == "" {
+		return ""
+	}
+
+	s = abstractHeading.ReplaceAllStringFunc(s, func(heading string) string {
+		text := strings.TrimSpace(abstractTag.ReplaceAllString(abstractHeading.FindStringSubmatch(heading)[1], ""))
+		if text == "" || strings.EqualFold(text, "abstract") {
+			return "\n\n"
+		}
+		return "\n\n" + strings.TrimRight(text, ":") + ":\x00"
+	})
+	s = abstractBlockTag.ReplaceAllString(s, "\n\n")
+	s = labelEnd.ReplaceAllString(s, " ")
+	s = abstractTag.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	var paragraphs []string
+	for _, p := range abstractParagraph.Split(s, -1) {
+		if p = strings.Join(strings.Fields(p), " "); p != "" {
+			paragraphs = append(paragraphs, p)
+		}
+	}
+	return abstractLabel.ReplaceAllString(strings.Join(paragraphs, "\n\n"), "")
+}
@@ -0,0 +1,104 @@
+package paper
+
+import (
+	"go_ingestion/db"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	SchemeArxiv    = "arxiv"
+	SchemePMID     = "pmid"
+	SchemePMCID    = "pmcid"
+	SchemeMAG      = "mag"
+	SchemeACL      = "acl"
+	SchemeDBLP     = "dblp"
+	SchemeCorpusID = "corpusid"
+	// SchemeOpenAlex is the openalex work id, W followed by digits
+	SchemeOpenAlex = "openalex"
+	// SchemeS2 is the semantic scholar paperId
+	SchemeS2 = "s2"
+	// SchemeCore is the core work id, a number
+	SchemeCore = "core"
+)
+
+// schemeAliases maps the names sources use, lowercased, to our schemes
+var schemeAliases = map[string]string{
+	"arxiv":         SchemeArxiv,
+	"pubmed":        SchemePMID,
+	"pmid":          SchemePMID,
+	"pubmedcentral": SchemePMCID,
+	"pmcid":         SchemePMCID,
+	"pmc":           SchemePMCID,
+	"mag":           SchemeMAG,
+	"acl":           SchemeACL,
+	"dblp":          SchemeDBLP,
+	"corpusid":      SchemeCorpusID,
+	"openalex":      SchemeOpenAlex,
+	"s2":            SchemeS2,
+	"core":          SchemeCore,
+}
+
+var arxivVersion = regexp.MustCompile(`v\d+$`)
+
+// Scheme returns our name for a source's identifier scheme, false for schemes that
+// aren't kept (DOIs have their own column).
+func Scheme(name string) (string, bool) {
+	scheme, ok := schemeAliases[strings.ToLower(strings.TrimSpace(name))]
+	return scheme, ok
+}
+
+// NormalizeIdentifier brings value into the form lookups use: arxiv ids without their
+// url and version, PMC ids with their PMC prefix, everything else trimmed.
+func NormalizeIdentifier(scheme, value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+
+	switch scheme {
+	case SchemeArxiv:
+		value = strings.TrimPrefix(value, "arXiv:")
+		if i := strings.LastIndex(value, "/abs/"); i >= 0 {
+			value = value[i+len("/abs/"):]
+		}
+		return arxivVersion.ReplaceAllString(value, "")
+	case SchemePMCID:
+		return "PMC" + strings.TrimPrefix(strings.ToUpper(value), "PMC")
+	default:
+		return value
+	}
+}
+
+// SplitVersion splits an arxiv id or abs url into the id without version and the version,
+// 0 when it has none.
+func SplitVersion(id string) (string, int) {
+	loc := arxivVersion.FindStringIndex(id)
+	if loc == nil {
+		return id, 0
+	}
+	version, _ := strconv.Atoi(id[loc[0]+1:])
+	return id[:loc[0]], version
+}
+
+// NormalizeIdentifiers maps source scheme names and values to stored identifiers, sorted
+// by scheme. Unknown schemes and empty values are dropped.
+func NormalizeIdentifiers(ids map[string]string) []db.Identifier {
+	var identifiers []db.Identifier
+	for name, value := range ids {
+		scheme, ok := Scheme(name)
+		if !ok {
+			continue
+		}
+		if value = NormalizeIdentifier(scheme, value); value != "" {
+			identifiers = append(identifiers, db.Identifier{Scheme: scheme, Value: value})
+		}
+	}
+
+	slices.SortFunc(identifiers, func(a, b db.Identifier) int {
+		return strings.Compare(a.Scheme+":"+a.Value, b.Scheme+":"+b.Value)
+	})
+	return identifiers
+}
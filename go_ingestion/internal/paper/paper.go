@@ -0,0 +1,242 @@
+package paper
+
+import (
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/filter"
+	"go_ingestion/internal/language"
+	"go_ingestion/internal/subject"
+	"strings"
+	"time"
+)
+
+// Paper is what a source mapper produces, independent of how research_papers stores it.
+// Empty strings and zero times mean the source didn't report the field.
+type Paper struct {
+	Source    db.PaperSource
+	SourceID  string
+	Title     string
+	PDFURL    string
+	DOI       string
+	Authors   []Author
+	Published time.Time
+	// Query is the search the paper was ingested under, stored as its topic
+	Query string
+	// Topics are the subjects the source files the paper under (arxiv categories, fields of study)
+	Topics []string
+	// Categories are the source's own classification, primary first, see NormalizeCategories
+	Categories []db.Category
+	// Subjects are the disciplines of the paper, normalized into the subjects taxonomy
+	Subjects []string
+	// Abstract may carry html or JATS markup, Row stores it cleaned, see CleanAbstract
+	Abstract string
+	// TLDR is a one sentence machine summary
+	TLDR    string
+	Venue   string
+	License string
+	// Keywords are the author keywords, Conference the event of a proceedings paper
+	Keywords   []string
+	Conference string
+	// Embargoed papers aren't open access yet, they wait in the pdf backlog instead
+	Embargoed bool
+	// PDFCandidates are all the PDFs the source links, the store may prefer another one than PDFURL
+	PDFCandidates []db.PDFCandidate
+	// Identifiers are the ids the paper has in other schemes, keyed by scheme, see NormalizeIdentifiers
+	Identifiers map[string]string
+	// Attributes are only used by the filter rules, Year falls back to Published
+	Attributes filter.Attributes
+	// Raw is the upstream payload, stored as metadata
+	Raw any
+}
+
+type Author struct {
+	Name string
+}
+
+// Encoder marshals authors and the raw payload, pagers pass one that reuses buffers
+// across pages so the returned bytes are only valid until the next call.
+type Encoder func(authors, raw any) (*[]byte, *[]byte, error)
+
+func JSONEncoder(authors, raw any) (*[]byte, *[]byte, error) {
+	authorsJSON, err := json.Marshal(authors)
+	if err != nil {
+		return nil, nil, err
+	}
+	rawJSON, err := json.Marshal(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &authorsJSON, &rawJSON, nil
+}
+
+// Row maps p onto a research_papers row, authors are stored as a JSON array of names.
+func (p Paper) Row(encode Encoder) (db.ResearchPaper, error) {
+	names := make([]string, 0, len(p.Authors))
+	for _, a := range p.Authors {
+		names = append(names, a.Name)
+	}
+
+	authorsJSON, metadataJSON, err := encode(names, p.Raw)
+	if err != nil {
+		return db.ResearchPaper{}, fmt.Errorf("failed to marshal %s authors/metadata: %w", p.Source, err)
+	}
+
+	attrs := p.Attributes
+	if attrs.Year == 0 && !p.Published.IsZero() {
+		attrs.Year = p.Published.Year()
+	}
+	if len(attrs.Categories) == 0 {
+		for _, c := range p.Categories {
+			attrs.Categories = append(attrs.Categories, c.Term)
+		}
+	}
+
+	// NOTE: what the source reports wins over guessing from the text
+	abstract := CleanAbstract(p.Abstract)
+	lang := language.Normalize(attrs.Language)
+	if lang == "" {
+		lang = language.Detect(p.Title + "\n" + abstract)
+	}
+
+	var publishedOn *time.Time
+	if !p.Published.IsZero() {
+		publishedOn = &p.Published
+	}
+
+	var categoriesJSON *[]byte
+	if len(p.Categories) > 0 {
+		b, err := json.Marshal(p.Categories)
+		if err != nil {
+			return db.ResearchPaper{}, fmt.Errorf("failed to marshal %s categories: %w", p.Source, err)
+		}
+		categoriesJSON = &b
+	}
+
+	return db.ResearchPaper{
+		Source:      p.Source,
+		SourceID:    optional(p.SourceID),
+		Title:       p.Title,
+		PDFURL:      p.PDFURL,
+		DOI:         optional(p.DOI),
+		Authors:     authorsJSON,
+		Metadata:    metadataJSON,
+		Topic:       p.Query,
+		License:     optional(p.License),
+		TLDR:        optional(p.TLDR),
+		Categories:  categoriesJSON,
+		Keywords:    p.Keywords,
+		Conference:  optional(p.Conference),
+		Abstract:    optional(abstract),
+		Language:    optional(lang),
+		PublishedOn: publishedOn,
+		Attributes:  attrs,
+		Search:      db.SearchFields{Venue: p.Venue, Tags: p.Topics},
+		Embargoed:   p.Embargoed,
+		// NOTE: the store ranks them and picks PDFURL, see mirror.Rank
+		PDFCandidates: p.PDFCandidates,
+		Subjects:      subject.Normalize(p.Subjects),
+		Identifiers:   NormalizeIdentifiers(p.Identifiers),
+	}, nil
+}
+
+// FromRow is the reverse of Row, Raw is left as the stored JSON.
+func FromRow(row db.ResearchPaper) (Paper, error) {
+	p := Paper{
+		Source:     row.Source,
+		SourceID:   value(row.SourceID),
+		Title:      row.Title,
+		PDFURL:     row.PDFURL,
+		DOI:        value(row.DOI),
+		Query:      row.Topic,
+		Topics:     row.Search.Tags,
+		Abstract:   value(row.Abstract),
+		Venue:      row.Search.Venue,
+		License:    value(row.License),
+		TLDR:       value(row.TLDR),
+		Keywords:   row.Keywords,
+		Conference: value(row.Conference),
+		Embargoed:  row.Embargoed,
+		Attributes: row.Attributes,
+	}
+	if row.PublishedOn != nil {
+		p.Published = *row.PublishedOn
+	}
+	p.PDFCandidates = row.PDFCandidates
+	for _, id := range row.Identifiers {
+		if p.Identifiers == nil {
+			p.Identifiers = map[string]string{}
+		}
+		p.Identifiers[id.Scheme] = id.Value
+	}
+	for _, s := range row.Subjects {
+		p.Subjects = append(p.Subjects, s.Label)
+	}
+
+	if row.Authors != nil {
+		var names []string
+		if err := json.Unmarshal(*row.Authors, &names); err != nil {
+			return p, fmt.Errorf("failed to decode authors: %w", err)
+		}
+		for _, name := range names {
+			p.Authors = append(p.Authors, Author{Name: name})
+		}
+	}
+
+	if row.Categories != nil {
+		if err := json.Unmarshal(*row.Categories, &p.Categories); err != nil {
+			return p, fmt.Errorf("failed to decode categories: %w", err)
+		}
+	}
+
+	if row.Metadata != nil {
+		p.Raw = json.RawMessage(*row.Metadata)
+	}
+	return p, nil
+}
+
+// NormalizeCategories trims and dedupes terms, primary goes first and is flagged even when
+// the source didn't repeat it among terms.
+func NormalizeCategories(primary string, terms []string) []db.Category {
+	var categories []db.Category
+	seen := make(map[string]bool, len(terms)+1)
+	add := func(term string, isPrimary bool) {
+		term = strings.TrimSpace(term)
+		if term == "" || seen[strings.ToLower(term)] {
+			return
+		}
+		seen[strings.ToLower(term)] = true
+		categories = append(categories, db.Category{Term: term, Primary: isPrimary})
+	}
+
+	add(primary, true)
+	for _, term := range terms {
+		add(term, false)
+	}
+	return categories
+}
+
+// ParseDate reads the date formats sources use, the zero time when none matches.
+func ParseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339, time.DateOnly, "2006-01", "2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func optional(s string) *string {
+	if s = strings.TrimSpace(s); s == "" {
+		return nil
+	}
+	return &s
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
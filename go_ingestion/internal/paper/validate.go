@@ -0,0 +1,51 @@
+package paper
+
+import (
+	"fmt"
+	"go_ingestion/config"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Invalid returns why p is too broken to store, nothing when it passes rules. thisYear
+// bounds the publication year, a paper may be dated next year at most.
+func (p Paper) Invalid(rules config.ValidationRules, thisYear int) []string {
+	var reasons []string
+
+	title := strings.TrimSpace(p.Title)
+	n := utf8.RuneCountInString(title)
+	if rules.MinTitleLength > 0 && n < rules.MinTitleLength {
+		reasons = append(reasons, fmt.Sprintf("title of %d characters < %d", n, rules.MinTitleLength))
+	}
+	if rules.MaxTitleLength > 0 && n > rules.MaxTitleLength {
+		reasons = append(reasons, fmt.Sprintf("title of %d characters > %d", n, rules.MaxTitleLength))
+	}
+	if title != "" && !strings.ContainsFunc(title, unicode.IsLetter) {
+		reasons = append(reasons, fmt.Sprintf("title %q has no letters", title))
+	}
+
+	if !p.Published.IsZero() {
+		year := p.Published.Year()
+		if (rules.MinYear > 0 && year < rules.MinYear) || year > thisYear+1 {
+			reasons = append(reasons, fmt.Sprintf("year %d not in %d-%d", year, rules.MinYear, thisYear+1))
+		}
+	}
+
+	if len(rules.URLSchemes) > 0 && strings.TrimSpace(p.PDFURL) != "" {
+		u, err := url.Parse(strings.TrimSpace(p.PDFURL))
+		if err != nil || u.Host == "" || !slices.Contains(rules.URLSchemes, strings.ToLower(u.Scheme)) {
+			reasons = append(reasons, fmt.Sprintf("pdf_url %q is not a %s url", p.PDFURL, strings.Join(rules.URLSchemes, "/")))
+		}
+	}
+
+	if rules.MaxAuthors > 0 && len(p.Authors) > rules.MaxAuthors {
+		reasons = append(reasons, fmt.Sprintf("%d authors > %d", len(p.Authors), rules.MaxAuthors))
+	}
+	if i := slices.IndexFunc(p.Authors, func(a Author) bool { return strings.TrimSpace(a.Name) == "" }); i >= 0 {
+		reasons = append(reasons, fmt.Sprintf("author %d has no name", i+1))
+	}
+	return reasons
+}
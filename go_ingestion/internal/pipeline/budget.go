@@ -0,0 +1,43 @@
+package pipeline
+
+import (
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"sync/atomic"
+)
+
+// Budget caps a whole run across all sources, a zero cap is unlimited. Papers are
+// checked before each page so a run can overshoot MaxPapers by one page per source.
+type Budget struct {
+	MaxPapers uint64
+	MaxPages  uint64
+
+	store *researchpaperapis.PaperStore
+	pages atomic.Uint64
+}
+
+func NewBudget(store *researchpaperapis.PaperStore, maxPapers, maxPages uint64) *Budget {
+	return &Budget{MaxPapers: maxPapers, MaxPages: maxPages, store: store}
+}
+
+// TakePage reserves the next page, false means the run is over budget. A nil budget never runs out.
+func (b *Budget) TakePage() bool {
+	if b.Exhausted() {
+		return false
+	}
+
+	if b != nil && b.MaxPages > 0 && b.pages.Add(1) > b.MaxPages {
+		return false
+	}
+	return true
+}
+
+func (b *Budget) Exhausted() bool {
+	if b == nil {
+		return false
+	}
+
+	if b.MaxPapers > 0 && b.store.Inserted() >= b.MaxPapers {
+		return true
+	}
+	return b.MaxPages > 0 && b.pages.Load() >= b.MaxPages
+}
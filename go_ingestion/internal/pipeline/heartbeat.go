@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"context"
+	"go_ingestion/db"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Heartbeat records in run_sources that a worker is alive and where its pager is, so runs
+// that stopped making progress (a wedged request, a source that stays down) can be told
+// apart from slow ones. A nil Heartbeat records nothing.
+type Heartbeat struct {
+	DBPool *pgxpool.Pool
+	RunID  uint64
+}
+
+func (h *Heartbeat) beat(ctx context.Context, source db.PaperSource, pager researchpaperapis.Pager, progressed bool) {
+	if h == nil {
+		return
+	}
+
+	var offset *uint64
+	if p, ok := pager.(*researchpaperapis.OffsetPager); ok {
+		offset = &p.Offset
+	}
+	if err := db.Heartbeat(ctx, h.DBPool, h.RunID, source, offset, progressed); err != nil && ctx.Err() == nil {
+		log.Printf("[HEARTBEAT] %v", err)
+	}
+}
+
+// stop uses a fresh context, workers mostly return because theirs is cancelled.
+func (h *Heartbeat) stop(source db.PaperSource) {
+	if h == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.StopHeartbeat(ctx, h.DBPool, h.RunID, source); err != nil {
+		log.Printf("[HEARTBEAT] %v", err)
+	}
+}
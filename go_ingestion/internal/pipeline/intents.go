@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"context"
+	"go_ingestion/db"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Intents records every page before it is fetched and completes the record once the page
+// is saved, so pages in flight when the process died are left behind as started and can be
+// re-driven on the next start. A nil Intents records nothing.
+//
+// NOTE: re-driving a page that was partly saved is safe, stored papers are matched by
+// source id and only rewritten when their content changed
+type Intents struct {
+	DBPool    *pgxpool.Pool
+	ProjectID uint64
+	RunID     uint64
+	Query     string
+	Window    *researchpaperapis.DateWindow
+	// Checkpoint also advances ingest_checkpoints past every finished page
+	Checkpoint bool
+}
+
+// begin returns 0 when nothing was recorded, only offset pagers can be re-driven.
+func (i *Intents) begin(ctx context.Context, source db.PaperSource, pager researchpaperapis.Pager) uint64 {
+	p, ok := pager.(*researchpaperapis.OffsetPager)
+	if i == nil || !ok {
+		return 0
+	}
+
+	intent := db.PageIntent{RunID: &i.RunID, Source: source, Query: i.Query, Offset: p.Offset, Limit: p.Limit}
+	if i.Window != nil {
+		intent.WindowFrom, intent.WindowTo = &i.Window.From, &i.Window.To
+	}
+
+	id, err := db.BeginPageIntent(ctx, i.DBPool, i.ProjectID, intent)
+	if err != nil {
+		log.Printf("[INTENT] %v", err)
+		return 0
+	}
+	return id
+}
+
+// advance moves the checkpoint of source to where pager continues, call it once a page is
+// saved or skipped.
+func (i *Intents) advance(ctx context.Context, source db.PaperSource, pager researchpaperapis.Pager) {
+	p, ok := pager.(*researchpaperapis.OffsetPager)
+	if i == nil || !i.Checkpoint || !ok {
+		return
+	}
+
+	if err := db.AdvanceCheckpoint(ctx, i.DBPool, i.ProjectID, source, i.Query, p.Offset); err != nil {
+		log.Printf("[CHECKPOINT] %v", err)
+	}
+}
+
+// interrupt flushes the checkpoint of source when the run stops on shutdown, so the next
+// run resumes at the page of id even when the run saved no page before, and marks that
+// page interrupted. Without a checkpoint the page is left for the next run to re-drive.
+func (i *Intents) interrupt(ctx context.Context, source db.PaperSource, id uint64, pager researchpaperapis.Pager) {
+	p, ok := pager.(*researchpaperapis.OffsetPager)
+	if i == nil || !i.Checkpoint || !ok {
+		return
+	}
+
+	i.finish(ctx, id, db.IntentInterrupted)
+	if err := db.AdvanceCheckpoint(ctx, i.DBPool, i.ProjectID, source, i.Query, p.Offset); err != nil {
+		log.Printf("[CHECKPOINT] %v", err)
+		return
+	}
+	log.Printf("[CHECKPOINT] %s %q saved at offset=%d", source, i.Query, p.Offset)
+}
+
+func (i *Intents) finish(ctx context.Context, id uint64, status string) {
+	if i == nil || id == 0 {
+		return
+	}
+
+	if err := db.FinishPageIntent(ctx, i.DBPool, id, status); err != nil {
+		log.Printf("[INTENT] %v", err)
+	}
+}
@@ -2,180 +2,140 @@ package pipeline
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"go_ingestion/internal/ratelimit"
 	researchpaperapis "go_ingestion/internal/research_paper_apis"
 	"log"
-	"strconv"
-	"sync"
-	"time"
-
-	"github.com/jackc/pgx/v5/pgxpool"
+	"strings"
 )
 
-const maxRetries = 3
-const initialTimeSkip uint16 = 45
-
-func GetTotalPapers(ctx context.Context, query, semanticScholarApiKey, springerNatureApiKey string, limit, offset uint64) (uint64, uint64, uint64) {
-	var (
-		totalArxivPapers           uint64
-		totalSemanticScholarPapers uint64
-		totalSpringerNaturePapers  uint64
-	)
-
-	var wg sync.WaitGroup
-
-	wg.Add(3)
-	errChan := make(chan error, 3)
-
-	go func() {
-		// fmt.Println("start ARXIV")
-		defer wg.Done()
-		arxivRes, err := researchpaperapis.MakeArivAPICALL(ctx, query, offset, limit)
-		if err != nil {
-			errChan <- fmt.Errorf("[ARXIV] %w", err)
-			return
-		}
-		totalArxivPapers = arxivRes.TotalResults
-		// fmt.Println("end ARXIV")
-	}()
-
-	go func() {
-		// fmt.Println("start SEMANTIC")
-
-		defer wg.Done()
-		semanticScholarRes, err := researchpaperapis.MakeSemanticScholarAPICALL(ctx, semanticScholarApiKey, query, limit, offset)
-		if err != nil {
-			errChan <- fmt.Errorf("[SEMANTIC SCHOLAR] %w", err)
-			return
-		}
-		totalSemanticScholarPapers = semanticScholarRes.Total
-
-		// fmt.Println("end SEMANTIC")
-	}()
-
-	go func() {
-		// fmt.Println("start SPRINGER")
-		defer wg.Done()
-
-		springerNatureRes, err := researchpaperapis.MakeSpringerNatureAPICALL(ctx, springerNatureApiKey, query, limit, offset)
-		if err != nil {
-			errChan <- fmt.Errorf("[SPRINGER] %w", err)
-			return
-		}
-
-		if len(springerNatureRes.Result) == 0 {
-			errChan <- fmt.Errorf("[SPRINGER] empty result metadata")
-			return
-		}
+// ErrPagesSkipped is returned by Run when pages kept failing and were skipped, a later
+// run of the same query doesn't fetch them again.
+var ErrPagesSkipped = errors.New("pages were skipped")
+
+// Run saves every page of pager into store, retrying each page per policy. A page that
+// keeps failing is skipped when the pager can skip it, otherwise the worker stops.
+// intents and heartbeat may be nil.
+//
+// The error says why the worker stopped before the last page: the context, the limiter
+// (e.g. ratelimit.ErrQuotaExhausted), a rejected api key or a page it couldn't skip. A
+// worker that got to the end or used up budget but skipped pages returns ErrPagesSkipped.
+func Run(ctx context.Context, source db.PaperSource, store *researchpaperapis.PaperStore, pager researchpaperapis.Pager, limiter ratelimit.Limiter, budget *Budget, policy config.RetryPolicy, intents *Intents, heartbeat *Heartbeat) error {
+	tag := LogTag(source)
+	// NOTE: every page gets at least one attempt
+	attempts := max(policy.MaxRetries, 1)
+
+	heartbeat.beat(ctx, source, pager, false)
+	defer heartbeat.stop(source)
+
+	// NOTE: a page already fetched when the run is stopped is still saved and checkpointed,
+	// stopping only keeps the worker from fetching the next one
+	saveCtx := context.WithoutCancel(ctx)
+	interrupted := func(intent uint64) error {
+		log.Printf("[%s] stopping worker at %s: %v", tag, position(pager), ctx.Err())
+		intents.interrupt(saveCtx, source, intent, pager)
+		return ctx.Err()
+	}
 
-		totalSpringerNaturePapers, err = strconv.ParseUint(springerNatureRes.Result[0].Total, 10, 64)
-		if err != nil {
-			errChan <- fmt.Errorf("[SPRINGER] parse error: %w", err)
-			return
+	skipped := 0
+	finished := func() error {
+		if skipped > 0 {
+			return fmt.Errorf("%w: %d", ErrPagesSkipped, skipped)
 		}
-
-		// fmt.Println("end SPRINGER")
-	}()
-
-	wg.Wait()
-	close(errChan)
-
-	for err := range errChan {
-		log.Fatal(err)
+		return nil
 	}
 
-	return totalArxivPapers, totalSemanticScholarPapers, totalSpringerNaturePapers
-}
-
-func exponentialBackoff(currAttempt uint16, initialTimeSkip uint16) uint16 {
-	return initialTimeSkip * (1 << (currAttempt - 1))
-}
-
-func StartArxivProcess(ctx context.Context, dbPool *pgxpool.Pool, query string, processedArxivPapers, totalArxivPapers, limit uint64) {
-	for processedArxivPapers < totalArxivPapers {
+	for {
 		select {
 		case <-ctx.Done():
-			log.Println("[ARXIV] context cancelled, stopping worker")
-			return
+			return interrupted(0)
 		default:
 		}
 
-		var err error
-		for attempt := 1; attempt <= maxRetries; attempt++ {
-			err = researchpaperapis.InsertArxivEntryToDB(ctx, dbPool, query, processedArxivPapers, limit)
-
-			timeToSleep := exponentialBackoff(uint16(attempt), initialTimeSkip)
-			time.Sleep(time.Duration(timeToSleep) * time.Second)
-			if err == nil {
-				break
-			}
-
-			log.Printf("[ARXIV] error at offset=%d attempt=%d/%d: %v", processedArxivPapers, attempt, maxRetries, err)
-		}
-
-		if err != nil {
-			log.Printf("[ARXIV] skipping offset=%d after %d failures", processedArxivPapers, maxRetries)
+		if !budget.TakePage() {
+			log.Printf("[%s] run budget exhausted, stopping worker at %s", tag, position(pager))
+			return finished()
 		}
 
-		processedArxivPapers += limit
-	}
-}
-
-func StartSemanticProcess(ctx context.Context, dbPool *pgxpool.Pool, semanticScholarApiKey, query string, processedSemanticPapers, totalSemanticScholarPapers, limit uint64) {
-	for processedSemanticPapers < totalSemanticScholarPapers {
-		select {
-		case <-ctx.Done():
-			log.Println("[SEMANTIC] context cancelled, stopping worker")
-			return
-		default:
-		}
+		var (
+			done bool
+			err  error
+		)
+		intent := intents.begin(ctx, source, pager)
+		for attempt := 1; attempt <= attempts; attempt++ {
+			if err = limiter.Wait(ctx); err != nil {
+				if ctx.Err() != nil {
+					return interrupted(intent)
+				}
+				log.Printf("[%s] stopping worker at %s: %v", tag, position(pager), err)
+				return err
+			}
 
-		var err error
-		for attempt := 1; attempt <= maxRetries; attempt++ {
-			err = researchpaperapis.InsertSemanticPaperIntoDB(ctx, dbPool, semanticScholarApiKey, query, limit, processedSemanticPapers)
+			var page []db.ResearchPaper
+			if page, done, err = pager.NextPage(ctx); err == nil {
+				store.SavePage(saveCtx, source, page)
+				intents.finish(saveCtx, intent, db.IntentDone)
+				intents.advance(saveCtx, source, pager)
+				heartbeat.beat(saveCtx, source, pager, true)
+				break
+			}
+			log.Printf("[%s] error at %s attempt=%d/%d: %v", tag, position(pager), attempt, attempts, err)
+			heartbeat.beat(ctx, source, pager, false)
 
-			timeToSleep := exponentialBackoff(uint16(attempt), initialTimeSkip)
-			time.Sleep(time.Duration(timeToSleep) * time.Second)
-			if err == nil {
+			if !retryable(policy, err) || attempt == attempts {
 				break
 			}
 
-			log.Printf("[SEMANTIC] error at offset=%d attempt=%d/%d: %v", processedSemanticPapers, attempt, maxRetries, err)
+			if sleepErr := sleep(ctx, backoff(policy, attempt, err)); sleepErr != nil {
+				return interrupted(intent)
+			}
 		}
 
-		if err != nil {
-			log.Printf("[SEMANTIC] skipping offset=%d after %d failures", processedSemanticPapers, maxRetries)
+		// NOTE: a page that failed because the run is stopping isn't skipped, the next run fetches it
+		if err != nil && ctx.Err() != nil {
+			return interrupted(intent)
 		}
-
-		processedSemanticPapers += limit
-	}
-}
-
-func StartSpringerProcess(ctx context.Context, dbPool *pgxpool.Pool, springerNatureApiKey, query string, processedSpringerNaturePapers, totalSpringerNaturePapers, limit uint64) {
-	for processedSpringerNaturePapers < totalSpringerNaturePapers {
-		select {
-		case <-ctx.Done():
-			log.Println("[SPRINGER] context cancelled, stopping worker")
-			return
-		default:
+		// NOTE: every other page would be rejected the same, the next run resumes here once
+		// the key is fixed
+		if errors.Is(err, researchpaperapis.ErrAuth) {
+			log.Printf("[%s] stopping worker at %s, check the api key: %v", tag, position(pager), err)
+			return err
 		}
-
-		var err error
-		for attempt := 1; attempt <= maxRetries; attempt++ {
-			err = researchpaperapis.InsertSpringerPaperIntoDB(ctx, dbPool, springerNatureApiKey, query, limit, processedSpringerNaturePapers)
-
-			time.Sleep(time.Duration(initialTimeSkip) * time.Second)
-			if err == nil {
-				break
+		if err != nil {
+			skipper, ok := pager.(researchpaperapis.PageSkipper)
+			if !ok {
+				log.Printf("[%s] stopping worker, can't skip past %s: %v", tag, position(pager), err)
+				return fmt.Errorf("stopped at %s: %w", position(pager), err)
 			}
-
-			log.Printf("[SPRINGER] error at offset=%d attempt=%d/%d: %v", processedSpringerNaturePapers, attempt, maxRetries, err)
+			log.Printf("[%s] skipping %s: %v", tag, position(pager), err)
+			intents.finish(ctx, intent, db.IntentSkipped)
+			skipper.SkipPage()
+			skipped++
+			intents.advance(ctx, source, pager)
+			heartbeat.beat(ctx, source, pager, true)
+			continue
 		}
 
-		if err != nil {
-			log.Printf("[SPRINGER] skipping offset=%d after %d failures", processedSpringerNaturePapers, maxRetries)
+		if done {
+			return finished()
 		}
+	}
+}
+
+// LogTag is the prefix workers of source log with.
+func LogTag(source db.PaperSource) string {
+	if p, err := researchpaperapis.Lookup(source); err == nil && p.Info().Tag != "" {
+		return p.Info().Tag
+	}
+	return strings.ToUpper(string(source))
+}
 
-		processedSpringerNaturePapers += limit
+func position(pager researchpaperapis.Pager) string {
+	if p, ok := pager.(researchpaperapis.Positioner); ok {
+		return p.Position()
 	}
+	return "unknown position"
 }
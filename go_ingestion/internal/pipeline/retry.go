@@ -0,0 +1,61 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"go_ingestion/config"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// retryable reports whether policy allows another attempt after err. Network failures and
+// timeouts are always retried, a rejected api key, a missing resource or a response that
+// doesn't decode never is.
+func retryable(policy config.RetryPolicy, err error) bool {
+	if errors.Is(err, researchpaperapis.ErrAuth) || errors.Is(err, researchpaperapis.ErrNotFound) {
+		return false
+	}
+	if status := researchpaperapis.StatusCode(err); status != 0 {
+		return slices.Contains(policy.RetryableStatuses, status)
+	}
+	return errors.Is(err, researchpaperapis.ErrTransient)
+}
+
+// backoff is the wait after the given failed attempt (1-based) that failed with err. The
+// policy's Jitter takes a random share off it, so workers that failed together don't retry
+// together. A longer Retry-After of the source is waited instead, up to MaxBackoff.
+func backoff(policy config.RetryPolicy, attempt int, err error) time.Duration {
+	d := float64(policy.InitialBackoff) * math.Pow(policy.Multiplier, float64(attempt-1))
+	if policy.MaxBackoff > 0 && d > float64(policy.MaxBackoff) {
+		d = float64(policy.MaxBackoff)
+	}
+	if policy.Jitter > 0 {
+		d -= d * min(policy.Jitter, 1) * rand.Float64()
+	}
+
+	wait := time.Duration(d)
+	if after := researchpaperapis.RetryAfter(err); after > wait {
+		// NOTE: a source asking for more than MaxBackoff (e.g. until its quota resets) is
+		// retried early, the attempt most likely fails and the page is skipped as before
+		wait = after
+		if policy.MaxBackoff > 0 && wait > policy.MaxBackoff {
+			wait = policy.MaxBackoff
+		}
+	}
+	return wait
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,38 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"go_ingestion/config"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"net/http"
+	"testing"
+)
+
+func TestRetryable(t *testing.T) {
+	policy := config.RetryPolicy{RetryableStatuses: []int{429, 503}}
+	status := func(code int) error {
+		return &researchpaperapis.StatusError{Source: "arxiv", StatusCode: code, Status: http.StatusText(code)}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"network failure", fmt.Errorf("arxiv GET request failed: %w", fmt.Errorf("%w: connection refused", researchpaperapis.ErrTransient)), true},
+		{"retryable status", status(http.StatusServiceUnavailable), true},
+		{"rate limited", status(http.StatusTooManyRequests), true},
+		{"server error the policy leaves out", status(http.StatusBadGateway), false},
+		{"rejected key", status(http.StatusUnauthorized), false},
+		{"not found", status(http.StatusNotFound), false},
+		{"bad response", fmt.Errorf("failed to decode arxiv feed: %w", &json.SyntaxError{Offset: 1}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(policy, tt.err); got != tt.want {
+				t.Errorf("retryable(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/cache"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Totals asks sources how many papers match a query at most once per source, query and
+// day (UTC). Sources in Skip are never asked, their pagers run until an empty page instead.
+type Totals struct {
+	// Cache and TTL keep totals in front of the database, Cache may be nil
+	Cache cache.Cache
+	TTL   time.Duration
+	// DBPool keeps totals across restarts, may be nil
+	DBPool *pgxpool.Pool
+	Doer   researchpaperapis.Doer
+	Skip   map[db.PaperSource]bool
+	// Timeout bounds asking a source, 0 doesn't
+	Timeout time.Duration
+}
+
+// Get returns the total of source for query in window, researchpaperapis.UnknownTotal when
+// the source is skipped.
+func (t *Totals) Get(ctx context.Context, source db.PaperSource, apiKey, query string, window *researchpaperapis.DateWindow) (uint64, error) {
+	if t.Skip[source] {
+		return researchpaperapis.UnknownTotal, nil
+	}
+
+	var windowKey string
+	if window != nil {
+		windowKey = window.String()
+	}
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	key := fmt.Sprintf("total:%s:%s:%s:%s", source, query, windowKey, day.Format(time.DateOnly))
+
+	if t.Cache != nil {
+		cached, ok, err := t.Cache.Get(ctx, key)
+		if err != nil {
+			log.Printf("[CACHE] %v", err)
+		}
+		if ok {
+			if total, err := strconv.ParseUint(string(cached), 10, 64); err == nil {
+				return total, nil
+			}
+		}
+	}
+
+	if t.DBPool != nil {
+		total, ok, err := db.GetSourceTotal(ctx, t.DBPool, source, query, windowKey, day)
+		if err != nil {
+			log.Printf("[TOTALS] %v", err)
+		}
+		if ok {
+			t.cache(ctx, key, total)
+			return total, nil
+		}
+	}
+
+	sourceCtx := ctx
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		sourceCtx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	total, err := researchpaperapis.SourceTotal(sourceCtx, t.Doer, source, apiKey, query, window)
+	if err != nil {
+		return 0, err
+	}
+
+	if t.DBPool != nil {
+		if err := db.SaveSourceTotal(ctx, t.DBPool, source, query, windowKey, day, total); err != nil {
+			log.Printf("[TOTALS] %v", err)
+		}
+	}
+	t.cache(ctx, key, total)
+	return total, nil
+}
+
+func (t *Totals) cache(ctx context.Context, key string, total uint64) {
+	if t.Cache == nil {
+		return
+	}
+	if err := t.Cache.Set(ctx, key, []byte(strconv.FormatUint(total, 10)), t.TTL); err != nil {
+		log.Printf("[CACHE] %v", err)
+	}
+}
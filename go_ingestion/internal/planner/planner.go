@@ -0,0 +1,165 @@
+// Package planner estimates how long ingesting topics takes under the rate limits and
+// daily quotas of the sources, before a rate limited key is spent on a huge topic.
+package planner
+
+import (
+	"cmp"
+	"fmt"
+	"go_ingestion/db"
+	"slices"
+	"time"
+)
+
+// Limit is what a source allows.
+type Limit struct {
+	Interval   time.Duration
+	DailyQuota int
+	// UsedToday is how much of the quota is spent already, recorded by the shared limiter
+	UsedToday int
+	// MaxPageSize is the most papers the source returns per request, 0 when unknown
+	MaxPageSize uint64
+}
+
+// PerDay is how many requests the source allows a day, 0 when neither the interval nor a
+// quota limits it.
+func (l Limit) PerDay() uint64 {
+	var perDay uint64
+	if l.Interval > 0 {
+		perDay = uint64(24 * time.Hour / l.Interval)
+	}
+	if l.DailyQuota > 0 && (perDay == 0 || uint64(l.DailyQuota) < perDay) {
+		perDay = uint64(l.DailyQuota)
+	}
+	return perDay
+}
+
+// Work is a topic to ingest from a source.
+type Work struct {
+	Topic  string
+	Source db.PaperSource
+	// Total is what the source reports for the topic, only when KnownTotal
+	Total      uint64
+	KnownTotal bool
+	// Processed is where the checkpoint of the topic stands
+	Processed uint64
+	PageSize  uint64
+	// MaxPapers caps every run of the topic, 0 doesn't; runs happen Every
+	MaxPapers uint64
+	Every     time.Duration
+}
+
+type Estimate struct {
+	Work
+	Remaining uint64
+	Requests  uint64
+	// Days the work takes at the full rate of the source, if it had the source to itself
+	Days float64
+	// RunDays is how long the schedule takes when MaxPapers caps the runs, 0 when it doesn't
+	RunDays float64
+}
+
+// SourcePlan is all the work of a source together, it shares the source's rate.
+type SourcePlan struct {
+	Source   db.PaperSource
+	Limit    Limit
+	Topics   int
+	Requests uint64
+	// Days is 0 for sources without a limit
+	Days float64
+}
+
+type Plan struct {
+	Estimates   []Estimate
+	Sources     []SourcePlan
+	Suggestions []string
+}
+
+// longAfter is how many days of work make a source worth a suggestion
+const longAfter = 7
+
+// New works out the requests and days of works, a work whose total isn't known is left
+// out of the sums.
+func New(works []Work, limits map[db.PaperSource]Limit) Plan {
+	var plan Plan
+	sources := map[db.PaperSource]*SourcePlan{}
+
+	for _, w := range works {
+		limit := limits[w.Source]
+		sp, ok := sources[w.Source]
+		if !ok {
+			sp = &SourcePlan{Source: w.Source, Limit: limit}
+			sources[w.Source] = sp
+		}
+		sp.Topics++
+
+		e := Estimate{Work: w}
+		if !w.KnownTotal {
+			plan.Estimates = append(plan.Estimates, e)
+			plan.Suggestions = append(plan.Suggestions, fmt.Sprintf("%s has no known total for %q, run it once without --skip-totals or with --dry-run", w.Source, w.Topic))
+			continue
+		}
+
+		e.Remaining = w.Total - min(w.Processed, w.Total)
+		e.Requests = requests(e.Remaining, w.PageSize)
+		e.Days = days(e.Requests, 0, limit.PerDay())
+		if w.MaxPapers > 0 && w.Every > 0 && e.Remaining > 0 {
+			runs := (e.Remaining + w.MaxPapers - 1) / w.MaxPapers
+			e.RunDays = float64(runs-1)*w.Every.Hours()/24 + e.Days/float64(runs)
+		}
+		plan.Estimates = append(plan.Estimates, e)
+		sp.Requests += e.Requests
+
+		if e.RunDays >= longAfter && e.RunDays > 2*e.Days {
+			plan.Suggestions = append(plan.Suggestions, fmt.Sprintf("%q on %s is capped at max_papers %d a run every %s and takes %.0f days instead of %.0f",
+				w.Topic, w.Source, w.MaxPapers, w.Every, e.RunDays, e.Days))
+		}
+
+		if limit.MaxPageSize > w.PageSize && e.Requests > 1 {
+			plan.Suggestions = append(plan.Suggestions, fmt.Sprintf("%q on %s pages %d papers a request, the source takes %d: %d instead of %d requests",
+				w.Topic, w.Source, w.PageSize, limit.MaxPageSize, requests(e.Remaining, limit.MaxPageSize), e.Requests))
+		}
+	}
+
+	for _, sp := range sources {
+		sp.Days = days(sp.Requests, sp.Limit.UsedToday, sp.Limit.PerDay())
+		plan.Sources = append(plan.Sources, *sp)
+	}
+	slices.SortFunc(plan.Sources, func(a, b SourcePlan) int { return cmp.Compare(a.Source, b.Source) })
+
+	for _, sp := range plan.Sources {
+		if sp.Days < longAfter {
+			continue
+		}
+		perDay := sp.Limit.PerDay()
+		plan.Suggestions = append(plan.Suggestions, fmt.Sprintf("%s needs %.0f days for %d requests at %d a day; daily runs with max_papers of about %d per topic (%d topics) stay within it",
+			sp.Source, sp.Days, sp.Requests, perDay, perDay*pageSize(works, sp.Source)/uint64(sp.Topics), sp.Topics))
+	}
+	return plan
+}
+
+func requests(papers, pageSize uint64) uint64 {
+	if papers == 0 {
+		return 0
+	}
+	pageSize = max(pageSize, 1)
+	return (papers + pageSize - 1) / pageSize
+}
+
+// days counts the quota already used today as spent, 0 when nothing limits the rate.
+func days(requests uint64, usedToday int, perDay uint64) float64 {
+	if perDay == 0 || requests == 0 {
+		return 0
+	}
+	return float64(requests+uint64(max(usedToday, 0))) / float64(perDay)
+}
+
+// pageSize is the smallest page size the works of source use.
+func pageSize(works []Work, source db.PaperSource) uint64 {
+	var size uint64
+	for _, w := range works {
+		if w.Source == source && (size == 0 || w.PageSize < size) {
+			size = w.PageSize
+		}
+	}
+	return max(size, 1)
+}
@@ -0,0 +1,118 @@
+// Package progress writes what a command is doing as JSON lines on stdout, for workflow
+// tools (Airflow, Dagster) that run the binary and parse its output. Logs stay on stderr.
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// OutputText and OutputJSON are the values of the --output flag.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// Events of a command: started, then progress every interval while it runs, then
+// finished or failed. Short commands only write finished or failed.
+const (
+	Started  = "started"
+	Running  = "progress"
+	Finished = "finished"
+	Failed   = "failed"
+)
+
+// Event is one line of output, fields that don't apply to the command are left out.
+type Event struct {
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	Query   string    `json:"query,omitempty"`
+	RunID   uint64    `json:"run_id,omitempty"`
+	// Inserted and Sources are the papers of an ingest so far
+	Inserted uint64                                           `json:"inserted,omitempty"`
+	Sources  map[db.PaperSource]researchpaperapis.SourceStats `json:"sources,omitempty"`
+	// Rows, File, Manifest and SHA256 describe a written export
+	Rows     int    `json:"rows,omitempty"`
+	File     string `json:"file,omitempty"`
+	Manifest string `json:"manifest,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Writer writes events to W. A nil Writer writes nothing, commands run with --output text
+// get one.
+type Writer struct {
+	W io.Writer
+	// Every is how often Track writes a progress event
+	Every time.Duration
+
+	mu sync.Mutex
+}
+
+// New returns a writer to stdout for --output json, nil for text.
+func New(output string, w io.Writer, every time.Duration) (*Writer, error) {
+	switch output {
+	case OutputText, "":
+		return nil, nil
+	case OutputJSON:
+		return &Writer{W: w, Every: every}, nil
+	default:
+		return nil, fmt.Errorf("unknown output %q, use text or json", output)
+	}
+}
+
+func (p *Writer) Emit(e Event) {
+	if p == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := json.NewEncoder(p.W).Encode(e); err != nil {
+		log.Printf("[PROGRESS] %v", err)
+	}
+}
+
+// Fail writes a failed event for command when err isn't nil and returns err.
+func (p *Writer) Fail(command string, err error) error {
+	if err != nil {
+		p.Emit(Event{Event: Failed, Command: command, Error: err.Error()})
+	}
+	return err
+}
+
+// Track writes the event current returns every Every until stop is called.
+func (p *Writer) Track(current func() Event) (stop func()) {
+	if p == nil || p.Every <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(p.Every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				p.Emit(current())
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
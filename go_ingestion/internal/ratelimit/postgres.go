@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CREATE TABLE rate_limits (
+//     key TEXT PRIMARY KEY,
+//     next_allowed_at TIMESTAMPTZ NOT NULL -- when the bucket is full again, see Local
+// );
+//
+// CREATE TABLE quota_usage (
+//     key TEXT NOT NULL,
+//     day DATE NOT NULL,
+//     used INT NOT NULL DEFAULT 0,
+//     PRIMARY KEY (key, day)
+// );
+
+// Postgres is a token bucket shared by every instance pointing at the same database: each
+// Wait takes a token of key in one upsert (the row lock serializes instances), then sleeps
+// until the token is there. A daily quota of 0 means unlimited.
+type Postgres struct {
+	dbPool     *pgxpool.Pool
+	key        string
+	interval   time.Duration
+	slack      time.Duration
+	dailyQuota int
+}
+
+func NewPostgres(dbPool *pgxpool.Pool, key string, interval time.Duration, burst, dailyQuota int) *Postgres {
+	return &Postgres{dbPool: dbPool, key: key, interval: interval, slack: burstSlack(interval, burst), dailyQuota: dailyQuota}
+}
+
+func (p *Postgres) Wait(ctx context.Context) error {
+	if p.dailyQuota > 0 {
+		if err := p.reserveQuota(ctx); err != nil {
+			return err
+		}
+	}
+
+	var slot time.Time
+	err := p.dbPool.QueryRow(ctx, `
+		INSERT INTO rate_limits (key, next_allowed_at)
+		VALUES ($1, now() + $2)
+		ON CONFLICT (key) DO UPDATE
+			SET next_allowed_at = GREATEST(rate_limits.next_allowed_at, now()) + $2
+		RETURNING GREATEST(next_allowed_at - $2 - $3::interval, now());
+	`, p.key, p.interval, p.slack).Scan(&slot)
+	if err != nil {
+		return fmt.Errorf("failed to reserve rate limit slot for %s: %w", p.key, err)
+	}
+
+	return sleepUntil(ctx, slot)
+}
+
+// UsedToday returns how much of the daily quota of key was spent today.
+func UsedToday(ctx context.Context, dbPool *pgxpool.Pool, key string) (int, error) {
+	var used int
+	err := dbPool.QueryRow(ctx, `
+		SELECT COALESCE(sum(used), 0) FROM quota_usage WHERE key = $1 AND day = current_date;
+	`, key).Scan(&used)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read quota usage of %s: %w", key, err)
+	}
+	return used, nil
+}
+
+// ReserveDaily takes up to n from what is left today of a daily quota of key and returns
+// how much it got, 0 once the quota is spent. Unlike the quota of a Postgres limiter, which
+// counts requests, n counts whatever the caller budgets, such as papers looked up.
+func ReserveDaily(ctx context.Context, dbPool *pgxpool.Pool, key string, n, quota int) (int, error) {
+	_, err := dbPool.Exec(ctx, `
+		INSERT INTO quota_usage (key, day, used) VALUES ($1, current_date, 0)
+		ON CONFLICT (key, day) DO NOTHING;
+	`, key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve quota for %s: %w", key, err)
+	}
+
+	var granted int
+	err = dbPool.QueryRow(ctx, `
+		UPDATE quota_usage q
+		SET used = q.used + g.granted
+		FROM (
+			SELECT LEAST($2, GREATEST($3 - used, 0)) AS granted
+			FROM quota_usage
+			WHERE key = $1 AND day = current_date
+			FOR UPDATE
+		) g
+		WHERE q.key = $1 AND q.day = current_date
+		RETURNING g.granted;
+	`, key, n, quota).Scan(&granted)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve quota for %s: %w", key, err)
+	}
+	return granted, nil
+}
+
+func (p *Postgres) reserveQuota(ctx context.Context) error {
+	tag, err := p.dbPool.Exec(ctx, `
+		INSERT INTO quota_usage (key, day, used)
+		VALUES ($1, current_date, 1)
+		ON CONFLICT (key, day) DO UPDATE
+			SET used = quota_usage.used + 1
+			WHERE quota_usage.used < $2;
+	`, p.key, p.dailyQuota)
+	if err != nil {
+		return fmt.Errorf("failed to reserve quota for %s: %w", p.key, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", p.key, ErrQuotaExhausted)
+	}
+	return nil
+}
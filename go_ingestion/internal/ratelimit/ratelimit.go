@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrQuotaExhausted = errors.New("daily quota exhausted")
+
+// Limiter blocks until the caller may make one upstream request.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// Local is the token bucket of a single process: a bucket of burst requests refilled one
+// per interval. A burst of 0 or 1 spaces every request interval apart.
+type Local struct {
+	interval time.Duration
+	// slack is how far ahead of the bucket a request may go, (burst-1) intervals
+	slack time.Duration
+
+	mu sync.Mutex
+	// tat is when the bucket is full again, the theoretical arrival time of GCRA
+	tat time.Time
+}
+
+func NewLocal(interval time.Duration, burst int) *Local {
+	return &Local{interval: interval, slack: burstSlack(interval, burst)}
+}
+
+func (l *Local) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.tat.Before(now) {
+		l.tat = now
+	}
+	slot := l.tat.Add(-l.slack)
+	if slot.Before(now) {
+		slot = now
+	}
+	l.tat = l.tat.Add(l.interval)
+	l.mu.Unlock()
+
+	return sleepUntil(ctx, slot)
+}
+
+func burstSlack(interval time.Duration, burst int) time.Duration {
+	if burst <= 1 {
+		return 0
+	}
+	return time.Duration(burst-1) * interval
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
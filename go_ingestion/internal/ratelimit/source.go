@@ -0,0 +1,24 @@
+package ratelimit
+
+import (
+	"go_ingestion/config"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SourceKey is the key the shared limiter of source uses.
+func SourceKey(source string) string {
+	return "source:" + source
+}
+
+// ForSource builds the limiter configured for source, shared through Postgres when
+// several ingester instances run against the same database.
+func ForSource(dbPool *pgxpool.Pool, cfg config.RateLimits, source string) Limiter {
+	limit := cfg.Sources[source]
+
+	// NOTE: without a database to share, e.g. an ingest to stdout, the limit is kept in process
+	if cfg.Shared && dbPool != nil {
+		return NewPostgres(dbPool, SourceKey(source), limit.Interval, limit.Burst, limit.DailyQuota)
+	}
+	return NewLocal(limit.Interval, limit.Burst)
+}
@@ -0,0 +1,138 @@
+// Package reenrich slowly walks the whole corpus keeping the citation counts and open
+// access status of papers fresh, within a daily budget of semantic scholar lookups.
+package reenrich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/ratelimit"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// BudgetKey is the quota_usage key the daily budget is counted under, in papers looked up
+const BudgetKey = "reenrich:semanticscholar"
+
+type Options struct {
+	// APIKey is the semantic scholar key, it works without one at a much lower rate
+	APIKey string
+	// Limiter paces the batch requests, usually the semanticscholar source limiter
+	Limiter ratelimit.Limiter
+	Doer    researchpaperapis.Doer
+	// BatchSize papers are looked up per run, in requests of at most SemanticBatchMax
+	BatchSize int
+	// DailyBudget caps the papers looked up per day across runs and instances, 0 is unlimited
+	DailyBudget int
+	// MaxAge is how long a paper stays fresh before it is looked up again
+	MaxAge time.Duration
+}
+
+type Report struct {
+	Checked    int
+	Updated    int
+	Unknown    int
+	OpenAccess int
+	Failed     int
+	Exhausted  bool
+}
+
+func (r Report) String() string {
+	s := fmt.Sprintf("checked=%d updated=%d unknown=%d open_access=%d failed=%d", r.Checked, r.Updated, r.Unknown, r.OpenAccess, r.Failed)
+	if r.Exhausted {
+		s += " (daily budget spent)"
+	}
+	return s
+}
+
+// Run re-enriches the stalest batch of papers. The budget is reserved before the lookups,
+// so lookups that fail still count against it.
+func Run(ctx context.Context, dbPool *pgxpool.Pool, projectID uint64, opts Options) (Report, error) {
+	var report Report
+
+	papers, err := db.PapersToReenrich(ctx, dbPool, projectID, opts.MaxAge, opts.BatchSize)
+	if err != nil || len(papers) == 0 {
+		return report, err
+	}
+
+	if opts.DailyBudget > 0 {
+		granted, err := ratelimit.ReserveDaily(ctx, dbPool, BudgetKey, len(papers), opts.DailyBudget)
+		if err != nil {
+			return report, err
+		}
+		if granted < len(papers) {
+			report.Exhausted = true
+			papers = papers[:granted]
+		}
+	}
+
+	for len(papers) > 0 {
+		n := min(len(papers), researchpaperapis.SemanticBatchMax)
+		batch := papers[:n]
+		papers = papers[n:]
+
+		if err := opts.Limiter.Wait(ctx); err != nil {
+			if errors.Is(err, ratelimit.ErrQuotaExhausted) {
+				report.Exhausted = true
+				return report, nil
+			}
+			return report, err
+		}
+
+		ids := make([]string, len(batch))
+		for i, p := range batch {
+			ids[i] = p.LookupID
+		}
+		report.Checked += len(batch)
+
+		// NOTE: a failed batch leaves its papers stale, the next run picks them up again
+		found, err := researchpaperapis.FindSemanticPapers(ctx, opts.Doer, opts.APIKey, ids)
+		if err != nil {
+			log.Printf("[REENRICH] batch of %d papers: %v", len(batch), err)
+			report.Failed += len(batch)
+			continue
+		}
+
+		for i, p := range batch {
+			if found[i] == nil {
+				report.Unknown++
+				if err := db.SaveReenrichment(ctx, dbPool, p.ID, nil); err != nil {
+					return report, err
+				}
+				continue
+			}
+
+			r := toReenrichment(*found[i])
+			if err := db.SaveReenrichment(ctx, dbPool, p.ID, &r); err != nil {
+				return report, err
+			}
+			report.Updated++
+			if r.OpenAccess {
+				report.OpenAccess++
+			}
+		}
+	}
+
+	return report, nil
+}
+
+func toReenrichment(p researchpaperapis.SemanticPaper) db.Reenrichment {
+	r := db.Reenrichment{CitationCount: p.CitationCount}
+	pdfURL := researchpaperapis.GetSemanticPDFLink(p)
+	if pdfURL == "" {
+		return r
+	}
+
+	r.OpenAccess = true
+	// NOTE: green open access is a copy in a repository, the other statuses are the publisher's
+	kind := db.PDFPublisher
+	if p.OpenAccessPdf.Status != nil && *p.OpenAccessPdf.Status == "GREEN" {
+		kind = db.PDFRepository
+	}
+	r.PDFCandidates = []db.PDFCandidate{db.NewPDFCandidate(pdfURL, kind)}
+	return r
+}
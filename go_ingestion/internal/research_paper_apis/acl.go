@@ -0,0 +1,513 @@
+package researchpaperapis
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/filter"
+	"go_ingestion/internal/license"
+	"go_ingestion/internal/paper"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// aclDumpURL is the whole anthology as bibtex with abstracts, the anthology has no search api
+const aclDumpURL = "https://aclanthology.org/anthology+abstracts.bib.gz"
+
+const (
+	// aclDumpMaxAge is how long the local copy of the dump is searched before it is downloaded
+	// again, the anthology adds volumes every few days
+	aclDumpMaxAge = 24 * time.Hour
+	// aclMaxPerPage bounds the pages cut from the matches
+	aclMaxPerPage = 1000
+	// aclCachedQueries is how many queries keep their matches in memory
+	aclCachedQueries = 16
+)
+
+// aclDump is the local copy of the dump and the entries that matched recent queries. The
+// matches are in the order of the dump, so offsets stay put until the dump is replaced.
+type aclDump struct {
+	mu       sync.Mutex
+	modified time.Time
+	matches  map[string][]ACLEntry
+}
+
+var aclAnthology = &aclDump{}
+
+func aclDumpPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "researchq", "acl-anthology.bib.gz")
+}
+
+// search returns the papers of the dump matching query in window, downloading the dump
+// first when the local copy is missing or stale.
+func (d *aclDump) search(ctx context.Context, doer Doer, query string, window *DateWindow) ([]ACLEntry, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dumpPath := aclDumpPath()
+	info, err := os.Stat(dumpPath)
+	if err != nil || time.Since(info.ModTime()) > aclDumpMaxAge {
+		if err := downloadACLDump(ctx, doer, dumpPath); err != nil {
+			// NOTE: a stale copy is better than none
+			if info == nil {
+				return nil, err
+			}
+			log.Printf("[ACL] searching the copy from %s: %v", info.ModTime().Format(time.DateOnly), err)
+		}
+		if info, err = os.Stat(dumpPath); err != nil {
+			return nil, err
+		}
+	}
+	if !info.ModTime().Equal(d.modified) || len(d.matches) >= aclCachedQueries {
+		d.modified = info.ModTime()
+		d.matches = map[string][]ACLEntry{}
+	}
+
+	matches, ok := d.matches[query]
+	if !ok {
+		if matches, err = searchACLDump(dumpPath, aclTerms(query)); err != nil {
+			return nil, err
+		}
+		d.matches[query] = matches
+	}
+
+	if window == nil {
+		return matches, nil
+	}
+	var inWindow []ACLEntry
+	for _, e := range matches {
+		if published := aclPublished(e); !published.IsZero() && !published.Before(window.From) && !published.After(window.To) {
+			inWindow = append(inWindow, e)
+		}
+	}
+	return inWindow, nil
+}
+
+// downloadACLDump replaces the dump at dumpPath, the old copy stays until the new one is
+// complete.
+func downloadACLDump(ctx context.Context, doer Doer, dumpPath string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, aclDumpURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create acl anthology request: %w", err)
+	}
+
+	res, err := doerOrDefault(doer).Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return newStatusError("acl anthology", res)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dumpPath), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dumpPath), "acl-anthology-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, res.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to download the acl anthology dump: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dumpPath)
+}
+
+func searchACLDump(dumpPath string, terms []string) ([]ACLEntry, error) {
+	f, err := os.Open(dumpPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the acl anthology dump: %w", err)
+	}
+	defer gz.Close()
+
+	var matches []ACLEntry
+	err = parseBibTeX(gz, func(e ACLEntry) {
+		if aclMatches(e, terms) {
+			matches = append(matches, e)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the acl anthology dump: %w", err)
+	}
+	return matches, nil
+}
+
+// aclTerms are the lowercased words of query.
+func aclTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// aclMatches keeps papers whose title or abstract contain every term, volumes and other
+// front matter are left out.
+func aclMatches(e ACLEntry, terms []string) bool {
+	if e.Type != "inproceedings" && e.Type != "article" {
+		return false
+	}
+	text := strings.ToLower(e.Fields["title"] + " " + e.Fields["abstract"])
+	for _, t := range terms {
+		if !strings.Contains(text, t) {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	Register(aclProvider{})
+}
+
+type aclProvider struct{}
+
+// NOTE: the anthology is searched in a local copy of its dump, no key and no rate to respect
+func (aclProvider) Info() ProviderInfo {
+	return ProviderInfo{Source: db.ACL, Tag: "ACL"}
+}
+
+func (aclProvider) Total(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow) (uint64, error) {
+	matches, err := aclAnthology.search(ctx, doer, query, window)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(matches)), nil
+}
+
+func (aclProvider) Pager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) Pager {
+	return NewACLPager(query, window, offset, total, limit, opts)
+}
+
+func (aclProvider) Remap(raw []byte, query string) (paper.Paper, error) {
+	var e ACLEntry
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return paper.Paper{}, fmt.Errorf("failed to decode acl payload: %w", err)
+	}
+	return getPaperFromACL(e, query)
+}
+
+// NewACLPager pages the papers of the anthology matching query from offset until total.
+func NewACLPager(query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) *OffsetPager {
+	return newOffsetPager(db.ACL, opts, offset, total, min(limit, aclMaxPerPage), func(ctx context.Context, offset, limit uint64, page *pageState) ([]db.ResearchPaper, error) {
+		matches, err := aclAnthology.search(ctx, opts.Doer, query, window)
+		if err != nil {
+			return nil, err
+		}
+		entries := matches[min(offset, uint64(len(matches))):min(offset+limit, uint64(len(matches)))]
+
+		page.fetched(len(entries))
+		mapped := opts.Mappings.For(db.ACL) != nil
+		papers := make([]db.ResearchPaper, 0, len(entries))
+		for i, e := range entries {
+			// NOTE: the field mapping sees the bibtex fields
+			var record map[string]any
+			if mapped {
+				record = make(map[string]any, len(e.Fields))
+				for k, v := range e.Fields {
+					record[k] = v
+				}
+			}
+			researchPaper, ok := page.mapEntry(ctx, i, e.Key, e, record, func() (paper.Paper, error) {
+				return getPaperFromACL(e, query)
+			})
+			if ok {
+				papers = append(papers, researchPaper)
+			}
+		}
+
+		return papers, nil
+	})
+}
+
+// parseBibTeX calls fn with every entry of r. Only what the anthology dump uses is
+// understood: quoted or braced values and bare words, no @string macros or concatenation.
+func parseBibTeX(r io.Reader, fn func(ACLEntry)) error {
+	br := bufio.NewReaderSize(r, 64<<10)
+	for {
+		if _, err := br.ReadString('@'); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		typ, err := br.ReadString('{')
+		if err != nil {
+			return err
+		}
+		typ = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(typ, "{")))
+		if typ == "comment" || typ == "string" || typ == "preamble" {
+			if _, err := readBibBraced(br); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key, err := br.ReadString(',')
+		if err != nil {
+			return err
+		}
+		fields, err := readBibFields(br)
+		if err != nil {
+			return fmt.Errorf("entry %s: %w", strings.TrimSpace(key), err)
+		}
+		fn(ACLEntry{Type: typ, Key: strings.TrimSpace(strings.TrimSuffix(key, ",")), Fields: fields})
+	}
+}
+
+// readBibFields reads name = value pairs until the brace closing the entry.
+func readBibFields(br *bufio.Reader) (map[string]string, error) {
+	fields := map[string]string{}
+	for {
+		c, err := skipBibSpace(br)
+		if err != nil {
+			return nil, err
+		}
+		if c == '}' {
+			return fields, nil
+		}
+		br.UnreadRune()
+
+		name, err := br.ReadString('=')
+		if err != nil {
+			return nil, err
+		}
+		name = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(name, "=")))
+
+		c, err = skipBibSpace(br)
+		if err != nil {
+			return nil, err
+		}
+		var value string
+		switch c {
+		case '"':
+			value, err = readBibQuoted(br)
+		case '{':
+			value, err = readBibBraced(br)
+		default:
+			br.UnreadRune()
+			value, err = readBibBare(br)
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = latexText(value)
+	}
+}
+
+// skipBibSpace returns the next rune that is neither space nor a comma between fields.
+func skipBibSpace(br *bufio.Reader) (rune, error) {
+	for {
+		c, _, err := br.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if !unicode.IsSpace(c) && c != ',' {
+			return c, nil
+		}
+	}
+}
+
+// readBibQuoted reads until the closing quote that isn't inside braces.
+func readBibQuoted(br *bufio.Reader) (string, error) {
+	var sb strings.Builder
+	depth := 0
+	for {
+		c, _, err := br.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case c == '"' && depth == 0:
+			return sb.String(), nil
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		}
+		sb.WriteRune(c)
+	}
+}
+
+// readBibBraced reads until the brace closing the one already read.
+func readBibBraced(br *bufio.Reader) (string, error) {
+	var sb strings.Builder
+	depth := 1
+	for {
+		c, _, err := br.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return sb.String(), nil
+			}
+		}
+		sb.WriteRune(c)
+	}
+}
+
+// readBibBare reads a bare value such as a month macro (jun) or a number.
+func readBibBare(br *bufio.Reader) (string, error) {
+	var sb strings.Builder
+	for {
+		c, _, err := br.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		if c == ',' || c == '}' {
+			br.UnreadRune()
+			return strings.TrimSpace(sb.String()), nil
+		}
+		sb.WriteRune(c)
+	}
+}
+
+var (
+	latexAccent = regexp.MustCompile(`\\([` + "`" + `'"^~=.uvHck])\s*\{?\s*(\\i|[A-Za-z])\s*\}?`)
+	// latexCombining are the combining marks of the accent commands
+	latexCombining = map[string]string{
+		"`": "̀", "'": "́", "^": "̂", "~": "̃", "=": "̄", "u": "̆",
+		".": "̇", `"`: "̈", "H": "̋", "v": "̌", "c": "̧", "k": "̨",
+	}
+	latexSymbols = strings.NewReplacer(
+		`\&`, "&", `\%`, "%", `\_`, "_", `\$`, "$", `\#`, "#",
+		`\ss`, "ß", `\o`, "ø", `\O`, "Ø", `\l`, "ł", `\L`, "Ł", `\aa`, "å", `\AA`, "Å", `\ae`, "æ", `\i`, "ı",
+		"{", "", "}", "",
+	)
+)
+
+// latexText resolves the accents and escapes of a bibtex value and drops its braces.
+func latexText(s string) string {
+	s = latexAccent.ReplaceAllStringFunc(s, func(m string) string {
+		parts := latexAccent.FindStringSubmatch(m)
+		letter := parts[2]
+		if letter == `\i` {
+			letter = "i"
+		}
+		return letter + latexCombining[parts[1]]
+	})
+	return strings.Join(strings.Fields(latexSymbols.Replace(s)), " ")
+}
+
+var aclAuthorSeparator = regexp.MustCompile(`\s+and\s+`)
+
+// aclAuthors turns "Devlin, Jacob and Chang, Ming-Wei" into names in reading order.
+func aclAuthors(s string) []paper.Author {
+	var authors []paper.Author
+	for _, name := range aclAuthorSeparator.Split(strings.TrimSpace(s), -1) {
+		if last, first, ok := strings.Cut(name, ","); ok {
+			name = strings.TrimSpace(first) + " " + strings.TrimSpace(last)
+		}
+		if name = strings.TrimSpace(name); name != "" {
+			authors = append(authors, paper.Author{Name: name})
+		}
+	}
+	return authors
+}
+
+// aclPublished is the first day of the month of publication, of the year when the entry
+// has no month.
+func aclPublished(e ACLEntry) time.Time {
+	year, err := strconv.Atoi(e.Fields["year"])
+	if err != nil || year == 0 {
+		return time.Time{}
+	}
+	month := time.January
+	if m := strings.TrimSpace(e.Fields["month"]); len(m) >= 3 {
+		if t, err := time.Parse("Jan", strings.ToUpper(m[:1])+strings.ToLower(m[1:3])); err == nil {
+			month = t.Month()
+		}
+	}
+	return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// aclID is the anthology id of an entry, the last segment of its url such as 2020.acl-main.1.
+func aclID(e ACLEntry) string {
+	u, err := url.Parse(strings.TrimSpace(e.Fields["url"]))
+	if err != nil || !strings.HasSuffix(u.Hostname(), "aclanthology.org") {
+		return ""
+	}
+	return path.Base(strings.TrimSuffix(u.Path, "/"))
+}
+
+// NOTE: papers from 2016 on are CC BY 4.0, older ones CC BY-NC-SA 3.0
+func getPaperFromACL(e ACLEntry, query string) (paper.Paper, error) {
+	title := strings.TrimSpace(e.Fields["title"])
+	if title == "" {
+		return paper.Paper{}, fmt.Errorf("%w in acl entry", errNoTitle)
+	}
+	id := aclID(e)
+	if id == "" || id == "." || id == "/" {
+		return paper.Paper{}, fmt.Errorf("%w for acl entry key=%s", errNoPDF, e.Key)
+	}
+	pdfURL := "https://aclanthology.org/" + id + ".pdf"
+
+	venue := strings.TrimSpace(e.Fields["booktitle"])
+	var conference string
+	if venue != "" {
+		conference = venue
+	} else {
+		venue = strings.TrimSpace(e.Fields["journal"])
+	}
+
+	published := aclPublished(e)
+	lic := license.CCBY
+	if published.Year() < 2016 {
+		lic = license.CCBYNCSA
+	}
+	return paper.Paper{
+		Source:     db.ACL,
+		SourceID:   id,
+		Title:      title,
+		PDFURL:     pdfURL,
+		DOI:        strings.ToLower(strings.TrimSpace(e.Fields["doi"])),
+		Authors:    aclAuthors(e.Fields["author"]),
+		Published:  published,
+		Query:      query,
+		Abstract:   strings.TrimSpace(e.Fields["abstract"]),
+		Venue:      venue,
+		Conference: conference,
+		License:    lic,
+		Attributes: filter.Attributes{
+			PublicationTypes: []string{e.Type},
+			Year:             published.Year(),
+			Language:         strings.TrimSpace(e.Fields["language"]),
+		},
+		Raw:           e,
+		PDFCandidates: []db.PDFCandidate{db.NewPDFCandidate(pdfURL, db.PDFPublisher)},
+		Identifiers:   map[string]string{paper.SchemeACL: id},
+	}, nil
+}
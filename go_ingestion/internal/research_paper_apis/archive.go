@@ -0,0 +1,51 @@
+package researchpaperapis
+
+import (
+	"context"
+	"go_ingestion/db"
+	"log"
+	"strings"
+	"time"
+)
+
+// PageArchive keeps the raw pages as they came from upstream, see archive.Pages.
+type PageArchive interface {
+	Archive(ctx context.Context, page ArchivedPage) error
+}
+
+// ArchivedPage is a raw page and the request it answered, enough to page the same request
+// again with the archived body in place of the source.
+type ArchivedPage struct {
+	Source db.PaperSource `json:"source"`
+	Query  string         `json:"query"`
+	Window *DateWindow    `json:"window,omitempty"`
+	Offset uint64         `json:"offset"`
+	Limit  uint64         `json:"limit"`
+	// Key is the request URL without api keys, what the page is cached under
+	Key       string    `json:"key"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Body      []byte    `json:"-"`
+}
+
+// archive hands a freshly fetched page to the archive. Pages read from the cache were
+// archived when they were fetched.
+//
+// NOTE: a page that can't be archived is still ingested, the failure is only logged
+func (p *pageState) archive(ctx context.Context, key string, body []byte) {
+	if p.opts.Archive == nil {
+		return
+	}
+	page := ArchivedPage{
+		Source:    p.source,
+		Query:     p.opts.query,
+		Window:    p.opts.window,
+		Offset:    p.offset,
+		Limit:     p.limit,
+		Key:       key,
+		FetchedAt: time.Now().UTC(),
+		Body:      body,
+	}
+	if err := p.opts.Archive.Archive(ctx, page); err != nil {
+		log.Printf("[%s] failed to archive page offset=%d: %v", strings.ToUpper(string(p.source)), p.offset, err)
+	}
+}
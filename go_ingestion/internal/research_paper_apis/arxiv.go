@@ -1,25 +1,27 @@
 package researchpaperapis
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"go_ingestion/db"
-	"io"
+	"go_ingestion/internal/paper"
 	"log"
 	"net/http"
 	"net/url"
 	"strings"
-
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 const baseURL = "https://export.arxiv.org/api/query?search_query=all:%s&start=%d&max_results=%d"
 
-func buildArxivURL(query string, start uint64, maxResults uint64) string {
+func buildArxivURL(query string, window *DateWindow, start uint64, maxResults uint64) string {
 	q := url.QueryEscape(query) // e.g. "machine learning" → "machine+learning"
+	if window != nil {
+		q += url.QueryEscape(arxivDateFilter(window))
+	}
 	return fmt.Sprintf(baseURL, q, start, maxResults)
 }
 
@@ -47,116 +49,180 @@ func GetPDFLink(entry ArxivEntry) string {
 	return ""
 }
 
-func MakeArivAPICALL(ctx context.Context, query string, start, maxResults uint64) (Feed, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, buildArxivURL(query, start, maxResults), nil)
+// arxivPDFCandidates returns every PDF link of the entry, arxiv sometimes lists a versioned one too.
+func arxivPDFCandidates(entry ArxivEntry) []db.PDFCandidate {
+	var candidates []db.PDFCandidate
+	for _, l := range entry.Link {
+		if l.Type == "application/pdf" || l.Title == "pdf" {
+			candidates = append(candidates, db.NewPDFCandidate(l.Href, db.PDFArxiv))
+		}
+	}
+	return candidates
+}
+
+func MakeArivAPICALL(ctx context.Context, doer Doer, query string, window *DateWindow, start, maxResults uint64) (Feed, error) {
+	body, err := getArxivPage(ctx, doer, query, window, start, maxResults)
 	if err != nil {
-		return Feed{}, fmt.Errorf("failed to create arxiv request: %w", err)
+		return Feed{}, err
 	}
+	defer putBuffer(body)
 
-	res, err := http.DefaultClient.Do(req)
+	return parseArxivFeed(body.Bytes())
+}
+
+// getArxivPage returns the raw response in a pooled buffer, putBuffer it once decoded.
+func getArxivPage(ctx context.Context, doer Doer, query string, window *DateWindow, start, maxResults uint64) (*bytes.Buffer, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, buildArxivURL(query, window, start, maxResults), nil)
 	if err != nil {
-		return Feed{}, fmt.Errorf("arxiv GET request failed: %w", err)
+		return nil, fmt.Errorf("failed to create arxiv request: %w", err)
+	}
+
+	res, err := doerOrDefault(doer).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("arxiv GET request failed: %w", err)
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		return Feed{}, fmt.Errorf("arxiv returned non-200 status: %s", res.Status)
+		return nil, newStatusError("arxiv", res)
 	}
 
-	body, err := io.ReadAll(res.Body)
+	body, err := readBody(res.Body)
 	if err != nil {
 		log.Printf("Failed to read response body: %v\n", err)
-		return Feed{}, err
+		return nil, err
 	}
+	return body, nil
+}
 
+func parseArxivFeed(data []byte) (Feed, error) {
 	var feed Feed
-	if err := xml.Unmarshal(body, &feed); err != nil {
+	if err := xml.Unmarshal(data, &feed); err != nil {
 		log.Printf("Failed to parse XML: %v\n", err)
 		return Feed{}, err
 	}
-
 	return feed, nil
 }
 
-func InsertArxivEntryToDB(ctx context.Context, dbPool *pgxpool.Pool, query string, start, maxResults uint64) error {
-	feed, err := MakeArivAPICALL(ctx, query, start, maxResults)
+func init() {
+	Register(arxivProvider{})
+}
+
+type arxivProvider struct{}
+
+func (arxivProvider) Info() ProviderInfo {
+	return ProviderInfo{Source: db.Arxiv, Tag: "ARXIV"}
+}
+
+func (arxivProvider) Total(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow) (uint64, error) {
+	feed, err := MakeArivAPICALL(ctx, doer, query, window, 0, 1)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	return feed.TotalResults, nil
+}
+
+func (arxivProvider) Pager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) Pager {
+	return NewArxivPager(query, window, offset, total, limit, opts)
+}
+
+func (arxivProvider) Remap(raw []byte, query string) (paper.Paper, error) {
+	var entry ArxivEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return paper.Paper{}, fmt.Errorf("failed to decode arxiv payload: %w", err)
 	}
+	return getPaperFromArxivEntry(&entry, query)
+}
 
-	for _, entry := range feed.Entries {
-		researchPaper, err := getResearchPaperFromArxivEntry(&entry, query)
+// NewArxivPager pages arxiv search results from offset until total.
+func NewArxivPager(query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) *OffsetPager {
+	return newOffsetPager(db.Arxiv, opts, offset, total, limit, func(ctx context.Context, offset, limit uint64, page *pageState) ([]db.ResearchPaper, error) {
+		body, done, err := page.body(ctx, buildArxivURL(query, window, offset, limit), func() (*bytes.Buffer, error) {
+			return getArxivPage(ctx, opts.Doer, query, window, offset, limit)
+		})
 		if err != nil {
-			log.Printf("[ARXIV] skipping entry id=%s: %v", entry.ID, err)
-			continue
+			return nil, err
 		}
+		defer done()
 
-		if strings.TrimSpace(researchPaper.PDFURL) == "" {
-			log.Printf("[ARXIV] skipping paperId=%s: empty PDF URL", entry.ID)
-			continue
+		feed, err := parseArxivFeed(body)
+		if err != nil {
+			return nil, err
 		}
 
-		if err := db.InsertIntoDb(ctx, dbPool, researchPaper); err != nil {
-			log.Printf("[DB] failed inserting arxiv paper id=%s title=%q: %v", entry.ID, researchPaper.Title, err)
-			continue
+		page.fetched(len(feed.Entries))
+		papers := make([]db.ResearchPaper, 0, len(feed.Entries))
+		for i := range feed.Entries {
+			entry := &feed.Entries[i]
+			// NOTE: the feed is XML, so arxiv templates see the decoded entry and its Go field names
+			researchPaper, ok := page.mapEntry(ctx, i, entry.ID, entry, entry, func() (paper.Paper, error) {
+				return getPaperFromArxivEntry(entry, query)
+			})
+			if ok {
+				papers = append(papers, researchPaper)
+			}
 		}
-	}
 
-	return nil
+		return papers, nil
+	})
+}
+
+// splitArxivVersion splits an arxiv source id into its abs url without version and the
+// version, see paper.SplitVersion.
+func splitArxivVersion(sourceID string) (string, int) {
+	return paper.SplitVersion(sourceID)
 }
 
-func getResearchPaperFromArxivEntry(entry *ArxivEntry, query string) (db.ResearchPaper, error) {
+func getPaperFromArxivEntry(entry *ArxivEntry, query string) (paper.Paper, error) {
 	if entry == nil {
-		return db.ResearchPaper{}, errors.New("nil entry")
+		return paper.Paper{}, errors.New("nil entry")
 	}
 
 	title := strings.TrimSpace(entry.Title)
 	if title == "" {
-		return db.ResearchPaper{}, errors.New("missing title in entry")
+		return paper.Paper{}, fmt.Errorf("%w in entry", errNoTitle)
 	}
 
+	// NOTE: without a PDF the paper is still returned when it has a DOI, the store queues it for lookup
+	doi := strings.TrimSpace(entry.ArxivDOI)
 	pdfURL := GetPDFLink(*entry)
-	if pdfURL == "" {
-		return db.ResearchPaper{}, fmt.Errorf("no pdf/url found for entry id=%s title=%s", entry.ID, title)
+	if pdfURL == "" && doi == "" {
+		return paper.Paper{}, fmt.Errorf("%w for entry id=%s title=%s", errNoPDF, entry.ID, title)
 	}
 
-	var sourceID *string
-	if s := strings.TrimSpace(entry.ID); s != "" {
-		sourceID = &s
-	}
-
-	authors := make([]string, 0, len(entry.Author))
+	authors := make([]paper.Author, 0, len(entry.Author))
 	for _, author := range entry.Author {
-		name := strings.TrimSpace(author.Name)
-		authors = append(authors, name)
-	}
-
-	authorsJSON, err := json.Marshal(authors)
-	if err != nil {
-		return db.ResearchPaper{}, fmt.Errorf("failed to marshal authors: %w", err)
-	}
-
-	// Metadata: marshal the whole entry for raw payload (useful later)
-	metadataJSON, err := json.Marshal(entry)
-	if err != nil {
-		return db.ResearchPaper{}, fmt.Errorf("failed to marshal metadata: %w", err)
-	}
-
-	var doiPtr *string
-	if d := strings.TrimSpace(entry.ArxivDOI); d != "" {
-		doiPtr = &d
-	}
-
-	paper := db.ResearchPaper{
-		Source:   db.Arxiv,
-		SourceID: sourceID,
-		Title:    title,
-		PDFURL:   pdfURL,
-		DOI:      doiPtr,
-		Authors:  &authorsJSON,
-		Metadata: &metadataJSON,
-		Topic:    query,
-	}
-
-	return paper, nil
+		authors = append(authors, paper.Author{Name: strings.TrimSpace(author.Name)})
+	}
+
+	terms := make([]string, 0, len(entry.Categories))
+	for _, c := range entry.Categories {
+		terms = append(terms, c.Term)
+	}
+	categories := paper.NormalizeCategories(entry.ArxivPrimaryCategory.Term, terms)
+
+	topics := make([]string, 0, len(categories))
+	for _, c := range categories {
+		topics = append(topics, c.Term)
+	}
+
+	// NOTE: arxiv reports no citations, publication types or language
+	return paper.Paper{
+		Source:     db.Arxiv,
+		SourceID:   entry.ID,
+		Title:      title,
+		PDFURL:     pdfURL,
+		DOI:        doi,
+		Authors:    authors,
+		Published:  paper.ParseDate(entry.Published),
+		Query:      query,
+		Topics:     topics,
+		Categories: categories,
+		Abstract:   strings.TrimSpace(entry.Summary),
+		Venue:      strings.TrimSpace(entry.ArxivJournalRef),
+		// Metadata: marshal the whole entry for raw payload (useful later)
+		Raw:           entry,
+		PDFCandidates: arxivPDFCandidates(*entry),
+		Identifiers:   map[string]string{paper.SchemeArxiv: entry.ID},
+	}, nil
 }
@@ -0,0 +1,115 @@
+package researchpaperapis
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+)
+
+// NOTE: the benchmarks cover the per-page hot path without network or database, decoding
+// each source's response and mapping it into research papers. `make bench` writes them in
+// benchstat format
+
+func BenchmarkArxivDecode(b *testing.B) {
+	data := mustFixture("fixtures/arxiv.xml")
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for range b.N {
+		var feed Feed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkArxivMap(b *testing.B) {
+	var feed Feed
+	if err := xml.Unmarshal(mustFixture("fixtures/arxiv.xml"), &feed); err != nil {
+		b.Fatal(err)
+	}
+	bufs := newPaperBuffers()
+	defer bufs.release()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		for i := range feed.Entries {
+			p, err := getPaperFromArxivEntry(&feed.Entries[i], "bench")
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := p.Row(bufs.encode); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkSemanticDecode(b *testing.B) {
+	data := mustFixture("fixtures/semantic.json")
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for range b.N {
+		var resp SemanticSearchResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSemanticMap(b *testing.B) {
+	var resp SemanticSearchResponse
+	if err := json.Unmarshal(mustFixture("fixtures/semantic.json"), &resp); err != nil {
+		b.Fatal(err)
+	}
+	bufs := newPaperBuffers()
+	defer bufs.release()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		for _, p := range resp.Data {
+			mapped, err := getPaperFromSemantic(p, "bench")
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := mapped.Row(bufs.encode); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkSpringerDecode(b *testing.B) {
+	data := mustFixture("fixtures/springer.json")
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := parseSpringerResponse(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSpringerMap(b *testing.B) {
+	resp, err := parseSpringerResponse(mustFixture("fixtures/springer.json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	bufs := newPaperBuffers()
+	defer bufs.release()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		for _, rec := range resp.Records {
+			p, err := getPaperFromSpringerNature(rec, "bench")
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := p.Row(bufs.encode); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package researchpaperapis
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// NOTE: bigger buffers are dropped instead of pooled so one huge page doesn't pin memory forever
+const maxPooledBufferSize = 4 << 20
+
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// readBody reads r into a pooled buffer, putBuffer it once the bytes are decoded.
+func readBody(r io.Reader) (*bytes.Buffer, error) {
+	buf := getBuffer()
+	if _, err := buf.ReadFrom(r); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// paperBuffers holds the authors/metadata JSON of one entry of a page. Pagers reuse it
+// for the same entry of the next page, which is safe because PaperStore.Save doesn't
+// keep the bytes after it returns.
+type paperBuffers struct {
+	authors  *bytes.Buffer
+	metadata *bytes.Buffer
+}
+
+func newPaperBuffers() *paperBuffers {
+	return &paperBuffers{authors: getBuffer(), metadata: getBuffer()}
+}
+
+func (b *paperBuffers) release() {
+	putBuffer(b.authors)
+	putBuffer(b.metadata)
+	b.authors, b.metadata = nil, nil
+}
+
+// encode overwrites the previous entry's JSON, the returned slices are valid until the next call.
+func (b *paperBuffers) encode(authors, metadata any) (*[]byte, *[]byte, error) {
+	authorsJSON, err := encodeInto(b.authors, authors)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadataJSON, err := encodeInto(b.metadata, metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &authorsJSON, &metadataJSON, nil
+}
+
+func encodeInto(buf *bytes.Buffer, v any) ([]byte, error) {
+	buf.Reset()
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
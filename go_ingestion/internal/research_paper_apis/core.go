@@ -0,0 +1,275 @@
+package researchpaperapis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/filter"
+	"go_ingestion/internal/paper"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const coreBaseURL = "https://api.core.ac.uk/v3/search/works"
+
+const (
+	// coreMaxResults is as deep as core pages by offset, deeper needs its scroll ids
+	coreMaxResults = 10000
+	// coreMaxPerPage is the largest page core serves
+	coreMaxPerPage = 100
+)
+
+// buildCoreURL asks for the page of limit works that starts at offset.
+//
+// NOTE: core filters by publication year only, so every window of a year gets the papers
+// of the whole year, the duplicates are dropped when stored
+func buildCoreURL(query string, window *DateWindow, limit, offset uint64) string {
+	if window != nil {
+		query = fmt.Sprintf("(%s) AND yearPublished>=%d AND yearPublished<=%d", query, window.From.Year(), window.To.Year())
+	}
+
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("limit", strconv.FormatUint(limit, 10))
+	params.Set("offset", strconv.FormatUint(offset, 10))
+	return coreBaseURL + "?" + params.Encode()
+}
+
+func parseCoreResponse(data []byte) (CoreResponse, error) {
+	var resp CoreResponse
+	err := json.Unmarshal(data, &resp)
+	return resp, err
+}
+
+// getCorePage returns the raw response in a pooled buffer, putBuffer it once decoded. The
+// api key goes in a header, so it never ends up in the url.
+func getCorePage(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow, limit, offset uint64) (*bytes.Buffer, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, buildCoreURL(query, window, limit, offset), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create core request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	res, err := doerOrDefault(doer).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, newStatusError("core", res)
+	}
+	return readBody(res.Body)
+}
+
+func init() {
+	Register(coreProvider{})
+}
+
+type coreProvider struct{}
+
+func (coreProvider) Info() ProviderInfo {
+	return ProviderInfo{Source: db.Core, Tag: "CORE", KeyEnv: "CORE_API_KEY", KeyRequired: true}
+}
+
+func (coreProvider) Total(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow) (uint64, error) {
+	body, err := getCorePage(ctx, doer, apiKey, query, window, 1, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer putBuffer(body)
+
+	resp, err := parseCoreResponse(body.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return resp.TotalHits, nil
+}
+
+func (coreProvider) Pager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) Pager {
+	return NewCorePager(apiKey, query, window, offset, total, limit, opts)
+}
+
+func (coreProvider) Remap(raw []byte, query string) (paper.Paper, error) {
+	var w CoreWork
+	if err := json.Unmarshal(raw, &w); err != nil {
+		return paper.Paper{}, fmt.Errorf("failed to decode core payload: %w", err)
+	}
+	return getPaperFromCore(w, query)
+}
+
+// NewCorePager pages core works search results from offset until total, at most until
+// coreMaxResults.
+func NewCorePager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) *OffsetPager {
+	total = min(total, coreMaxResults)
+	return newOffsetPager(db.Core, opts, offset, total, min(limit, coreMaxPerPage), func(ctx context.Context, offset, limit uint64, page *pageState) ([]db.ResearchPaper, error) {
+		body, done, err := page.body(ctx, buildCoreURL(query, window, limit, offset), func() (*bytes.Buffer, error) {
+			return getCorePage(ctx, opts.Doer, apiKey, query, window, limit, offset)
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+
+		resp, err := parseCoreResponse(body)
+		if err != nil {
+			return nil, err
+		}
+
+		page.fetched(len(resp.Results))
+		records := page.records(body, "results")
+		papers := make([]db.ResearchPaper, 0, len(resp.Results))
+		for i, work := range resp.Results {
+			researchPaper, ok := page.mapEntry(ctx, i, work.ID.String(), work, entryAt(records, i), func() (paper.Paper, error) {
+				return getPaperFromCore(work, query)
+			})
+			if ok {
+				papers = append(papers, researchPaper)
+			}
+		}
+
+		return papers, nil
+	})
+}
+
+// CorePDFCandidates are the full texts core has of a work, its own cached copy first and
+// then the download links of the repositories it harvested the work from.
+func CorePDFCandidates(w CoreWork) []db.PDFCandidate {
+	urls := []string{w.DownloadURL}
+	for _, l := range w.Links {
+		if l.Type == "download" {
+			urls = append(urls, l.URL)
+		}
+	}
+	for _, u := range w.SourceFulltextURLs {
+		// NOTE: the others are mostly landing pages
+		if strings.Contains(strings.ToLower(u), ".pdf") {
+			urls = append(urls, u)
+		}
+	}
+
+	var candidates []db.PDFCandidate
+	seen := map[string]bool{}
+	for _, u := range urls {
+		if u = strings.TrimSpace(u); u == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		candidates = append(candidates, db.NewPDFCandidate(u, db.PDFRepository))
+	}
+	return candidates
+}
+
+func coreIdentifiers(w CoreWork) map[string]string {
+	ids := map[string]string{paper.SchemeCore: w.ID.String()}
+	for scheme, value := range map[string]string{paper.SchemeArxiv: w.ArxivID, paper.SchemePMID: w.PubmedID, paper.SchemeMAG: w.MagID} {
+		if value = strings.TrimSpace(value); value != "" {
+			ids[scheme] = value
+		}
+	}
+	return ids
+}
+
+// NOTE: works without a full text are returned when they have a DOI, the store queues them
+// for the resolver
+func getPaperFromCore(w CoreWork, query string) (paper.Paper, error) {
+	title := strings.TrimSpace(w.Title)
+	if title == "" {
+		return paper.Paper{}, fmt.Errorf("%w in core work", errNoTitle)
+	}
+	id := w.ID.String()
+	if id == "" {
+		return paper.Paper{}, fmt.Errorf("core work %q has no id", title)
+	}
+
+	doi := strings.ToLower(strings.TrimSpace(w.DOI))
+	candidates := CorePDFCandidates(w)
+	if len(candidates) == 0 && doi == "" {
+		return paper.Paper{}, fmt.Errorf("%w for core work id=%s title=%s", errNoPDF, id, title)
+	}
+	var pdfURL string
+	if len(candidates) > 0 {
+		pdfURL = candidates[0].URL
+	}
+
+	authors := make([]paper.Author, 0, len(w.Authors))
+	for _, a := range w.Authors {
+		if name := strings.TrimSpace(a.Name); name != "" {
+			authors = append(authors, paper.Author{Name: name})
+		}
+	}
+
+	var venue string
+	for _, j := range w.Journals {
+		if venue = strings.TrimSpace(j.Title); venue != "" {
+			break
+		}
+	}
+	var lang string
+	if w.Language != nil {
+		lang = w.Language.Code
+	}
+	var subjects, types []string
+	if f := strings.TrimSpace(w.FieldOfStudy); f != "" {
+		subjects = []string{f}
+	}
+	if t := strings.TrimSpace(w.DocumentType); t != "" {
+		types = []string{t}
+	}
+
+	published, err := time.Parse("2006-01-02T15:04:05", w.PublishedDate)
+	if err != nil {
+		published = paper.ParseDate(w.PublishedDate)
+	}
+	citations := w.CitationCount
+	return paper.Paper{
+		Source:    db.Core,
+		SourceID:  id,
+		Title:     title,
+		PDFURL:    pdfURL,
+		DOI:       doi,
+		Authors:   authors,
+		Published: published,
+		Query:     query,
+		Topics:    subjects,
+		Subjects:  subjects,
+		Abstract:  strings.TrimSpace(w.Abstract),
+		Venue:     venue,
+		Attributes: filter.Attributes{
+			PublicationTypes: types,
+			FieldsOfStudy:    subjects,
+			CitationCount:    &citations,
+			Year:             w.YearPublished,
+			Language:         lang,
+		},
+		Raw:           w,
+		PDFCandidates: candidates,
+		Identifiers:   coreIdentifiers(w),
+	}, nil
+}
+
+// FindCoreWork looks up the work core has with doi, the first one with a full text when it
+// has several. It reports false when core has none.
+func FindCoreWork(ctx context.Context, doer Doer, apiKey, doi string) (CoreWork, bool, error) {
+	body, err := getCorePage(ctx, doer, apiKey, fmt.Sprintf("doi:%q", doi), nil, 10, 0)
+	if err != nil {
+		return CoreWork{}, false, err
+	}
+	defer putBuffer(body)
+
+	resp, err := parseCoreResponse(body.Bytes())
+	if err != nil {
+		return CoreWork{}, false, fmt.Errorf("failed to decode core response: %w", err)
+	}
+	for _, w := range resp.Results {
+		if len(CorePDFCandidates(w)) > 0 {
+			return w, true, nil
+		}
+	}
+	return CoreWork{}, false, nil
+}
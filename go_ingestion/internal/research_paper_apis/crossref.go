@@ -0,0 +1,265 @@
+package researchpaperapis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/filter"
+	"go_ingestion/internal/license"
+	"go_ingestion/internal/paper"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const crossrefBaseURL = "https://api.crossref.org/works"
+
+// crossrefMaxOffset is as deep as crossref pages with offsets, deeper needs its cursors
+const crossrefMaxOffset = 10000
+
+func buildCrossrefURL(query, mailto string, window *DateWindow, limit, offset uint64) string {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("rows", strconv.FormatUint(limit, 10))
+	params.Set("offset", strconv.FormatUint(offset, 10))
+	if window != nil {
+		params.Set("filter", crossrefDateFilter(window))
+	}
+	if mailto != "" {
+		params.Set("mailto", mailto)
+	}
+	return crossrefBaseURL + "?" + params.Encode()
+}
+
+func parseCrossrefResponse(data []byte) (CrossrefResponse, error) {
+	var resp CrossrefResponse
+	err := json.Unmarshal(data, &resp)
+	return resp, err
+}
+
+// getCrossrefPage returns the raw response in a pooled buffer, putBuffer it once decoded.
+// A Plus token is sent when the project has one, crossref works without it.
+func getCrossrefPage(ctx context.Context, doer Doer, token, mailto, query string, window *DateWindow, limit, offset uint64) (*bytes.Buffer, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, buildCrossrefURL(query, mailto, window, limit, offset), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create crossref request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Crossref-Plus-API-Token", "Bearer "+token)
+	}
+
+	res, err := doerOrDefault(doer).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, newStatusError("crossref", res)
+	}
+	return readBody(res.Body)
+}
+
+func init() {
+	Register(crossrefProvider{})
+}
+
+type crossrefProvider struct{}
+
+func (crossrefProvider) Info() ProviderInfo {
+	return ProviderInfo{Source: db.Crossref, Tag: "CROSSREF", KeyEnv: "CROSSREF_PLUS_API_TOKEN"}
+}
+
+func (crossrefProvider) Total(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow) (uint64, error) {
+	body, err := getCrossrefPage(ctx, doer, apiKey, "", query, window, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer putBuffer(body)
+
+	resp, err := parseCrossrefResponse(body.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return resp.Message.TotalResults, nil
+}
+
+func (crossrefProvider) Pager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) Pager {
+	return NewCrossrefPager(apiKey, query, window, offset, total, limit, opts)
+}
+
+func (crossrefProvider) Remap(raw []byte, query string) (paper.Paper, error) {
+	var w CrossrefWork
+	if err := json.Unmarshal(raw, &w); err != nil {
+		return paper.Paper{}, fmt.Errorf("failed to decode crossref payload: %w", err)
+	}
+	return getPaperFromCrossref(w, query)
+}
+
+// NewCrossrefPager pages crossref works search results from offset until total, at most
+// until crossrefMaxOffset.
+func NewCrossrefPager(token, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) *OffsetPager {
+	total = min(total, crossrefMaxOffset)
+	return newOffsetPager(db.Crossref, opts, offset, total, limit, func(ctx context.Context, offset, limit uint64, page *pageState) ([]db.ResearchPaper, error) {
+		// NOTE: mailto is left out of the cache key
+		body, done, err := page.body(ctx, buildCrossrefURL(query, "", window, limit, offset), func() (*bytes.Buffer, error) {
+			return getCrossrefPage(ctx, opts.Doer, token, opts.Mailto, query, window, limit, offset)
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+
+		resp, err := parseCrossrefResponse(body)
+		if err != nil {
+			return nil, err
+		}
+
+		items := resp.Message.Items
+		page.fetched(len(items))
+		records := page.records(body, "message", "items")
+		papers := make([]db.ResearchPaper, 0, len(items))
+		for i, work := range items {
+			researchPaper, ok := page.mapEntry(ctx, i, work.DOI, work, entryAt(records, i), func() (paper.Paper, error) {
+				return getPaperFromCrossref(work, query)
+			})
+			if ok {
+				papers = append(papers, researchPaper)
+			}
+		}
+
+		return papers, nil
+	})
+}
+
+// crossref filters on the publication date, days inclusive
+func crossrefDateFilter(w *DateWindow) string {
+	return "from-pub-date:" + w.From.Format(time.DateOnly) + ",until-pub-date:" + w.To.Format(time.DateOnly)
+}
+
+// Time returns the date crossref reports, the zero time when it reports none.
+func (d CrossrefDate) Time() time.Time {
+	if len(d.DateParts) == 0 || len(d.DateParts[0]) == 0 || d.DateParts[0][0] == 0 {
+		return time.Time{}
+	}
+	parts := append(d.DateParts[0], 1, 1)
+	return time.Date(parts[0], time.Month(max(parts[1], 1)), max(parts[2], 1), 0, 0, 0, 0, time.UTC)
+}
+
+// crossrefPDFCandidates are the links served as PDF, those meant for text mining first
+// since they're usually the full text rather than a landing page.
+func crossrefPDFCandidates(w CrossrefWork) []db.PDFCandidate {
+	var mining, other []db.PDFCandidate
+	for _, l := range w.Link {
+		if !strings.EqualFold(l.ContentType, "application/pdf") || strings.TrimSpace(l.URL) == "" {
+			continue
+		}
+		candidate := db.NewPDFCandidate(l.URL, db.PDFPublisher)
+		if l.IntendedApplication == "text-mining" {
+			mining = append(mining, candidate)
+		} else {
+			other = append(other, candidate)
+		}
+	}
+	return append(mining, other...)
+}
+
+// crossrefLicense returns the license of the version of record, else the first one, and
+// whether it only starts applying in the future.
+func crossrefLicense(w CrossrefWork) (string, bool) {
+	if len(w.License) == 0 {
+		return "", false
+	}
+	l := w.License[0]
+	for _, candidate := range w.License {
+		if candidate.ContentVersion == "vor" {
+			l = candidate
+			break
+		}
+	}
+	start := l.Start.Time()
+	return license.Normalize(l.URL), !start.IsZero() && start.After(time.Now())
+}
+
+func crossrefAuthors(w CrossrefWork) []paper.Author {
+	authors := make([]paper.Author, 0, len(w.Author))
+	for _, a := range w.Author {
+		name := strings.TrimSpace(a.Name)
+		if name == "" {
+			name = strings.TrimSpace(a.Given + " " + a.Family)
+		}
+		if name != "" {
+			authors = append(authors, paper.Author{Name: name})
+		}
+	}
+	return authors
+}
+
+func firstNonEmpty(values []string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// NOTE: every crossref work has a DOI, works without a PDF link are queued for the
+// resolver, see PaperStore.Save
+func getPaperFromCrossref(w CrossrefWork, query string) (paper.Paper, error) {
+	title := firstNonEmpty(w.Title)
+	if title == "" {
+		return paper.Paper{}, fmt.Errorf("%w in crossref work", errNoTitle)
+	}
+	doi := strings.ToLower(strings.TrimSpace(w.DOI))
+	if doi == "" {
+		return paper.Paper{}, fmt.Errorf("%w for crossref work %q", errNoPDF, title)
+	}
+
+	candidates := crossrefPDFCandidates(w)
+	var pdfURL string
+	if len(candidates) > 0 {
+		pdfURL = candidates[0].URL
+	}
+
+	var conference string
+	if w.Event != nil {
+		conference = strings.TrimSpace(w.Event.Name)
+	}
+	venue := firstNonEmpty(w.ContainerTitle)
+	if venue == "" {
+		venue = conference
+	}
+
+	published := w.Issued.Time()
+	citations := w.IsReferencedByCount
+	lic, embargoed := crossrefLicense(w)
+	return paper.Paper{
+		Source:     db.Crossref,
+		SourceID:   doi,
+		Title:      title,
+		PDFURL:     pdfURL,
+		DOI:        doi,
+		Authors:    crossrefAuthors(w),
+		Published:  published,
+		Query:      query,
+		Topics:     w.Subject,
+		Subjects:   w.Subject,
+		Abstract:   w.Abstract,
+		Venue:      venue,
+		Conference: conference,
+		License:    lic,
+		Embargoed:  embargoed,
+		Attributes: filter.Attributes{
+			PublicationTypes: []string{w.Type},
+			CitationCount:    &citations,
+			Language:         strings.TrimSpace(w.Language),
+		},
+		Raw:           w,
+		PDFCandidates: candidates,
+	}, nil
+}
@@ -0,0 +1,249 @@
+package researchpaperapis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/filter"
+	"go_ingestion/internal/license"
+	"go_ingestion/internal/paper"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dblpBaseURL = "https://dblp.org/search/publ/api"
+
+const (
+	// dblpMaxResults is as deep as dblp pages a search
+	dblpMaxResults = 10000
+	// dblpMaxPerPage is the largest page dblp serves
+	dblpMaxPerPage = 1000
+)
+
+// buildDBLPURL asks for the page of limit records that starts at offset.
+//
+// NOTE: dblp filters by publication year only, so every window of a year gets the papers
+// of the whole year, the duplicates are dropped when stored
+func buildDBLPURL(query string, window *DateWindow, limit, offset uint64) string {
+	if window != nil {
+		years := make([]string, 0, window.To.Year()-window.From.Year()+1)
+		for y := window.From.Year(); y <= window.To.Year(); y++ {
+			years = append(years, fmt.Sprintf("year:%d:", y))
+		}
+		query += " " + strings.Join(years, "|")
+	}
+
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("format", "json")
+	params.Set("h", strconv.FormatUint(limit, 10))
+	params.Set("f", strconv.FormatUint(offset, 10))
+	return dblpBaseURL + "?" + params.Encode()
+}
+
+func parseDBLPResponse(data []byte) (DBLPResponse, error) {
+	var resp DBLPResponse
+	err := json.Unmarshal(data, &resp)
+	return resp, err
+}
+
+// getDBLPPage returns the raw response in a pooled buffer, putBuffer it once decoded.
+func getDBLPPage(ctx context.Context, doer Doer, query string, window *DateWindow, limit, offset uint64) (*bytes.Buffer, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, buildDBLPURL(query, window, limit, offset), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dblp request: %w", err)
+	}
+
+	res, err := doerOrDefault(doer).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, newStatusError("dblp", res)
+	}
+	return readBody(res.Body)
+}
+
+func init() {
+	Register(dblpProvider{})
+}
+
+type dblpProvider struct{}
+
+func (dblpProvider) Info() ProviderInfo {
+	return ProviderInfo{Source: db.DBLP, Tag: "DBLP"}
+}
+
+func (dblpProvider) Total(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow) (uint64, error) {
+	body, err := getDBLPPage(ctx, doer, query, window, 1, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer putBuffer(body)
+
+	resp, err := parseDBLPResponse(body.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(resp.Result.Hits.Total.String(), 10, 64)
+}
+
+func (dblpProvider) Pager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) Pager {
+	return NewDBLPPager(query, window, offset, total, limit, opts)
+}
+
+func (dblpProvider) Remap(raw []byte, query string) (paper.Paper, error) {
+	var hit DBLPHit
+	if err := json.Unmarshal(raw, &hit); err != nil {
+		return paper.Paper{}, fmt.Errorf("failed to decode dblp payload: %w", err)
+	}
+	return getPaperFromDBLP(hit, query)
+}
+
+// NewDBLPPager pages dblp publication search results from offset until total, at most until
+// dblpMaxResults.
+func NewDBLPPager(query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) *OffsetPager {
+	total = min(total, dblpMaxResults)
+	return newOffsetPager(db.DBLP, opts, offset, total, min(limit, dblpMaxPerPage), func(ctx context.Context, offset, limit uint64, page *pageState) ([]db.ResearchPaper, error) {
+		body, done, err := page.body(ctx, buildDBLPURL(query, window, limit, offset), func() (*bytes.Buffer, error) {
+			return getDBLPPage(ctx, opts.Doer, query, window, limit, offset)
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+
+		resp, err := parseDBLPResponse(body)
+		if err != nil {
+			return nil, err
+		}
+
+		hits := resp.Result.Hits.Hit
+		page.fetched(len(hits))
+		records := page.records(body, "result", "hits", "hit")
+		papers := make([]db.ResearchPaper, 0, len(hits))
+		for i, hit := range hits {
+			researchPaper, ok := page.mapEntry(ctx, i, hit.Info.Key, hit, entryAt(records, i), func() (paper.Paper, error) {
+				return getPaperFromDBLP(hit, query)
+			})
+			if ok {
+				papers = append(papers, researchPaper)
+			}
+		}
+
+		return papers, nil
+	})
+}
+
+// dblpHomonym is the number dblp appends to the names of different people with the same name
+var dblpHomonym = regexp.MustCompile(`\s+\d{4}$`)
+
+// dblpEditions splits the electronic editions into the PDFs among them, the DOI and the
+// arxiv id.
+func dblpEditions(info DBLPInfo) ([]db.PDFCandidate, string, string) {
+	var candidates []db.PDFCandidate
+	var arxiv string
+	doi := strings.ToLower(strings.TrimSpace(info.DOI))
+	for _, ee := range info.EE {
+		ee = strings.TrimSpace(ee)
+		u, err := url.Parse(ee)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		switch {
+		case host == "doi.org" || host == "dx.doi.org":
+			if doi == "" {
+				doi = strings.ToLower(strings.TrimPrefix(u.Path, "/"))
+			}
+		case host == "arxiv.org" && strings.HasPrefix(u.Path, "/abs/"):
+			arxiv = paper.NormalizeIdentifier(paper.SchemeArxiv, ee)
+			candidates = append(candidates, db.NewPDFCandidate("https://arxiv.org/pdf/"+arxiv, db.PDFArxiv))
+		case strings.HasSuffix(strings.ToLower(u.Path), ".pdf"):
+			candidates = append(candidates, db.NewPDFCandidate(ee, db.PDFPublisher))
+		}
+	}
+	return candidates, doi, arxiv
+}
+
+// NOTE: dblp links the electronic editions, not the PDFs, records without an arxiv or PDF
+// link are returned when they have a DOI, the store queues them for the resolver
+func getPaperFromDBLP(hit DBLPHit, query string) (paper.Paper, error) {
+	info := hit.Info
+	title := strings.TrimSuffix(strings.TrimSpace(info.Title), ".")
+	if title == "" {
+		return paper.Paper{}, fmt.Errorf("%w in dblp record", errNoTitle)
+	}
+	if info.Key == "" {
+		return paper.Paper{}, fmt.Errorf("dblp record %q has no key", title)
+	}
+
+	candidates, doi, arxiv := dblpEditions(info)
+	if len(candidates) == 0 && doi == "" {
+		return paper.Paper{}, fmt.Errorf("%w for dblp record key=%s", errNoPDF, info.Key)
+	}
+	var pdfURL string
+	if len(candidates) > 0 {
+		pdfURL = candidates[0].URL
+	}
+
+	authors := make([]paper.Author, 0, len(info.Authors.Author))
+	for _, a := range info.Authors.Author {
+		if name := dblpHomonym.ReplaceAllString(strings.TrimSpace(a.Text), ""); name != "" {
+			authors = append(authors, paper.Author{Name: name})
+		}
+	}
+
+	venue := strings.TrimSpace(strings.Join(info.Venue, ", "))
+	var conference string
+	if info.Type == "Conference and Workshop Papers" {
+		conference = venue
+	}
+	var types []string
+	if t := strings.TrimSpace(info.Type); t != "" {
+		types = []string{t}
+	}
+	var lic string
+	if info.Access == "open" {
+		lic = license.OAUnspecified
+	}
+
+	year, _ := strconv.Atoi(info.Year)
+	var published time.Time
+	if year > 0 {
+		published = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	ids := map[string]string{paper.SchemeDBLP: info.Key}
+	if arxiv != "" {
+		ids[paper.SchemeArxiv] = arxiv
+	}
+	return paper.Paper{
+		Source:     db.DBLP,
+		SourceID:   info.Key,
+		Title:      title,
+		PDFURL:     pdfURL,
+		DOI:        doi,
+		Authors:    authors,
+		Published:  published,
+		Query:      query,
+		Venue:      venue,
+		Conference: conference,
+		License:    lic,
+		Attributes: filter.Attributes{
+			PublicationTypes: types,
+			ContentType:      strings.TrimSpace(info.Type),
+			Year:             year,
+		},
+		Raw:           hit,
+		PDFCandidates: candidates,
+		Identifiers:   ids,
+	}, nil
+}
@@ -0,0 +1,47 @@
+package researchpaperapis
+
+import (
+	"io"
+	"net/http"
+)
+
+// Doer sends the upstream requests, *http.Client satisfies it. Replace it to serve
+// recorded fixtures or to add tracing without touching the sources.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// doerOrDefault returns d, http.DefaultClient without one, with its network failures
+// classified, see transient.
+func doerOrDefault(d Doer) Doer {
+	if d == nil {
+		d = http.DefaultClient
+	}
+	return transientDoer{d}
+}
+
+type transientDoer struct {
+	Doer
+}
+
+func (d transientDoer) Do(req *http.Request) (*http.Response, error) {
+	res, err := d.Doer.Do(req)
+	if err != nil {
+		return nil, transient(err)
+	}
+	// NOTE: a connection dropped while the body is read fails the decoding, not Do
+	res.Body = transientBody{res.Body}
+	return res, nil
+}
+
+type transientBody struct {
+	io.ReadCloser
+}
+
+func (b transientBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = transient(err)
+	}
+	return n, err
+}
@@ -0,0 +1,56 @@
+package researchpaperapis
+
+import (
+	"fmt"
+	"go_ingestion/db"
+	"io"
+	"sync"
+)
+
+const dryRunSamples = 5
+
+// DryRunReport keeps a few of the papers a PaperStore in dry-run mode would have
+// inserted, the counts are in the store's RunStats.
+type DryRunReport struct {
+	mu      sync.Mutex
+	Samples []DryRunSample
+}
+
+// DryRunSample is a copy of the fields worth eyeballing, the paper's own bytes are reused by the source.
+type DryRunSample struct {
+	Source  db.PaperSource
+	Title   string
+	DOI     string
+	PDFURL  string
+	License string
+}
+
+func NewDryRunReport() *DryRunReport {
+	return &DryRunReport{}
+}
+
+func (r *DryRunReport) sample(paper db.ResearchPaper) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.Samples) < dryRunSamples {
+		r.Samples = append(r.Samples, DryRunSample{
+			Source:  paper.Source,
+			Title:   paper.Title,
+			DOI:     nullable(paper.DOI),
+			PDFURL:  paper.PDFURL,
+			License: nullable(paper.License),
+		})
+	}
+}
+
+// Print writes the counts of stats followed by the sample rows.
+func (r *DryRunReport) Print(w io.Writer, stats *RunStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats.Print(w)
+	for i, s := range r.Samples {
+		fmt.Fprintf(w, "\n#%d [%s] %s\n   doi=%s license=%s\n   pdf=%s\n", i+1, s.Source, s.Title, s.DOI, s.License, s.PDFURL)
+	}
+}
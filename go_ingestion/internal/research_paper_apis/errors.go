@@ -0,0 +1,130 @@
+package researchpaperapis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// What a StatusError means for the request, match them with errors.Is. Requests that didn't
+// get an answer are ErrTransient when the failure may pass, see transient.
+var (
+	// ErrRateLimited is a 429, the source wants fewer requests
+	ErrRateLimited = errors.New("rate limited")
+	// ErrAuth is a 401 or 403, the api key is missing, invalid or lacks access. Retrying
+	// doesn't help, nor does the next page
+	ErrAuth     = errors.New("api key rejected")
+	ErrNotFound = errors.New("not found")
+	// ErrTransient is a timeout, dropped connection or server error that may pass on its own
+	ErrTransient = errors.New("transient failure")
+)
+
+// transient wraps err into ErrTransient when the request failed for a reason that may pass
+// on its own: a timeout, a refused, reset or dropped connection, a failed DNS lookup. A
+// cancelled request, a bad url or certificate are left as they are.
+func transient(err error) error {
+	if err == nil || errors.Is(err, ErrTransient) || !isTransient(err) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrTransient, err)
+}
+
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	// NOTE: the client's Timeout ends a request with DeadlineExceeded, a connection deadline
+	// with os.ErrDeadlineExceeded
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	for _, errno := range []syscall.Errno{syscall.ECONNREFUSED, syscall.ECONNRESET, syscall.ECONNABORTED, syscall.EPIPE, syscall.ETIMEDOUT, syscall.EHOSTUNREACH, syscall.ENETUNREACH} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	// NOTE: the server closed the connection before or while answering
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// StatusError is a non-200 answer from a source, kept typed so retry policies can decide on the status code.
+type StatusError struct {
+	Source     string
+	StatusCode int
+	Status     string
+	// RetryAfter is how long the source asked to wait before the next request, 0 when it didn't
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned non-200 status: %s", e.Source, e.Status)
+}
+
+// Unwrap is the class of the status, nil for statuses that are none of them (e.g. 400).
+func (e *StatusError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuth
+	case http.StatusNotFound, http.StatusGone:
+		return ErrNotFound
+	case http.StatusRequestTimeout, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrTransient
+	}
+	return nil
+}
+
+func newStatusError(source string, res *http.Response) *StatusError {
+	return &StatusError{Source: source, StatusCode: res.StatusCode, Status: res.Status, RetryAfter: retryAfter(res.Header, time.Now())}
+}
+
+// retryAfter reads a Retry-After header, given in seconds or as a date.
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+// StatusCode returns the HTTP status behind err, 0 when it didn't come from a response.
+func StatusCode(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+// RetryAfter returns the wait the source asked for with err, 0 when it didn't ask.
+func RetryAfter(err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.RetryAfter
+	}
+	return 0
+}
@@ -0,0 +1,124 @@
+package researchpaperapis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// timeoutError is a net.Error that timed out, like a dial or read deadline.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestTransient(t *testing.T) {
+	get := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://example.org", Err: err}
+	}
+	dial := func(err error) error {
+		return get(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", err)})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection refused", dial(syscall.ECONNREFUSED), true},
+		{"connection reset", get(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), true},
+		{"network unreachable", dial(syscall.ENETUNREACH), true},
+		{"net.Error timeout", get(&net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}), true},
+		{"client timeout", get(context.DeadlineExceeded), true},
+		{"connection deadline", get(os.ErrDeadlineExceeded), true},
+		{"closed before answering", get(io.EOF), true},
+		{"body cut short", io.ErrUnexpectedEOF, true},
+		{"dns timeout", get(&net.DNSError{Err: "timeout", Name: "example.org", IsTimeout: true}), true},
+		{"unknown host", get(&net.DNSError{Err: "no such host", Name: "example.org", IsNotFound: true}), false},
+		{"cancelled", get(context.Canceled), false},
+		{"bad json", &json.SyntaxError{Offset: 1}, false},
+		{"bad status", &StatusError{Source: "arxiv", StatusCode: http.StatusBadRequest, Status: "400 Bad Request"}, false},
+		{"already transient", &StatusError{Source: "arxiv", StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := transient(tt.err)
+			if got := errors.Is(err, ErrTransient); got != tt.want {
+				t.Errorf("transient(%v) is ErrTransient: %t, want %t", tt.err, got, tt.want)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("transient(%v) = %v, lost the cause", tt.err, err)
+			}
+		})
+	}
+	if transient(nil) != nil {
+		t.Error("transient(nil) isn't nil")
+	}
+}
+
+// NOTE: real connections, so the errors are what net/http returns and not made up ones
+func TestDoerTransient(t *testing.T) {
+	hang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer hang.Close()
+
+	cut := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte(`{"data": [`))
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer cut.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL := closed.URL
+	closed.Close()
+
+	get := func(t *testing.T, client *http.Client, url string) error {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := doerOrDefault(client).Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		_, err = readBody(res.Body)
+		return err
+	}
+
+	tests := []struct {
+		name   string
+		client *http.Client
+		url    string
+	}{
+		{"client timeout", &http.Client{Timeout: 50 * time.Millisecond}, hang.URL},
+		{"connection refused", &http.Client{}, closedURL},
+		{"body cut short", &http.Client{}, cut.URL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := get(t, tt.client, tt.url)
+			if !errors.Is(err, ErrTransient) {
+				t.Errorf("got %v, want ErrTransient", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package researchpaperapis
+
+import "embed"
+
+// NOTE: recorded upstream payloads, read by the parser tests and benchmarks and served by
+// the mock sources of testsupport
+//
+//go:embed fixtures
+var fixtures embed.FS
+
+// Fixture returns one of the recorded payloads, e.g. "fixtures/arxiv.xml".
+func Fixture(name string) ([]byte, error) {
+	return fixtures.ReadFile(name)
+}
+
+func mustFixture(name string) []byte {
+	data, err := Fixture(name)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
@@ -0,0 +1,242 @@
+package researchpaperapis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/filter"
+	"go_ingestion/internal/license"
+	"go_ingestion/internal/paper"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ieeeBaseURL = "https://ieeexploreapi.ieee.org/api/v1/search/articles"
+
+// ieeeMaxPerPage is the largest page ieee xplore serves
+const ieeeMaxPerPage = 200
+
+// buildIEEEURL asks for the page of limit articles that starts at offset, ieee counts
+// records from 1.
+//
+// NOTE: ieee filters by publication year only, so every window of a year gets the papers
+// of the whole year, the duplicates are dropped when stored
+func buildIEEEURL(apiKey, query string, window *DateWindow, limit, offset uint64) string {
+	params := url.Values{}
+	params.Set("querytext", query)
+	params.Set("format", "json")
+	params.Set("max_records", strconv.FormatUint(limit, 10))
+	params.Set("start_record", strconv.FormatUint(offset+1, 10))
+	if window != nil {
+		params.Set("start_year", strconv.Itoa(window.From.Year()))
+		params.Set("end_year", strconv.Itoa(window.To.Year()))
+	}
+	params.Set("apikey", apiKey)
+	return ieeeBaseURL + "?" + params.Encode()
+}
+
+func parseIEEEResponse(data []byte) (IEEEResponse, error) {
+	var resp IEEEResponse
+	err := json.Unmarshal(data, &resp)
+	return resp, err
+}
+
+// getIEEEPage returns the raw response in a pooled buffer, putBuffer it once decoded.
+func getIEEEPage(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow, limit, offset uint64) (*bytes.Buffer, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, buildIEEEURL(apiKey, query, window, limit, offset), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ieee request: %w", err)
+	}
+
+	res, err := doerOrDefault(doer).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, newStatusError("ieee", res)
+	}
+	return readBody(res.Body)
+}
+
+func init() {
+	Register(ieeeProvider{})
+}
+
+type ieeeProvider struct{}
+
+func (ieeeProvider) Info() ProviderInfo {
+	return ProviderInfo{Source: db.IEEE, Tag: "IEEE", KeyEnv: "IEEE_XPLORE_APIKEY", KeyRequired: true}
+}
+
+func (ieeeProvider) Total(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow) (uint64, error) {
+	body, err := getIEEEPage(ctx, doer, apiKey, query, window, 1, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer putBuffer(body)
+
+	resp, err := parseIEEEResponse(body.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return resp.TotalRecords, nil
+}
+
+func (ieeeProvider) Pager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) Pager {
+	return NewIEEEPager(apiKey, query, window, offset, total, limit, opts)
+}
+
+func (ieeeProvider) Remap(raw []byte, query string) (paper.Paper, error) {
+	var article IEEEArticle
+	if err := json.Unmarshal(raw, &article); err != nil {
+		return paper.Paper{}, fmt.Errorf("failed to decode ieee payload: %w", err)
+	}
+	return getPaperFromIEEE(article, query)
+}
+
+// NewIEEEPager pages ieee xplore search results from offset until total.
+func NewIEEEPager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) *OffsetPager {
+	return newOffsetPager(db.IEEE, opts, offset, total, min(limit, ieeeMaxPerPage), func(ctx context.Context, offset, limit uint64, page *pageState) ([]db.ResearchPaper, error) {
+		// NOTE: the api key is left out of the cache key
+		body, done, err := page.body(ctx, buildIEEEURL("", query, window, limit, offset), func() (*bytes.Buffer, error) {
+			return getIEEEPage(ctx, opts.Doer, apiKey, query, window, limit, offset)
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+
+		resp, err := parseIEEEResponse(body)
+		if err != nil {
+			return nil, err
+		}
+
+		page.fetched(len(resp.Articles))
+		records := page.records(body, "articles")
+		papers := make([]db.ResearchPaper, 0, len(resp.Articles))
+		for i, article := range resp.Articles {
+			researchPaper, ok := page.mapEntry(ctx, i, article.ArticleNumber.String(), article, entryAt(records, i), func() (paper.Paper, error) {
+				return getPaperFromIEEE(article, query)
+			})
+			if ok {
+				papers = append(papers, researchPaper)
+			}
+		}
+
+		return papers, nil
+	})
+}
+
+var (
+	ieeeYear  = regexp.MustCompile(`\b(\d{4})\b`)
+	ieeeMonth = regexp.MustCompile(`\b([A-Za-z]{3})[A-Za-z]*\.?\s+\d{4}\b`)
+)
+
+// ieeeDate reads publication dates such as "2-5 Dec. 2020" or "March 2021" to their month,
+// the day is dropped since conferences give a range.
+func ieeeDate(s string, year int) time.Time {
+	if m := ieeeYear.FindAllStringSubmatch(s, -1); len(m) > 0 {
+		year, _ = strconv.Atoi(m[len(m)-1][1])
+	}
+	if year == 0 {
+		return time.Time{}
+	}
+	month := time.January
+	if m := ieeeMonth.FindStringSubmatch(s); m != nil {
+		if t, err := time.Parse("Jan", strings.ToUpper(m[1][:1])+strings.ToLower(m[1][1:])); err == nil {
+			month = t.Month()
+		}
+	}
+	return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func ieeeTerms(terms []string) []string {
+	var kept []string
+	for _, t := range terms {
+		if t = strings.TrimSpace(t); t != "" && !slices.ContainsFunc(kept, func(v string) bool { return strings.EqualFold(v, t) }) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// NOTE: locked articles keep their PDF link, which is behind the paywall, and are only
+// returned with a DOI so the resolver looks for an open copy, like closed springer records
+func getPaperFromIEEE(a IEEEArticle, query string) (paper.Paper, error) {
+	title := strings.TrimSpace(a.Title)
+	if title == "" {
+		return paper.Paper{}, fmt.Errorf("%w in ieee article", errNoTitle)
+	}
+	id := a.ArticleNumber.String()
+	if id == "" {
+		return paper.Paper{}, fmt.Errorf("ieee article %q has no article number", title)
+	}
+
+	doi := strings.ToLower(strings.TrimSpace(a.DOI))
+	pdfURL := strings.TrimSpace(a.PDFURL)
+	openAccess := a.AccessType == "OPEN_ACCESS"
+	if (pdfURL == "" || !openAccess) && doi == "" {
+		return paper.Paper{}, fmt.Errorf("%w for ieee article article_number=%s", errNoPDF, id)
+	}
+	var candidates []db.PDFCandidate
+	if pdfURL != "" {
+		candidates = append(candidates, db.NewPDFCandidate(pdfURL, db.PDFPublisher))
+	}
+
+	authors := make([]paper.Author, 0, len(a.Authors.Authors))
+	for _, author := range a.Authors.Authors {
+		if name := strings.TrimSpace(author.FullName); name != "" {
+			authors = append(authors, paper.Author{Name: name})
+		}
+	}
+
+	venue := strings.TrimSpace(a.PublicationTitle)
+	var conference string
+	if a.ContentType == "Conferences" {
+		conference = venue
+	}
+	var lic string
+	if openAccess {
+		lic = license.OAUnspecified
+	}
+
+	year, _ := strconv.Atoi(a.PublicationYear.String())
+	citations := a.CitingPaperCount
+	// NOTE: the ieee terms are a controlled vocabulary, the author terms free keywords
+	subjects := ieeeTerms(a.IndexTerms.IEEETerms.Terms)
+	return paper.Paper{
+		Source:     db.IEEE,
+		SourceID:   id,
+		Title:      title,
+		PDFURL:     pdfURL,
+		DOI:        doi,
+		Authors:    authors,
+		Published:  ieeeDate(a.PublicationDate, year),
+		Query:      query,
+		Topics:     subjects,
+		Subjects:   subjects,
+		Keywords:   ieeeTerms(a.IndexTerms.AuthorTerms.Terms),
+		Abstract:   strings.TrimSpace(a.Abstract),
+		Venue:      venue,
+		Conference: conference,
+		License:    lic,
+		Embargoed:  !openAccess,
+		Attributes: filter.Attributes{
+			PublicationTypes: []string{a.ContentType},
+			ContentType:      strings.TrimSpace(a.ContentType),
+			CitationCount:    &citations,
+			Year:             year,
+		},
+		Raw:           a,
+		PDFCandidates: candidates,
+	}, nil
+}
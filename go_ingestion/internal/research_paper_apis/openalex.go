@@ -0,0 +1,306 @@
+package researchpaperapis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/filter"
+	"go_ingestion/internal/license"
+	"go_ingestion/internal/paper"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const openAlexBaseURL = "https://api.openalex.org/works"
+
+const (
+	// openAlexMaxResults is as deep as openalex pages by page number, deeper needs its cursors
+	openAlexMaxResults = 10000
+	// openAlexMaxPerPage is the largest page openalex serves
+	openAlexMaxPerPage = 200
+)
+
+// buildOpenAlexURL asks for the page of limit works that starts at offset, which must be
+// a multiple of limit since openalex pages by number.
+func buildOpenAlexURL(apiKey, query, mailto string, window *DateWindow, limit, offset uint64) string {
+	params := url.Values{}
+	params.Set("search", query)
+	params.Set("per-page", strconv.FormatUint(max(limit, 1), 10))
+	params.Set("page", strconv.FormatUint(offset/max(limit, 1)+1, 10))
+	if window != nil {
+		params.Set("filter", "from_publication_date:"+window.From.Format(time.DateOnly)+",to_publication_date:"+window.To.Format(time.DateOnly))
+	}
+	if mailto != "" {
+		params.Set("mailto", mailto)
+	}
+	if apiKey != "" {
+		params.Set("api_key", apiKey)
+	}
+	return openAlexBaseURL + "?" + params.Encode()
+}
+
+func parseOpenAlexResponse(data []byte) (OpenAlexResponse, error) {
+	var resp OpenAlexResponse
+	err := json.Unmarshal(data, &resp)
+	return resp, err
+}
+
+// getOpenAlexPage returns the raw response in a pooled buffer, putBuffer it once decoded.
+// openalex works without a key, a premium key only raises the limits.
+func getOpenAlexPage(ctx context.Context, doer Doer, apiKey, mailto, query string, window *DateWindow, limit, offset uint64) (*bytes.Buffer, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, buildOpenAlexURL(apiKey, query, mailto, window, limit, offset), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create openalex request: %w", err)
+	}
+
+	res, err := doerOrDefault(doer).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, newStatusError("openalex", res)
+	}
+	return readBody(res.Body)
+}
+
+func init() {
+	Register(openAlexProvider{})
+}
+
+type openAlexProvider struct{}
+
+func (openAlexProvider) Info() ProviderInfo {
+	return ProviderInfo{Source: db.OpenAlex, Tag: "OPENALEX", KeyEnv: "OPENALEX_API_KEY"}
+}
+
+func (openAlexProvider) Total(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow) (uint64, error) {
+	body, err := getOpenAlexPage(ctx, doer, apiKey, "", query, window, 1, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer putBuffer(body)
+
+	resp, err := parseOpenAlexResponse(body.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return resp.Meta.Count, nil
+}
+
+func (openAlexProvider) Pager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) Pager {
+	return NewOpenAlexPager(apiKey, query, window, offset, total, limit, opts)
+}
+
+func (openAlexProvider) Remap(raw []byte, query string) (paper.Paper, error) {
+	var w OpenAlexWork
+	if err := json.Unmarshal(raw, &w); err != nil {
+		return paper.Paper{}, fmt.Errorf("failed to decode openalex payload: %w", err)
+	}
+	return getPaperFromOpenAlex(w, query)
+}
+
+// NewOpenAlexPager pages openalex works search results from offset until total, at most
+// until openAlexMaxResults.
+//
+// NOTE: pages are addressed by number, so the page size stays fixed instead of following
+// page_sizing and an offset that isn't on a page boundary is moved back to the last one,
+// the papers in between are already stored
+func NewOpenAlexPager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) *OffsetPager {
+	limit = min(max(limit, 1), openAlexMaxPerPage)
+	total = min(total, openAlexMaxResults)
+	p := newOffsetPager(db.OpenAlex, opts, offset-offset%limit, total, limit, func(ctx context.Context, offset, limit uint64, page *pageState) ([]db.ResearchPaper, error) {
+		// NOTE: the api key and mailto are left out of the cache key
+		body, done, err := page.body(ctx, buildOpenAlexURL("", query, "", window, limit, offset), func() (*bytes.Buffer, error) {
+			return getOpenAlexPage(ctx, opts.Doer, apiKey, opts.Mailto, query, window, limit, offset)
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+
+		resp, err := parseOpenAlexResponse(body)
+		if err != nil {
+			return nil, err
+		}
+
+		results := resp.Results
+		page.fetched(len(results))
+		records := page.records(body, "results")
+		papers := make([]db.ResearchPaper, 0, len(results))
+		for i, work := range results {
+			researchPaper, ok := page.mapEntry(ctx, i, openAlexID(work.ID), work, entryAt(records, i), func() (paper.Paper, error) {
+				return getPaperFromOpenAlex(work, query)
+			})
+			if ok {
+				papers = append(papers, researchPaper)
+			}
+		}
+
+		return papers, nil
+	})
+	p.sizer = nil
+	return p
+}
+
+// openAlexID strips the url from an openalex id, https://openalex.org/W123 is W123. PubMed
+// ids come as urls too.
+func openAlexID(id string) string {
+	id = strings.TrimSuffix(strings.TrimSpace(id), "/")
+	return id[strings.LastIndex(id, "/")+1:]
+}
+
+// openAlexAbstract puts the words of an inverted index back in order.
+func openAlexAbstract(index map[string][]int) string {
+	type word struct {
+		text string
+		pos  int
+	}
+	var words []word
+	for text, positions := range index {
+		for _, pos := range positions {
+			words = append(words, word{text, pos})
+		}
+	}
+	sort.Slice(words, func(i, j int) bool { return words[i].pos < words[j].pos })
+
+	var b strings.Builder
+	for i, w := range words {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(w.text)
+	}
+	return b.String()
+}
+
+// openAlexPDFCandidates are the PDFs of the open access locations, the best one first.
+func openAlexPDFCandidates(w OpenAlexWork) []db.PDFCandidate {
+	var locations []OpenAlexLocation
+	if w.BestOALocation != nil {
+		locations = append(locations, *w.BestOALocation)
+	}
+	locations = append(locations, w.Locations...)
+
+	var candidates []db.PDFCandidate
+	seen := map[string]bool{}
+	for _, l := range locations {
+		pdfURL := strings.TrimSpace(l.PDFURL)
+		if pdfURL == "" || seen[pdfURL] {
+			continue
+		}
+		seen[pdfURL] = true
+
+		kind := db.PDFPublisher
+		if l.Source != nil && l.Source.Type == "repository" {
+			kind = db.PDFRepository
+		}
+		candidates = append(candidates, db.NewPDFCandidate(pdfURL, kind))
+	}
+	return candidates
+}
+
+// openAlexIdentifiers keeps the openalex id and the external ids but the DOI, which has its
+// own column.
+func openAlexIdentifiers(w OpenAlexWork) map[string]string {
+	ids := map[string]string{paper.SchemeOpenAlex: openAlexID(w.ID)}
+	for scheme, value := range w.IDs {
+		if scheme == "doi" || scheme == "openalex" {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			ids[scheme] = openAlexID(v)
+		case float64:
+			ids[scheme] = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return ids
+}
+
+func openAlexNames(topics []OpenAlexTopic) []string {
+	names := make([]string, 0, len(topics))
+	for _, t := range topics {
+		if name := strings.TrimSpace(t.DisplayName); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// NOTE: closed works have no PDF, those with a DOI are queued for the resolver, see
+// PaperStore.Save
+func getPaperFromOpenAlex(w OpenAlexWork, query string) (paper.Paper, error) {
+	title := strings.TrimSpace(w.Title)
+	if title == "" {
+		title = strings.TrimSpace(w.DisplayName)
+	}
+	if title == "" {
+		return paper.Paper{}, fmt.Errorf("%w in openalex work", errNoTitle)
+	}
+	id := openAlexID(w.ID)
+	if id == "" {
+		return paper.Paper{}, fmt.Errorf("openalex work %q has no id", title)
+	}
+
+	candidates := openAlexPDFCandidates(w)
+	var pdfURL string
+	if len(candidates) > 0 {
+		pdfURL = candidates[0].URL
+	}
+
+	authors := make([]paper.Author, 0, len(w.Authorships))
+	for _, a := range w.Authorships {
+		if name := strings.TrimSpace(a.Author.DisplayName); name != "" {
+			authors = append(authors, paper.Author{Name: name})
+		}
+	}
+
+	var venue, conference, lic string
+	if l := w.PrimaryLocation; l != nil && l.Source != nil {
+		venue = strings.TrimSpace(l.Source.DisplayName)
+		if l.Source.Type == "conference" {
+			conference = venue
+		}
+	}
+	if w.BestOALocation != nil {
+		lic = license.Normalize(w.BestOALocation.License)
+	}
+
+	published, _ := time.Parse(time.DateOnly, w.PublicationDate)
+	citations := w.CitedByCount
+	topics := openAlexNames(w.Topics)
+	return paper.Paper{
+		Source:     db.OpenAlex,
+		SourceID:   id,
+		Title:      title,
+		PDFURL:     pdfURL,
+		DOI:        strings.ToLower(strings.TrimPrefix(strings.TrimSpace(w.DOI), "https://doi.org/")),
+		Authors:    authors,
+		Published:  published,
+		Query:      query,
+		Topics:     topics,
+		Subjects:   topics,
+		Abstract:   openAlexAbstract(w.AbstractInvertedIndex),
+		Venue:      venue,
+		Conference: conference,
+		License:    lic,
+		Keywords:   openAlexNames(w.Keywords),
+		Attributes: filter.Attributes{
+			PublicationTypes: []string{w.Type},
+			CitationCount:    &citations,
+			Year:             w.PublicationYear,
+			Language:         strings.TrimSpace(w.Language),
+		},
+		Raw:           w,
+		PDFCandidates: candidates,
+		Identifiers:   openAlexIdentifiers(w),
+	}, nil
+}
@@ -0,0 +1,326 @@
+package researchpaperapis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"go_ingestion/internal/cache"
+	"go_ingestion/internal/mapping"
+	"go_ingestion/internal/paper"
+	"log"
+	"math"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Pager walks a source's results one page at a time. The papers of a page are valid
+// until the next NextPage call, their JSON buffers are reused for the page after.
+type Pager interface {
+	NextPage(ctx context.Context) (papers []db.ResearchPaper, done bool, err error)
+}
+
+// PageSkipper is implemented by pagers that can move past a page which keeps failing.
+type PageSkipper interface {
+	SkipPage()
+}
+
+// Positioner reports where a pager is, for logging.
+type Positioner interface {
+	Position() string
+}
+
+type fetchOffsetFunc func(ctx context.Context, offset, limit uint64, page *pageState) ([]db.ResearchPaper, error)
+
+// UnknownTotal pages an OffsetPager until the source returns an empty page, for when
+// asking the source for its total isn't worth a request.
+const UnknownTotal = math.MaxUint64
+
+// OffsetPager pages sources addressed by offset/limit until a known total. With a page
+// sizer the limit changes between pages, see PageSizer.
+type OffsetPager struct {
+	Offset uint64
+	Total  uint64
+	Limit  uint64
+
+	fetch fetchOffsetFunc
+	page  pageState
+	sizer *PageSizer
+}
+
+func newOffsetPager(source db.PaperSource, opts PagerOptions, offset, total, limit uint64, fetch fetchOffsetFunc) *OffsetPager {
+	return &OffsetPager{Offset: offset, Total: total, Limit: limit, fetch: fetch, page: pageState{source: source, opts: opts}, sizer: opts.PageSizers[source]}
+}
+
+func (p *OffsetPager) NextPage(ctx context.Context) ([]db.ResearchPaper, bool, error) {
+	if p.Offset >= p.Total {
+		return nil, true, nil
+	}
+
+	start := time.Now()
+	papers, err := p.fetchPage(ctx)
+	limit := p.sizer.observe(p.Limit, time.Since(start), err)
+	if err != nil {
+		p.Limit = limit
+		return nil, false, err
+	}
+
+	if p.Total == UnknownTotal && p.page.last == 0 {
+		return papers, true, nil
+	}
+
+	// NOTE: the next limit only applies once the offset moved past this page
+	p.Offset += p.Limit
+	p.Limit = limit
+	return papers, p.Offset >= p.Total, nil
+}
+
+func (p *OffsetPager) fetchPage(ctx context.Context) (papers []db.ResearchPaper, err error) {
+	defer recoverPage(p.page.source, &err)
+	p.page.offset, p.page.limit = p.Offset, p.Limit
+	return p.fetch(ctx, p.Offset, p.Limit, &p.page)
+}
+
+func (p *OffsetPager) SkipPage() {
+	p.Offset += p.Limit
+}
+
+func (p *OffsetPager) Position() string {
+	return fmt.Sprintf("offset=%d", p.Offset)
+}
+
+// fetchTokenFunc fetches the page at token ("" for the first one) and returns the token
+// of the next page, "" when there is none.
+type fetchTokenFunc func(ctx context.Context, token string, page *pageState) ([]db.ResearchPaper, string, error)
+
+// TokenPager pages sources that hand out a cursor or resumption token with every page.
+// A failed page can't be skipped since its token is the only way forward.
+type TokenPager struct {
+	Token string
+
+	fetch   fetchTokenFunc
+	page    pageState
+	started bool
+}
+
+// newTokenPager starts at token, "" for the first page.
+func newTokenPager(source db.PaperSource, opts PagerOptions, token string, fetch fetchTokenFunc) *TokenPager {
+	return &TokenPager{Token: token, fetch: fetch, started: token != "", page: pageState{source: source, opts: opts}}
+}
+
+func (p *TokenPager) NextPage(ctx context.Context) ([]db.ResearchPaper, bool, error) {
+	if p.started && p.Token == "" {
+		return nil, true, nil
+	}
+
+	papers, next, err := p.fetchPage(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	p.Token, p.started = next, true
+	return papers, next == "", nil
+}
+
+func (p *TokenPager) fetchPage(ctx context.Context) (papers []db.ResearchPaper, next string, err error) {
+	defer recoverPage(p.page.source, &err)
+	return p.fetch(ctx, p.Token, &p.page)
+}
+
+func (p *TokenPager) Position() string {
+	return "token=" + p.Token
+}
+
+// recoverPage turns a panic while fetching or decoding a page into a failed page, so upstream
+// schema drift costs the page (retried, then skipped) instead of the whole run.
+func recoverPage(source db.PaperSource, err *error) {
+	if r := recover(); r != nil {
+		log.Printf("[%s] page panicked: %v\n%s", strings.ToUpper(string(source)), r, debug.Stack())
+		*err = fmt.Errorf("%s page panicked: %v", source, r)
+	}
+}
+
+// PagerOptions are shared by every pager of a run, all of them are optional.
+type PagerOptions struct {
+	Stats *RunStats
+	// Cache keeps raw pages for CacheTTL, keyed by request URL without API keys
+	Cache    cache.Cache
+	CacheTTL time.Duration
+	// Doer sends the page requests, nil uses http.DefaultClient
+	Doer Doer
+	// Mappings override mapped fields per source, see config.Mappings
+	Mappings mapping.Set
+	// PageSizers adapt the page size of offset pagers per source, nil keeps the limit fixed
+	PageSizers map[db.PaperSource]*PageSizer
+	// Quarantine skips records that keep failing to map
+	Quarantine *Quarantine
+	// Validation rejects mapped records that are obviously broken, the zero value none
+	Validation config.Validation
+	// Volumes handles springer records of whole volumes, the zero value keeps them
+	Volumes Volumes
+	// Mailto identifies us to crossref and openalex so page requests go to their polite pools,
+	// and to NCBI for pubmed
+	Mailto string
+	// Archive keeps every page fetched upstream, so mappers can be re-run over old pages
+	Archive PageArchive
+
+	// query and window are what NewPager was asked for, archived pages are filed under them
+	query  string
+	window *DateWindow
+}
+
+// pageState is what a pager hands its fetch function: one paperBuffers per entry of a
+// page, reused by the next page, and the run stats to count fetched and skipped entries in.
+type pageState struct {
+	source db.PaperSource
+	opts   PagerOptions
+	slots  []*paperBuffers
+	// last is how many entries the last page had before mapping
+	last int
+	// offset and limit are the request of the page being fetched
+	offset uint64
+	limit  uint64
+}
+
+// body returns the page at key from the cache, or gets, archives and caches it. done must
+// be called once the bytes are decoded.
+func (p *pageState) body(ctx context.Context, key string, get func() (*bytes.Buffer, error)) ([]byte, func(), error) {
+	cacheKey := "page:" + key
+	if p.opts.Cache != nil {
+		cached, ok, err := p.opts.Cache.Get(ctx, cacheKey)
+		if err != nil {
+			log.Printf("[CACHE] %v", err)
+		}
+		if ok {
+			return cached, func() {}, nil
+		}
+	}
+
+	buf, err := get()
+	if err != nil {
+		return nil, nil, err
+	}
+	p.archive(ctx, key, buf.Bytes())
+
+	if p.opts.Cache != nil {
+		if err := p.opts.Cache.Set(ctx, cacheKey, bytes.Clone(buf.Bytes()), p.opts.CacheTTL); err != nil {
+			log.Printf("[CACHE] %v", err)
+		}
+	}
+	return buf.Bytes(), func() { putBuffer(buf) }, nil
+}
+
+func (p *pageState) slot(i int) *paperBuffers {
+	for len(p.slots) <= i {
+		p.slots = append(p.slots, newPaperBuffers())
+	}
+	return p.slots[i]
+}
+
+// records decodes the entries under path (keys of nested objects) of a JSON page without
+// a schema when the source has a field mapping, so its templates reach fields the typed
+// response drops. Entries line up with the typed ones, nil when there is no mapping or the
+// page doesn't decode.
+func (p *pageState) records(body []byte, path ...string) []map[string]any {
+	if p.opts.Mappings.For(p.source) == nil {
+		return nil
+	}
+
+	// NOTE: only the objects on the path are decoded, their other fields may be of any type
+	raw := json.RawMessage(body)
+	for _, key := range path {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &object); err != nil {
+			log.Printf("[MAPPING] %s page isn't decodable for mapping: %v", p.source, err)
+			return nil
+		}
+		raw = object[key]
+	}
+
+	var entries []map[string]any
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		log.Printf("[MAPPING] %s page isn't decodable for mapping: %v", p.source, err)
+		return nil
+	}
+	return entries
+}
+
+func entryAt(records []map[string]any, i int) map[string]any {
+	if i < len(records) {
+		return records[i]
+	}
+	return nil
+}
+
+// mapEntry turns entry i of a page into a row: mapper maps raw, the source's field mapping
+// sees record. A failing entry is skipped, parse errors, panics and invalid records also
+// count toward quarantining it so one poison record can't fail its page on every run.
+func (p *pageState) mapEntry(ctx context.Context, i int, sourceID string, raw, record any, mapper func() (paper.Paper, error)) (row db.ResearchPaper, ok bool) {
+	if p.opts.Quarantine.contains(ctx, p.source, sourceID) {
+		p.skip(SkipQuarantined)
+		return db.ResearchPaper{}, false
+	}
+
+	fail := func(reason SkipReason, err error) {
+		p.skip(reason)
+		log.Printf("[%s] skipping source_id=%s: %v", strings.ToUpper(string(p.source)), sourceID, err)
+		if reason == SkipParseError || reason == SkipInvalid {
+			p.opts.Quarantine.fail(ctx, p.source, sourceID, raw, err.Error())
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			fail(SkipParseError, fmt.Errorf("panic: %v", r))
+			row, ok = db.ResearchPaper{}, false
+		}
+	}()
+
+	mapped, err := mapper()
+	if err != nil {
+		fail(mappingSkipReason(err), err)
+		return db.ResearchPaper{}, false
+	}
+	if err := p.remap(&mapped, record); err != nil {
+		fail(SkipParseError, err)
+		return db.ResearchPaper{}, false
+	}
+	if reasons := mapped.Invalid(p.opts.Validation.For(string(p.source)), time.Now().Year()); len(reasons) > 0 {
+		fail(SkipInvalid, fmt.Errorf("invalid record: %s", strings.Join(reasons, "; ")))
+		return db.ResearchPaper{}, false
+	}
+
+	row, err = mapped.Row(p.slot(i).encode)
+	if err != nil {
+		fail(SkipParseError, err)
+		return db.ResearchPaper{}, false
+	}
+	return row, true
+}
+
+// remap applies the field mapping of the source to dst, record is what its templates see.
+func (p *pageState) remap(dst *paper.Paper, record any) error {
+	return p.opts.Mappings.For(p.source).Apply(dst, record)
+}
+
+func (p *pageState) fetched(n int) {
+	p.last = n
+	p.opts.Stats.fetched(p.source, n)
+}
+
+func (p *pageState) skip(reason SkipReason) {
+	p.opts.Stats.skip(p.source, reason, 1)
+}
+
+// NewPager returns the pager of source starting at offset, apiKey is ignored by sources
+// without one.
+func NewPager(source db.PaperSource, apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) (Pager, error) {
+	p, err := Lookup(source)
+	if err != nil {
+		return nil, err
+	}
+	opts.query, opts.window = query, window
+	return p.Pager(apiKey, query, window, offset, total, limit, opts), nil
+}
@@ -0,0 +1,99 @@
+package researchpaperapis
+
+import (
+	"context"
+	"errors"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// growAfter is how many fast pages in a row grow the page size
+const growAfter = 5
+
+// ewmaWeight is how much the latest page moves the error rate and latency averages
+const ewmaWeight = 0.2
+
+// PageSizer adapts the page size of a source to how it copes: a page that times out or
+// is rate limited halves the size, a streak of fast pages grows it by a quarter up to Max.
+// It is shared by every pager of the source in a run.
+type PageSizer struct {
+	Source db.PaperSource
+	Min    uint64
+	Max    uint64
+	// SlowAfter is the latency above which a page doesn't count toward growing
+	SlowAfter time.Duration
+
+	mu      sync.Mutex
+	streak  int
+	errRate float64
+	latency time.Duration
+}
+
+// NewPageSizers returns a sizer per source when cfg is adaptive, nil otherwise.
+func NewPageSizers(cfg config.PageSizing) map[db.PaperSource]*PageSizer {
+	if !cfg.Adaptive {
+		return nil
+	}
+
+	sizers := map[db.PaperSource]*PageSizer{}
+	for _, source := range Sources() {
+		sizers[source] = &PageSizer{Source: source, Min: max(cfg.Min, 1), Max: cfg.Max[string(source)], SlowAfter: cfg.SlowAfter}
+	}
+	return sizers
+}
+
+// observe records how a page of size current went and returns the size of the next page.
+func (s *PageSizer) observe(current uint64, latency time.Duration, err error) uint64 {
+	if s == nil {
+		return current
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failed := 0.0
+	if err != nil {
+		failed = 1
+	}
+	s.errRate += ewmaWeight * (failed - s.errRate)
+	s.latency += time.Duration(ewmaWeight * float64(latency-s.latency))
+
+	next := current
+	switch {
+	case err != nil && overloaded(err):
+		s.streak = 0
+		next = max(current/2, s.Min)
+	case err != nil || (s.SlowAfter > 0 && latency > s.SlowAfter):
+		s.streak = 0
+	default:
+		s.streak++
+		if s.streak >= growAfter {
+			s.streak = 0
+			next = current + max(current/4, 1)
+		}
+	}
+	if s.Max > 0 {
+		next = min(next, s.Max)
+	}
+
+	if next != current {
+		log.Printf("[PAGESIZE] %s %d -> %d (errors=%.0f%%, latency=%s)", s.Source, current, next, s.errRate*100, s.latency.Round(time.Millisecond))
+	}
+	return next
+}
+
+// overloaded reports whether err means the source wants smaller or fewer requests.
+func overloaded(err error) bool {
+	switch StatusCode(err) {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
@@ -0,0 +1,375 @@
+package researchpaperapis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"go_ingestion/db"
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// fixtureResponse is a recorded upstream answer.
+type fixtureResponse struct {
+	status int
+	body   []byte
+}
+
+// fixtureDoer answers requests by url path, the "" path answers every other one.
+type fixtureDoer map[string]fixtureResponse
+
+func (d fixtureDoer) Do(req *http.Request) (*http.Response, error) {
+	res, ok := d[req.URL.Path]
+	if !ok {
+		res = d[""]
+	}
+	return &http.Response{
+		StatusCode: res.status,
+		Status:     fmt.Sprintf("%d %s", res.status, http.StatusText(res.status)),
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewReader(res.body)),
+		Request:    req,
+	}, nil
+}
+
+// pubMedSearch is the esearch answer for the two articles of fixtures/pubmed.xml, the page
+// itself is their efetch.
+var pubMedSearch = fixtureResponse{http.StatusOK, []byte(`{"esearchresult": {"count": "2", "retmax": "2", "retstart": "0", "idlist": ["31501885", "19683066"]}}`)}
+
+// edit replaces old with new in the fixture name, failing the test when old isn't in it.
+func edit(t *testing.T, name, old, new string) []byte {
+	t.Helper()
+	data := mustFixture(name)
+	if !bytes.Contains(data, []byte(old)) {
+		t.Fatalf("%s doesn't contain %q", name, old)
+	}
+	return bytes.Replace(data, []byte(old), []byte(new), 1)
+}
+
+func TestPagerParsesFixtures(t *testing.T) {
+	tests := []struct {
+		name   string
+		source db.PaperSource
+		status int
+		body   func(t *testing.T) []byte
+		// titles are the mapped papers in order
+		titles  []string
+		skipped map[SkipReason]int
+		wantErr error
+		// failed is set when the page fails without one of the sentinels
+		failed bool
+	}{
+		{
+			name:   "arxiv",
+			source: db.Arxiv,
+			body:   func(t *testing.T) []byte { return mustFixture("fixtures/arxiv.xml") },
+			titles: []string{"BERT: Pre-training of Deep Bidirectional Transformers for Language Understanding", "Attention Is All You Need"},
+		},
+		{
+			name:   "arxiv entry without title",
+			source: db.Arxiv,
+			body: func(t *testing.T) []byte {
+				return edit(t, "fixtures/arxiv.xml", "<title>Attention Is All You Need</title>", "<title> </title>")
+			},
+			titles:  []string{"BERT: Pre-training of Deep Bidirectional Transformers for Language Understanding"},
+			skipped: map[SkipReason]int{SkipNoTitle: 1},
+		},
+		{
+			name:   "arxiv malformed feed",
+			source: db.Arxiv,
+			body:   func(t *testing.T) []byte { return mustFixture("fixtures/arxiv.xml")[:200] },
+			failed: true,
+		},
+		{
+			name:   "semantic scholar",
+			source: db.SemanticScholar,
+			body:   func(t *testing.T) []byte { return mustFixture("fixtures/semantic.json") },
+			titles: []string{"BERT: Pre-training of Deep Bidirectional Transformers for Language Understanding", "Attention is All you Need"},
+		},
+		{
+			name:   "semantic scholar paper without pdf",
+			source: db.SemanticScholar,
+			body: func(t *testing.T) []byte {
+				return edit(t, "fixtures/semantic.json", `"openAccessPdf": {"url": "https://arxiv.org/pdf/1706.03762", "status": "GREEN", "license": null, "disclaimer": null},`, `"openAccessPdf": null,`)
+			},
+			titles:  []string{"BERT: Pre-training of Deep Bidirectional Transformers for Language Understanding"},
+			skipped: map[SkipReason]int{SkipNoPDF: 1},
+		},
+		{
+			name:    "semantic scholar rate limited",
+			source:  db.SemanticScholar,
+			status:  http.StatusTooManyRequests,
+			body:    func(t *testing.T) []byte { return []byte(`{"message": "Too Many Requests"}`) },
+			wantErr: ErrRateLimited,
+		},
+		{
+			name:   "springer nature",
+			source: db.SpringerNature,
+			body:   func(t *testing.T) []byte { return mustFixture("fixtures/springer.json") },
+			titles: []string{"A survey on natural language processing for clinical text", "Tokenization Strategies for Low-Resource Languages"},
+		},
+		{
+			name:   "springer nature record without title",
+			source: db.SpringerNature,
+			body: func(t *testing.T) []byte {
+				return edit(t, "fixtures/springer.json", `"title": "Tokenization Strategies for Low-Resource Languages",`, `"title": "",`)
+			},
+			titles:  []string{"A survey on natural language processing for clinical text"},
+			skipped: map[SkipReason]int{SkipNoTitle: 1},
+		},
+		{
+			name:    "springer nature rejected key",
+			source:  db.SpringerNature,
+			status:  http.StatusUnauthorized,
+			body:    func(t *testing.T) []byte { return []byte(`{"error": "Invalid api key"}`) },
+			wantErr: ErrAuth,
+		},
+		{
+			name:    "springer nature unavailable",
+			source:  db.SpringerNature,
+			status:  http.StatusServiceUnavailable,
+			body:    func(t *testing.T) []byte { return nil },
+			wantErr: ErrTransient,
+		},
+		{
+			name:   "crossref",
+			source: db.Crossref,
+			body:   func(t *testing.T) []byte { return mustFixture("fixtures/crossref.json") },
+			titles: []string{"BERT: Pre-training of Deep Bidirectional Transformers for Language Understanding", "Natural language processing in clinical decision support"},
+		},
+		{
+			name:   "crossref work without doi",
+			source: db.Crossref,
+			body: func(t *testing.T) []byte {
+				return edit(t, "fixtures/crossref.json", `"DOI": "10.1016/j.jbi.2009.08.007",`, ``)
+			},
+			titles:  []string{"BERT: Pre-training of Deep Bidirectional Transformers for Language Understanding"},
+			skipped: map[SkipReason]int{SkipNoPDF: 1},
+		},
+		{
+			name:   "crossref truncated response",
+			source: db.Crossref,
+			body:   func(t *testing.T) []byte { return mustFixture("fixtures/crossref.json")[:300] },
+			failed: true,
+		},
+		{
+			name:   "openalex",
+			source: db.OpenAlex,
+			body:   func(t *testing.T) []byte { return mustFixture("fixtures/openalex.json") },
+			titles: []string{"BERT: Pre-training of Deep Bidirectional Transformers for Language Understanding", "Natural language processing in clinical decision support"},
+		},
+		{
+			name:   "openalex work without title",
+			source: db.OpenAlex,
+			body: func(t *testing.T) []byte {
+				data := edit(t, "fixtures/openalex.json", `"title": "Natural language processing in clinical decision support",`, `"title": null,`)
+				return bytes.Replace(data, []byte(`"display_name": "Natural language processing in clinical decision support",`), []byte(`"display_name": "",`), 1)
+			},
+			titles:  []string{"BERT: Pre-training of Deep Bidirectional Transformers for Language Understanding"},
+			skipped: map[SkipReason]int{SkipNoTitle: 1},
+		},
+		{
+			name:    "openalex rate limited",
+			source:  db.OpenAlex,
+			status:  http.StatusTooManyRequests,
+			body:    func(t *testing.T) []byte { return []byte(`{"error": "Rate limit exceeded"}`) },
+			wantErr: ErrRateLimited,
+		},
+		{
+			name:   "pubmed",
+			source: db.PubMed,
+			body:   func(t *testing.T) []byte { return mustFixture("fixtures/pubmed.xml") },
+			titles: []string{"BioBERT: a pre-trained biomedical language representation model for biomedical text mining.", "Natural language processing in clinical decision support."},
+		},
+		{
+			name:   "pubmed article without pmc copy or doi",
+			source: db.PubMed,
+			body: func(t *testing.T) []byte {
+				return edit(t, "fixtures/pubmed.xml", `<ArticleId IdType="doi">10.1016/j.jbi.2009.08.007</ArticleId>`, ``)
+			},
+			titles:  []string{"BioBERT: a pre-trained biomedical language representation model for biomedical text mining."},
+			skipped: map[SkipReason]int{SkipNoPDF: 1},
+		},
+		{
+			name:   "pubmed malformed efetch",
+			source: db.PubMed,
+			body:   func(t *testing.T) []byte { return mustFixture("fixtures/pubmed.xml")[:400] },
+			failed: true,
+		},
+		{
+			name:   "ieee xplore",
+			source: db.IEEE,
+			body:   func(t *testing.T) []byte { return mustFixture("fixtures/ieee.json") },
+			titles: []string{"Transformer-Based Acoustic Modeling for Hybrid Speech Recognition", "A Survey on Natural Language Processing for Open Access Publishing"},
+		},
+		{
+			name:   "ieee xplore locked article without doi",
+			source: db.IEEE,
+			body: func(t *testing.T) []byte {
+				return edit(t, "fixtures/ieee.json", `"doi": "10.1109/ICASSP40776.2020.9053458",`, `"doi": "",`)
+			},
+			titles:  []string{"A Survey on Natural Language Processing for Open Access Publishing"},
+			skipped: map[SkipReason]int{SkipNoPDF: 1},
+		},
+		{
+			name:    "ieee xplore rejected key",
+			source:  db.IEEE,
+			status:  http.StatusForbidden,
+			body:    func(t *testing.T) []byte { return []byte(`<h1>Developer Inactive</h1>`) },
+			wantErr: ErrAuth,
+		},
+		{
+			name:   "core",
+			source: db.Core,
+			body:   func(t *testing.T) []byte { return mustFixture("fixtures/core.json") },
+			titles: []string{"BERT: Pre-training of Deep Bidirectional Transformers for Language Understanding", "Natural language processing for under-resourced languages"},
+		},
+		{
+			name:   "core work without full text or doi",
+			source: db.Core,
+			body: func(t *testing.T) []byte {
+				return edit(t, "fixtures/core.json", `"sourceFulltextUrls": ["https://eprints.example.ac.uk/4411/1/thesis.pdf"],`, `"sourceFulltextUrls": [],`)
+			},
+			titles:  []string{"BERT: Pre-training of Deep Bidirectional Transformers for Language Understanding"},
+			skipped: map[SkipReason]int{SkipNoPDF: 1},
+		},
+		{
+			name:    "core unavailable",
+			source:  db.Core,
+			status:  http.StatusBadGateway,
+			body:    func(t *testing.T) []byte { return nil },
+			wantErr: ErrTransient,
+		},
+		{
+			name:   "dblp",
+			source: db.DBLP,
+			body:   func(t *testing.T) []byte { return mustFixture("fixtures/dblp.json") },
+			titles: []string{"BERT: Pre-training of Deep Bidirectional Transformers for Language Understanding", "Attention Is All You Need"},
+		},
+		{
+			name:   "dblp record without title",
+			source: db.DBLP,
+			body: func(t *testing.T) []byte {
+				return edit(t, "fixtures/dblp.json", `"title": "Attention Is All You Need.",`, `"title": "",`)
+			},
+			titles:  []string{"BERT: Pre-training of Deep Bidirectional Transformers for Language Understanding"},
+			skipped: map[SkipReason]int{SkipNoTitle: 1},
+		},
+		{
+			name:    "dblp rate limited",
+			source:  db.DBLP,
+			status:  http.StatusTooManyRequests,
+			body:    func(t *testing.T) []byte { return nil },
+			wantErr: ErrRateLimited,
+		},
+		{
+			name:   "acl anthology",
+			source: db.ACL,
+			body:   func(t *testing.T) []byte { return gzipped(t, mustFixture("fixtures/acl.bib")) },
+			titles: []string{"BERT: Pre-training of Deep Bidirectional Transformers for Language Understanding", "Transformers: State-of-the-Art Natural Language Processing"},
+		},
+		{
+			name:   "acl anthology entry without url",
+			source: db.ACL,
+			body: func(t *testing.T) []byte {
+				return gzipped(t, edit(t, "fixtures/acl.bib", `url = "https://aclanthology.org/2020.emnlp-demos.6/",`, ``))
+			},
+			titles:  []string{"BERT: Pre-training of Deep Bidirectional Transformers for Language Understanding"},
+			skipped: map[SkipReason]int{SkipNoPDF: 1},
+		},
+		{
+			name:    "acl anthology dump missing",
+			source:  db.ACL,
+			status:  http.StatusNotFound,
+			body:    func(t *testing.T) []byte { return nil },
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := tt.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			doer := fixtureDoer{"": {status, tt.body(t)}}
+			if tt.source == db.PubMed {
+				doer["/entrez/eutils/esearch.fcgi"] = pubMedSearch
+			}
+			// NOTE: acl searches a copy of its dump in the user cache, every case downloads
+			// its own
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+			stats := NewRunStats()
+			opts := PagerOptions{Stats: stats, Doer: doer}
+
+			pager, err := NewPager(tt.source, "key", "natural language processing", nil, 0, 2, 2, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			papers, _, err := pager.NextPage(context.Background())
+
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			case tt.failed:
+				if err == nil {
+					t.Fatal("page didn't fail")
+				}
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+
+			var titles []string
+			for _, p := range papers {
+				if p.Source != tt.source {
+					t.Errorf("%q mapped with source %s", p.Title, p.Source)
+				}
+				titles = append(titles, p.Title)
+			}
+			if !slices.Equal(titles, tt.titles) {
+				t.Errorf("titles = %q, want %q", titles, tt.titles)
+			}
+
+			got := stats.Snapshot()[tt.source]
+			if got.Fetched != len(tt.titles)+sum(tt.skipped) {
+				t.Errorf("fetched = %d, want %d", got.Fetched, len(tt.titles)+sum(tt.skipped))
+			}
+			for reason, n := range tt.skipped {
+				if got.Skipped[reason] != n {
+					t.Errorf("skipped %s = %d, want %d", reason, got.Skipped[reason], n)
+				}
+			}
+		})
+	}
+}
+
+// gzipped compresses data like the acl anthology serves its dump.
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sum(counts map[SkipReason]int) int {
+	n := 0
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
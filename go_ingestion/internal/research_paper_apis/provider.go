@@ -0,0 +1,110 @@
+package researchpaperapis
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/paper"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ProviderInfo describes an upstream source.
+type ProviderInfo struct {
+	Source db.PaperSource
+	// Tag prefixes the log lines of the source's workers
+	Tag string
+	// KeyEnv is the environment variable of the source's API key, "" for sources without
+	// one. Sources with KeyRequired aren't queried without a key.
+	KeyEnv      string
+	KeyRequired bool
+}
+
+// Provider is an upstream source of papers. Every source registers one from its own file,
+// the pipeline, the totals and the commands only go through the registry.
+//
+// NOTE: a new source also needs its value added to the paper_source enum, see db.PaperSource
+type Provider interface {
+	Info() ProviderInfo
+	// Total asks how many papers match query in window, doer may be nil
+	Total(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow) (uint64, error)
+	// Pager searches query page by page from offset until total
+	Pager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) Pager
+	// Remap maps a raw payload stored as metadata again, see Remap
+	Remap(raw []byte, query string) (paper.Paper, error)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[db.PaperSource]Provider{}
+)
+
+// Register adds the provider of a source, registering a source twice panics.
+func Register(p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	source := p.Info().Source
+	if _, ok := providers[source]; ok {
+		panic(fmt.Sprintf("provider of %s registered twice", source))
+	}
+	providers[source] = p
+}
+
+// Lookup returns the provider of source.
+func Lookup(source db.PaperSource) (Provider, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	p, ok := providers[source]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q", source)
+	}
+	return p, nil
+}
+
+// Sources returns the registered sources by name.
+func Sources() []db.PaperSource {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	sources := make([]db.PaperSource, 0, len(providers))
+	for source := range providers {
+		sources = append(sources, source)
+	}
+	slices.Sort(sources)
+	return sources
+}
+
+// Providers returns the registered providers in the order of Sources.
+func Providers() []Provider {
+	sources := Sources()
+
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	list := make([]Provider, len(sources))
+	for i, source := range sources {
+		list[i] = providers[source]
+	}
+	return list
+}
+
+// AllSources is the comma separated list of every registered source.
+func AllSources() string {
+	names := make([]string, 0)
+	for _, source := range Sources() {
+		names = append(names, string(source))
+	}
+	return strings.Join(names, ",")
+}
+
+// SourceTotal asks source how many papers match query in window, doer may be nil.
+func SourceTotal(ctx context.Context, doer Doer, source db.PaperSource, apiKey, query string, window *DateWindow) (uint64, error) {
+	p, err := Lookup(source)
+	if err != nil {
+		return 0, err
+	}
+	return p.Total(ctx, doer, apiKey, query, window)
+}
@@ -0,0 +1,351 @@
+package researchpaperapis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/filter"
+	"go_ingestion/internal/paper"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	pubMedSearchURL = "https://eutils.ncbi.nlm.nih.gov/entrez/eutils/esearch.fcgi"
+	pubMedFetchURL  = "https://eutils.ncbi.nlm.nih.gov/entrez/eutils/efetch.fcgi"
+	// pubMedTool names us to NCBI next to the mailto, as the E-utilities usage policy asks
+	pubMedTool = "researchq"
+)
+
+// pubMedMaxResults is as deep as esearch pages, retstart stops at 9999
+const pubMedMaxResults = 10000
+
+// buildPubMedSearchURL asks esearch for the PMIDs of the page of limit results that starts
+// at offset, the window filters by publication date.
+func buildPubMedSearchURL(apiKey, query, mailto string, window *DateWindow, limit, offset uint64) string {
+	params := url.Values{}
+	params.Set("db", "pubmed")
+	params.Set("term", query)
+	params.Set("retmode", "json")
+	params.Set("retstart", strconv.FormatUint(offset, 10))
+	params.Set("retmax", strconv.FormatUint(limit, 10))
+	if window != nil {
+		params.Set("datetype", "pdat")
+		params.Set("mindate", window.From.Format("2006/01/02"))
+		params.Set("maxdate", window.To.Format("2006/01/02"))
+	}
+	setPubMedIdentity(params, apiKey, mailto)
+	return pubMedSearchURL + "?" + params.Encode()
+}
+
+func buildPubMedFetchURL(apiKey, mailto string, pmids []string) string {
+	params := url.Values{}
+	params.Set("db", "pubmed")
+	params.Set("id", strings.Join(pmids, ","))
+	params.Set("retmode", "xml")
+	setPubMedIdentity(params, apiKey, mailto)
+	return pubMedFetchURL + "?" + params.Encode()
+}
+
+func setPubMedIdentity(params url.Values, apiKey, mailto string) {
+	if mailto != "" {
+		params.Set("tool", pubMedTool)
+		params.Set("email", mailto)
+	}
+	if apiKey != "" {
+		params.Set("api_key", apiKey)
+	}
+}
+
+// getPubMed returns the raw response in a pooled buffer, putBuffer it once decoded.
+func getPubMed(ctx context.Context, doer Doer, u string) (*bytes.Buffer, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pubmed request: %w", err)
+	}
+
+	res, err := doerOrDefault(doer).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, newStatusError("pubmed", res)
+	}
+	return readBody(res.Body)
+}
+
+// searchPubMed runs esearch and returns how many papers match and the PMIDs of the page.
+func searchPubMed(ctx context.Context, doer Doer, apiKey, mailto, query string, window *DateWindow, limit, offset uint64) (uint64, []string, error) {
+	body, err := getPubMed(ctx, doer, buildPubMedSearchURL(apiKey, query, mailto, window, limit, offset))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer putBuffer(body)
+
+	var resp PubMedSearchResponse
+	if err := json.Unmarshal(body.Bytes(), &resp); err != nil {
+		return 0, nil, fmt.Errorf("failed to decode pubmed search: %w", err)
+	}
+	result := resp.Result
+	if result.Error != "" {
+		return 0, nil, fmt.Errorf("pubmed search failed: %s", result.Error)
+	}
+	count, err := strconv.ParseUint(result.Count, 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to parse pubmed count %q: %w", result.Count, err)
+	}
+	return count, result.IDs, nil
+}
+
+// getPubMedPage searches for the PMIDs of a page and fetches their records, the efetch XML
+// is returned in a pooled buffer, putBuffer it once decoded. A page past the last result
+// is an empty buffer.
+func getPubMedPage(ctx context.Context, doer Doer, apiKey, mailto, query string, window *DateWindow, limit, offset uint64) (*bytes.Buffer, error) {
+	_, pmids, err := searchPubMed(ctx, doer, apiKey, mailto, query, window, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(pmids) == 0 {
+		return getBuffer(), nil
+	}
+	return getPubMed(ctx, doer, buildPubMedFetchURL(apiKey, mailto, pmids))
+}
+
+func parsePubMedArticles(data []byte) (PubMedArticleSet, error) {
+	var set PubMedArticleSet
+	if len(bytes.TrimSpace(data)) == 0 {
+		return set, nil
+	}
+	if err := xml.Unmarshal(data, &set); err != nil {
+		return set, fmt.Errorf("failed to parse pubmed articles: %w", err)
+	}
+	return set, nil
+}
+
+func init() {
+	Register(pubMedProvider{})
+}
+
+type pubMedProvider struct{}
+
+func (pubMedProvider) Info() ProviderInfo {
+	return ProviderInfo{Source: db.PubMed, Tag: "PUBMED", KeyEnv: "NCBI_API_KEY"}
+}
+
+func (pubMedProvider) Total(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow) (uint64, error) {
+	count, _, err := searchPubMed(ctx, doer, apiKey, "", query, window, 0, 0)
+	return count, err
+}
+
+func (pubMedProvider) Pager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) Pager {
+	return NewPubMedPager(apiKey, query, window, offset, total, limit, opts)
+}
+
+func (pubMedProvider) Remap(raw []byte, query string) (paper.Paper, error) {
+	var article PubMedArticle
+	if err := json.Unmarshal(raw, &article); err != nil {
+		return paper.Paper{}, fmt.Errorf("failed to decode pubmed payload: %w", err)
+	}
+	return getPaperFromPubMed(&article, query)
+}
+
+// NewPubMedPager pages pubmed search results from offset until total, at most until
+// pubMedMaxResults. A page is an esearch for its PMIDs and an efetch of their records.
+func NewPubMedPager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) *OffsetPager {
+	total = min(total, pubMedMaxResults)
+	return newOffsetPager(db.PubMed, opts, offset, total, limit, func(ctx context.Context, offset, limit uint64, page *pageState) ([]db.ResearchPaper, error) {
+		// NOTE: the cache keeps the fetched records under the search url, without the api
+		// key and mailto
+		body, done, err := page.body(ctx, buildPubMedSearchURL("", query, "", window, limit, offset), func() (*bytes.Buffer, error) {
+			return getPubMedPage(ctx, opts.Doer, apiKey, opts.Mailto, query, window, limit, offset)
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+
+		set, err := parsePubMedArticles(body)
+		if err != nil {
+			return nil, err
+		}
+
+		page.fetched(len(set.Articles))
+		papers := make([]db.ResearchPaper, 0, len(set.Articles))
+		for i := range set.Articles {
+			article := &set.Articles[i]
+			// NOTE: efetch is XML, so pubmed templates see the decoded article and its Go field names
+			researchPaper, ok := page.mapEntry(ctx, i, strings.TrimSpace(article.PMID), article, article, func() (paper.Paper, error) {
+				return getPaperFromPubMed(article, query)
+			})
+			if ok {
+				papers = append(papers, researchPaper)
+			}
+		}
+
+		return papers, nil
+	})
+}
+
+// pubMedMarkup are the inline tags of titles and abstracts, such as <i> and <sup>
+var pubMedMarkup = regexp.MustCompile(`</?[a-zA-Z][\w:.-]*(?:\s[^<>]*)?/?>`)
+
+// pubMedText turns the inner XML of a title into plain text.
+func pubMedText(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(pubMedMarkup.ReplaceAllString(s, ""))), " ")
+}
+
+// pubMedAbstract joins the sections of an abstract into paragraphs, labelled ones such as
+// BACKGROUND and METHODS start with their label. The markup is left to paper.CleanAbstract.
+func pubMedAbstract(sections []PubMedAbstractText) string {
+	paragraphs := make([]string, 0, len(sections))
+	for _, s := range sections {
+		text := strings.TrimSpace(s.Text)
+		if text == "" {
+			continue
+		}
+		if label := strings.TrimSpace(s.Label); label != "" {
+			text = label + ": " + text
+		}
+		paragraphs = append(paragraphs, text)
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// pubMedDate reads a journal issue date, whose month is a number or an abbreviation. Dates
+// only given as text ("1998 Dec-1999 Jan") keep their first year.
+func pubMedDate(d PubMedDate) (time.Time, int) {
+	year, _ := strconv.Atoi(strings.TrimSpace(d.Year))
+	if year == 0 {
+		if fields := strings.Fields(d.MedlineDate); len(fields) > 0 && len(fields[0]) >= 4 {
+			year, _ = strconv.Atoi(fields[0][:4])
+		}
+	}
+	if year == 0 {
+		return time.Time{}, 0
+	}
+
+	month := time.January
+	if m, err := strconv.Atoi(strings.TrimSpace(d.Month)); err == nil && m >= 1 && m <= 12 {
+		month = time.Month(m)
+	} else if t, err := time.Parse("Jan", strings.TrimSpace(d.Month)); err == nil {
+		month = t.Month()
+	}
+	day, err := strconv.Atoi(strings.TrimSpace(d.Day))
+	if err != nil || day < 1 {
+		day = 1
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC), year
+}
+
+// pubMedArticleID returns the id of the article in the idType scheme (doi, pmc, ...).
+func pubMedArticleID(article *PubMedArticle, idType string) string {
+	for _, id := range article.ArticleIDs {
+		if strings.EqualFold(id.IDType, idType) {
+			return strings.TrimSpace(id.Value)
+		}
+	}
+	return ""
+}
+
+// pubMedPDFCandidates are the PDFs of the PMC copy of an article, Europe PMC renders them
+// without the browser checks of the NCBI site.
+func pubMedPDFCandidates(pmcid string) []db.PDFCandidate {
+	if pmcid == "" {
+		return nil
+	}
+	return []db.PDFCandidate{
+		db.NewPDFCandidate("https://europepmc.org/articles/"+pmcid+"?pdf=render", db.PDFRepository),
+		db.NewPDFCandidate("https://www.ncbi.nlm.nih.gov/pmc/articles/"+pmcid+"/pdf/", db.PDFRepository),
+	}
+}
+
+// NOTE: only articles with a PMC copy have a PDF, the others are returned when they have a
+// DOI so the resolver looks for one, see PaperStore.Save
+func getPaperFromPubMed(article *PubMedArticle, query string) (paper.Paper, error) {
+	title := pubMedText(article.Title.Text)
+	if title == "" {
+		return paper.Paper{}, fmt.Errorf("%w in pubmed article", errNoTitle)
+	}
+	pmid := strings.TrimSpace(article.PMID)
+	if pmid == "" {
+		return paper.Paper{}, fmt.Errorf("pubmed article %q has no PMID", title)
+	}
+
+	doi := pubMedArticleID(article, "doi")
+	if doi == "" {
+		for _, id := range article.ELocationIDs {
+			if strings.EqualFold(id.EIDType, "doi") {
+				doi = strings.TrimSpace(id.Value)
+				break
+			}
+		}
+	}
+	doi = strings.ToLower(doi)
+
+	pmcid := paper.NormalizeIdentifier(paper.SchemePMCID, pubMedArticleID(article, "pmc"))
+	candidates := pubMedPDFCandidates(pmcid)
+	if len(candidates) == 0 && doi == "" {
+		return paper.Paper{}, fmt.Errorf("%w for pubmed article pmid=%s title=%s", errNoPDF, pmid, title)
+	}
+	var pdfURL string
+	if len(candidates) > 0 {
+		pdfURL = candidates[0].URL
+	}
+
+	authors := make([]paper.Author, 0, len(article.Authors))
+	for _, a := range article.Authors {
+		name := strings.TrimSpace(a.CollectiveName)
+		if name == "" {
+			name = strings.TrimSpace(strings.TrimSpace(a.ForeName) + " " + strings.TrimSpace(a.LastName))
+		}
+		if name != "" {
+			authors = append(authors, paper.Author{Name: name})
+		}
+	}
+
+	var lang string
+	if len(article.Languages) > 0 {
+		lang = article.Languages[0]
+	}
+
+	identifiers := map[string]string{paper.SchemePMID: pmid}
+	if pmcid != "" {
+		identifiers[paper.SchemePMCID] = pmcid
+	}
+
+	published, year := pubMedDate(article.PubDate)
+	return paper.Paper{
+		Source:    db.PubMed,
+		SourceID:  pmid,
+		Title:     title,
+		PDFURL:    pdfURL,
+		DOI:       doi,
+		Authors:   authors,
+		Published: published,
+		Query:     query,
+		// NOTE: the MeSH descriptors are what pubmed indexes articles by
+		Topics:   article.MeshHeadings,
+		Subjects: article.MeshHeadings,
+		Abstract: pubMedAbstract(article.Abstract),
+		Venue:    strings.TrimSpace(article.Journal),
+		Keywords: article.Keywords,
+		Attributes: filter.Attributes{
+			PublicationTypes: article.PublicationTypes,
+			Year:             year,
+			Language:         lang,
+		},
+		Raw:           article,
+		PDFCandidates: candidates,
+		Identifiers:   identifiers,
+	}, nil
+}
@@ -0,0 +1,82 @@
+package researchpaperapis
+
+import (
+	"context"
+	"encoding/json"
+	"go_ingestion/db"
+	"log"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Quarantine keeps records that keep failing to map out of the pages they come in, their
+// raw payload is kept for debugging. It is shared by every pager of a run, a nil
+// Quarantine quarantines nothing.
+type Quarantine struct {
+	DBPool    *pgxpool.Pool
+	ProjectID uint64
+	// After is how many failures quarantine a record
+	After int
+
+	mu sync.Mutex
+	// ids are loaded once per source and grow as records get quarantined during the run
+	ids map[db.PaperSource]map[string]bool
+}
+
+func NewQuarantine(dbPool *pgxpool.Pool, projectID uint64, after int) *Quarantine {
+	return &Quarantine{DBPool: dbPool, ProjectID: projectID, After: after, ids: map[db.PaperSource]map[string]bool{}}
+}
+
+// contains reports whether the record is quarantined, on a lookup failure nothing is.
+func (q *Quarantine) contains(ctx context.Context, source db.PaperSource, sourceID string) bool {
+	if q == nil || sourceID == "" {
+		return false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids, ok := q.ids[source]
+	if !ok {
+		list, err := db.QuarantinedSourceIDs(ctx, q.DBPool, q.ProjectID, source)
+		if err != nil {
+			log.Printf("[QUARANTINE] %v", err)
+			return false
+		}
+		ids = make(map[string]bool, len(list))
+		for _, id := range list {
+			ids[id] = true
+		}
+		q.ids[source] = ids
+	}
+	return ids[sourceID]
+}
+
+// fail counts a failure to map raw, the record is quarantined once it failed After times.
+func (q *Quarantine) fail(ctx context.Context, source db.PaperSource, sourceID string, raw any, reason string) {
+	if q == nil || sourceID == "" {
+		return
+	}
+
+	payload, err := json.Marshal(raw)
+	if err != nil {
+		payload = nil
+	}
+
+	quarantined, err := db.RecordMappingFailure(ctx, q.DBPool, q.ProjectID, source, sourceID, payload, reason, q.After)
+	if err != nil {
+		log.Printf("[QUARANTINE] %v", err)
+		return
+	}
+	if !quarantined {
+		return
+	}
+
+	q.mu.Lock()
+	if ids, ok := q.ids[source]; ok {
+		ids[sourceID] = true
+	}
+	q.mu.Unlock()
+	log.Printf("[QUARANTINE] %s record %s quarantined: %s", source, sourceID, reason)
+}
@@ -0,0 +1,25 @@
+package researchpaperapis
+
+import (
+	"errors"
+	"go_ingestion/db"
+	"go_ingestion/internal/paper"
+)
+
+// ErrNoPayload is returned by Remap for papers whose raw payload was pruned, see
+// retention.raw_payload_days.
+var ErrNoPayload = errors.New("raw payload not stored")
+
+// Remap maps the stored raw payload of a paper again, so what is derived from it (subjects,
+// tags, venue) can be rebuilt after the mapping changed without fetching the paper.
+func Remap(row db.ResearchPaper) (paper.Paper, error) {
+	if row.Metadata == nil || len(*row.Metadata) == 0 || string(*row.Metadata) == "null" {
+		return paper.Paper{}, ErrNoPayload
+	}
+
+	p, err := Lookup(row.Source)
+	if err != nil {
+		return paper.Paper{}, err
+	}
+	return p.Remap([]byte(*row.Metadata), row.Topic)
+}
@@ -1,6 +1,7 @@
 package researchpaperapis
 
 import (
+	"encoding/json"
 	"encoding/xml"
 )
 
@@ -14,15 +15,15 @@ type Feed struct {
 }
 
 type ArxivEntry struct {
-	XMLName   xml.Name      `xml:"entry"`
-	ID        string        `xml:"id"`
-	Title     string        `xml:"title"`
-	Updated   string        `xml:"updated"`
-	Summary   string        `xml:"summary"`
-	Published string        `xml:"published"`
-	Category  Category      `xml:"category"`
-	Author    []ArxivAuthor `xml:"author"`
-	Link      []Link        `xml:"link"`
+	XMLName    xml.Name      `xml:"entry"`
+	ID         string        `xml:"id"`
+	Title      string        `xml:"title"`
+	Updated    string        `xml:"updated"`
+	Summary    string        `xml:"summary"`
+	Published  string        `xml:"published"`
+	Categories []Category    `xml:"category"`
+	Author     []ArxivAuthor `xml:"author"`
+	Link       []Link        `xml:"link"`
 
 	ArxivComment         string          `xml:"comment,omitempty"`
 	ArxivPrimaryCategory PrimaryCategory `xml:"primary_category,omitempty"`
@@ -70,6 +71,14 @@ type SemanticPaper struct {
 	CitationCount    int              `json:"citationCount"`
 	ReferenceCount   int              `json:"referenceCount"`
 	FieldsOfStudy    []string         `json:"fieldsOfStudy"`
+	TLDR             *SemanticTLDR    `json:"tldr"`
+	// ExternalIDs values are strings except CorpusId, which is a number
+	ExternalIDs map[string]any `json:"externalIds"`
+}
+
+type SemanticTLDR struct {
+	Model string `json:"model"`
+	Text  string `json:"text"`
 }
 
 type SemanticAuthor struct {
@@ -120,15 +129,18 @@ type Record struct {
 	Number          string      `json:"number"`
 	ArticleNumber   string      `json:"article-number"`
 	JournalID       string      `json:"journalId"`
+	ISBN            string      `json:"isbn"`
+	PrintISBN       string      `json:"printIsbn"`
+	ElectronicISBN  string      `json:"electronicIsbn"`
 	// PrintDate         string       `json:"printDate"`
 	// OnlineDate        string       `json:"onlineDate"`
 	// CoverDate         string       `json:"coverDate"`
 	// Copyright         string       `json:"copyright"`
-	Abstract string `json:"abstract"`
-	// ConferenceInfo []string     `json:"conferenceInfo"`
-	// Keyword        []string     `json:"keyword"`
-	// Subjects       []string     `json:"subjects"`
-	// Disciplines    []Discipline `json:"disciplines"`
+	Abstract       string           `json:"abstract"`
+	Subjects       []string         `json:"subjects"`
+	ConferenceInfo []ConferenceInfo `json:"conferenceInfo"`
+	Keyword        []string         `json:"keyword"`
+	Disciplines    []Discipline     `json:"disciplines"`
 }
 
 type RecordURL struct {
@@ -141,7 +153,395 @@ type Creator struct {
 	Creator string `json:"creator"`
 }
 
-// type Discipline struct {
-// 	ID   string `json:"id"`
-// 	Term string `json:"term"`
-// }
+type Discipline struct {
+	ID   string `json:"id"`
+	Term string `json:"term"`
+}
+
+// ConferenceInfo is only reported for proceedings papers
+type ConferenceInfo struct {
+	SeriesName    string `json:"confSeriesName"`
+	EventName     string `json:"confEventName"`
+	EventLocation string `json:"confEventLocation"`
+	EventDate     string `json:"confEventDate"`
+	EventURL      string `json:"confEventURL"`
+}
+
+// Crossref API
+
+type CrossrefResponse struct {
+	Status  string          `json:"status"`
+	Message CrossrefMessage `json:"message"`
+}
+
+type CrossrefMessage struct {
+	TotalResults uint64         `json:"total-results"`
+	Items        []CrossrefWork `json:"items"`
+}
+
+type CrossrefWork struct {
+	DOI            string            `json:"DOI"`
+	Title          []string          `json:"title"`
+	Abstract       string            `json:"abstract"`
+	Author         []CrossrefAuthor  `json:"author"`
+	ContainerTitle []string          `json:"container-title"`
+	Publisher      string            `json:"publisher"`
+	Type           string            `json:"type"`
+	Subject        []string          `json:"subject"`
+	Language       string            `json:"language"`
+	License        []CrossrefLicense `json:"license"`
+	Link           []CrossrefLink    `json:"link"`
+	Issued         CrossrefDate      `json:"issued"`
+	// IsReferencedByCount is the number of citations crossref knows of
+	IsReferencedByCount int `json:"is-referenced-by-count"`
+	// Event is only reported for proceedings papers
+	Event *CrossrefEvent `json:"event"`
+}
+
+type CrossrefAuthor struct {
+	Given  string `json:"given"`
+	Family string `json:"family"`
+	Name   string `json:"name"` // organizations as authors
+}
+
+type CrossrefLicense struct {
+	URL string `json:"URL"`
+	// ContentVersion is vor (version of record), am (accepted manuscript), tdm or unspecified
+	ContentVersion string       `json:"content-version"`
+	Start          CrossrefDate `json:"start"`
+}
+
+type CrossrefLink struct {
+	URL         string `json:"URL"`
+	ContentType string `json:"content-type"`
+	// IntendedApplication is text-mining, similarity-checking or unspecified
+	IntendedApplication string `json:"intended-application"`
+}
+
+type CrossrefDate struct {
+	// DateParts is [[year, month, day]], month and day may be missing
+	DateParts [][]int `json:"date-parts"`
+}
+
+type CrossrefEvent struct {
+	Name string `json:"name"`
+}
+
+// OpenAlex API
+
+type OpenAlexResponse struct {
+	Meta    OpenAlexMeta   `json:"meta"`
+	Results []OpenAlexWork `json:"results"`
+}
+
+type OpenAlexMeta struct {
+	Count   uint64 `json:"count"`
+	Page    int    `json:"page"`
+	PerPage int    `json:"per_page"`
+}
+
+type OpenAlexWork struct {
+	// ID is the openalex url of the work, https://openalex.org/W...
+	ID          string `json:"id"`
+	DOI         string `json:"doi"` // https://doi.org/...
+	Title       string `json:"title"`
+	DisplayName string `json:"display_name"`
+	// PublicationDate is YYYY-MM-DD
+	PublicationDate string               `json:"publication_date"`
+	PublicationYear int                  `json:"publication_year"`
+	Language        string               `json:"language"`
+	Type            string               `json:"type"`
+	Authorships     []OpenAlexAuthorship `json:"authorships"`
+	OpenAccess      OpenAlexOpenAccess   `json:"open_access"`
+	// BestOALocation is the open access copy openalex would read, nil for closed works
+	BestOALocation  *OpenAlexLocation  `json:"best_oa_location"`
+	PrimaryLocation *OpenAlexLocation  `json:"primary_location"`
+	Locations       []OpenAlexLocation `json:"locations"`
+	CitedByCount    int                `json:"cited_by_count"`
+	// AbstractInvertedIndex maps every word of the abstract to its positions
+	AbstractInvertedIndex map[string][]int `json:"abstract_inverted_index"`
+	Keywords              []OpenAlexTopic  `json:"keywords"`
+	Topics                []OpenAlexTopic  `json:"topics"`
+	// IDs are the ids in other schemes, urls or numbers
+	IDs map[string]any `json:"ids"`
+}
+
+type OpenAlexAuthorship struct {
+	Author struct {
+		DisplayName string `json:"display_name"`
+	} `json:"author"`
+}
+
+type OpenAlexOpenAccess struct {
+	IsOA bool `json:"is_oa"`
+	// OAStatus is gold, green, hybrid, bronze, diamond or closed
+	OAStatus string `json:"oa_status"`
+	OAURL    string `json:"oa_url"`
+}
+
+type OpenAlexLocation struct {
+	IsOA           bool            `json:"is_oa"`
+	LandingPageURL string          `json:"landing_page_url"`
+	PDFURL         string          `json:"pdf_url"`
+	License        string          `json:"license"`
+	Version        string          `json:"version"`
+	Source         *OpenAlexSource `json:"source"`
+}
+
+type OpenAlexSource struct {
+	DisplayName string `json:"display_name"`
+	// Type is journal, repository, conference, ebook platform or book series
+	Type string `json:"type"`
+}
+
+// OpenAlexTopic is a topic, field or keyword, only the name is kept
+type OpenAlexTopic struct {
+	DisplayName string `json:"display_name"`
+}
+
+// PubMed API
+
+// PubMedSearchResponse is the esearch JSON, its numbers are strings
+type PubMedSearchResponse struct {
+	Result struct {
+		Count string   `json:"count"`
+		IDs   []string `json:"idlist"`
+		Error string   `json:"ERROR"`
+	} `json:"esearchresult"`
+}
+
+// PubMedArticleSet is the efetch XML of a page of PMIDs
+type PubMedArticleSet struct {
+	XMLName  xml.Name        `xml:"PubmedArticleSet"`
+	Articles []PubMedArticle `xml:"PubmedArticle"`
+}
+
+type PubMedArticle struct {
+	PMID         string               `xml:"MedlineCitation>PMID"`
+	Title        PubMedText           `xml:"MedlineCitation>Article>ArticleTitle"`
+	Abstract     []PubMedAbstractText `xml:"MedlineCitation>Article>Abstract>AbstractText"`
+	Authors      []PubMedAuthor       `xml:"MedlineCitation>Article>AuthorList>Author"`
+	Journal      string               `xml:"MedlineCitation>Article>Journal>Title"`
+	PubDate      PubMedDate           `xml:"MedlineCitation>Article>Journal>JournalIssue>PubDate"`
+	ELocationIDs []PubMedELocationID  `xml:"MedlineCitation>Article>ELocationID"`
+	// Languages are ISO 639-2 codes, eng
+	Languages        []string `xml:"MedlineCitation>Article>Language"`
+	PublicationTypes []string `xml:"MedlineCitation>Article>PublicationTypeList>PublicationType"`
+	MeshHeadings     []string `xml:"MedlineCitation>MeshHeadingList>MeshHeading>DescriptorName"`
+	Keywords         []string `xml:"MedlineCitation>KeywordList>Keyword"`
+	// ArticleIDs are the ids in other schemes, doi and pmc among them
+	ArticleIDs []PubMedArticleID `xml:"PubmedData>ArticleIdList>ArticleId"`
+}
+
+// PubMedText keeps the inline markup of a title, such as <i>
+type PubMedText struct {
+	Text string `xml:",innerxml"`
+}
+
+type PubMedAbstractText struct {
+	// Label names the section of a structured abstract, BACKGROUND, METHODS, ...
+	Label string `xml:"Label,attr"`
+	Text  string `xml:",innerxml"`
+}
+
+type PubMedAuthor struct {
+	LastName       string `xml:"LastName"`
+	ForeName       string `xml:"ForeName"`
+	CollectiveName string `xml:"CollectiveName"`
+}
+
+// PubMedDate has a year, month and day, or only MedlineDate text such as "1998 Dec-1999 Jan"
+type PubMedDate struct {
+	Year        string `xml:"Year"`
+	Month       string `xml:"Month"`
+	Day         string `xml:"Day"`
+	MedlineDate string `xml:"MedlineDate"`
+}
+
+type PubMedArticleID struct {
+	// IDType is doi, pmc, pubmed, pii, ...
+	IDType string `xml:"IdType,attr"`
+	Value  string `xml:",chardata"`
+}
+
+// PubMedELocationID is where the article is found online, a doi or a pii
+type PubMedELocationID struct {
+	EIDType string `xml:"EIdType,attr"`
+	Value   string `xml:",chardata"`
+}
+
+// IEEE Xplore API
+
+type IEEEResponse struct {
+	TotalRecords uint64        `json:"total_records"`
+	Articles     []IEEEArticle `json:"articles"`
+}
+
+type IEEEArticle struct {
+	// ArticleNumber and PublicationYear come as numbers or strings
+	ArticleNumber    json.Number `json:"article_number"`
+	DOI              string      `json:"doi"`
+	Title            string      `json:"title"`
+	Abstract         string      `json:"abstract"`
+	Publisher        string      `json:"publisher"`
+	PublicationTitle string      `json:"publication_title"`
+	PublicationYear  json.Number `json:"publication_year"`
+	// PublicationDate is free text, "2-5 Dec. 2020", "March 2021"
+	PublicationDate string `json:"publication_date"`
+	// ContentType is Conferences, Journals, Magazines, Early Access, Books, Standards or Courses
+	ContentType string `json:"content_type"`
+	// AccessType is OPEN_ACCESS, LOCKED or EPHEMERA
+	AccessType         string         `json:"access_type"`
+	PDFURL             string         `json:"pdf_url"`
+	HTMLURL            string         `json:"html_url"`
+	ConferenceLocation string         `json:"conference_location"`
+	ConferenceDates    string         `json:"conference_dates"`
+	CitingPaperCount   int            `json:"citing_paper_count"`
+	Authors            IEEEAuthorList `json:"authors"`
+	IndexTerms         IEEEIndexTerms `json:"index_terms"`
+}
+
+type IEEEAuthorList struct {
+	Authors []IEEEAuthor `json:"authors"`
+}
+
+type IEEEAuthor struct {
+	FullName    string `json:"full_name"`
+	Affiliation string `json:"affiliation"`
+}
+
+type IEEEIndexTerms struct {
+	IEEETerms   IEEETerms `json:"ieee_terms"`
+	AuthorTerms IEEETerms `json:"author_terms"`
+}
+
+type IEEETerms struct {
+	Terms []string `json:"terms"`
+}
+
+// CORE API
+
+type CoreResponse struct {
+	TotalHits uint64     `json:"totalHits"`
+	Results   []CoreWork `json:"results"`
+}
+
+type CoreWork struct {
+	ID       json.Number  `json:"id"`
+	DOI      string       `json:"doi"`
+	Title    string       `json:"title"`
+	Abstract string       `json:"abstract"`
+	Authors  []CoreAuthor `json:"authors"`
+	// DownloadURL is core's own copy of the full text, https://core.ac.uk/download/...
+	DownloadURL string `json:"downloadUrl"`
+	// SourceFulltextURLs are where the repositories serve the full text, PDFs or landing pages
+	SourceFulltextURLs []string   `json:"sourceFulltextUrls"`
+	Links              []CoreLink `json:"links"`
+	// PublishedDate is 2006-01-02T15:04:05 without a time zone
+	PublishedDate string        `json:"publishedDate"`
+	YearPublished int           `json:"yearPublished"`
+	Language      *CoreLanguage `json:"language"`
+	Publisher     string        `json:"publisher"`
+	Journals      []CoreJournal `json:"journals"`
+	DocumentType  string        `json:"documentType"`
+	FieldOfStudy  string        `json:"fieldOfStudy"`
+	CitationCount int           `json:"citationCount"`
+	ArxivID       string        `json:"arxivId"`
+	PubmedID      string        `json:"pubmedId"`
+	MagID         string        `json:"magId"`
+}
+
+type CoreAuthor struct {
+	Name string `json:"name"`
+}
+
+type CoreLink struct {
+	// Type is download, reader, display or a thumbnail
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type CoreLanguage struct {
+	// Code is ISO 639-1
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type CoreJournal struct {
+	Title string `json:"title"`
+}
+
+// DBLP API
+
+type DBLPResponse struct {
+	Result DBLPResult `json:"result"`
+}
+
+type DBLPResult struct {
+	Hits DBLPHits `json:"hits"`
+}
+
+type DBLPHits struct {
+	// Total is sent as a string
+	Total json.Number `json:"@total"`
+	Hit   []DBLPHit   `json:"hit"`
+}
+
+type DBLPHit struct {
+	ID   json.Number `json:"@id"`
+	Info DBLPInfo    `json:"info"`
+}
+
+type DBLPInfo struct {
+	Authors DBLPAuthors      `json:"authors"`
+	Title   string           `json:"title"`
+	Venue   DBLPList[string] `json:"venue"`
+	Year    string           `json:"year"`
+	// Type is e.g. Journal Articles, Conference and Workshop Papers or Informal and Other
+	// Publications, the latter mostly preprints
+	Type string `json:"type"`
+	// Access is open when the electronic edition is open access
+	Access string `json:"access"`
+	// Key is the dblp record key, e.g. conf/nips/VaswaniSPUJGKP17
+	Key string `json:"key"`
+	DOI string `json:"doi"`
+	// EE are the electronic editions, doi.org, arxiv or publisher links
+	EE  DBLPList[string] `json:"ee"`
+	URL string           `json:"url"`
+}
+
+type DBLPAuthors struct {
+	Author DBLPList[DBLPAuthor] `json:"author"`
+}
+
+type DBLPAuthor struct {
+	PID string `json:"@pid"`
+	// Text is the name, homonyms end in a 4 digit number such as 0001
+	Text string `json:"text"`
+}
+
+// DBLPList decodes fields dblp sends as a single value when there is one and as an array
+// otherwise.
+type DBLPList[T any] []T
+
+func (l *DBLPList[T]) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, (*[]T)(l))
+	}
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*l = DBLPList[T]{v}
+	return nil
+}
+
+// ACL Anthology bibtex dump
+
+// ACLEntry is one entry of the bibtex dump, Fields are keyed by lowercased field name with
+// the braces and latex escapes of the values resolved.
+type ACLEntry struct {
+	Type   string            `json:"type"`
+	Key    string            `json:"key"`
+	Fields map[string]string `json:"fields"`
+}
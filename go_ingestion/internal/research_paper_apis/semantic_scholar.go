@@ -1,86 +1,134 @@
 package researchpaperapis
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"go_ingestion/db"
-	"io"
-	"log"
+	"go_ingestion/internal/filter"
+	"go_ingestion/internal/license"
+	"go_ingestion/internal/paper"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
-
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-const semanticBaseURL = "https://api.semanticscholar.org/graph/v1/paper/search?query=%s&limit=%d&offset=%d&fields=paperId,title,abstract,year,authors,url,openAccessPdf,venue,publicationTypes,citationCount,referenceCount,fieldsOfStudy"
+const semanticBaseURL = "https://api.semanticscholar.org/graph/v1/paper/search?query=%s&limit=%d&offset=%d&fields=paperId,title,abstract,year,authors,url,openAccessPdf,venue,publicationTypes,citationCount,referenceCount,fieldsOfStudy,tldr,externalIds"
 
-func buildSemanticURL(query string, limit uint64, offset uint64) string {
+func buildSemanticURL(query string, window *DateWindow, limit uint64, offset uint64) string {
 	q := url.QueryEscape(query)
-	return fmt.Sprintf(semanticBaseURL, q, limit, offset)
+	u := fmt.Sprintf(semanticBaseURL, q, limit, offset)
+	if window != nil {
+		u += "&publicationDateOrYear=" + semanticDateFilter(window)
+	}
+	return u
 }
 
-func MakeSemanticScholarAPICALL(ctx context.Context, semanticPaperApiKey, query string, limit, offset uint64) (SemanticSearchResponse, error) {
-	client := &http.Client{}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, buildSemanticURL(query, limit, offset), nil)
+func MakeSemanticScholarAPICALL(ctx context.Context, doer Doer, semanticPaperApiKey, query string, window *DateWindow, limit, offset uint64) (SemanticSearchResponse, error) {
+	body, err := getSemanticPage(ctx, doer, semanticPaperApiKey, query, window, limit, offset)
 	if err != nil {
 		return SemanticSearchResponse{}, err
 	}
+	defer putBuffer(body)
+
+	return parseSemanticResponse(body.Bytes())
+}
+
+// getSemanticPage returns the raw response in a pooled buffer, putBuffer it once decoded.
+func getSemanticPage(ctx context.Context, doer Doer, semanticPaperApiKey, query string, window *DateWindow, limit, offset uint64) (*bytes.Buffer, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, buildSemanticURL(query, window, limit, offset), nil)
+	if err != nil {
+		return nil, err
+	}
 
 	req.Header.Add("x-api-key", semanticPaperApiKey)
 
-	res, err := client.Do(req)
+	res, err := doerOrDefault(doer).Do(req)
 	if err != nil {
-		return SemanticSearchResponse{}, err
+		return nil, err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		return SemanticSearchResponse{}, fmt.Errorf("semantic scholar returned non-200 status: %s", res.Status)
+		return nil, newStatusError("semantic scholar", res)
 	}
 
-	body, err := io.ReadAll(res.Body)
+	body, err := readBody(res.Body)
 	if err != nil {
-		return SemanticSearchResponse{}, fmt.Errorf("semantic scholar returned status %s", res.Status)
+		return nil, fmt.Errorf("semantic scholar returned status %s", res.Status)
 	}
+	return body, nil
+}
 
+func parseSemanticResponse(data []byte) (SemanticSearchResponse, error) {
 	var resp SemanticSearchResponse
-	if err := json.Unmarshal(body, &resp); err != nil {
-		return SemanticSearchResponse{}, err
-	}
+	err := json.Unmarshal(data, &resp)
+	return resp, err
+}
+
+func init() {
+	Register(semanticProvider{})
+}
+
+type semanticProvider struct{}
 
-	return resp, nil
+// NOTE: semantic scholar works without a key at a much lower rate
+func (semanticProvider) Info() ProviderInfo {
+	return ProviderInfo{Source: db.SemanticScholar, Tag: "SEMANTIC", KeyEnv: "SEMANTIC_PAPER_API_KEY"}
 }
 
-func InsertSemanticPaperIntoDB(ctx context.Context, dbPool *pgxpool.Pool, semanticPaperApiKey, query string, limit uint64, offset uint64) error {
-	resp, err := MakeSemanticScholarAPICALL(ctx, semanticPaperApiKey, query, limit, offset)
+func (semanticProvider) Total(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow) (uint64, error) {
+	res, err := MakeSemanticScholarAPICALL(ctx, doer, apiKey, query, window, 1, 0)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return res.Total, nil
+}
 
-	for _, semanticPaper := range resp.Data {
-		researchPaper, err := getResearchPaperFromSemantic(semanticPaper, query)
+func (semanticProvider) Pager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) Pager {
+	return NewSemanticPager(apiKey, query, window, offset, total, limit, opts)
+}
+
+func (semanticProvider) Remap(raw []byte, query string) (paper.Paper, error) {
+	var p SemanticPaper
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return paper.Paper{}, fmt.Errorf("failed to decode semantic scholar payload: %w", err)
+	}
+	return getPaperFromSemantic(p, query)
+}
 
+// NewSemanticPager pages semantic scholar search results from offset until total.
+func NewSemanticPager(semanticPaperApiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) *OffsetPager {
+	return newOffsetPager(db.SemanticScholar, opts, offset, total, limit, func(ctx context.Context, offset, limit uint64, page *pageState) ([]db.ResearchPaper, error) {
+		body, done, err := page.body(ctx, buildSemanticURL(query, window, limit, offset), func() (*bytes.Buffer, error) {
+			return getSemanticPage(ctx, opts.Doer, semanticPaperApiKey, query, window, limit, offset)
+		})
 		if err != nil {
-			log.Printf("[SEMANTIC] skipping entry id=%d: %v", researchPaper.ID, err)
-			continue
+			return nil, err
 		}
+		defer done()
 
-		if strings.TrimSpace(researchPaper.PDFURL) == "" {
-			log.Printf("[SEMANTIC] skipping paperId=%s: empty PDF URL", semanticPaper.PaperID)
-			continue
+		resp, err := parseSemanticResponse(body)
+		if err != nil {
+			return nil, err
 		}
 
-		if err := db.InsertIntoDb(ctx, dbPool, researchPaper); err != nil {
-			log.Printf("[DB] failed inserting arxiv paper id=%d title=%q: %v", researchPaper.ID, researchPaper.Title, err)
-			continue
+		page.fetched(len(resp.Data))
+		records := page.records(body, "data")
+		papers := make([]db.ResearchPaper, 0, len(resp.Data))
+		for i, semanticPaper := range resp.Data {
+			researchPaper, ok := page.mapEntry(ctx, i, semanticPaper.PaperID, semanticPaper, entryAt(records, i), func() (paper.Paper, error) {
+				return getPaperFromSemantic(semanticPaper, query)
+			})
+			if ok {
+				papers = append(papers, researchPaper)
+			}
 		}
-	}
 
-	return nil
+		return papers, nil
+	})
 }
 
 func GetSemanticPDFLink(paper SemanticPaper) string {
@@ -91,50 +139,124 @@ func GetSemanticPDFLink(paper SemanticPaper) string {
 	return ""
 }
 
-func getResearchPaperFromSemantic(p SemanticPaper, query string) (db.ResearchPaper, error) {
+func getSemanticLicense(p SemanticPaper) string {
+	if p.OpenAccessPdf == nil || p.OpenAccessPdf.License == nil {
+		return ""
+	}
+	return license.Normalize(*p.OpenAccessPdf.License)
+}
+
+func getSemanticTLDR(p SemanticPaper) string {
+	if p.TLDR == nil {
+		return ""
+	}
+	return strings.TrimSpace(p.TLDR.Text)
+}
+
+// getSemanticIdentifiers keeps the external ids but the DOI, which has its own column.
+func getSemanticIdentifiers(p SemanticPaper) map[string]string {
+	ids := map[string]string{paper.SchemeS2: p.PaperID}
+	for scheme, value := range p.ExternalIDs {
+		switch v := value.(type) {
+		case string:
+			ids[scheme] = v
+		case float64:
+			ids[scheme] = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return ids
+}
+
+func getPaperFromSemantic(p SemanticPaper, query string) (paper.Paper, error) {
 	if strings.TrimSpace(p.Title) == "" {
-		return db.ResearchPaper{}, errors.New("missing title in semantic paper")
+		return paper.Paper{}, fmt.Errorf("%w in semantic paper", errNoTitle)
 	}
 
 	pdfURL := GetSemanticPDFLink(p)
 	if strings.TrimSpace(pdfURL) == "" {
-		return db.ResearchPaper{}, fmt.Errorf("no PDF URL found for semantic paperId=%s", p.PaperID)
-	}
-
-	var sourceID *string
-	if id := strings.TrimSpace(p.PaperID); id != "" {
-		sourceID = &id
+		return paper.Paper{}, fmt.Errorf("%w for semantic paperId=%s", errNoPDF, p.PaperID)
 	}
 
-	authorNames := make([]string, 0, len(p.Authors))
+	authors := make([]paper.Author, 0, len(p.Authors))
 	for _, a := range p.Authors {
 		name := strings.TrimSpace(a.URL)
 		if name == "" {
 			name = strings.TrimSpace(a.AuthorID)
 		}
-		authorNames = append(authorNames, name)
+		authors = append(authors, paper.Author{Name: name})
+	}
+
+	citations := p.CitationCount
+	return paper.Paper{
+		Source:   db.SemanticScholar,
+		SourceID: p.PaperID,
+		Title:    strings.TrimSpace(p.Title),
+		PDFURL:   pdfURL,
+		Authors:  authors,
+		Query:    query,
+		Topics:   p.FieldsOfStudy,
+		Subjects: p.FieldsOfStudy,
+		Abstract: strings.TrimSpace(p.Abstract),
+		TLDR:     getSemanticTLDR(p),
+		Venue:    strings.TrimSpace(p.Venue),
+		License:  getSemanticLicense(p),
+		Attributes: filter.Attributes{
+			Year:             p.Year,
+			FieldsOfStudy:    p.FieldsOfStudy,
+			PublicationTypes: p.PublicationTypes,
+			CitationCount:    &citations,
+		},
+		Raw:           p,
+		PDFCandidates: []db.PDFCandidate{db.NewPDFCandidate(pdfURL, db.PDFRepository)},
+		Identifiers:   getSemanticIdentifiers(p),
+	}, nil
+}
+
+const semanticBatchURL = "https://api.semanticscholar.org/graph/v1/paper/batch?fields=paperId,citationCount,openAccessPdf"
+
+// SemanticBatchMax is the most ids semantic scholar looks up in one batch request
+const SemanticBatchMax = 500
+
+// FindSemanticPapers looks up ids (a paperId, or prefixed as in DOI:, ARXIV:, PMID:,
+// CorpusId:) in one request. The papers are in the order of ids, nil where semantic
+// scholar doesn't know the id.
+func FindSemanticPapers(ctx context.Context, doer Doer, semanticPaperApiKey string, ids []string) ([]*SemanticPaper, error) {
+	if len(ids) > SemanticBatchMax {
+		return nil, fmt.Errorf("semantic scholar looks up at most %d ids at once, got %d", SemanticBatchMax, len(ids))
+	}
+	payload, err := json.Marshal(map[string][]string{"ids": ids})
+	if err != nil {
+		return nil, err
 	}
 
-	authorsJSON, err := json.Marshal(authorNames)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, semanticBatchURL, bytes.NewReader(payload))
 	if err != nil {
-		return db.ResearchPaper{}, fmt.Errorf("failed to marshal semantic authors: %w", err)
+		return nil, fmt.Errorf("failed to create semantic scholar batch request: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Add("x-api-key", semanticPaperApiKey)
 
-	metadataJSON, err := json.Marshal(p)
+	res, err := doerOrDefault(doer).Do(req)
 	if err != nil {
-		return db.ResearchPaper{}, fmt.Errorf("failed to marshal semantic metadata: %w", err)
+		return nil, err
 	}
+	defer res.Body.Close()
 
-	paper := db.ResearchPaper{
-		Source:   db.SemanticScholar,
-		SourceID: sourceID,
-		Title:    strings.TrimSpace(p.Title),
-		PDFURL:   pdfURL,
-		DOI:      nil,
-		Authors:  &authorsJSON,
-		Metadata: &metadataJSON,
-		Topic:    query,
+	if res.StatusCode != http.StatusOK {
+		return nil, newStatusError("semantic scholar", res)
 	}
+	body, err := readBody(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer putBuffer(body)
 
-	return paper, nil
+	var papers []*SemanticPaper
+	if err := json.Unmarshal(body.Bytes(), &papers); err != nil {
+		return nil, fmt.Errorf("failed to decode semantic scholar batch response: %w", err)
+	}
+	if len(papers) != len(ids) {
+		return nil, fmt.Errorf("semantic scholar returned %d papers for %d ids", len(papers), len(ids))
+	}
+	return papers, nil
 }
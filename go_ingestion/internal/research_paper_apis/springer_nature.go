@@ -1,23 +1,28 @@
 package researchpaperapis
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"go_ingestion/db"
-	"io"
-	"log"
+	"go_ingestion/internal/filter"
+	"go_ingestion/internal/license"
+	"go_ingestion/internal/paper"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
-
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 const springerBaseURL = "http://api.springernature.com/meta/v2/json"
 
-func buildSpringerURL(query, apiKey string, limit, offset uint64) string {
+func buildSpringerURL(query, apiKey string, window *DateWindow, limit, offset uint64) string {
+	if window != nil {
+		query += springerDateFilter(window)
+	}
+
 	params := url.Values{}
 	params.Set("q", query)
 	params.Set("p", fmt.Sprintf("%d", limit))
@@ -42,113 +47,223 @@ func GetSpringerPDF(record Record) string {
 	return ""
 }
 
-func MakeSpringerNatureAPICALL(ctx context.Context, apiKey, query string, limit, offset uint64) (SpringerResponse, error) {
-	fullURL := buildSpringerURL(query, apiKey, limit, offset)
+func springerPDFCandidates(record Record) []db.PDFCandidate {
+	var candidates []db.PDFCandidate
+	for _, u := range record.URL {
+		if u.Format == "pdf" {
+			candidates = append(candidates, db.NewPDFCandidate(u.Value, db.PDFPublisher))
+		}
+	}
+	return candidates
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
+func MakeSpringerNatureAPICALL(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow, limit, offset uint64) (SpringerResponse, error) {
+	body, err := getSpringerPage(ctx, doer, apiKey, query, window, limit, offset)
 	if err != nil {
-		return SpringerResponse{}, fmt.Errorf("failed to create Springer request: %w", err)
+		return SpringerResponse{}, err
 	}
+	defer putBuffer(body)
 
-	res, err := http.DefaultClient.Do(req)
+	resp, err := parseSpringerResponse(body.Bytes())
 	if err != nil {
 		return SpringerResponse{}, err
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return SpringerResponse{}, fmt.Errorf("Springer Nature returned non-200 status: %s", res.Status)
-	}
-	body, err := io.ReadAll(res.Body)
+	return resp, nil
+}
+
+// getSpringerPage returns the raw response in a pooled buffer, putBuffer it once decoded.
+func getSpringerPage(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow, limit, offset uint64) (*bytes.Buffer, error) {
+	fullURL := buildSpringerURL(query, apiKey, window, limit, offset)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
 	if err != nil {
-		return SpringerResponse{}, err
+		return nil, fmt.Errorf("failed to create Springer request: %w", err)
 	}
 
-	resp, err := parseSpringerResponse(body)
+	res, err := doerOrDefault(doer).Do(req)
 	if err != nil {
-		return SpringerResponse{}, err
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, newStatusError("Springer Nature", res)
 	}
+	return readBody(res.Body)
+}
 
-	return resp, nil
+func init() {
+	Register(springerProvider{})
 }
 
-func InsertSpringerPaperIntoDB(ctx context.Context, dbPool *pgxpool.Pool, apiKey, query string, limit, offset uint64) error {
-	resp, err := MakeSpringerNatureAPICALL(ctx, apiKey, query, limit, offset)
+type springerProvider struct{}
+
+func (springerProvider) Info() ProviderInfo {
+	return ProviderInfo{Source: db.SpringerNature, Tag: "SPRINGER", KeyEnv: "SPRINGER_NATURE_META_APIKEY", KeyRequired: true}
+}
+
+func (springerProvider) Total(ctx context.Context, doer Doer, apiKey, query string, window *DateWindow) (uint64, error) {
+	res, err := MakeSpringerNatureAPICALL(ctx, doer, apiKey, query, window, 1, 0)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if len(res.Result) == 0 {
+		return 0, fmt.Errorf("empty springer result metadata")
+	}
+	return strconv.ParseUint(res.Result[0].Total, 10, 64)
+}
+
+func (springerProvider) Pager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) Pager {
+	return NewSpringerPager(apiKey, query, window, offset, total, limit, opts)
+}
+
+func (springerProvider) Remap(raw []byte, query string) (paper.Paper, error) {
+	var rec Record
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return paper.Paper{}, fmt.Errorf("failed to decode springer payload: %w", err)
 	}
+	return getPaperFromSpringerNature(rec, query)
+}
 
-	for _, record := range resp.Records {
-		researchPaper, err := getResearchPaperFromSpringerNature(record, query)
+// NewSpringerPager pages springer nature metadata results from offset until total. Records
+// of whole volumes are kept, skipped or expanded into their chapters, see Volumes.
+func NewSpringerPager(apiKey, query string, window *DateWindow, offset, total, limit uint64, opts PagerOptions) *OffsetPager {
+	return newOffsetPager(db.SpringerNature, opts, offset, total, limit, func(ctx context.Context, offset, limit uint64, page *pageState) ([]db.ResearchPaper, error) {
+		// NOTE: the api key is left out of the cache key
+		body, done, err := page.body(ctx, buildSpringerURL(query, "", window, limit, offset), func() (*bytes.Buffer, error) {
+			return getSpringerPage(ctx, opts.Doer, apiKey, query, window, limit, offset)
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer done()
 
+		resp, err := parseSpringerResponse(body)
 		if err != nil {
-			log.Printf("[SPRINGER] skipping entry id=%d: %v", researchPaper.ID, err)
-			continue
+			return nil, err
 		}
 
-		if strings.TrimSpace(researchPaper.PDFURL) == "" {
-			log.Printf("[SPRINGER] skipping paperId=%s: empty PDF URL", record.Identifier)
-			continue
+		page.fetched(len(resp.Records))
+		records := page.records(body, "records")
+		papers := make([]db.ResearchPaper, 0, len(resp.Records))
+		var volumes []Record
+		for i, record := range resp.Records {
+			if springerVolume(record) && (opts.Volumes.Mode == VolumesSkip || opts.Volumes.Mode == VolumesExpand) {
+				page.skip(SkipVolume)
+				if opts.Volumes.Mode == VolumesExpand {
+					volumes = append(volumes, record)
+				}
+				continue
+			}
+			researchPaper, ok := page.mapEntry(ctx, i, record.Identifier, record, entryAt(records, i), func() (paper.Paper, error) {
+				return getPaperFromSpringerNature(record, query)
+			})
+			if ok {
+				papers = append(papers, researchPaper)
+			}
 		}
 
-		if err := db.InsertIntoDb(ctx, dbPool, researchPaper); err != nil {
-			log.Printf("[DB] failed inserting arxiv paper id=%d title=%q: %v", researchPaper.ID, researchPaper.Title, err)
-			continue
+		papers = append(papers, springerVolumes(ctx, apiKey, query, volumes, limit, opts.Volumes, page, len(resp.Records))...)
+		return papers, nil
+	})
+}
+
+// springerConference names the conference of a proceedings paper, the series name is the same
+// every year so it normalizes better as a venue than the event name.
+func springerConference(rec Record) string {
+	for _, c := range rec.ConferenceInfo {
+		for _, name := range []string{c.SeriesName, c.EventName} {
+			if name = strings.TrimSpace(name); name != "" {
+				return name
+			}
 		}
 	}
+	return ""
+}
 
-	return nil
+func springerKeywords(rec Record) []string {
+	var keywords []string
+	for _, k := range rec.Keyword {
+		if k = strings.TrimSpace(k); k != "" && !slices.ContainsFunc(keywords, func(v string) bool { return strings.EqualFold(v, k) }) {
+			keywords = append(keywords, k)
+		}
+	}
+	return keywords
 }
 
-func getResearchPaperFromSpringerNature(rec Record, query string) (db.ResearchPaper, error) {
+// NOTE: springer only says whether a record is open access, not under which license
+func getSpringerLicense(rec Record) string {
+	if strings.EqualFold(strings.TrimSpace(rec.OpenAccess), "true") {
+		return license.OAUnspecified
+	}
+	return ""
+}
+
+func getPaperFromSpringerNature(rec Record, query string) (paper.Paper, error) {
 	title := strings.TrimSpace(rec.Title)
 	if title == "" {
-		return db.ResearchPaper{}, errors.New("missing title in springer record")
+		return paper.Paper{}, fmt.Errorf("%w in springer record", errNoTitle)
 	}
 
+	// NOTE: without a PDF the paper is still returned when it has a DOI, the store queues it for lookup,
+	// closed records too since their PDF link is behind the paywall
+	doi := strings.TrimSpace(rec.DOI)
 	pdfURL := GetSpringerPDF(rec)
-	if strings.TrimSpace(pdfURL) == "" {
-		return db.ResearchPaper{}, fmt.Errorf("no PDF URL found for springer record identifier=%s", rec.Identifier)
+	embargoed := !strings.EqualFold(strings.TrimSpace(rec.OpenAccess), "true")
+	if (strings.TrimSpace(pdfURL) == "" || embargoed) && doi == "" {
+		return paper.Paper{}, fmt.Errorf("%w for springer record identifier=%s", errNoPDF, rec.Identifier)
 	}
 
-	var sourceID *string
-	if id := strings.TrimSpace(rec.Identifier); id != "" {
-		sourceID = &id
-	}
-
-	authorNames := make([]string, 0, len(rec.Creators))
+	authors := make([]paper.Author, 0, len(rec.Creators))
 	for _, c := range rec.Creators {
-		name := strings.TrimSpace(c.Creator)
-		if name != "" {
-			authorNames = append(authorNames, name)
+		if name := strings.TrimSpace(c.Creator); name != "" {
+			authors = append(authors, paper.Author{Name: name})
 		}
 	}
 
-	authorsJSON, err := json.Marshal(authorNames)
-	if err != nil {
-		return db.ResearchPaper{}, fmt.Errorf("failed to marshal springer authors: %w", err)
-	}
-
-	metadataJSON, err := json.Marshal(rec)
-	if err != nil {
-		return db.ResearchPaper{}, fmt.Errorf("failed to marshal springer metadata: %w", err)
+	var types []string
+	for _, t := range []string{rec.ContentType, rec.PublicationType} {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
 	}
 
-	var doiPtr *string
-	if d := strings.TrimSpace(rec.DOI); d != "" {
-		doiPtr = &d
+	subjects := slices.Clone(rec.Subjects)
+	for _, d := range rec.Disciplines {
+		subjects = append(subjects, d.Term)
 	}
 
-	paper := db.ResearchPaper{
-		Source:   db.SpringerNature,
-		SourceID: sourceID,
-		Title:    title,
-		PDFURL:   pdfURL,
-		DOI:      doiPtr,
-		Authors:  &authorsJSON,
-		Metadata: &metadataJSON,
-		Topic:    query,
+	conference := springerConference(rec)
+	venue := strings.TrimSpace(rec.PublicationName)
+	if venue == "" {
+		venue = conference
 	}
 
-	return paper, nil
+	keywords := springerKeywords(rec)
+	return paper.Paper{
+		Source:     db.SpringerNature,
+		SourceID:   rec.Identifier,
+		Title:      title,
+		PDFURL:     pdfURL,
+		DOI:        doi,
+		Authors:    authors,
+		Published:  paper.ParseDate(rec.PublicationDate),
+		Query:      query,
+		Abstract:   strings.TrimSpace(rec.Abstract),
+		Venue:      venue,
+		Topics:     keywords,
+		Keywords:   keywords,
+		Conference: conference,
+		Subjects:   subjects,
+		License:    getSpringerLicense(rec),
+		Embargoed:  embargoed,
+		Attributes: filter.Attributes{
+			PublicationTypes: types,
+			ContentType:      strings.TrimSpace(rec.ContentType),
+			Language:         strings.TrimSpace(rec.Language),
+		},
+		Raw:           rec,
+		PDFCandidates: springerPDFCandidates(rec),
+	}, nil
 }
@@ -0,0 +1,124 @@
+package researchpaperapis
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/paper"
+	"log"
+	"strings"
+)
+
+// VolumeMode says what a springer pager does with a record of a whole book or proceedings
+// volume.
+type VolumeMode string
+
+const (
+	VolumesKeep   VolumeMode = "keep"
+	VolumesSkip   VolumeMode = "skip"
+	VolumesExpand VolumeMode = "expand"
+)
+
+// ParseVolumeMode returns the mode named s, "" keeps volumes.
+func ParseVolumeMode(s string) (VolumeMode, error) {
+	switch mode := VolumeMode(s); mode {
+	case "":
+		return VolumesKeep, nil
+	case VolumesKeep, VolumesSkip, VolumesExpand:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown volumes mode %q, expected keep, skip or expand", s)
+	}
+}
+
+type Volumes struct {
+	Mode VolumeMode
+	// MaxChapters caps the chapters fetched per expanded volume, 0 is no cap
+	MaxChapters int
+}
+
+// springerVolume reports whether a record is a whole book or proceedings volume, the papers
+// in it come back as records of content type Chapter.
+func springerVolume(rec Record) bool {
+	switch strings.ToLower(strings.TrimSpace(rec.ContentType)) {
+	case "book", "bookseries", "proceedings", "conferenceproceedings":
+		return true
+	default:
+		return false
+	}
+}
+
+func springerISBN(rec Record) string {
+	for _, isbn := range []string{rec.ElectronicISBN, rec.PrintISBN, rec.ISBN} {
+		if isbn = strings.TrimSpace(isbn); isbn != "" {
+			return isbn
+		}
+	}
+	return ""
+}
+
+// springerChapters fetches the chapter records of a volume by its ISBN, limit per request.
+func springerChapters(ctx context.Context, apiKey string, volume Record, limit uint64, opts Volumes, page *pageState) ([]Record, error) {
+	isbn := springerISBN(volume)
+	if isbn == "" {
+		return nil, fmt.Errorf("volume %s has no isbn", volume.Identifier)
+	}
+	query := "isbn:" + isbn
+
+	var chapters []Record
+	for offset := uint64(0); ; offset += limit {
+		// NOTE: the api key is left out of the cache key
+		body, done, err := page.body(ctx, buildSpringerURL(query, "", nil, limit, offset), func() (*bytes.Buffer, error) {
+			return getSpringerPage(ctx, page.opts.Doer, apiKey, query, nil, limit, offset)
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp, err := parseSpringerResponse(body)
+		done()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rec := range resp.Records {
+			if !springerVolume(rec) {
+				chapters = append(chapters, rec)
+			}
+		}
+		if opts.MaxChapters > 0 && len(chapters) >= opts.MaxChapters {
+			return chapters[:opts.MaxChapters], nil
+		}
+		if uint64(len(resp.Records)) < limit {
+			return chapters, nil
+		}
+	}
+}
+
+// springerVolumes maps the chapters of volumes, a volume whose chapters can't be fetched is
+// only logged since its record comes back with the next run. first is the slot of the first
+// chapter.
+func springerVolumes(ctx context.Context, apiKey, query string, volumes []Record, limit uint64, opts Volumes, page *pageState, first int) []db.ResearchPaper {
+	var papers []db.ResearchPaper
+	slot := first
+	for _, volume := range volumes {
+		chapters, err := springerChapters(ctx, apiKey, volume, limit, opts, page)
+		if err != nil {
+			log.Printf("[SPRINGERNATURE] failed to expand volume %s: %v", volume.Identifier, err)
+			continue
+		}
+		log.Printf("[SPRINGERNATURE] expanded volume %s %q into %d chapters", volume.Identifier, volume.Title, len(chapters))
+
+		page.opts.Stats.fetched(page.source, len(chapters))
+		for _, chapter := range chapters {
+			researchPaper, ok := page.mapEntry(ctx, slot, chapter.Identifier, chapter, nil, func() (paper.Paper, error) {
+				return getPaperFromSpringerNature(chapter, query)
+			})
+			slot++
+			if ok {
+				papers = append(papers, researchPaper)
+			}
+		}
+	}
+	return papers
+}
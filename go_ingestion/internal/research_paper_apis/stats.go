@@ -0,0 +1,153 @@
+package researchpaperapis
+
+import (
+	"errors"
+	"fmt"
+	"go_ingestion/db"
+	"io"
+	"sort"
+	"sync"
+)
+
+// SkipReason says why a fetched paper didn't end up as a new row.
+type SkipReason string
+
+const (
+	SkipNoTitle     SkipReason = "no_title"
+	SkipNoPDF       SkipReason = "no_pdf"
+	SkipParseError  SkipReason = "parse_error"
+	SkipExisting    SkipReason = "existing"
+	SkipDuplicate   SkipReason = "duplicate"
+	SkipFiltered    SkipReason = "filtered"
+	SkipLicense     SkipReason = "license"
+	SkipEmbargoed   SkipReason = "embargoed"
+	SkipInsertError SkipReason = "insert_error"
+	// SkipQuarantined records failed to map too often, see Quarantine
+	SkipQuarantined SkipReason = "quarantined"
+	// SkipVolume records are whole volumes, skipped or expanded into chapters, see Volumes
+	SkipVolume SkipReason = "volume"
+	// SkipHeld papers have weak metadata and wait for a curator, see config.Review
+	SkipHeld SkipReason = "held_for_review"
+	// SkipInvalid records failed the validation rules, see config.Validation
+	SkipInvalid SkipReason = "invalid"
+)
+
+var (
+	errNoTitle = errors.New("missing title")
+	errNoPDF   = errors.New("no PDF URL found")
+)
+
+// mappingSkipReason classifies an error returned by a source mapper.
+func mappingSkipReason(err error) SkipReason {
+	switch {
+	case errors.Is(err, errNoTitle):
+		return SkipNoTitle
+	case errors.Is(err, errNoPDF):
+		return SkipNoPDF
+	default:
+		return SkipParseError
+	}
+}
+
+// SourceStats is what happened to the papers one source returned during a run.
+type SourceStats struct {
+	Fetched  int `json:"fetched"`
+	Inserted int `json:"inserted"`
+	Reviewed int `json:"reviewed"`
+	// Updated are already stored papers whose content changed since they were stored
+	Updated int                `json:"updated"`
+	Skipped map[SkipReason]int `json:"skipped"`
+}
+
+// RunStats counts fetched, inserted and skipped papers per source, safe for concurrent workers.
+// A nil RunStats ignores everything.
+type RunStats struct {
+	mu      sync.Mutex
+	sources map[db.PaperSource]*SourceStats
+}
+
+func NewRunStats() *RunStats {
+	return &RunStats{sources: map[db.PaperSource]*SourceStats{}}
+}
+
+func (r *RunStats) update(source db.PaperSource, fn func(*SourceStats)) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sources[source]
+	if !ok {
+		s = &SourceStats{Skipped: map[SkipReason]int{}}
+		r.sources[source] = s
+	}
+	fn(s)
+}
+
+func (r *RunStats) fetched(source db.PaperSource, n int) {
+	r.update(source, func(s *SourceStats) { s.Fetched += n })
+}
+
+func (r *RunStats) inserted(source db.PaperSource) {
+	r.update(source, func(s *SourceStats) { s.Inserted++ })
+}
+
+func (r *RunStats) reviewed(source db.PaperSource) {
+	r.update(source, func(s *SourceStats) { s.Reviewed++ })
+}
+
+func (r *RunStats) updated(source db.PaperSource) {
+	r.update(source, func(s *SourceStats) { s.Updated++ })
+}
+
+func (r *RunStats) skip(source db.PaperSource, reason SkipReason, n int) {
+	r.update(source, func(s *SourceStats) { s.Skipped[reason] += n })
+}
+
+// Snapshot returns a copy of the per source counts.
+func (r *RunStats) Snapshot() map[db.PaperSource]SourceStats {
+	out := map[db.PaperSource]SourceStats{}
+	if r == nil {
+		return out
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for source, s := range r.sources {
+		skipped := make(map[SkipReason]int, len(s.Skipped))
+		for reason, n := range s.Skipped {
+			skipped[reason] = n
+		}
+		out[source] = SourceStats{Fetched: s.Fetched, Inserted: s.Inserted, Reviewed: s.Reviewed, Updated: s.Updated, Skipped: skipped}
+	}
+	return out
+}
+
+// Print writes one line per source, e.g. "arxiv fetched=25 inserted=6 reviewed=0 updated=1 existing=11 no_pdf=7".
+func (r *RunStats) Print(w io.Writer) {
+	snapshot := r.Snapshot()
+
+	sources := make([]string, 0, len(snapshot))
+	for source := range snapshot {
+		sources = append(sources, string(source))
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		s := snapshot[db.PaperSource(source)]
+		fmt.Fprintf(w, "%-16s fetched=%d inserted=%d reviewed=%d updated=%d", source, s.Fetched, s.Inserted, s.Reviewed, s.Updated)
+
+		reasons := make([]string, 0, len(s.Skipped))
+		for reason := range s.Skipped {
+			reasons = append(reasons, string(reason))
+		}
+		sort.Strings(reasons)
+		for _, reason := range reasons {
+			fmt.Fprintf(w, " %s=%d", reason, s.Skipped[SkipReason(reason)])
+		}
+		fmt.Fprintln(w)
+	}
+}
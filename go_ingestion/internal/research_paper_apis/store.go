@@ -0,0 +1,509 @@
+package researchpaperapis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"go_ingestion/internal/dedupe"
+	"go_ingestion/internal/filter"
+	"go_ingestion/internal/license"
+	"go_ingestion/internal/merge"
+	"go_ingestion/internal/mirror"
+	"go_ingestion/internal/sink"
+	"log"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PaperStore is where every source hands its mapped papers, so project scoping and
+// dedupe happen the same way for all of them.
+type PaperStore struct {
+	DBPool    *pgxpool.Pool
+	ProjectID uint64
+	Dedupe    config.Dedupe
+	// Review holds papers with weak metadata for a curator, only with DBPool
+	Review  config.Review
+	License config.License
+	Filters config.Filters
+	// Sink receives every paper that passes the checks
+	Sink sink.Sink
+	// Embargo is how long closed papers with a DOI wait in the pdf backlog before the
+	// resolver first looks for an open access copy
+	Embargo time.Duration
+	// PreferPDFHosts ranks the PDF candidates of a paper, the first one becomes its pdf_url
+	PreferPDFHosts []string
+	// Prevalidate requests the PDF links of new papers before they are saved, nil doesn't
+	Prevalidate *mirror.Prevalidator
+	// ResolvePDF looks up papers with a DOI but no PDF before they are left to the pdf
+	// backlog, nil leaves all of them to it
+	ResolvePDF PDFResolver
+	// DryRun runs every check but records into the report instead of writing, dedupe
+	// still reads the database when DBPool is set
+	DryRun *DryRunReport
+	// Stats counts what happened to every paper, may be nil
+	Stats *RunStats
+
+	inserted atomic.Uint64
+}
+
+// PDFResolver finds an open access copy of a DOI, nil when there is none, see oa.Resolver.
+type PDFResolver interface {
+	Resolve(ctx context.Context, doi string) (*db.OALocation, error)
+}
+
+// Inserted is how many papers this store has inserted (or would have, in dry-run).
+func (s *PaperStore) Inserted() uint64 {
+	return s.inserted.Load()
+}
+
+// SavePage saves a page from a Pager, papers that are already stored are only rewritten
+// when their content changed. Failures are logged per paper so one bad row doesn't lose
+// the rest of the page.
+func (s *PaperStore) SavePage(ctx context.Context, source db.PaperSource, papers []db.ResearchPaper) {
+	ids := make([]string, 0, len(papers))
+	for _, paper := range papers {
+		if paper.SourceID != nil {
+			ids = append(ids, *paper.SourceID)
+		}
+	}
+	existing := s.existingSourceIDs(ctx, source, ids)
+	versions := s.storedVersions(ctx, source, ids, existing)
+	s.prevalidate(ctx, source, papers, existing)
+
+	for _, paper := range papers {
+		if err := s.savePagePaper(ctx, paper, existing, versions); err != nil {
+			s.Stats.skip(source, SkipInsertError, 1)
+			log.Printf("[DB] failed inserting %s paper source_id=%s title=%q: %v", source, nullable(paper.SourceID), paper.Title, err)
+		}
+	}
+}
+
+// savePagePaper refreshes or saves one paper of a page, a panic is turned into an error so
+// one paper can't lose the rest of the page.
+func (s *PaperStore) savePagePaper(ctx context.Context, paper db.ResearchPaper, existing map[string]string, versions map[string]db.StoredVersion) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[DB] saving source_id=%s panicked: %v\n%s", nullable(paper.SourceID), r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	if paper.SourceID != nil {
+		if hash, ok := existing[*paper.SourceID]; ok {
+			s.refresh(ctx, paper, hash)
+			return nil
+		}
+
+		base, version := splitArxivVersion(*paper.SourceID)
+		if stored, ok := versions[base]; ok {
+			return s.replaceVersion(ctx, paper, stored, version)
+		}
+	}
+	return s.Save(ctx, paper)
+}
+
+// Save must not keep paper's Authors/Metadata bytes after returning, sources reuse them
+// for the next page.
+func (s *PaperStore) Save(ctx context.Context, paper db.ResearchPaper) error {
+	return s.save(ctx, paper, false)
+}
+
+// SaveApproved saves a paper a curator approved, it isn't held for review again.
+func (s *PaperStore) SaveApproved(ctx context.Context, paper db.ResearchPaper) error {
+	return s.save(ctx, paper, true)
+}
+
+func (s *PaperStore) save(ctx context.Context, paper db.ResearchPaper, approved bool) error {
+	paper.ProjectID = s.ProjectID
+	s.preferPDF(&paper)
+
+	if reason := filter.Check(s.Filters, paper.Attributes); reason != "" {
+		log.Printf("[FILTER] skipping %q: %s", paper.Title, reason)
+		s.Stats.skip(paper.Source, SkipFiltered, 1)
+		return nil
+	}
+
+	if paper.Embargoed {
+		s.Stats.skip(paper.Source, SkipEmbargoed, 1)
+		return s.queueMissingPDF(ctx, paper, time.Now().Add(s.Embargo))
+	}
+
+	if strings.TrimSpace(paper.PDFURL) == "" {
+		s.resolvePDF(ctx, &paper)
+	}
+
+	if s.License.OnlyRedistributable && !license.Redistributable(paper.License, s.License.Allowed) {
+		log.Printf("[LICENSE] skipping %q: license %q is not redistributable", paper.Title, nullable(paper.License))
+		s.Stats.skip(paper.Source, SkipLicense, 1)
+		// NOTE: an unknown license may only mean the paper is still under embargo
+		if paper.License == nil {
+			return s.queueMissingPDF(ctx, paper, time.Now().Add(s.Embargo))
+		}
+		return nil
+	}
+
+	if strings.TrimSpace(paper.PDFURL) == "" {
+		s.Stats.skip(paper.Source, SkipNoPDF, 1)
+		return s.queueMissingPDF(ctx, paper, time.Time{})
+	}
+
+	if s.Review.WeakPapers && s.DBPool != nil && !approved {
+		if reasons := weakMetadata(paper, s.Review.MinAuthors); len(reasons) > 0 {
+			s.Stats.skip(paper.Source, SkipHeld, 1)
+			if s.DryRun != nil {
+				return nil
+			}
+			return db.HoldForReview(ctx, s.DBPool, s.ProjectID, paper, reasons)
+		}
+	}
+
+	var check dedupe.Result
+	if s.Dedupe.Enabled && s.DBPool != nil {
+		var err error
+		check, err = dedupe.Check(ctx, s.DBPool, paper, s.Dedupe)
+		if err != nil {
+			return err
+		}
+
+		if check.Verdict == dedupe.Duplicate {
+			log.Printf("[DEDUPE] merging %q into id=%d score=%.3f", paper.Title, check.CandidateID, check.Score)
+			s.Stats.skip(paper.Source, SkipDuplicate, 1)
+			if s.DryRun != nil {
+				return nil
+			}
+			if err := merge.Into(ctx, s.DBPool, check.CandidateID, paper, s.Dedupe.Precedence); err != nil {
+				return err
+			}
+			// NOTE: the identifiers of the duplicate lead to the merged paper from now on
+			paper.ID = check.CandidateID
+			s.saveIdentifiers(ctx, paper)
+			return nil
+		}
+	}
+
+	if s.DryRun != nil {
+		s.DryRun.sample(paper)
+	} else if err := s.Sink.Write(ctx, &paper); err != nil {
+		return err
+	}
+	s.inserted.Add(1)
+	s.Stats.inserted(paper.Source)
+	s.savePDFCandidates(ctx, paper)
+	s.linkSubjects(ctx, paper)
+	s.saveIdentifiers(ctx, paper)
+
+	if check.Verdict == dedupe.Borderline {
+		s.Stats.reviewed(paper.Source)
+		if s.DryRun != nil {
+			return nil
+		}
+
+		log.Printf("[DEDUPE] queued id=%d for review against id=%d score=%.3f", paper.ID, check.CandidateID, check.Score)
+		return db.InsertDuplicateReview(ctx, s.DBPool, s.ProjectID, paper.ID, check.CandidateID, check.Score)
+	}
+
+	return nil
+}
+
+// weakMetadata returns why a paper without a DOI is too thin to store unreviewed, nothing
+// for papers with a DOI.
+func weakMetadata(paper db.ResearchPaper, minAuthors int) []string {
+	if paper.DOI != nil && strings.TrimSpace(*paper.DOI) != "" {
+		return nil
+	}
+
+	var reasons []string
+	if paper.Abstract == nil || strings.TrimSpace(*paper.Abstract) == "" {
+		reasons = append(reasons, "no_abstract")
+	}
+	var authors []json.RawMessage
+	if paper.Authors != nil {
+		// NOTE: authors that can't be read count as none
+		json.Unmarshal(*paper.Authors, &authors)
+	}
+	if len(authors) < minAuthors {
+		reasons = append(reasons, "few_authors")
+	}
+	return reasons
+}
+
+// refresh rewrites an already stored paper only when its content hash changed, unchanged
+// papers cost no write at all.
+func (s *PaperStore) refresh(ctx context.Context, paper db.ResearchPaper, storedHash string) {
+	s.preferPDF(&paper)
+	if db.ContentHash(paper) == storedHash {
+		s.Stats.skip(paper.Source, SkipExisting, 1)
+		return
+	}
+
+	if s.DryRun != nil {
+		s.Stats.updated(paper.Source)
+		return
+	}
+
+	paper.ProjectID = s.ProjectID
+	updated, err := db.UpdatePaperContent(ctx, s.DBPool, s.ProjectID, paper)
+	if err != nil {
+		s.Stats.skip(paper.Source, SkipInsertError, 1)
+		log.Printf("[DB] failed updating %s paper source_id=%s: %v", paper.Source, nullable(paper.SourceID), err)
+		return
+	}
+
+	if !updated {
+		s.Stats.skip(paper.Source, SkipExisting, 1)
+		return
+	}
+	s.Stats.updated(paper.Source)
+	log.Printf("[DB] updated %s paper source_id=%s, content changed", paper.Source, nullable(paper.SourceID))
+}
+
+// preferPDF ranks the candidates of paper and makes the preferred one its pdf_url.
+func (s *PaperStore) preferPDF(paper *db.ResearchPaper) {
+	if len(paper.PDFCandidates) == 0 {
+		return
+	}
+
+	paper.PDFCandidates = mirror.Rank(paper.PDFCandidates, s.PreferPDFHosts)
+	if len(paper.PDFCandidates) > 0 {
+		paper.PDFURL = paper.PDFCandidates[0].URL
+	}
+}
+
+// prevalidate requests the PDF links of the papers of a page that aren't stored yet in one
+// batch. Dead links are dropped, so a paper falls back to its next candidate or, without
+// one, is left to the pdf backlog like papers without a PDF. Papers whose link answered
+// with a PDF get has_pdf.
+func (s *PaperStore) prevalidate(ctx context.Context, source db.PaperSource, papers []db.ResearchPaper, existing map[string]string) {
+	if s.Prevalidate == nil {
+		return
+	}
+
+	var urls []string
+	first := make([]int, len(papers))
+	for i := range papers {
+		paper := &papers[i]
+		first[i] = len(urls)
+		if paper.SourceID != nil {
+			if _, ok := existing[*paper.SourceID]; ok {
+				continue
+			}
+		}
+
+		s.preferPDF(paper)
+		if len(paper.PDFCandidates) == 0 {
+			if strings.TrimSpace(paper.PDFURL) != "" {
+				urls = append(urls, paper.PDFURL)
+			}
+			continue
+		}
+		for _, c := range paper.PDFCandidates {
+			urls = append(urls, c.URL)
+		}
+	}
+	if len(urls) == 0 {
+		return
+	}
+
+	verdicts := s.Prevalidate.Check(ctx, urls)
+	dead := 0
+	for i := range papers {
+		paper := &papers[i]
+		end := len(urls)
+		if i+1 < len(papers) {
+			end = first[i+1]
+		}
+		if first[i] == end {
+			continue
+		}
+
+		// NOTE: the verdicts of a paper follow its candidates, or its pdf_url without any
+		var (
+			alive     []db.PDFCandidate
+			preferred = mirror.Dead
+		)
+		for j, verdict := range verdicts[first[i]:end] {
+			if verdict == mirror.Dead {
+				dead++
+				continue
+			}
+			if preferred == mirror.Dead {
+				preferred = verdict
+				paper.PDFURL = urls[first[i]+j]
+			}
+			if len(paper.PDFCandidates) > 0 {
+				alive = append(alive, paper.PDFCandidates[j])
+			}
+		}
+
+		paper.PDFCandidates = alive
+		switch preferred {
+		case mirror.Dead:
+			paper.PDFURL = ""
+		case mirror.PDF:
+			hasPDF := true
+			paper.HasPDF = &hasPDF
+		}
+	}
+	if dead > 0 {
+		log.Printf("[PDF] %s: %d/%d pdf links of new papers are dead", source, dead, len(urls))
+	}
+}
+
+// savePDFCandidates keeps the alternatives of an inserted paper for the downloader, a
+// failure is only logged since the paper itself is stored.
+func (s *PaperStore) savePDFCandidates(ctx context.Context, paper db.ResearchPaper) {
+	if s.DBPool == nil || s.DryRun != nil || paper.ID == 0 || len(paper.PDFCandidates) == 0 {
+		return
+	}
+
+	if err := db.SavePDFCandidates(ctx, s.DBPool, paper.ID, paper.PDFCandidates); err != nil {
+		log.Printf("[DB] %v", err)
+	}
+}
+
+// linkSubjects files an inserted paper under its subjects, a failure is only logged.
+func (s *PaperStore) linkSubjects(ctx context.Context, paper db.ResearchPaper) {
+	if s.DBPool == nil || s.DryRun != nil || paper.ID == 0 || len(paper.Subjects) == 0 {
+		return
+	}
+
+	if err := db.LinkPaperSubjects(ctx, s.DBPool, paper.ID, paper.Source, paper.Subjects); err != nil {
+		log.Printf("[DB] %v", err)
+	}
+}
+
+// saveIdentifiers keeps the ids paper has in other schemes, a failure is only logged.
+func (s *PaperStore) saveIdentifiers(ctx context.Context, paper db.ResearchPaper) {
+	if s.DBPool == nil || s.DryRun != nil || paper.ID == 0 || len(paper.Identifiers) == 0 {
+		return
+	}
+
+	if err := db.SavePaperIdentifiers(ctx, s.DBPool, s.ProjectID, paper.ID, paper.Identifiers); err != nil {
+		log.Printf("[DB] %v", err)
+	}
+}
+
+// resolvePDF gives a paper without a PDF the open access copy ResolvePDF finds for its DOI,
+// along with the license of the copy when the source had none.
+//
+// NOTE: a failed lookup leaves the paper to the pdf backlog like one that found nothing
+func (s *PaperStore) resolvePDF(ctx context.Context, paper *db.ResearchPaper) {
+	if s.ResolvePDF == nil || paper.DOI == nil || *paper.DOI == "" {
+		return
+	}
+
+	loc, err := s.ResolvePDF.Resolve(ctx, *paper.DOI)
+	if err != nil {
+		log.Printf("[OA] lookup of doi=%s failed: %v", *paper.DOI, err)
+		return
+	}
+	if loc == nil {
+		return
+	}
+
+	paper.PDFURL = loc.URL
+	paper.PDFCandidates = append(paper.PDFCandidates, loc.Candidates...)
+	if paper.License == nil && loc.License != "" {
+		paper.License = &loc.License
+	}
+	s.preferPDF(paper)
+	log.Printf("[OA] resolved %q doi=%s via %s", paper.Title, *paper.DOI, loc.ResolvedBy)
+}
+
+// queueMissingPDF leaves papers with a DOI to the pdf backlog resolver, see internal/oa.
+// A non-zero embargoUntil holds the lookup back until then.
+func (s *PaperStore) queueMissingPDF(ctx context.Context, paper db.ResearchPaper, embargoUntil time.Time) error {
+	if paper.DOI == nil || s.DBPool == nil || s.DryRun != nil {
+		return nil
+	}
+
+	if embargoUntil.IsZero() {
+		log.Printf("[OA] queued %q doi=%s for pdf lookup", paper.Title, *paper.DOI)
+	} else {
+		log.Printf("[OA] queued %q doi=%s as embargoed until %s", paper.Title, *paper.DOI, embargoUntil.Format(time.DateOnly))
+	}
+	return db.QueuePDFBacklog(ctx, s.DBPool, paper, embargoUntil)
+}
+
+// existingSourceIDs looks up a fetched page before it is saved so re-runs don't pay a
+// constraint violation per paper, on failure nothing is skipped and the constraints still hold.
+func (s *PaperStore) existingSourceIDs(ctx context.Context, source db.PaperSource, ids []string) map[string]string {
+	if s.DBPool == nil || len(ids) == 0 {
+		return nil
+	}
+
+	existing, err := db.ExistingSourceIDs(ctx, s.DBPool, s.ProjectID, source, ids)
+	if err != nil {
+		log.Printf("[DB] %s: %v", source, err)
+		return nil
+	}
+
+	if len(existing) > 0 {
+		log.Printf("[DB] %s: %d/%d papers already stored, checking them for changes", source, len(existing), len(ids))
+	}
+	return existing
+}
+
+// storedVersions finds the stored versions of arxiv papers of a page that aren't stored as
+// they are, by their source id without version.
+func (s *PaperStore) storedVersions(ctx context.Context, source db.PaperSource, ids []string, existing map[string]string) map[string]db.StoredVersion {
+	if source != db.Arxiv || s.DBPool == nil {
+		return nil
+	}
+
+	var bases []string
+	for _, id := range ids {
+		if _, ok := existing[id]; ok {
+			continue
+		}
+		if base, version := splitArxivVersion(id); version > 0 {
+			bases = append(bases, base)
+		}
+	}
+	if len(bases) == 0 {
+		return nil
+	}
+
+	versions, err := db.StoredVersions(ctx, s.DBPool, s.ProjectID, source, bases)
+	if err != nil {
+		log.Printf("[DB] %s: %v", source, err)
+		return nil
+	}
+	return versions
+}
+
+// replaceVersion swaps a stored paper for a newer version of it, which starts over at
+// ingested so it is downloaded and chunked again. Older versions than the stored one are
+// skipped.
+func (s *PaperStore) replaceVersion(ctx context.Context, paper db.ResearchPaper, stored db.StoredVersion, version int) error {
+	if _, storedVersion := splitArxivVersion(stored.SourceID); version <= storedVersion {
+		s.Stats.skip(paper.Source, SkipExisting, 1)
+		return nil
+	}
+
+	s.preferPDF(&paper)
+	if s.DryRun != nil {
+		s.Stats.updated(paper.Source)
+		return nil
+	}
+
+	if err := db.ReplacePaperVersion(ctx, s.DBPool, s.ProjectID, stored.PaperID, paper); err != nil {
+		return err
+	}
+	s.Stats.updated(paper.Source)
+	log.Printf("[DB] paper id=%d %s replaced by %s", stored.PaperID, stored.SourceID, nullable(paper.SourceID))
+	return nil
+}
+
+func nullable(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
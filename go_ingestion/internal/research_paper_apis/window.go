@@ -0,0 +1,65 @@
+package researchpaperapis
+
+import (
+	"fmt"
+	"time"
+)
+
+const monthLayout = "2006-01"
+
+// DateWindow limits a search to papers published between From and To, both days inclusive.
+// A nil window searches everything.
+type DateWindow struct {
+	From time.Time
+	To   time.Time
+}
+
+func (w DateWindow) String() string {
+	return w.From.Format(time.DateOnly) + ".." + w.To.Format(time.DateOnly)
+}
+
+// MonthWindows splits from..to (YYYY-MM, inclusive) into one window per calendar month.
+func MonthWindows(from, to string) ([]DateWindow, error) {
+	start, err := time.Parse(monthLayout, from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid month %q, expected YYYY-MM: %w", from, err)
+	}
+	end, err := time.Parse(monthLayout, to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid month %q, expected YYYY-MM: %w", to, err)
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("%s is before %s", to, from)
+	}
+
+	var windows []DateWindow
+	for month := start; !month.After(end); month = month.AddDate(0, 1, 0) {
+		windows = append(windows, DateWindow{From: month, To: month.AddDate(0, 1, -1)})
+	}
+	return windows, nil
+}
+
+// YearWindows returns one window per calendar year for the last years years, the current
+// year included and oldest first.
+func YearWindows(years int, now time.Time) []DateWindow {
+	windows := make([]DateWindow, 0, years)
+	for year := now.Year() - years + 1; year <= now.Year(); year++ {
+		from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		windows = append(windows, DateWindow{From: from, To: from.AddDate(1, 0, -1)})
+	}
+	return windows
+}
+
+// arxiv filters on submission date, minutes included
+func arxivDateFilter(w *DateWindow) string {
+	return fmt.Sprintf(" AND submittedDate:[%s0000 TO %s2359]", w.From.Format("20060102"), w.To.Format("20060102"))
+}
+
+func semanticDateFilter(w *DateWindow) string {
+	return w.From.Format(time.DateOnly) + ":" + w.To.Format(time.DateOnly)
+}
+
+// NOTE: springer only has constraints inside q, on the online publication date
+func springerDateFilter(w *DateWindow) string {
+	return fmt.Sprintf(" onlinedatefrom:%s onlinedateto:%s", w.From.Format(time.DateOnly), w.To.Format(time.DateOnly))
+}
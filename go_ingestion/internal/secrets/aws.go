@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/internal/sigv4"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// AWS reads a Secrets Manager secret whose SecretString is a JSON object. Credentials are
+// read from the environment on every fetch, so rotated session tokens are used.
+type AWS struct {
+	cfg    config.AWSSecrets
+	client *http.Client
+}
+
+func NewAWS(cfg config.AWSSecrets) (*AWS, error) {
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if cfg.Region == "" {
+		return nil, errors.New("aws needs secrets.aws.region or AWS_REGION")
+	}
+	if cfg.SecretID == "" {
+		return nil, errors.New("aws needs secrets.aws.secret_id")
+	}
+	return &AWS{cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+func (a *AWS) Name() string {
+	return "aws secretsmanager " + a.cfg.SecretID
+}
+
+func (a *AWS) Fetch(ctx context.Context) (map[string]string, error) {
+	creds, err := sigv4.FromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": a.cfg.SecretID})
+	if err != nil {
+		return nil, err
+	}
+	host := "secretsmanager." + a.cfg.Region + ".amazonaws.com"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secretsmanager request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	sigv4.Sign(req, sigv4.PayloadHash(body), a.cfg.Region, "secretsmanager", creds, time.Now().UTC())
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("secretsmanager request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secretsmanager response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("secretsmanager returned status %s: %s", res.Status, data)
+	}
+
+	var secret struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return nil, fmt.Errorf("failed to parse secretsmanager response: %w", err)
+	}
+	if secret.SecretString == nil {
+		return nil, fmt.Errorf("secret %s has no SecretString, binary secrets aren't supported", a.cfg.SecretID)
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal([]byte(*secret.SecretString), &values); err != nil {
+		return nil, fmt.Errorf("secret %s is not a JSON object of variables: %w", a.cfg.SecretID, err)
+	}
+	return stringValues(values), nil
+}
@@ -0,0 +1,96 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_ingestion/config"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// File reads a mounted directory holding one file per variable, the file name is the
+// variable, e.g. a kubernetes secret volume or docker secrets.
+type File struct {
+	cfg config.FileSecrets
+}
+
+func NewFile(cfg config.FileSecrets) (*File, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("file needs secrets.file.dir")
+	}
+	return &File{cfg: cfg}, nil
+}
+
+func (f *File) Name() string {
+	return "files in " + f.cfg.Dir
+}
+
+func (f *File) Fetch(ctx context.Context) (map[string]string, error) {
+	entries, err := os.ReadDir(f.cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.cfg.Dir, err)
+	}
+
+	values := map[string]string{}
+	for _, entry := range entries {
+		// NOTE: kubernetes keeps the versions of the secret in ..data and ..<timestamp>
+		// directories, the variables are symlinks into them
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(f.cfg.Dir, entry.Name())
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		value, err := readSecretFile(path)
+		if err != nil {
+			return nil, err
+		}
+		values[entry.Name()] = value
+	}
+	return values, nil
+}
+
+// LoadFileVars sets the variable X from the file named by X_FILE, the docker convention
+// for secrets, unless X is set already. X is DATABASE_URL, one of keyVars (the api key
+// variables of the sources) or a config override starting with RESEARCHQ_, other _FILE
+// variables such as SSL_CERT_FILE name files that aren't secrets.
+func LoadFileVars(keyVars []string) error {
+	for _, kv := range os.Environ() {
+		name, path, _ := strings.Cut(kv, "=")
+		variable, ok := strings.CutSuffix(name, "_FILE")
+		if !ok || variable == "" || path == "" {
+			continue
+		}
+		if variable != "DATABASE_URL" && !slices.Contains(keyVars, variable) && !strings.HasPrefix(variable, config.EnvPrefix+"_") {
+			continue
+		}
+		if _, set := os.LookupEnv(variable); set {
+			continue
+		}
+
+		value, err := readSecretFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := os.Setenv(variable, value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", variable, err)
+		}
+		log.Printf("[SECRETS] read %s from %s", variable, path)
+	}
+	return nil
+}
+
+// readSecretFile returns the content of path without the trailing newline editors and
+// echo leave in secret files.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %w", path, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
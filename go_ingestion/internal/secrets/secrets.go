@@ -0,0 +1,100 @@
+// Package secrets reads DATABASE_URL and the source API keys from a secrets manager into
+// the environment, where the rest of the program already looks for them.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"go_ingestion/config"
+	"log"
+	"os"
+	"slices"
+	"time"
+)
+
+// Provider returns the variables of a secret, keyed by environment variable name.
+type Provider interface {
+	Name() string
+	Fetch(ctx context.Context) (map[string]string, error)
+}
+
+// New returns the provider cfg names, nil when it names none.
+func New(cfg config.Secrets) (Provider, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "vault":
+		return NewVault(cfg.Vault)
+	case "aws":
+		return NewAWS(cfg.AWS)
+	case "file":
+		return NewFile(cfg.File)
+	default:
+		return nil, fmt.Errorf("unknown secrets provider %q, expected vault, aws or file", cfg.Provider)
+	}
+}
+
+// Load reads the secret of cfg into the environment, over what .env set. It returns the
+// provider for Refresh, nil when cfg names none.
+func Load(ctx context.Context, cfg config.Secrets) (Provider, error) {
+	p, err := New(cfg)
+	if err != nil || p == nil {
+		return nil, err
+	}
+
+	values, err := p.Fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets from %s: %w", p.Name(), err)
+	}
+	if err := apply(values); err != nil {
+		return nil, err
+	}
+	log.Printf("[SECRETS] loaded %d variables from %s", len(values), p.Name())
+	return p, nil
+}
+
+// Refresh reads the secret again every interval until ctx is cancelled, so rotated keys
+// are picked up by the next run and rotated database credentials by new connections.
+// A failed read keeps the values of the last one.
+func Refresh(ctx context.Context, p Provider, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		values, err := p.Fetch(ctx)
+		if err != nil {
+			log.Printf("[SECRETS] failed to refresh from %s: %v", p.Name(), err)
+			continue
+		}
+
+		var changed []string
+		for k, v := range values {
+			if os.Getenv(k) != v {
+				changed = append(changed, k)
+			}
+		}
+		if err := apply(values); err != nil {
+			log.Printf("[SECRETS] %v", err)
+			continue
+		}
+		if len(changed) > 0 {
+			slices.Sort(changed)
+			log.Printf("[SECRETS] %s rotated %v", p.Name(), changed)
+		}
+	}
+}
+
+func apply(values map[string]string) error {
+	for k, v := range values {
+		if err := os.Setenv(k, v); err != nil {
+			return fmt.Errorf("failed to set %s: %w", k, err)
+		}
+	}
+	return nil
+}
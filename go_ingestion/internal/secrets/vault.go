@@ -0,0 +1,215 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_ingestion/config"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Vault reads a KV v2 secret. A VAULT_TOKEN is renewed while it is renewable, an AppRole
+// login (VAULT_ROLE_ID and VAULT_SECRET_ID) is renewed and done again once it can't be.
+type Vault struct {
+	cfg    config.Vault
+	client *http.Client
+
+	mu        sync.Mutex
+	token     string
+	renewable bool
+	expires   time.Time // zero for tokens that don't expire
+	ttl       time.Duration
+}
+
+func NewVault(cfg config.Vault) (*Vault, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = os.Getenv("VAULT_ADDR")
+	}
+	if cfg.Addr == "" {
+		return nil, errors.New("vault needs secrets.vault.addr or VAULT_ADDR")
+	}
+	if cfg.Path == "" {
+		return nil, errors.New("vault needs secrets.vault.path")
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	if os.Getenv("VAULT_TOKEN") == "" && (os.Getenv("VAULT_ROLE_ID") == "" || os.Getenv("VAULT_SECRET_ID") == "") {
+		return nil, errors.New("vault needs VAULT_TOKEN or VAULT_ROLE_ID and VAULT_SECRET_ID")
+	}
+	return &Vault{cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+func (v *Vault) Name() string {
+	return "vault " + v.cfg.Mount + "/" + v.cfg.Path
+}
+
+func (v *Vault) Fetch(ctx context.Context) (map[string]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.authenticate(ctx); err != nil {
+		return nil, err
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	path := "/v1/" + strings.Trim(v.cfg.Mount, "/") + "/data/" + strings.Trim(v.cfg.Path, "/")
+	if err := v.do(ctx, http.MethodGet, path, nil, &secret); err != nil {
+		return nil, err
+	}
+	return stringValues(secret.Data.Data), nil
+}
+
+// authenticate makes sure there is a token that outlives the next refresh, renewing it
+// once half of its ttl is gone.
+func (v *Vault) authenticate(ctx context.Context) error {
+	if v.token == "" {
+		if token := os.Getenv("VAULT_TOKEN"); token != "" {
+			v.token = token
+			return v.lookup(ctx)
+		}
+		return v.login(ctx)
+	}
+	if v.expires.IsZero() || time.Until(v.expires) > v.ttl/2 {
+		return nil
+	}
+
+	if v.renewable {
+		var res tokenResponse
+		if err := v.do(ctx, http.MethodPost, "/v1/auth/token/renew-self", struct{}{}, &res); err == nil {
+			v.setLease(res.Auth.Renewable, res.Auth.LeaseDuration)
+			return nil
+		} else if !v.canLogin() {
+			return fmt.Errorf("failed to renew vault token: %w", err)
+		}
+	}
+	if !v.canLogin() {
+		if time.Now().After(v.expires) {
+			return errors.New("vault token expired and can't be renewed")
+		}
+		return nil
+	}
+	return v.login(ctx)
+}
+
+func (v *Vault) canLogin() bool {
+	return os.Getenv("VAULT_TOKEN") == "" && os.Getenv("VAULT_ROLE_ID") != ""
+}
+
+type tokenResponse struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		Renewable     bool   `json:"renewable"`
+		LeaseDuration int64  `json:"lease_duration"`
+	} `json:"auth"`
+}
+
+func (v *Vault) login(ctx context.Context) error {
+	v.token = ""
+	body := map[string]string{"role_id": os.Getenv("VAULT_ROLE_ID"), "secret_id": os.Getenv("VAULT_SECRET_ID")}
+
+	var res tokenResponse
+	if err := v.do(ctx, http.MethodPost, "/v1/auth/"+strings.Trim(v.cfg.AppRoleMount, "/")+"/login", body, &res); err != nil {
+		return fmt.Errorf("vault approle login failed: %w", err)
+	}
+	v.token = res.Auth.ClientToken
+	v.setLease(res.Auth.Renewable, res.Auth.LeaseDuration)
+	return nil
+}
+
+// lookup reads the lease of VAULT_TOKEN, root tokens have none.
+func (v *Vault) lookup(ctx context.Context) error {
+	var res struct {
+		Data struct {
+			Renewable bool  `json:"renewable"`
+			TTL       int64 `json:"ttl"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, "/v1/auth/token/lookup-self", nil, &res); err != nil {
+		v.token = ""
+		return fmt.Errorf("failed to look up VAULT_TOKEN: %w", err)
+	}
+	v.setLease(res.Data.Renewable, res.Data.TTL)
+	return nil
+}
+
+func (v *Vault) setLease(renewable bool, seconds int64) {
+	v.renewable = renewable
+	v.ttl = time.Duration(seconds) * time.Second
+	v.expires = time.Time{}
+	if seconds > 0 {
+		v.expires = time.Now().Add(v.ttl)
+	}
+}
+
+func (v *Vault) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(v.cfg.Addr, "/")+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create vault request: %w", err)
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read vault response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(data, &e)
+		return fmt.Errorf("vault %s %s returned status %s: %s", method, path, res.Status, strings.Join(e.Errors, "; "))
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse vault response: %w", err)
+	}
+	return nil
+}
+
+// stringValues keeps strings as they are and writes other JSON values as JSON.
+func stringValues(data map[string]any) map[string]string {
+	values := make(map[string]string, len(data))
+	for k, v := range data {
+		if s, ok := v.(string); ok {
+			values[k] = s
+			continue
+		}
+		b, _ := json.Marshal(v)
+		values[k] = string(b)
+	}
+	return values
+}
@@ -0,0 +1,127 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ManifestCSV   = "csv"
+	ManifestJSONL = "jsonl"
+)
+
+var manifestHeader = []string{"id", "source", "doi", "title", "pdf_url"}
+
+type manifestEntry struct {
+	ID     uint64         `json:"id,omitempty"`
+	Source db.PaperSource `json:"source"`
+	DOI    string         `json:"doi,omitempty"`
+	Title  string         `json:"title"`
+	PDFURL string         `json:"pdf_url"`
+}
+
+// Manifest writes to Primary and then lists the paper in a file, so batch jobs downstream
+// can pick up exactly what one run inserted. Manifest failures are logged, the paper is
+// stored either way.
+type Manifest struct {
+	Primary Sink
+	Path    string
+
+	mu   sync.Mutex
+	f    *os.File
+	w    *bufio.Writer
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+// ManifestFormat is jsonl for .json and .jsonl paths and csv otherwise.
+func ManifestFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".jsonl", ".ndjson":
+		return ManifestJSONL
+	default:
+		return ManifestCSV
+	}
+}
+
+// NewManifest creates (or truncates) the manifest at path.
+func NewManifest(primary Sink, path string) (*Manifest, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create manifest dir: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create manifest %s: %w", path, err)
+	}
+
+	m := &Manifest{Primary: primary, Path: path, f: f, w: bufio.NewWriter(f)}
+	if ManifestFormat(path) == ManifestJSONL {
+		m.json = json.NewEncoder(m.w)
+		return m, nil
+	}
+
+	m.csv = csv.NewWriter(m.w)
+	if err := m.csv.Write(manifestHeader); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write manifest header: %w", err)
+	}
+	return m, nil
+}
+
+func (m *Manifest) Write(ctx context.Context, paper *db.ResearchPaper) error {
+	if err := m.Primary.Write(ctx, paper); err != nil {
+		return err
+	}
+
+	entry := manifestEntry{ID: paper.ID, Source: paper.Source, Title: paper.Title, PDFURL: paper.PDFURL}
+	if paper.DOI != nil {
+		entry.DOI = *paper.DOI
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.write(entry); err != nil {
+		log.Printf("[MANIFEST] failed to list %q: %v", paper.Title, err)
+	}
+	return nil
+}
+
+func (m *Manifest) write(entry manifestEntry) error {
+	if m.json != nil {
+		return m.json.Encode(entry)
+	}
+
+	// NOTE: sinks other than postgres assign no id, the column stays empty
+	var id string
+	if entry.ID != 0 {
+		id = strconv.FormatUint(entry.ID, 10)
+	}
+	return m.csv.Write([]string{id, string(entry.Source), entry.DOI, entry.Title, entry.PDFURL})
+}
+
+func (m *Manifest) Close() error {
+	m.mu.Lock()
+	if m.csv != nil {
+		m.csv.Flush()
+	}
+	if err := m.w.Flush(); err != nil {
+		log.Printf("[MANIFEST] failed to flush %s: %v", m.Path, err)
+	}
+	if err := m.f.Close(); err != nil {
+		log.Printf("[MANIFEST] failed to close %s: %v", m.Path, err)
+	}
+	m.mu.Unlock()
+
+	return m.Primary.Close()
+}
@@ -0,0 +1,265 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"go_ingestion/internal/paper"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenSearch indexes papers through the _bulk api, batching BatchSize papers per request.
+// Works against Elasticsearch too, the bulk format is the same.
+type OpenSearch struct {
+	cfg      config.OpenSearch
+	password string
+	client   *http.Client
+
+	mu    sync.Mutex
+	batch bytes.Buffer
+	n     int
+}
+
+func NewOpenSearch(cfg config.OpenSearch, password string) *OpenSearch {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1
+	}
+	return &OpenSearch{cfg: cfg, password: password, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+type searchDoc struct {
+	ProjectID uint64         `json:"project_id"`
+	Source    db.PaperSource `json:"source"`
+	SourceID  *string        `json:"source_id,omitempty"`
+	Title     string         `json:"title"`
+	Abstract  string         `json:"abstract,omitempty"`
+	TLDR      string         `json:"tldr,omitempty"`
+	Authors   []string       `json:"authors,omitempty"`
+	Venue     string         `json:"venue,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+	Topic     string         `json:"topic"`
+	DOI       *string        `json:"doi,omitempty"`
+	License   *string        `json:"license,omitempty"`
+	PDFURL    string         `json:"pdf_url"`
+}
+
+type bulkAction struct {
+	Index struct {
+		Index string `json:"_index"`
+		ID    string `json:"_id,omitempty"`
+	} `json:"index"`
+}
+
+func (o *OpenSearch) Write(ctx context.Context, row *db.ResearchPaper) error {
+	p, err := paper.FromRow(*row)
+	if err != nil {
+		return err
+	}
+
+	doc := searchDoc{
+		ProjectID: row.ProjectID,
+		Source:    p.Source,
+		SourceID:  row.SourceID,
+		Title:     p.Title,
+		Abstract:  p.Abstract,
+		TLDR:      p.TLDR,
+		Venue:     p.Venue,
+		Tags:      p.Topics,
+		Topic:     p.Query,
+		DOI:       row.DOI,
+		License:   row.License,
+		PDFURL:    p.PDFURL,
+	}
+	for _, a := range p.Authors {
+		doc.Authors = append(doc.Authors, a.Name)
+	}
+
+	var action bulkAction
+	action.Index.Index = o.cfg.Index
+	action.Index.ID = documentID(row)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	enc := json.NewEncoder(&o.batch)
+	if err := enc.Encode(action); err != nil {
+		return err
+	}
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	o.n++
+
+	if o.n < o.cfg.BatchSize {
+		return nil
+	}
+	return o.flush(ctx)
+}
+
+// documentID keeps re-indexing idempotent, papers without any id get one from OpenSearch.
+func documentID(paper *db.ResearchPaper) string {
+	if paper.ID != 0 {
+		return fmt.Sprintf("%d", paper.ID)
+	}
+	if paper.SourceID != nil {
+		return fmt.Sprintf("%d:%s:%s", paper.ProjectID, paper.Source, *paper.SourceID)
+	}
+	return ""
+}
+
+// flush sends the batch, it is dropped even on failure so one bad batch doesn't grow forever.
+func (o *OpenSearch) flush(ctx context.Context) error {
+	if o.n == 0 {
+		return nil
+	}
+	n := o.n
+	defer func() {
+		o.batch.Reset()
+		o.n = 0
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(o.cfg.URL, "/")+"/_bulk", bytes.NewReader(o.batch.Bytes()))
+	if err != nil {
+		return fmt.Errorf("failed to create bulk request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if o.cfg.Username != "" {
+		req.SetBasicAuth(o.cfg.Username, o.password)
+	}
+
+	res, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("bulk request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read bulk response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("bulk request returned status %s: %s", res.Status, body)
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("failed to parse bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+
+	failed := 0
+	var first string
+	for _, item := range result.Items {
+		for _, r := range item {
+			if r.Error != nil {
+				failed++
+				if first == "" {
+					first = r.Error.Type + ": " + r.Error.Reason
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%d/%d papers failed to index, first: %s", failed, n, first)
+}
+
+// DeleteTopic removes the documents of a project's topic from the index, all of the
+// project's when topic is "", so a rebuild doesn't leave papers that are gone.
+func (o *OpenSearch) DeleteTopic(ctx context.Context, projectID uint64, topic string) (int64, error) {
+	filter := []any{map[string]any{"term": map[string]any{"project_id": projectID}}}
+	if topic != "" {
+		filter = append(filter, map[string]any{"match_phrase": map[string]any{"topic": topic}})
+	}
+	query, err := json.Marshal(map[string]any{"query": map[string]any{"bool": map[string]any{"filter": filter}}})
+	if err != nil {
+		return 0, err
+	}
+
+	url := strings.TrimRight(o.cfg.URL, "/") + "/" + o.cfg.Index + "/_delete_by_query?conflicts=proceed&refresh=true"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(query))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create delete request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.cfg.Username != "" {
+		req.SetBasicAuth(o.cfg.Username, o.password)
+	}
+
+	res, err := o.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("delete request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read delete response: %w", err)
+	}
+	// NOTE: an index that doesn't exist yet has nothing to delete
+	if res.StatusCode == http.StatusNotFound {
+		return 0, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("delete request returned status %s: %s", res.Status, body)
+	}
+
+	var result struct {
+		Deleted int64 `json:"deleted"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, fmt.Errorf("failed to parse delete response: %w", err)
+	}
+	return result.Deleted, nil
+}
+
+func (o *OpenSearch) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return o.flush(ctx)
+}
+
+// Indexed writes to Primary and then indexes the paper, so it gets the id Primary assigned.
+// Index failures are logged but never fail the write, the search index can be rebuilt.
+type Indexed struct {
+	Primary Sink
+	Index   *OpenSearch
+}
+
+func (s *Indexed) Write(ctx context.Context, paper *db.ResearchPaper) error {
+	if err := s.Primary.Write(ctx, paper); err != nil {
+		return err
+	}
+
+	if err := s.Index.Write(ctx, paper); err != nil {
+		log.Printf("[OPENSEARCH] %v", err)
+	}
+	return nil
+}
+
+func (s *Indexed) Close() error {
+	if err := s.Index.Close(); err != nil {
+		log.Printf("[OPENSEARCH] %v", err)
+	}
+	return s.Primary.Close()
+}
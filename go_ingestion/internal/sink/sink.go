@@ -0,0 +1,165 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	KindPostgres = "postgres"
+	KindJSONL    = "jsonl"
+	KindStdout   = "stdout"
+)
+
+// Sink is where papers end up once they passed every check, it is shared by all
+// source workers of a run.
+type Sink interface {
+	// Write must not keep paper's Authors/Metadata bytes after returning, sources reuse them
+	Write(ctx context.Context, paper *db.ResearchPaper) error
+	Close() error
+}
+
+// New opens the sink of cfg.Kind, wrapped to also index into OpenSearch when configured.
+func New(cfg config.Sink, dbPool *pgxpool.Pool) (Sink, error) {
+	s, err := open(cfg.Kind, cfg.Path, dbPool)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.OpenSearch.URL == "" {
+		return s, nil
+	}
+	return &Indexed{Primary: s, Index: NewOpenSearch(cfg.OpenSearch, os.Getenv("OPENSEARCH_PASSWORD"))}, nil
+}
+
+func open(kind, path string, dbPool *pgxpool.Pool) (Sink, error) {
+	switch kind {
+	case KindPostgres, "":
+		if dbPool == nil {
+			return nil, fmt.Errorf("the %s sink needs a database connection", KindPostgres)
+		}
+		return &Postgres{DBPool: dbPool}, nil
+	case KindJSONL:
+		if path == "" {
+			return nil, fmt.Errorf("the %s sink needs an output path", KindJSONL)
+		}
+		return NewJSONL(path)
+	case KindStdout:
+		return NewNDJSON(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unknown sink %q", kind)
+	}
+}
+
+// Postgres inserts into research_papers and fills in the paper's id.
+type Postgres struct {
+	DBPool *pgxpool.Pool
+}
+
+func (p *Postgres) Write(ctx context.Context, paper *db.ResearchPaper) error {
+	return db.InsertIntoDb(ctx, p.DBPool, paper)
+}
+
+func (p *Postgres) Close() error {
+	return nil
+}
+
+type record struct {
+	Source     db.PaperSource  `json:"source"`
+	SourceID   *string         `json:"source_id"`
+	Title      string          `json:"title"`
+	PDFURL     string          `json:"pdf_url"`
+	Authors    json.RawMessage `json:"authors,omitempty"`
+	DOI        *string         `json:"doi"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+	Topic      string          `json:"topic"`
+	License    *string         `json:"license,omitempty"`
+	TLDR       *string         `json:"tldr,omitempty"`
+	Categories json.RawMessage `json:"categories,omitempty"`
+	Keywords   []string        `json:"keywords,omitempty"`
+	Conference *string         `json:"conference,omitempty"`
+	Abstract   *string         `json:"abstract,omitempty"`
+	Language   *string         `json:"language,omitempty"`
+}
+
+// NDJSON writes one json object per paper, papers get no id.
+type NDJSON struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	enc    *json.Encoder
+	closer io.Closer
+}
+
+func NewNDJSON(w io.Writer) *NDJSON {
+	bw := bufio.NewWriter(w)
+	return &NDJSON{w: bw, enc: json.NewEncoder(bw)}
+}
+
+// NewJSONL appends to the file at path, creating it if needed.
+func NewJSONL(path string) (*NDJSON, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	s := NewNDJSON(f)
+	s.closer = f
+	return s, nil
+}
+
+func (s *NDJSON) Write(ctx context.Context, paper *db.ResearchPaper) error {
+	rec := record{
+		Source:     paper.Source,
+		SourceID:   paper.SourceID,
+		Title:      paper.Title,
+		PDFURL:     paper.PDFURL,
+		DOI:        paper.DOI,
+		Topic:      paper.Topic,
+		License:    paper.License,
+		TLDR:       paper.TLDR,
+		Keywords:   paper.Keywords,
+		Conference: paper.Conference,
+		Abstract:   paper.Abstract,
+		Language:   paper.Language,
+	}
+	if paper.Authors != nil {
+		rec.Authors = *paper.Authors
+	}
+	if paper.Metadata != nil {
+		rec.Metadata = *paper.Metadata
+	}
+	if paper.Categories != nil {
+		rec.Categories = *paper.Categories
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// NOTE: flushed per paper so a consumer on the other end of a pipe sees papers as they come
+	if err := s.enc.Encode(rec); err != nil {
+		return fmt.Errorf("failed to write paper: %w", err)
+	}
+	return s.w.Flush()
+}
+
+func (s *NDJSON) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,553 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_ingestion/db"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// archive layout (tar.gz), written in restore order:
+//
+//	manifest.json
+//	papers.jsonl   (with each paper's identifiers, subjects and pdf candidates)
+//	chunks.jsonl   (only if embedding_chunks exists)
+//	vectors.jsonl  (only if embedding_vectors exists)
+//	pdfs/<paper id>.pdf (optional)
+
+const formatVersion = 1
+
+type Manifest struct {
+	Version     int       `json:"version"`
+	Project     string    `json:"project"`
+	CreatedAt   time.Time `json:"created_at"`
+	Papers      int       `json:"papers"`
+	Chunks      int       `json:"chunks"`
+	Vectors     int       `json:"vectors"`
+	PDFs        int       `json:"pdfs"`
+	IncludePDFs bool      `json:"include_pdfs"`
+}
+
+type paperRecord struct {
+	ID       uint64          `json:"id"`
+	Source   db.PaperSource  `json:"source"`
+	SourceID *string         `json:"source_id"`
+	Title    string          `json:"title"`
+	PDFURL   string          `json:"pdf_url"`
+	Authors  json.RawMessage `json:"authors,omitempty"`
+	DOI      *string         `json:"doi"`
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+	Status   db.PaperStatus  `json:"status,omitempty"`
+	// EmbeddingProcessed is only read from snapshots taken before papers had a status
+	EmbeddingProcessed bool            `json:"embedding_processed,omitempty"`
+	Topic              string          `json:"topic"`
+	License            *string         `json:"license,omitempty"`
+	TLDR               *string         `json:"tldr,omitempty"`
+	Categories         json.RawMessage `json:"categories,omitempty"`
+	Keywords           []string        `json:"keywords,omitempty"`
+	Conference         *string         `json:"conference,omitempty"`
+	Abstract           *string         `json:"abstract,omitempty"`
+	Language           *string         `json:"language,omitempty"`
+	HasPDF             *bool           `json:"has_pdf,omitempty"`
+	Venue              string          `json:"venue,omitempty"`
+	PublishedOn        *time.Time      `json:"published_on,omitempty"`
+	Provenance         json.RawMessage `json:"provenance,omitempty"`
+	ContentHash        *string         `json:"content_hash,omitempty"`
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          *time.Time      `json:"updated_at,omitempty"`
+
+	Identifiers   []db.Identifier      `json:"identifiers,omitempty"`
+	Subjects      []db.SnapshotSubject `json:"subjects,omitempty"`
+	PDFCandidates []pdfCandidateRecord `json:"pdf_candidates,omitempty"`
+}
+
+// pdfCandidateRecord is a db.PDFCandidate, the candidates of a paper are listed preferred
+// first.
+type pdfCandidateRecord struct {
+	URL  string `json:"url"`
+	Host string `json:"host"`
+	Kind string `json:"kind"`
+}
+
+type CreateOptions struct {
+	IncludePDFs bool
+	PDFDir      string
+}
+
+func Create(ctx context.Context, dbPool *pgxpool.Pool, project db.Project, path string, opts CreateOptions) (Manifest, error) {
+	manifest := Manifest{
+		Version:     formatVersion,
+		Project:     project.Name,
+		CreatedAt:   time.Now().UTC(),
+		IncludePDFs: opts.IncludePDFs,
+	}
+
+	tmpDir, err := os.MkdirTemp("", "snapshot-*")
+	if err != nil {
+		return manifest, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	identifiers, err := db.ProjectPaperIdentifiers(ctx, dbPool, project.ID)
+	if err != nil {
+		return manifest, err
+	}
+	subjects, err := db.ProjectPaperSubjects(ctx, dbPool, project.ID)
+	if err != nil {
+		return manifest, err
+	}
+	candidates, err := db.ProjectPDFCandidates(ctx, dbPool, project.ID)
+	if err != nil {
+		return manifest, err
+	}
+
+	var paperIDs []uint64
+	manifest.Papers, err = writeJSONL(filepath.Join(tmpDir, "papers.jsonl"), func(emit func(any) error) error {
+		return db.ForEachProjectPaper(ctx, dbPool, project.ID, func(p db.ResearchPaper) error {
+			paperIDs = append(paperIDs, p.ID)
+			rec := toRecord(p)
+			rec.Identifiers = identifiers[p.ID]
+			rec.Subjects = subjects[p.ID]
+			for _, c := range candidates[p.ID] {
+				rec.PDFCandidates = append(rec.PDFCandidates, pdfCandidateRecord{URL: c.URL, Host: c.Host, Kind: c.Kind})
+			}
+			return emit(rec)
+		})
+	})
+	if err != nil {
+		return manifest, err
+	}
+
+	files := []string{"papers.jsonl"}
+
+	if ok, err := db.TableExists(ctx, dbPool, "embedding_chunks"); err != nil {
+		return manifest, err
+	} else if ok {
+		manifest.Chunks, err = writeJSONL(filepath.Join(tmpDir, "chunks.jsonl"), func(emit func(any) error) error {
+			return db.ForEachProjectChunk(ctx, dbPool, project.ID, func(row json.RawMessage) error { return emit(row) })
+		})
+		if err != nil {
+			return manifest, err
+		}
+		files = append(files, "chunks.jsonl")
+	}
+
+	if ok, err := db.TableExists(ctx, dbPool, "embedding_vectors"); err != nil {
+		return manifest, err
+	} else if ok && manifest.Chunks > 0 {
+		manifest.Vectors, err = writeJSONL(filepath.Join(tmpDir, "vectors.jsonl"), func(emit func(any) error) error {
+			return db.ForEachProjectVector(ctx, dbPool, project.ID, func(row json.RawMessage) error { return emit(row) })
+		})
+		if err != nil {
+			return manifest, err
+		}
+		files = append(files, "vectors.jsonl")
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	var pdfs []string
+	if opts.IncludePDFs {
+		for _, id := range paperIDs {
+			pdf := filepath.Join(opts.PDFDir, strconv.FormatUint(id, 10)+".pdf")
+			if _, err := os.Stat(pdf); err == nil {
+				pdfs = append(pdfs, pdf)
+			}
+		}
+		manifest.PDFs = len(pdfs)
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	if err := writeTarBytes(tw, "manifest.json", manifestJSON); err != nil {
+		return manifest, err
+	}
+
+	for _, name := range files {
+		if err := writeTarFile(tw, name, filepath.Join(tmpDir, name)); err != nil {
+			return manifest, err
+		}
+	}
+
+	for _, pdf := range pdfs {
+		if err := writeTarFile(tw, "pdfs/"+filepath.Base(pdf), pdf); err != nil {
+			return manifest, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return manifest, fmt.Errorf("failed to finish tar: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return manifest, fmt.Errorf("failed to finish gzip: %w", err)
+	}
+
+	return manifest, nil
+}
+
+type RestoreReport struct {
+	Papers  int
+	Skipped int
+	Chunks  int
+	Vectors int
+	PDFs    int
+}
+
+func (r RestoreReport) String() string {
+	return fmt.Sprintf("papers=%d skipped=%d chunks=%d vectors=%d pdfs=%d", r.Papers, r.Skipped, r.Chunks, r.Vectors, r.PDFs)
+}
+
+// Restore loads a snapshot into project, ids are reassigned so it can be restored next to existing data.
+func Restore(ctx context.Context, dbPool *pgxpool.Pool, project db.Project, path, pdfDir string) (RestoreReport, error) {
+	var report RestoreReport
+
+	in, err := os.Open(path)
+	if err != nil {
+		return report, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer in.Close()
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return report, fmt.Errorf("failed to read gzip: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+
+	paperIDs := make(map[uint64]uint64)
+	chunkIDs := make(map[int64]int64)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+
+		switch {
+		case hdr.Name == "manifest.json":
+			var manifest Manifest
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return report, fmt.Errorf("invalid manifest: %w", err)
+			}
+			if manifest.Version != formatVersion {
+				return report, fmt.Errorf("unsupported snapshot version %d", manifest.Version)
+			}
+			log.Printf("[SNAPSHOT] restoring project=%q created_at=%s into project=%q", manifest.Project, manifest.CreatedAt.Format(time.RFC3339), project.Name)
+
+		case hdr.Name == "papers.jsonl":
+			err = readJSONL(tr, func(line []byte) error {
+				var rec paperRecord
+				if err := json.Unmarshal(line, &rec); err != nil {
+					return err
+				}
+
+				id, err := db.RestorePaper(ctx, dbPool, project.ID, fromRecord(rec))
+				if err != nil {
+					log.Printf("[SNAPSHOT] skipping paper id=%d: %v", rec.ID, err)
+					report.Skipped++
+					return nil
+				}
+				paperIDs[rec.ID] = id
+				report.Papers++
+				return restorePaperRelations(ctx, dbPool, project.ID, id, rec)
+			})
+
+		case hdr.Name == "chunks.jsonl":
+			err = readJSONL(tr, func(line []byte) error {
+				var row map[string]any
+				if err := json.Unmarshal(line, &row); err != nil {
+					return err
+				}
+
+				newPaperID, ok := paperIDs[uint64(asInt(row["paper_id"]))]
+				if !ok {
+					return nil
+				}
+				oldID := asInt(row["id"])
+				row["paper_id"] = newPaperID
+
+				data, err := json.Marshal(row)
+				if err != nil {
+					return err
+				}
+				newID, err := db.RestoreChunk(ctx, dbPool, data)
+				if err != nil {
+					return err
+				}
+				chunkIDs[oldID] = newID
+				report.Chunks++
+				return nil
+			})
+
+		case hdr.Name == "vectors.jsonl":
+			err = readJSONL(tr, func(line []byte) error {
+				var row map[string]any
+				if err := json.Unmarshal(line, &row); err != nil {
+					return err
+				}
+
+				newChunkID, ok := chunkIDs[asInt(row["embedding_chunk_id"])]
+				if !ok {
+					return nil
+				}
+				row["embedding_chunk_id"] = newChunkID
+
+				data, err := json.Marshal(row)
+				if err != nil {
+					return err
+				}
+				if err := db.RestoreVector(ctx, dbPool, data); err != nil {
+					return err
+				}
+				report.Vectors++
+				return nil
+			})
+
+		case strings.HasPrefix(hdr.Name, "pdfs/"):
+			oldID, perr := strconv.ParseUint(strings.TrimSuffix(filepath.Base(hdr.Name), ".pdf"), 10, 64)
+			newID, ok := paperIDs[oldID]
+			if perr != nil || !ok {
+				continue
+			}
+			err = copyPDF(tr, pdfDir, newID)
+			if err == nil {
+				report.PDFs++
+			}
+		}
+
+		if err != nil {
+			return report, fmt.Errorf("failed restoring %s: %w", hdr.Name, err)
+		}
+	}
+
+	return report, nil
+}
+
+func toRecord(p db.ResearchPaper) paperRecord {
+	rec := paperRecord{
+		ID:          p.ID,
+		Source:      p.Source,
+		SourceID:    p.SourceID,
+		Title:       p.Title,
+		PDFURL:      p.PDFURL,
+		DOI:         p.DOI,
+		Status:      p.Status,
+		Topic:       p.Topic,
+		License:     p.License,
+		TLDR:        p.TLDR,
+		Keywords:    p.Keywords,
+		Conference:  p.Conference,
+		Abstract:    p.Abstract,
+		Language:    p.Language,
+		HasPDF:      p.HasPDF,
+		Venue:       p.Search.Venue,
+		PublishedOn: p.PublishedOn,
+		ContentHash: p.ContentHash,
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+	}
+	if p.Authors != nil {
+		rec.Authors = json.RawMessage(*p.Authors)
+	}
+	if p.Metadata != nil {
+		rec.Metadata = json.RawMessage(*p.Metadata)
+	}
+	if p.Provenance != nil {
+		rec.Provenance = json.RawMessage(*p.Provenance)
+	}
+	if p.Categories != nil {
+		rec.Categories = json.RawMessage(*p.Categories)
+	}
+	return rec
+}
+
+func fromRecord(rec paperRecord) db.ResearchPaper {
+	paper := db.ResearchPaper{
+		Source:      rec.Source,
+		SourceID:    rec.SourceID,
+		Title:       rec.Title,
+		PDFURL:      rec.PDFURL,
+		DOI:         rec.DOI,
+		Status:      rec.Status,
+		Topic:       rec.Topic,
+		License:     rec.License,
+		TLDR:        rec.TLDR,
+		Keywords:    rec.Keywords,
+		Conference:  rec.Conference,
+		Abstract:    rec.Abstract,
+		Language:    rec.Language,
+		HasPDF:      rec.HasPDF,
+		Search:      db.SearchFields{Venue: rec.Venue},
+		PublishedOn: rec.PublishedOn,
+		ContentHash: rec.ContentHash,
+		CreatedAt:   rec.CreatedAt,
+		UpdatedAt:   rec.UpdatedAt,
+	}
+	if paper.Status == "" {
+		paper.Status = db.StatusIngested
+		if rec.EmbeddingProcessed {
+			paper.Status = db.StatusEmbedded
+		}
+	}
+	if len(rec.Authors) > 0 {
+		authors := []byte(rec.Authors)
+		paper.Authors = &authors
+	}
+	if len(rec.Metadata) > 0 {
+		metadata := []byte(rec.Metadata)
+		paper.Metadata = &metadata
+	}
+	if len(rec.Provenance) > 0 {
+		provenance := []byte(rec.Provenance)
+		paper.Provenance = &provenance
+	}
+	if len(rec.Categories) > 0 {
+		categories := []byte(rec.Categories)
+		paper.Categories = &categories
+	}
+	return paper
+}
+
+// restorePaperRelations saves the identifiers, subjects and pdf candidates of the restored
+// paper id.
+func restorePaperRelations(ctx context.Context, dbPool *pgxpool.Pool, projectID, id uint64, rec paperRecord) error {
+	if len(rec.Identifiers) > 0 {
+		if err := db.SavePaperIdentifiers(ctx, dbPool, projectID, id, rec.Identifiers); err != nil {
+			return err
+		}
+	}
+
+	// NOTE: subjects are linked per source that filed them
+	bySource := map[db.PaperSource][]db.Subject{}
+	for _, s := range rec.Subjects {
+		bySource[s.Source] = append(bySource[s.Source], db.Subject{Key: s.Key, Label: s.Label})
+	}
+	for source, subjects := range bySource {
+		if err := db.LinkPaperSubjects(ctx, dbPool, id, source, subjects); err != nil {
+			return err
+		}
+	}
+
+	if len(rec.PDFCandidates) > 0 {
+		candidates := make([]db.PDFCandidate, len(rec.PDFCandidates))
+		for i, c := range rec.PDFCandidates {
+			candidates[i] = db.PDFCandidate{URL: c.URL, Host: c.Host, Kind: c.Kind}
+		}
+		if err := db.SavePDFCandidates(ctx, dbPool, id, candidates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func asInt(v any) int64 {
+	// NOTE: json numbers decode as float64, fine for ids below 2^53
+	if n, ok := v.(float64); ok {
+		return int64(n)
+	}
+	return 0
+}
+
+func writeJSONL(path string, produce func(emit func(any) error) error) (int, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	count := 0
+	err = produce(func(v any) error {
+		count++
+		return enc.Encode(v)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, w.Flush()
+}
+
+func readJSONL(r io.Reader, fn func([]byte) error) error {
+	scanner := bufio.NewScanner(r)
+	// NOTE: metadata/vector rows easily exceed the default 64KB token size
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func writeTarBytes(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s header: %w", name, err)
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func writeTarFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s header: %w", name, err)
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func copyPDF(r io.Reader, pdfDir string, paperID uint64) error {
+	if err := os.MkdirAll(pdfDir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(pdfDir, strconv.FormatUint(paperID, 10)+".pdf"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
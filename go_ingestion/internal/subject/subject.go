@@ -0,0 +1,32 @@
+// Package subject normalizes the disciplines sources file papers under (semantic scholar
+// fields of study, springer subjects) into one taxonomy.
+package subject
+
+import (
+	"go_ingestion/db"
+	"strings"
+)
+
+var keyReplacer = strings.NewReplacer("&", " and ", ",", " ", "/", " ", "-", " ")
+
+// Key is how a subject is matched across sources, "Computer Science" and
+// "computer-science" share one.
+func Key(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(keyReplacer.Replace(name))), " ")
+}
+
+// Normalize turns subject names into subjects, duplicates by key keep the first spelling.
+func Normalize(names []string) []db.Subject {
+	var subjects []db.Subject
+	seen := map[string]bool{}
+	for _, name := range names {
+		label := strings.Join(strings.Fields(name), " ")
+		key := Key(label)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		subjects = append(subjects, db.Subject{Key: key, Label: label})
+	}
+	return subjects
+}
@@ -0,0 +1,166 @@
+// Package testsupport emulates the upstream sources with local HTTP servers, so the whole
+// pipeline can run without network access or api keys, see the e2e test.
+package testsupport
+
+import (
+	"fmt"
+	"go_ingestion/db"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// Faults makes a server fail before it answers, e.g. with 429 or 503.
+type Faults struct {
+	// Status answers the first Times requests, 0 never fails
+	Status int
+	Times  int
+	// RetryAfter is sent with the failures when set, in seconds
+	RetryAfter int
+}
+
+// Server emulates one source, serving its recorded fixture as the first page and empty pages
+// after it.
+type Server struct {
+	*httptest.Server
+	Source db.PaperSource
+	// Host is the upstream host whose requests the server answers
+	Host string
+
+	mu       sync.Mutex
+	faults   Faults
+	requests int
+	failed   int
+}
+
+// Requests returns how many requests the server got and how many of them it failed.
+func (s *Server) Requests() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests, s.failed
+}
+
+// fault counts a request and reports whether it has to fail.
+func (s *Server) fault() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if s.faults.Status == 0 || s.failed >= s.faults.Times {
+		return false
+	}
+	s.failed++
+	return true
+}
+
+// page serves first for requests whose offset param is 0 and empty otherwise.
+func (s *Server) page(offsetParam, contentType string, first, empty []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.fault() {
+			if s.faults.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(s.faults.RetryAfter))
+			}
+			http.Error(w, http.StatusText(s.faults.Status), s.faults.Status)
+			return
+		}
+
+		body := first
+		if offset, _ := strconv.Atoi(r.URL.Query().Get(offsetParam)); offset > 0 {
+			body = empty
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body)
+	}
+}
+
+const (
+	// fixtureTotal is the number of papers every fixture has
+	fixtureTotal = 2
+
+	emptyArxiv = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:opensearch="http://a9.com/-/spec/opensearch/1.1/">
+  <opensearch:totalResults>%d</opensearch:totalResults>
+</feed>`
+	emptySemantic = `{"total": %d, "data": []}`
+	emptySpringer = `{"result": [{"total": "%d"}], "records": []}`
+)
+
+// Servers are the mock arxiv, semantic scholar and springer nature sources.
+type Servers struct {
+	Arxiv    *Server
+	Semantic *Server
+	Springer *Server
+}
+
+// NewServers starts the servers, faults apply to each of them. Close them when done.
+func NewServers(faults Faults) (*Servers, error) {
+	arxiv, err := researchpaperapis.Fixture("fixtures/arxiv.xml")
+	if err != nil {
+		return nil, err
+	}
+	semantic, err := researchpaperapis.Fixture("fixtures/semantic.json")
+	if err != nil {
+		return nil, err
+	}
+	springer, err := researchpaperapis.Fixture("fixtures/springer.json")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Servers{
+		Arxiv:    &Server{Source: db.Arxiv, Host: "export.arxiv.org", faults: faults},
+		Semantic: &Server{Source: db.SemanticScholar, Host: "api.semanticscholar.org", faults: faults},
+		Springer: &Server{Source: db.SpringerNature, Host: "api.springernature.com", faults: faults},
+	}
+	s.Arxiv.Server = httptest.NewServer(s.Arxiv.page("start", "application/atom+xml", arxiv, []byte(fmt.Sprintf(emptyArxiv, fixtureTotal))))
+	s.Semantic.Server = httptest.NewServer(s.Semantic.page("offset", "application/json", semantic, []byte(fmt.Sprintf(emptySemantic, fixtureTotal))))
+	s.Springer.Server = httptest.NewServer(s.Springer.page("s", "application/json", springer, []byte(fmt.Sprintf(emptySpringer, fixtureTotal))))
+	return s, nil
+}
+
+// All returns the servers in a fixed order.
+func (s *Servers) All() []*Server {
+	return []*Server{s.Arxiv, s.Semantic, s.Springer}
+}
+
+// Total is how many papers each server has.
+func (s *Servers) Total() int {
+	return fixtureTotal
+}
+
+func (s *Servers) Close() {
+	for _, server := range s.All() {
+		server.Close()
+	}
+}
+
+// Doer sends the requests meant for the emulated sources to their server, requests to any
+// other host fail so nothing leaves the machine.
+func (s *Servers) Doer() researchpaperapis.Doer {
+	return doer{s}
+}
+
+type doer struct {
+	servers *Servers
+}
+
+func (d doer) Do(req *http.Request) (*http.Response, error) {
+	for _, server := range d.servers.All() {
+		if req.URL.Hostname() != server.Host {
+			continue
+		}
+		target, err := url.Parse(server.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		req = req.Clone(req.Context())
+		req.URL.Scheme = target.Scheme
+		req.URL.Host = target.Host
+		req.Host = target.Host
+		return server.Client().Do(req)
+	}
+	return nil, fmt.Errorf("no mock server for %s", req.URL.Host)
+}
@@ -2,7 +2,12 @@ package main
 
 import (
 	"context"
-	"go_ingestion/db"
+	"errors"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/internal/credentials"
+	"go_ingestion/internal/secrets"
+	"io/fs"
 	"log"
 	"os"
 	"os/signal"
@@ -12,74 +17,58 @@ import (
 )
 
 func main() {
+	// NOTE: .env is optional, in a container the orchestrator sets the environment. It never
+	// overrides a variable that is set already
 	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-		return
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		exit(fmt.Errorf("%w: failed to load .env: %w", config.ErrConfig, err))
+	}
+	keyVars := make([]string, 0, len(credentials.EnvVars))
+	for _, env := range credentials.EnvVars {
+		keyVars = append(keyVars, env)
+	}
+	if err := secrets.LoadFileVars(keyVars); err != nil {
+		exit(fmt.Errorf("%w: %w", config.ErrConfig, err))
 	}
 
-	dbPool := db.ConnectToDb()
-	defer dbPool.Close()
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		exit(err)
+	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, stop := shutdownContext()
 	defer stop()
 
-	db.GetFullData(ctx, dbPool)
-	// NOTE: uncomment below for pipeline
-	// const query = "natural language preprocessing"
-	//
-	// var semanticScholarApiKey = os.Getenv("SEMANTIC_PAPER_API_KEY")
-	// var springerNatureApiKey = os.Getenv("SPRINGER_NATURE_META_APIKEY")
-	// if semanticScholarApiKey == "" || springerNatureApiKey == "" {
-	// 	log.Fatal("Required API keys are missing. Exiting...")
-	// }
-	//
-	// const arXivlimit = 25
-	// const semanticScholarLimit = 25
-	// const springerNatureLimit = 25
-	//
-	// // Fetch totals with a short-lived context
-	// totalsCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	// defer cancel()
-	//
-	// totalArxivPapers, totalSemanticScholarPapers, totalSpringerNaturePapers := pipeline.GetTotalPapers(totalsCtx, query, semanticScholarApiKey, springerNatureApiKey, 1, 0)
-	// processedArxivPapers, processedSemanticPapers, processedSpringerNaturePapers := db.GetCurrentlyProcessedDocuments(totalsCtx, dbPool)
-	// time.Sleep(5 * time.Second)
-	//
-	// log.Printf(
-	// 	"[TOTALS] arXiv=%d (processed=%d) semantic=%d (processed=%d) springer=%d (processed=%d)",
-	// 	totalArxivPapers, processedArxivPapers,
-	// 	totalSemanticScholarPapers, processedSemanticPapers,
-	// 	totalSpringerNaturePapers, processedSpringerNaturePapers,
-	// )
-	//
-	// // var wg sync.WaitGroup
-	// // wg.Add(3)
-	// //
-	// // // NOTE: API limit reached
-	// // go func() {
-	// // 	defer wg.Done()
-	// // 	log.Println("[ARXIV] worker started")
-	// // 	pipeline.StartArxivProcess(ctx, dbPool, query, processedArxivPapers, totalArxivPapers, arXivlimit)
-	// // 	log.Println("[ARXIV] worker finished")
-	// // }()
-	// //
-	// // // NOTE: Its limit is reached
-	// // go func() {
-	// // 	defer wg.Done()
-	// // 	log.Println("[SEMANTIC] worker started")
-	// // 	pipeline.StartSemanticProcess(ctx, dbPool, semanticScholarApiKey, query, processedSemanticPapers, totalSemanticScholarPapers, semanticScholarLimit)
-	// // 	log.Println("[SEMANTIC] worker finished")
-	// // }()
-	// //
-	// // go func() {
-	// // 	defer wg.Done()
-	// // 	log.Println("[SPRINGER] worker started")
-	// // 	pipeline.StartSpringerProcess(ctx, dbPool, springerNatureApiKey, query, processedSpringerNaturePapers, totalSpringerNaturePapers, springerNatureLimit)
-	// // 	log.Println("[SPRINGER] worker finished")
-	// // }()
-	// //
-	// // wg.Wait()
-	//
-	// log.Println("All ingestion pipelines completed")
+	a := &app{cfg: cfg}
+	err = a.newRootCommand().ExecuteContext(ctx)
+	// NOTE: os.Exit skips deferred calls, the pool is closed before exiting
+	if a.dbPool != nil {
+		a.dbPool.Close()
+	}
+	if err != nil {
+		exit(err)
+	}
+}
+
+// shutdownContext is cancelled on the first SIGINT or SIGTERM: workers save the pages
+// they already fetched and their checkpoints, then return. A second signal exits at once.
+func shutdownContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case s := <-signals:
+			log.Printf("[SHUTDOWN] %s, saving checkpoints before exiting, send it again to exit now", s)
+			// NOTE: without the handler the next signal gets its default behaviour and ends the process
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
 }
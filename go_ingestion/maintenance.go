@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/ingest"
+	"go_ingestion/internal/maintenance"
+	"go_ingestion/internal/sink"
+	"go_ingestion/internal/snapshot"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// prune [--every 24h]
+func (a *app) pruneCommand() *cobra.Command {
+	var every time.Duration
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Applies the retention policy",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if every > 0 {
+				maintenance.RunRetentionEvery(ctx, a.dbPool, a.project.ID, a.cfg.Retention, a.cfg.PDFDir, every)
+				return nil
+			}
+
+			report, err := maintenance.RunRetention(ctx, a.dbPool, a.project.ID, a.cfg.Retention, a.cfg.PDFDir)
+			if err != nil {
+				return err
+			}
+
+			log.Printf("[RETENTION] %s", report)
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&every, "every", 0, "run retention repeatedly at this interval instead of once")
+	return cmd
+}
+
+// gc [--dry-run] [--min-age 1h] removes PDFs, chunks and vectors whose paper is gone
+func (a *app) gcCommand() *cobra.Command {
+	var opts maintenance.GCOptions
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Removes PDFs, chunks and vectors whose paper is gone",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := maintenance.CollectGarbage(cmd.Context(), a.dbPool, a.cfg.PDFDir, opts)
+			log.Printf("[GC] %s", report)
+			return err
+		},
+	}
+	fs := cmd.Flags()
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "only count what would be removed")
+	fs.DurationVar(&opts.MinAge, "min-age", a.cfg.GC.MinAge, "spare PDFs modified more recently than this")
+	return cmd
+}
+
+// delete-topic <topic>
+func (a *app) deleteTopicCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete-topic <topic>",
+		Short: "Marks a topic deleted, the next prune drops its papers",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := db.MarkTopicDeleted(cmd.Context(), a.dbPool, a.project.ID, args[0]); err != nil {
+				return err
+			}
+
+			log.Printf("[TOPIC] %q marked deleted, papers are dropped on the next prune", args[0])
+			return nil
+		},
+	}
+}
+
+// rebuild --stage chunks|embeddings|fts|tags [--topic t] clears a derived layer of the papers
+// of t (all topics by default) and regenerates it, after splitter settings, embedding
+// models or the subject taxonomy changed
+func (a *app) rebuildCommand() *cobra.Command {
+	var stage, topic string
+	cmd := &cobra.Command{
+		Use:   "rebuild --stage chunks|embeddings|fts|tags",
+		Short: "Regenerates a derived layer",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if stage == "" {
+				return fmt.Errorf("%w: rebuild --stage chunks|embeddings|fts|tags [--topic t]", ErrUsage)
+			}
+
+			var opts maintenance.RebuildOptions
+			if a.cfg.Sink.OpenSearch.URL != "" {
+				opts.Index = sink.NewOpenSearch(a.cfg.Sink.OpenSearch, os.Getenv("OPENSEARCH_PASSWORD"))
+			}
+
+			report, err := maintenance.Rebuild(cmd.Context(), a.dbPool, a.project.ID, maintenance.RebuildStage(stage), topic, opts)
+			log.Printf("[REBUILD] %s", report)
+			if err == nil && report.Cleared.Rewound > 0 {
+				log.Printf("[REBUILD] %d papers wait for the orchestrator to process them again", report.Cleared.Rewound)
+			}
+			return err
+		},
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&stage, "stage", "", fmt.Sprintf("derived layer to rebuild, one of %v", maintenance.RebuildStages))
+	fs.StringVar(&topic, "topic", "", "only rebuild papers of this topic")
+	return cmd
+}
+
+// quality-report [--check-links 0] [--workers 8] [--timeout 15s] counts per topic what
+// curators should clean up, with --check-links that many not yet downloaded PDF links per
+// topic are requested
+func (a *app) qualityReportCommand() *cobra.Command {
+	var opts maintenance.QualityOptions
+	cmd := &cobra.Command{
+		Use:   "quality-report",
+		Short: "Counts what curators should clean up per topic",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := maintenance.Quality(cmd.Context(), a.dbPool, a.project.ID, opts)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%-7s %-15s %-15s %-15s %-15s %-15s %-13s %s\n", "papers", "no_abstract", "no_doi", "duplicates", "in_review", "non_english", "dead_pdfs", "topic")
+			for _, t := range append(report.Topics, report.Total) {
+				dead := "-"
+				if t.LinksChecked > 0 {
+					dead = fmt.Sprintf("%d/%d", t.DeadLinks, t.LinksChecked)
+				}
+				fmt.Printf("%-7d %-15s %-15s %-15s %-15s %-15s %-13s %s\n", t.Papers,
+					share(t.MissingAbstract, t.Papers), share(t.MissingDOI, t.Papers), share(t.Duplicates, t.Papers),
+					share(t.PendingReviews, t.Papers), share(t.NonEnglish, t.Papers), dead, t.Topic)
+			}
+			if report.Total.UnknownLanguage > 0 {
+				fmt.Printf("\n%d papers have no language yet and aren't counted as non_english\n", report.Total.UnknownLanguage)
+			}
+			return nil
+		},
+	}
+	fs := cmd.Flags()
+	fs.IntVar(&opts.CheckLinks, "check-links", 0, "pdf links of papers not downloaded yet to request per topic")
+	fs.IntVar(&opts.Workers, "workers", 8, "links requested at a time")
+	fs.DurationVar(&opts.Timeout, "timeout", 15*time.Second, "timeout of a link request")
+	return cmd
+}
+
+// share formats n as a count and percentage of total
+func share(n, total int) string {
+	if total == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%d (%.1f%%)", n, 100*float64(n)/float64(total))
+}
+
+// snapshot create [--out file] [--pdfs] | snapshot restore <file>
+func (a *app) snapshotCommand() *cobra.Command {
+	var out string
+	var withPDFs bool
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Writes the project's papers, chunks and vectors to one file",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if out == "" {
+				out = fmt.Sprintf("data/%s-%s.snapshot.tar.gz", a.project.Name, time.Now().Format("20060102-150405"))
+			}
+			if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+				return err
+			}
+
+			manifest, err := snapshot.Create(cmd.Context(), a.dbPool, a.project, out, snapshot.CreateOptions{IncludePDFs: withPDFs, PDFDir: a.cfg.PDFDir})
+			if err != nil {
+				return err
+			}
+			log.Printf("[SNAPSHOT] wrote %s papers=%d chunks=%d vectors=%d pdfs=%d", out, manifest.Papers, manifest.Chunks, manifest.Vectors, manifest.PDFs)
+			return nil
+		},
+	}
+	create.Flags().StringVar(&out, "out", "", "snapshot file to write, data/<project>-<time>.snapshot.tar.gz by default")
+	create.Flags().BoolVar(&withPDFs, "pdfs", false, "include downloaded PDFs")
+
+	restore := &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Restores a snapshot into the project",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := snapshot.Restore(cmd.Context(), a.dbPool, a.project, args[0], a.cfg.PDFDir)
+			if err != nil {
+				return err
+			}
+			log.Printf("[SNAPSHOT] restored %s", report)
+			return nil
+		},
+	}
+
+	return group(&cobra.Command{Use: "snapshot", Short: "Backs up and restores the project"}, create, restore)
+}
+
+// archive replay [--sources s] [--day YYYY-MM-DD] [--query q] [--sink postgres|jsonl|stdout] [--out path]
+// pages the archived requests again, see archive in the config, so mapper fixes reach
+// papers without calling the sources
+func (a *app) archiveCommand() *cobra.Command {
+	var o ingest.ReplayOptions
+	replay := &cobra.Command{
+		Use:   "replay",
+		Short: "Maps archived pages again with the current mappers",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := a.runner().Replay(cmd.Context(), o)
+			if report.Stats != nil {
+				report.Stats.Print(os.Stdout)
+			}
+			if err != nil {
+				return err
+			}
+			log.Printf("[ARCHIVE] replayed pages=%d failed=%d", report.Pages, report.Failed)
+			return nil
+		},
+	}
+	fs := replay.Flags()
+	fs.StringVar(&o.Sources, "sources", ingest.AllSources, "comma separated sources to replay")
+	fs.StringVar(&o.Day, "day", "", "only pages fetched on this day, all days when empty")
+	fs.StringVar(&o.Query, "query", "", "only pages of this query")
+	fs.StringVar(&o.Sink, "sink", a.cfg.Sink.Kind, "where papers are written: postgres, jsonl or stdout")
+	fs.StringVar(&o.Out, "out", a.cfg.Sink.Path, "file the jsonl sink appends to")
+
+	return group(&cobra.Command{Use: "archive", Short: "Replays the archived source responses"}, replay)
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go_ingestion/db"
+	"go_ingestion/internal/progress"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// stats prints the papers per topic and source
+func (a *app) statsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stats",
+		Short: "Counts the papers per topic and source",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			counts, err := db.CountPapers(cmd.Context(), a.dbPool, a.project.ID)
+			if err != nil {
+				return err
+			}
+			if len(counts) == 0 {
+				fmt.Println("no papers yet")
+				return nil
+			}
+
+			perSource := map[db.PaperSource]int{}
+			total := 0
+			for i, c := range counts {
+				if i == 0 || counts[i-1].Topic != c.Topic {
+					fmt.Printf("%q\n", c.Topic)
+				}
+				fmt.Printf("  %-16s papers=%-7d embedded=%-7d latest=%s\n", c.Source, c.Papers, c.Embedded, c.Latest.Format(time.DateTime))
+				perSource[c.Source] += c.Papers
+				total += c.Papers
+			}
+
+			fmt.Printf("total=%d", total)
+			for _, source := range slices.Sorted(maps.Keys(perSource)) {
+				fmt.Printf(" %s=%d", source, perSource[source])
+			}
+			fmt.Println()
+			return nil
+		},
+	}
+}
+
+// runs list [-n 10] | runs diff <runA> <runB>
+func (a *app) runsCommand() *cobra.Command {
+	var n *int
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the latest runs with what each source fetched",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runs, err := db.ListRuns(cmd.Context(), a.dbPool, a.project.ID, *n)
+			if err != nil {
+				return err
+			}
+
+			for _, r := range runs {
+				finished := "running"
+				if r.FinishedAt != nil {
+					finished = r.FinishedAt.Sub(r.StartedAt).Round(time.Second).String()
+				}
+				fmt.Printf("#%d %s %q started=%s (%s)\n", r.ID, r.Command, r.Query, r.StartedAt.Format(time.DateTime), finished)
+
+				for _, s := range r.Sources {
+					fmt.Printf("  %-16s fetched=%d inserted=%d reviewed=%d updated=%d", s.Source, s.Fetched, s.Inserted, s.Reviewed, s.Updated)
+					reasons := slices.Sorted(maps.Keys(s.Skipped))
+					for _, reason := range reasons {
+						fmt.Printf(" %s=%d", reason, s.Skipped[reason])
+					}
+					fmt.Println()
+				}
+			}
+			return nil
+		},
+	}
+	n = countFlag(list.Flags(), 10, "number of runs to show")
+
+	// NOTE: diff writes one json object per changed paper to stdout, a changelog of the topic
+	// from runA finishing to runB finishing
+	diff := &cobra.Command{
+		Use:   "diff <runA> <runB>",
+		Short: "Prints the papers a topic gained, changed or lost between two runs",
+		Args:  usageArgs(cobra.ExactArgs(2)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			var runs [2]db.Run
+			for i, arg := range args {
+				id, err := strconv.ParseUint(arg, 10, 64)
+				if err != nil {
+					return fmt.Errorf("%w: invalid run id %q: %w", ErrUsage, arg, err)
+				}
+				if runs[i], err = db.GetRun(ctx, a.dbPool, a.project.ID, id); err != nil {
+					return err
+				}
+			}
+
+			from, to := runs[0], runs[1]
+			if from.Query != to.Query {
+				return fmt.Errorf("run #%d is for %q and run #%d for %q, only runs of the same topic can be diffed", from.ID, from.Query, to.ID, to.Query)
+			}
+			if to.StartedAt.Before(from.StartedAt) {
+				from, to = to, from
+			}
+
+			changes, err := db.RunDiff(ctx, a.dbPool, from, to)
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			counts := map[string]int{}
+			for _, c := range changes {
+				counts[c.Change]++
+				if err := enc.Encode(c); err != nil {
+					return err
+				}
+			}
+			log.Printf("[RUN] #%d..#%d %q added=%d updated=%d retracted=%d", from.ID, to.ID, to.Query, counts[db.ChangeAdded], counts[db.ChangeUpdated], counts[db.ChangeRetracted])
+			return nil
+		},
+	}
+
+	return group(&cobra.Command{Use: "runs", Short: "Lists runs and diffs two runs of a topic"}, list, diff)
+}
+
+// events [--after 0] [-n 100] [--follow] [--poll 5s] writes one json object per paper event
+// to stdout, with --follow it keeps polling for new ones until interrupted
+func (a *app) eventsCommand() *cobra.Command {
+	var after uint64
+	var n *int
+	var follow bool
+	var poll time.Duration
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Prints the change feed of the papers",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			enc := json.NewEncoder(os.Stdout)
+			for {
+				events, err := db.PaperEvents(ctx, a.dbPool, a.project.ID, after, *n)
+				if err != nil {
+					return err
+				}
+				for _, e := range events {
+					if err := enc.Encode(e); err != nil {
+						return err
+					}
+					after = e.ID
+				}
+
+				if len(events) == *n {
+					continue
+				}
+				if !follow {
+					return nil
+				}
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(poll):
+				}
+			}
+		},
+	}
+	fs := cmd.Flags()
+	fs.Uint64Var(&after, "after", 0, "only events after the event with this id")
+	n = countFlag(fs, 100, "events fetched per poll")
+	fs.BoolVar(&follow, "follow", false, "keep polling for new events")
+	fs.DurationVar(&poll, "poll", 5*time.Second, "how often --follow polls")
+	return cmd
+}
+
+// status [--output text|json] | status backlog <status> [-n 100] | status advance <paper id> <status> | status pdfs [--output text|json]
+// the funnel shows how many papers wait at each stage and how many got at least that far,
+// pdfs counts the downloaded PDFs per kind. --output json prints them as one json object.
+func (a *app) statusCommand() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Shows how many papers wait at each processing stage",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			funnel, err := db.StatusFunnel(ctx, a.dbPool, a.project.ID)
+			if err != nil {
+				return err
+			}
+			stuck, err := db.StuckWorkers(ctx, a.dbPool, a.project.ID, a.cfg.Runs.StuckAfter)
+			if err != nil {
+				return err
+			}
+			if output == progress.OutputJSON {
+				if stuck == nil {
+					stuck = []db.StuckWorker{}
+				}
+				return writeJSON(struct {
+					Project string           `json:"project"`
+					Funnel  []db.StatusCount `json:"funnel"`
+					Stuck   []db.StuckWorker `json:"stuck"`
+				}{a.project.Name, funnel, stuck})
+			}
+			if output != progress.OutputText {
+				return fmt.Errorf("%w: unknown output %q, use text or json", ErrUsage, output)
+			}
+
+			reached := 0
+			for _, c := range funnel {
+				reached += c.Papers
+			}
+			for _, c := range funnel {
+				waiting := ""
+				if c.Oldest != nil && c.Status != db.StatusEmbedded {
+					waiting = fmt.Sprintf(" oldest=%s", time.Since(*c.Oldest).Round(time.Minute))
+				}
+				fmt.Printf("%-11s reached=%-7d at=%-7d%s\n", c.Status, reached, c.Papers, waiting)
+				reached -= c.Papers
+			}
+			for _, w := range stuck {
+				fmt.Printf("STUCK %s\n", describeStuck(w))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&output, "output", progress.OutputText, "text, or json on stdout")
+
+	var pdfsOutput string
+	pdfs := &cobra.Command{
+		Use:   "pdfs",
+		Short: "Counts the downloaded PDFs per kind",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			counts, err := db.CountPDFKinds(cmd.Context(), a.dbPool, a.project.ID)
+			if err != nil {
+				return err
+			}
+			if pdfsOutput == progress.OutputJSON {
+				if counts == nil {
+					counts = []db.PDFKindCount{}
+				}
+				return writeJSON(counts)
+			}
+			if pdfsOutput != progress.OutputText {
+				return fmt.Errorf("%w: unknown output %q, use text or json", ErrUsage, pdfsOutput)
+			}
+			for _, c := range counts {
+				kind := c.Kind
+				if kind == "" {
+					kind = "unknown"
+				}
+				fmt.Printf("%-14s %d\n", kind, c.Papers)
+			}
+			return nil
+		},
+	}
+	pdfs.Flags().StringVar(&pdfsOutput, "output", progress.OutputText, "text, or json on stdout")
+
+	var n *int
+	backlog := &cobra.Command{
+		Use:   "backlog <status>",
+		Short: "Lists the ids of the papers waiting at a stage",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := db.ParsePaperStatus(args[0])
+			if err != nil {
+				return err
+			}
+			ids, err := db.PapersWithStatus(cmd.Context(), a.dbPool, a.project.ID, status, *n)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				fmt.Println(id)
+			}
+			return nil
+		},
+	}
+	n = countFlag(backlog.Flags(), 100, "number of paper ids to list")
+
+	advance := &cobra.Command{
+		Use:   "advance <paper id> <status>",
+		Short: "Moves a paper on to a later stage",
+		Args:  usageArgs(cobra.ExactArgs(2)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: invalid paper id %q: %w", ErrUsage, args[0], err)
+			}
+			status, err := db.ParsePaperStatus(args[1])
+			if err != nil {
+				return err
+			}
+
+			moved, err := db.AdvancePaperStatus(cmd.Context(), a.dbPool, a.project.ID, id, status)
+			if err != nil {
+				return err
+			}
+			if !moved {
+				log.Printf("[STATUS] paper %d isn't in this project or already is %s or further", id, status)
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(pdfs, backlog, advance)
+	return cmd
+}
+
+// describeStuck says which worker is stuck since when and where
+func describeStuck(w db.StuckWorker) string {
+	s := fmt.Sprintf("run #%d %s %q", w.RunID, w.Command, w.Query)
+	if w.Source == nil {
+		return s + fmt.Sprintf(" started %s ago and never started a worker", time.Since(w.StartedAt).Round(time.Minute))
+	}
+
+	s += " " + string(*w.Source)
+	if w.ProgressAt != nil {
+		s += fmt.Sprintf(" no progress for %s", time.Since(*w.ProgressAt).Round(time.Minute))
+	} else {
+		s += fmt.Sprintf(" no page since the run started %s ago", time.Since(w.StartedAt).Round(time.Minute))
+	}
+	if w.LastOffset != nil {
+		s += fmt.Sprintf(" offset=%d", *w.LastOffset)
+	}
+	if w.HeartbeatAt != nil {
+		s += fmt.Sprintf(" last activity %s ago", time.Since(*w.HeartbeatAt).Round(time.Second))
+	}
+	return s
+}
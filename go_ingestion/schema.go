@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"go_ingestion/db"
+
+	"github.com/spf13/cobra"
+)
+
+// schema prints db.Schema, e.g. `go_ingestion schema | psql "$DATABASE_URL"`
+func (a *app) schemaCommand() *cobra.Command {
+	return offlineCommand(&cobra.Command{
+		Use:   "schema",
+		Short: "Prints the DDL that creates an empty database",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			schema, err := db.Schema()
+			if err != nil {
+				return err
+			}
+			fmt.Print(schema)
+			return nil
+		},
+	})
+}
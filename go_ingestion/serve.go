@@ -0,0 +1,55 @@
+package main
+
+import (
+	"go_ingestion/internal/api"
+	"go_ingestion/internal/cache"
+	"go_ingestion/internal/credentials"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// apiCacheEntries bounds the in-memory cache of the api, clients can make up any number of
+// queries
+const apiCacheEntries = 10000
+
+// serve [--addr :8080] [--public] serves the project over HTTP until interrupted
+func (a *app) serveCommand() *cobra.Command {
+	var addr string
+	var public bool
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serves the project over HTTP",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s := &api.Server{DBPool: a.dbPool, ProjectID: a.project.ID, Public: public, CacheTTL: a.cfg.API.CacheTTL, QueryCacheTTL: a.cfg.API.QueryCacheTTL, MaxLimit: a.cfg.API.MaxLimit}
+			if public || s.QueryCacheTTL > 0 {
+				// NOTE: a redis cache is shared by all replicas, otherwise each keeps its own
+				c, err := cache.New(a.cfg.Cache)
+				if err != nil {
+					return err
+				}
+				if c == nil || a.cfg.Cache.Backend == "memory" {
+					m := cache.NewMemory()
+					m.Limit = apiCacheEntries
+					c = m
+				}
+				s.Cache = c
+			}
+			if public {
+				log.Printf("[API] public, read only, responses cached for %s", a.cfg.API.CacheTTL)
+			} else {
+				store, err := credentials.FromEnv(a.dbPool, a.project.ID)
+				if err != nil {
+					return err
+				}
+				s.Credentials, s.AdminToken = store, os.Getenv(api.AdminTokenEnv)
+			}
+			return s.Serve(cmd.Context(), addr)
+		},
+	}
+	cmd.Flags().StringVar(&addr, "addr", a.cfg.API.Addr, "address to listen on")
+	cmd.Flags().BoolVar(&public, "public", a.cfg.API.Public, "serve only the read endpoints, cached, without admin routes")
+	return cmd
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_ingestion/config"
+	"go_ingestion/db"
+	"go_ingestion/ingest"
+	"go_ingestion/internal/pipeline"
+	"go_ingestion/internal/planner"
+	"go_ingestion/internal/ratelimit"
+	researchpaperapis "go_ingestion/internal/research_paper_apis"
+	"go_ingestion/internal/sink"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// refresh [--topic q] ingests every scheduled topic once, one after the other, or only q
+func (a *app) refreshCommand() *cobra.Command {
+	var only string
+	cmd := &cobra.Command{
+		Use:   "refresh",
+		Short: "Ingests the scheduled topics once",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			topics, err := a.topics(ctx)
+			if err != nil {
+				return err
+			}
+			if only != "" {
+				topics = slices.DeleteFunc(topics, func(t config.Topic) bool { return t.Query != only })
+			}
+			if len(topics) == 0 {
+				return fmt.Errorf("no topics to refresh, configure topics or register them with plan --topic")
+			}
+
+			// NOTE: a topic left partial doesn't keep the next ones from refreshing, the run still
+			// ends with ErrPartial
+			r := a.runner()
+			var partial []error
+			for _, topic := range topics {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("[REFRESH] %q", topic.Query)
+				err := r.Ingest(ctx, newTopicJob(topic, a.cfg.PageSizing.Initial).options())
+				if errors.Is(err, ingest.ErrPartial) || errors.Is(err, ingest.ErrRunning) {
+					log.Printf("[REFRESH] %q: %v", topic.Query, err)
+					partial = append(partial, fmt.Errorf("topic %q: %w", topic.Query, err))
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("topic %q: %w", topic.Query, err)
+				}
+			}
+			return errors.Join(partial...)
+		},
+	}
+	cmd.Flags().StringVar(&only, "topic", "", "only refresh this topic")
+	return cmd
+}
+
+// plan [--topic q] [--sources ...] [--offline] estimates per source how many days ingesting
+// the scheduled topics (or just --topic) takes under the configured rate limits and quotas
+// and suggests page sizes and schedules. Totals recorded by earlier runs are used, missing
+// ones are fetched unless --offline.
+func (a *app) planCommand() *cobra.Command {
+	var query, sourceList string
+	var offline bool
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Estimates how long ingesting the topics takes",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.plan(cmd.Context(), query, sourceList, offline)
+		},
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&query, "topic", "", "plan only this query instead of the scheduled topics")
+	fs.StringVar(&sourceList, "sources", "", "comma separated sources of --topic, all of them when empty")
+	fs.BoolVar(&offline, "offline", false, "don't ask sources for totals that weren't recorded yet")
+	return cmd
+}
+
+func (a *app) plan(ctx context.Context, query, sourceList string, offline bool) error {
+	topics := []config.Topic{{Query: query}}
+	if sourceList != "" {
+		topics[0].Sources = strings.Split(sourceList, ",")
+	}
+	if query == "" {
+		var err error
+		if topics, err = a.topics(ctx); err != nil {
+			return err
+		}
+	}
+	if len(topics) == 0 {
+		return fmt.Errorf("no topics are scheduled, plan one with --topic")
+	}
+
+	var totals *pipeline.Totals
+	var apiKeys map[db.PaperSource]string
+	if !offline {
+		r := a.runner()
+		opts, err := r.PagerOptions(researchpaperapis.NewRunStats())
+		if err != nil {
+			return err
+		}
+		if apiKeys, err = r.APIKeys(ctx, nil); err != nil {
+			return err
+		}
+		totals = r.Totals(opts, false)
+	}
+
+	limits := map[db.PaperSource]planner.Limit{}
+	var works []planner.Work
+	for _, topic := range topics {
+		job := newTopicJob(topic, a.cfg.PageSizing.Initial)
+		sources, err := ingest.ParseSources(job.options().Sources)
+		if err != nil {
+			return err
+		}
+		every, err := topic.Every()
+		if err != nil {
+			return err
+		}
+
+		for _, source := range sortedSources(sources) {
+			if _, ok := limits[source]; !ok {
+				if limits[source], err = a.sourceLimit(ctx, source); err != nil {
+					return err
+				}
+			}
+
+			// NOTE: adaptive page sizing grows pages up to the source's max, the plan assumes it gets there
+			w := planner.Work{Topic: topic.Query, Source: source, PageSize: job.Limit, MaxPapers: job.MaxPapers, Every: every}
+			if a.cfg.PageSizing.Adaptive && limits[source].MaxPageSize > 0 {
+				w.PageSize = limits[source].MaxPageSize
+			}
+
+			cp, ok, err := db.GetCheckpoint(ctx, a.dbPool, a.project.ID, source, topic.Query)
+			if err != nil {
+				return err
+			}
+			if ok {
+				w.Processed = cp.NextOffset
+			}
+
+			w.Total, w.KnownTotal, err = db.LatestSourceTotal(ctx, a.dbPool, source, topic.Query)
+			if err != nil {
+				return err
+			}
+			if !w.KnownTotal && totals != nil && (apiKeys[source] != "" || !ingest.KeyRequired(source)) {
+				total, err := totals.Get(ctx, source, apiKeys[source], topic.Query, nil)
+				if err != nil {
+					log.Printf("[PLAN] %s total of %q failed: %v", source, topic.Query, err)
+				} else if total != researchpaperapis.UnknownTotal {
+					w.Total, w.KnownTotal = total, true
+				}
+			}
+			works = append(works, w)
+		}
+	}
+
+	plan := planner.New(works, limits)
+
+	fmt.Printf("%-16s %-9s %-9s %-9s %-5s %-9s %-8s %s\n", "source", "total", "done", "left", "page", "requests", "days", "topic")
+	for _, e := range plan.Estimates {
+		if !e.KnownTotal {
+			fmt.Printf("%-16s %-9s %-9d %-9s %-5d %-9s %-8s %s\n", e.Source, "?", e.Processed, "?", e.PageSize, "?", "?", e.Topic)
+			continue
+		}
+		days := fmt.Sprintf("%.1f", e.Days)
+		if e.RunDays > 0 {
+			days = fmt.Sprintf("%.1f", e.RunDays)
+		}
+		fmt.Printf("%-16s %-9d %-9d %-9d %-5d %-9d %-8s %s\n", e.Source, e.Total, e.Processed, e.Remaining, e.PageSize, e.Requests, days, e.Topic)
+	}
+
+	fmt.Printf("\n%-16s %-9s %-9s %-9s %s\n", "source", "requests", "per_day", "used", "days")
+	for _, s := range plan.Sources {
+		perDay, days := "unlimited", "-"
+		if n := s.Limit.PerDay(); n > 0 {
+			perDay, days = strconv.FormatUint(n, 10), fmt.Sprintf("%.1f", s.Days)
+		}
+		fmt.Printf("%-16s %-9d %-9s %-9d %s\n", s.Source, s.Requests, perDay, s.Limit.UsedToday, days)
+	}
+
+	if len(plan.Suggestions) > 0 {
+		fmt.Println()
+		for _, s := range plan.Suggestions {
+			fmt.Println("- " + s)
+		}
+	}
+	return nil
+}
+
+// suggest-topics --topic t [-n 10] [--register [--schedule weekly]]
+// suggests queries from the subjects and keywords of the papers already ingested for t
+func (a *app) suggestTopicsCommand() *cobra.Command {
+	var topic, schedule string
+	var n *int
+	var register bool
+	cmd := &cobra.Command{
+		Use:   "suggest-topics --topic q",
+		Short: "Suggests related queries",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if strings.TrimSpace(topic) == "" {
+				return fmt.Errorf("%w: suggest-topics --topic <topic> [-n 10] [--register [--schedule weekly]]", ErrUsage)
+			}
+			if _, err := (config.Topic{Query: topic, Schedule: schedule}).Every(); err != nil {
+				return err
+			}
+
+			terms, err := db.RelatedTerms(ctx, a.dbPool, a.project.ID, topic, *n)
+			if err != nil {
+				return err
+			}
+			if len(terms) == 0 {
+				log.Printf("[TOPIC] no suggestions for %q, its papers have no subjects or keywords yet", topic)
+				return nil
+			}
+
+			for _, t := range terms {
+				fmt.Printf("%6d  %s\n", t.Papers, t.Name)
+				if !register {
+					continue
+				}
+
+				added, err := db.RegisterTopic(ctx, a.dbPool, a.project.ID, t.Name, schedule)
+				if err != nil {
+					return err
+				}
+				if added {
+					log.Printf("[TOPIC] registered %q, ingested %s by the daemon", t.Name, schedule)
+				}
+			}
+			return nil
+		},
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&topic, "topic", "", "topic whose papers the suggestions come from")
+	n = countFlag(fs, 10, "number of suggestions")
+	fs.BoolVar(&register, "register", false, "register the suggestions as topics for the daemon to ingest")
+	fs.StringVar(&schedule, "schedule", "weekly", "how often registered topics are ingested: hourly, daily, weekly or a duration")
+	return cmd
+}
+
+// sourceLimit is the configured rate of source with what its quota spent today, the
+// latter is only recorded when limits are shared.
+func (a *app) sourceLimit(ctx context.Context, source db.PaperSource) (planner.Limit, error) {
+	cfg := a.cfg.RateLimits.Sources[string(source)]
+	limit := planner.Limit{Interval: cfg.Interval, DailyQuota: cfg.DailyQuota, MaxPageSize: a.cfg.PageSizing.Max[string(source)]}
+	if a.cfg.RateLimits.Shared && cfg.DailyQuota > 0 {
+		used, err := ratelimit.UsedToday(ctx, a.dbPool, ratelimit.SourceKey(string(source)))
+		if err != nil {
+			return limit, err
+		}
+		limit.UsedToday = used
+	}
+	return limit, nil
+}
+
+func sortedSources(sources map[db.PaperSource]bool) []db.PaperSource {
+	list := make([]db.PaperSource, 0, len(sources))
+	for source := range sources {
+		list = append(list, source)
+	}
+	slices.Sort(list)
+	return list
+}
+
+// topics are the configured topics followed by the ones registered in the database, the
+// config wins when a topic is in both.
+func (a *app) topics(ctx context.Context) ([]config.Topic, error) {
+	registered, err := db.ScheduledTopics(ctx, a.dbPool, a.project.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	topics := slices.Clone(a.cfg.Topics)
+	for _, t := range registered {
+		if !slices.ContainsFunc(topics, func(c config.Topic) bool { return c.Query == t.Name }) {
+			topics = append(topics, config.Topic{Query: t.Name, Schedule: t.Schedule})
+		}
+	}
+	return topics, nil
+}
+
+// topicJob is the payload of an ingest-topic job, the scheduler only queues a topic
+// again once its previous job finished.
+type topicJob struct {
+	Query     string   `json:"query"`
+	Sources   []string `json:"sources,omitempty"`
+	Limit     uint64   `json:"limit"`
+	MaxPapers uint64   `json:"max_papers"`
+}
+
+// newTopicJob starts topics without a limit of their own at limit papers per page
+func newTopicJob(topic config.Topic, limit uint64) topicJob {
+	job := topicJob{Query: topic.Query, Sources: topic.Sources, Limit: topic.Limit, MaxPapers: topic.MaxPapers}
+	if job.Limit == 0 {
+		job.Limit = limit
+	}
+	return job
+}
+
+// NOTE: a topic without sources runs every source that has its key, see Runner.Sources
+func (t topicJob) options() ingest.Options {
+	return ingest.Options{Query: t.Query, Sources: strings.Join(t.Sources, ","), Limit: t.Limit, MaxPapers: t.MaxPapers, Sink: sink.KindPostgres}
+}